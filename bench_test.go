@@ -0,0 +1,43 @@
+// gopische/bench_test.go
+
+package gopische
+
+import (
+	"context"
+	"testing"
+)
+
+var benchmarks = []struct {
+	name  string
+	setup string
+	src   string
+}{
+	{"fib", "(define (fib n) (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2)))))", "(fib 20)"},
+	{"loop", "(define (loop i acc) (if (= i 0) acc (loop (- i 1) (+ acc i))))", "(loop 100000 0)"},
+	{"map", "(define l (let loop ((i 0) (acc '())) (if (= i 1000) acc (loop (+ i 1) (cons i acc)))))", "(map (lambda (x) (* x x)) l)"},
+}
+
+func benchmarkEngine(b *testing.B, engine Engine) {
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			interp := New(WithEngine(engine))
+			if _, err := interp.Eval(context.Background(), bm.setup); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := interp.Eval(context.Background(), bm.src); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	benchmarkEngine(b, VM)
+}
+
+func BenchmarkTreeWalker(b *testing.B) {
+	benchmarkEngine(b, TreeWalker)
+}
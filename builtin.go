@@ -0,0 +1,172 @@
+package gopische
+
+import (
+	"slices"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// builtin describes a procedure implemented in Go.
+type builtin struct {
+	name string
+	min  int
+	max  int           // -1 if the procedure takes any number of arguments
+	fn   primitiveFunc // nil for a parameter object of the interpreter
+}
+
+// builtinLibrary is a set of builtins which are exported by a
+// standard library.  Writers are builtins which modify the world
+// outside the interpreter, and they are left out when the library is
+// allowed read-only by a sandbox.
+type builtinLibrary struct {
+	name     string
+	builtins [][]builtin
+	writers  [][]builtin
+}
+
+// builtinLibraries lists the libraries which are installed into the
+// global environment of an interpreter.  It is set in init, since
+// `environment` refers to it.
+var builtinLibraries []builtinLibrary
+
+func init() {
+	builtinLibraries = []builtinLibrary{
+		{"(scheme base)", [][]builtin{equivalenceBuiltins, numberBuiltins, listBuiltins, symbolBuiltins, charBuiltins, stringBuiltins, vectorBuiltins, bytevectorBuiltins, controlBuiltins, exceptionBuiltins, parameterBuiltins, portBuiltins, stringPortBuiltins, inputBuiltins, outputBuiltins, featureBuiltins}, nil},
+		{"(scheme inexact)", [][]builtin{inexactBuiltins}, nil},
+		{"(scheme read)", [][]builtin{readBuiltins}, nil},
+		{"(scheme write)", [][]builtin{writeBuiltins}, nil},
+		{"(scheme load)", [][]builtin{loadBuiltins}, nil},
+		{"(scheme eval)", [][]builtin{evalBuiltins}, nil},
+		{"(scheme repl)", [][]builtin{replBuiltins}, nil},
+		{"(scheme file)", [][]builtin{fileBuiltins}, [][]builtin{fileWriteBuiltins}},
+		{"(scheme process-context)", [][]builtin{processBuiltins}, [][]builtin{exitBuiltins}},
+		{"(gopische base)", [][]builtin{procedureBuiltins, recordBuiltins, prettyBuiltins}, nil},
+		{"(gopische string)", [][]builtin{textBuiltins}, nil},
+		{"(gopische regexp)", [][]builtin{regexpBuiltins}, nil},
+		{"(srfi 1)", [][]builtin{srfi1BaseBuiltins(), srfi1Builtins}, nil},
+		{"(srfi 69)", [][]builtin{srfi69Builtins}, nil},
+		{"(srfi 125)", [][]builtin{srfi69Builtins, srfi125Builtins}, nil},
+		{"(srfi 132)", [][]builtin{srfi132Builtins}, nil},
+	}
+}
+
+// all returns the builtins of the library.  Writers are included
+// only when withWriters is true.
+func (lib *builtinLibrary) all(withWriters bool) []builtin {
+	var result []builtin
+	for _, builtins := range lib.builtins {
+		result = append(result, builtins...)
+	}
+	if withWriters {
+		for _, builtins := range lib.writers {
+			result = append(result, builtins...)
+		}
+	}
+	return result
+}
+
+func newPrimitive(b builtin) *scheme.Procedure {
+	arity := scheme.Arity{Required: b.min, Optional: b.max - b.min}
+	if b.max < 0 {
+		arity = scheme.Arity{Required: b.min, Rest: true}
+	}
+	return scheme.NewPrimitive(b.name, arity, &primitive{fn: b.fn, ctl: controlKinds[b.name]})
+}
+
+// newBuiltin creates a builtin procedure.  A builtin without a
+// function is a parameter object which the interpreter has made.
+func (interp *Interpreter) newBuiltin(b builtin) *scheme.Procedure {
+	switch b.name {
+	case "current-input-port":
+		return interp.inputPort
+	case "current-output-port":
+		return interp.outputPort
+	case "current-error-port":
+		return interp.errorPort
+	}
+	return newPrimitive(b)
+}
+
+// installBuiltins creates builtin procedures and binds the ones
+// allowed by the sandbox in the global environment.  The expander
+// uses all of them regardless of the sandbox.
+func (interp *Interpreter) installBuiltins() {
+	for _, b := range slices.Concat(libraryBuiltins, parameterizeBuiltins, guardBuiltins) {
+		interp.prims[b.name] = newPrimitive(b)
+	}
+	for i := range builtinLibraries {
+		lib := &builtinLibraries[i]
+		for _, b := range lib.all(true) {
+			// Libraries may export the same builtins.
+			if _, ok := interp.prims[b.name]; !ok {
+				interp.prims[b.name] = interp.newBuiltin(b)
+			}
+		}
+		if interp.sandbox.allows(lib) {
+			interp.importLibrary(interp.global, lib)
+		}
+	}
+}
+
+func argInteger(args []scheme.Object, i int) (int64, error) {
+	if n, ok := args[i].(*scheme.Number); ok {
+		if iv, ok := n.Value().(int64); ok {
+			return iv, nil
+		}
+	}
+	return 0, wrongType("integer", args[i])
+}
+
+// argIndex returns a non-negative integer argument.
+func argIndex(args []scheme.Object, i int) (int, error) {
+	iv, err := argInteger(args, i)
+	if err != nil {
+		return 0, err
+	}
+	if iv < 0 {
+		return 0, wrongType("non-negative integer", args[i])
+	}
+	return int(iv), nil
+}
+
+func argString(args []scheme.Object, i int) (string, error) {
+	if s, ok := args[i].(*scheme.String); ok {
+		return s.Value().(string), nil
+	}
+	return "", wrongType("string", args[i])
+}
+
+func argSymbol(args []scheme.Object, i int) (*scheme.Symbol, error) {
+	if sym, ok := args[i].(*scheme.Symbol); ok {
+		return sym, nil
+	}
+	return nil, wrongType("symbol", args[i])
+}
+
+func argPair(args []scheme.Object, i int) (*scheme.Pair, error) {
+	if pair, ok := args[i].(*scheme.Pair); ok {
+		return pair, nil
+	}
+	return nil, wrongType("pair", args[i])
+}
+
+func argList(args []scheme.Object, i int) ([]scheme.Object, error) {
+	if elems, ok := scheme.ListToSlice(args[i]); ok {
+		return elems, nil
+	}
+	return nil, wrongType("list", args[i])
+}
+
+func argProcedure(args []scheme.Object, i int) (*scheme.Procedure, error) {
+	if proc, ok := args[i].(*scheme.Procedure); ok {
+		return proc, nil
+	}
+	return nil, wrongType("procedure", args[i])
+}
+
+func argEnvironment(args []scheme.Object, i int) (*environment, error) {
+	if env, ok := args[i].(*scheme.Environment); ok {
+		return env.Impl().(*environment), nil
+	}
+	return nil, wrongType("environment", args[i])
+}
@@ -0,0 +1,197 @@
+package gopische
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var bytevectorBuiltins = []builtin{
+	{"bytevector?", 1, 1, primIsBytevector},
+	{"make-bytevector", 1, 2, primMakeBytevector},
+	{"bytevector", 0, -1, primBytevector},
+	{"bytevector-length", 1, 1, primBytevectorLength},
+	{"bytevector-u8-ref", 2, 2, primBytevectorRef},
+	{"bytevector-u8-set!", 3, 3, primBytevectorSet},
+	{"bytevector-copy", 1, 3, primBytevectorCopy},
+	{"bytevector-append", 0, -1, primBytevectorAppend},
+	{"utf8->string", 1, 3, primUTF8ToString},
+	{"string->utf8", 1, 3, primStringToUTF8},
+}
+
+// newBytevector creates a bytevector holding b, counting its size.
+func (m *machine) newBytevector(b []byte) (scheme.Object, error) {
+	if err := m.allocString(len(b)); err != nil {
+		return nil, err
+	}
+	return scheme.NewBytevector(b), nil
+}
+
+func isByte(n *scheme.Number) bool {
+	iv, ok := n.Value().(int64)
+	return ok && iv >= 0 && iv <= 255
+}
+
+func argByte(args []scheme.Object, i int) (byte, error) {
+	if n, ok := args[i].(*scheme.Number); ok && isByte(n) {
+		return byte(n.Value().(int64)), nil
+	}
+	return 0, wrongType("byte", args[i])
+}
+
+func argBytevector(args []scheme.Object, i int) ([]byte, error) {
+	if bv, ok := args[i].(*scheme.Bytevector); ok {
+		return bv.Bytes(), nil
+	}
+	return nil, wrongType("bytevector", args[i])
+}
+
+// argRange returns the optional start and end arguments at i and i+1
+// for a sequence of length n.
+func argRange(args []scheme.Object, i int, n int) (int, int, error) {
+	start, end := 0, n
+	var err error
+	if len(args) > i {
+		if start, err = argIndex(args, i); err != nil {
+			return 0, 0, err
+		}
+	}
+	if len(args) > i+1 {
+		if end, err = argIndex(args, i+1); err != nil {
+			return 0, 0, err
+		}
+	}
+	if start > end || end > n {
+		return 0, 0, badArgument("index out of range, %d to %d", start, end)
+	}
+	return start, end, nil
+}
+
+func primIsBytevector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Bytevector)
+	return scheme.NewBoolean(ok), nil
+}
+
+// (make-bytevector k [byte])
+func primMakeBytevector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	k, err := argIndex(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var fill byte
+	if len(args) > 1 {
+		if fill, err = argByte(args, 1); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.allocString(k); err != nil {
+		return nil, err
+	}
+	return scheme.NewBytevector(bytes.Repeat([]byte{fill}, k)), nil
+}
+
+func primBytevector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b := make([]byte, len(args))
+	for i := range args {
+		var err error
+		if b[i], err = argByte(args, i); err != nil {
+			return nil, err
+		}
+	}
+	return m.newBytevector(b)
+}
+
+func primBytevectorLength(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b, err := argBytevector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewInteger(int64(len(b))), nil
+}
+
+func primBytevectorRef(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b, err := argBytevector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	k, err := argIndex(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if k >= len(b) {
+		return nil, badArgument("index out of range, %d", k)
+	}
+	return scheme.NewInteger(int64(b[k])), nil
+}
+
+func primBytevectorSet(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b, err := argBytevector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	k, err := argIndex(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if k >= len(b) {
+		return nil, badArgument("index out of range, %d", k)
+	}
+	if b[k], err = argByte(args, 2); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+// (bytevector-copy bytevector [start [end]])
+func primBytevectorCopy(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b, err := argBytevector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 1, len(b))
+	if err != nil {
+		return nil, err
+	}
+	return m.newBytevector(bytes.Clone(b[start:end]))
+}
+
+func primBytevectorAppend(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var result []byte
+	for i := range args {
+		b, err := argBytevector(args, i)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, b...)
+	}
+	if result == nil {
+		result = []byte{}
+	}
+	return m.newBytevector(result)
+}
+
+// (utf8->string bytevector [start [end]])
+func primUTF8ToString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b, err := argBytevector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 1, len(b))
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(b[start:end]) {
+		return nil, badArgument("invalid UTF-8 sequence")
+	}
+	return m.newString(string(b[start:end]))
+}
+
+// (string->utf8 string [start [end]])
+func primStringToUTF8(m *machine, args []scheme.Object) (scheme.Object, error) {
+	s, err := primSubstring(m, args)
+	if err != nil {
+		return nil, err
+	}
+	return m.newBytevector([]byte(s.(*scheme.String).Value().(string)))
+}
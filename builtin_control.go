@@ -0,0 +1,240 @@
+package gopische
+
+import (
+	"errors"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var equivalenceBuiltins = []builtin{
+	{"eq?", 2, 2, primEq},
+	{"eqv?", 2, 2, primEqv},
+	{"equal?", 2, 2, primEqual},
+	{"not", 1, 1, primNot},
+	{"boolean?", 1, 1, primIsBoolean},
+	{"boolean=?", 2, -1, primBooleanEq},
+}
+
+var procedureBuiltins = []builtin{
+	{"arity", 1, 1, primArity},
+}
+
+var controlBuiltins = []builtin{
+	{"procedure?", 1, 1, primIsProcedure},
+	{"apply", 1, -1, primApply},
+	{"map", 2, -1, primMap},
+	{"for-each", 2, -1, primForEach},
+	{"error", 1, -1, primError},
+	{"call-with-current-continuation", 1, 1, primCallCC},
+	{"call/cc", 1, 1, primCallCC},
+	{"values", 0, -1, primValues},
+	{"call-with-values", 2, 2, primCallWithValues},
+	{"dynamic-wind", 3, 3, primDynamicWind},
+}
+
+// controlKind tells the VM that a builtin manipulates the control
+// state.  The VM performs it by itself instead of calling the
+// function, which is used only by the tree-walker and primitives.
+type controlKind uint8
+
+const (
+	ctlNone controlKind = iota
+	ctlApply
+	ctlCallCC
+	ctlCallWithValues
+	ctlDynamicWind
+)
+
+var controlKinds = map[string]controlKind{
+	"apply":                          ctlApply,
+	"call-with-current-continuation": ctlCallCC,
+	"call/cc":                        ctlCallCC,
+	"call-with-values":               ctlCallWithValues,
+	"dynamic-wind":                   ctlDynamicWind,
+}
+
+func primIsProcedure(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Procedure)
+	return scheme.NewBoolean(ok), nil
+}
+
+// primArity returns the arity of a procedure as a list of the numbers
+// of required and optional arguments, and whether it takes the rest.
+func primArity(m *machine, args []scheme.Object) (scheme.Object, error) {
+	proc, err := argProcedure(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	arity := proc.Arity()
+	return scheme.NewList(
+		scheme.NewInteger(int64(arity.Required)),
+		scheme.NewInteger(int64(arity.Optional)),
+		scheme.NewBoolean(arity.Rest),
+	), nil
+}
+
+func primEq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBoolean(scheme.Eq(args[0], args[1])), nil
+}
+
+func primEqv(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBoolean(scheme.Eqv(args[0], args[1])), nil
+}
+
+func primEqual(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBoolean(scheme.Equal(args[0], args[1])), nil
+}
+
+func primNot(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBoolean(!scheme.IsTrue(args[0])), nil
+}
+
+func primIsBoolean(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Boolean)
+	return scheme.NewBoolean(ok), nil
+}
+
+func primBooleanEq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	for i := range args {
+		if _, ok := args[i].(*scheme.Boolean); !ok {
+			return nil, wrongType("boolean", args[i])
+		}
+	}
+	for i := 1; i < len(args); i++ {
+		if args[i] != args[0] {
+			return scheme.False, nil
+		}
+	}
+	return scheme.True, nil
+}
+
+// (apply proc arg1 ... args)
+func primApply(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if len(args) == 1 {
+		return m.apply(args[0], nil)
+	}
+	last, err := argList(args, len(args)-1)
+	if err != nil {
+		return nil, err
+	}
+	spread := append(append([]scheme.Object{}, args[1:len(args)-1]...), last...)
+	return m.apply(args[0], spread)
+}
+
+// primCallCC creates an escape-only continuation.  The VM creates
+// full ones instead.
+func primCallCC(m *machine, args []scheme.Object) (scheme.Object, error) {
+	k := &continuation{winders: m.winders}
+	value, err := m.apply(args[0], []scheme.Object{newContinuation(k)})
+	var invoked *continuationInvoked
+	if errors.As(err, &invoked) && invoked.k == k {
+		return invoked.value, nil
+	}
+	return value, err
+}
+
+func primValues(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewValues(append([]scheme.Object(nil), args...)...), nil
+}
+
+func primCallWithValues(m *machine, args []scheme.Object) (scheme.Object, error) {
+	value, err := m.apply(args[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.apply(args[1], scheme.ValuesToSlice(value))
+}
+
+func primDynamicWind(m *machine, args []scheme.Object) (scheme.Object, error) {
+	before, thunk, after := args[0], args[1], args[2]
+	if _, err := m.apply(before, nil); err != nil {
+		return nil, err
+	}
+	w := newWinder(before, after, m.winders)
+	m.winders = w
+	value, err := m.apply(thunk, nil)
+	var exit *ExitError
+	if m.winders != w || errors.As(err, &exit) {
+		// An error left the extent without running after, or
+		// emergency-exit skips it.
+		return value, err
+	}
+	m.winders = w.parent
+	if _, afterErr := m.apply(after, nil); afterErr != nil {
+		return nil, afterErr
+	}
+	return value, err
+}
+
+// errStopMapping stops mapLists without an error.
+var errStopMapping = errors.New("stop mapping")
+
+// mapLists calls fn with the i-th elements of lists until the shortest
+// list runs out, or fn returns errStopMapping.  It fails when all the
+// lists are circular.
+func mapLists(lists []scheme.Object, fn func([]scheme.Object) error) error {
+	rests := append([]scheme.Object{}, lists...)
+	walks := tortoises(lists)
+	for {
+		elems := make([]scheme.Object, len(rests))
+		circular := true
+		for i, list := range rests {
+			pair, ok := list.(*scheme.Pair)
+			if !ok {
+				if list != scheme.EmptyList {
+					return wrongType("list", lists[i])
+				}
+				return nil
+			}
+			elems[i] = pair.Car()
+			rests[i] = pair.Cdr()
+			circular = walks[i].meets(rests[i]) && circular
+		}
+		if err := fn(elems); err != nil {
+			if err == errStopMapping {
+				return nil
+			}
+			return err
+		}
+		if circular {
+			return wrongType("list", lists[0])
+		}
+	}
+}
+
+func primMap(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var results []scheme.Object
+	err := mapLists(args[1:], func(elems []scheme.Object) error {
+		result, err := m.apply(args[0], elems)
+		results = append(results, result)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.allocCells(len(results)); err != nil {
+		return nil, err
+	}
+	return scheme.NewList(results...), nil
+}
+
+func primForEach(m *machine, args []scheme.Object) (scheme.Object, error) {
+	err := mapLists(args[1:], func(elems []scheme.Object) error {
+		_, err := m.apply(args[0], elems)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+// (error message irritant ...)
+func primError(m *machine, args []scheme.Object) (scheme.Object, error) {
+	msg := args[0].String()
+	if s, ok := args[0].(*scheme.String); ok {
+		msg = s.Value().(string)
+	}
+	// The error object outlives the call, so it keeps its own irritants.
+	return nil, scheme.NewErrorObject(msg, append([]scheme.Object(nil), args[1:]...)...)
+}
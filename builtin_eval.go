@@ -0,0 +1,47 @@
+package gopische
+
+import (
+	"github.com/mnbi/gopische/scheme"
+)
+
+var evalBuiltins = []builtin{
+	{"environment", 0, -1, primEnvironment},
+	{"eval", 2, 2, primEval},
+}
+
+var replBuiltins = []builtin{
+	{"interaction-environment", 0, 0, primInteractionEnvironment},
+}
+
+// primEnvironment creates an environment from library names, such as
+// (scheme base).  Libraries hidden by the sandbox of the interpreter
+// are not available.
+func primEnvironment(m *machine, args []scheme.Object) (scheme.Object, error) {
+	env := newEnvironment(nil)
+	for _, spec := range args {
+		if _, ok := spec.(*scheme.Pair); !ok || !scheme.IsList(spec) {
+			return nil, wrongType("import set", spec)
+		}
+	}
+	if err := m.interp.importInto(m, env, args); err != nil {
+		return nil, err
+	}
+	return scheme.NewEnvironment(env), nil
+}
+
+func primEval(m *machine, args []scheme.Object) (scheme.Object, error) {
+	env, err := argEnvironment(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	x := &expander{interp: m.interp}
+	expr, err := x.expand(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.evaluate(expr, env)
+}
+
+func primInteractionEnvironment(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.interp.interactionEnvironment(), nil
+}
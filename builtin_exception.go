@@ -0,0 +1,124 @@
+package gopische
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var exceptionBuiltins = []builtin{
+	{"raise", 1, 1, primRaise},
+	{"error-object?", 1, 1, primIsErrorObject},
+	{"error-object-message", 1, 1, primErrorObjectMessage},
+	{"error-object-irritants", 1, 1, primErrorObjectIrritants},
+	{"file-error?", 1, 1, primIsFileError},
+	{"read-error?", 1, 1, primIsReadError},
+}
+
+// guardBuiltins implement `guard`, which the expander turns into a
+// call to them.  They are not bound to any variable.
+var guardBuiltins = []builtin{
+	{"%guard", 2, 2, primGuard},
+}
+
+// RaiseError is returned when `raise` is called with an object which
+// is not an error object, and no guard catches it.
+type RaiseError struct {
+	Value scheme.Object
+}
+
+func (e *RaiseError) Error() string {
+	return "uncaught exception: " + e.Value.String()
+}
+
+// condition returns the object which a guard catches for err.  It
+// returns false for an error which Scheme code cannot catch: exiting,
+// hitting a limit, cancelling the evaluation or invoking a
+// continuation.
+func condition(err error) (scheme.Object, bool) {
+	var raised *RaiseError
+	var exit *ExitError
+	var limit *LimitError
+	var invoked *continuationInvoked
+	switch {
+	case errors.As(err, &raised):
+		return raised.Value, true
+	case errors.As(err, &exit), errors.As(err, &limit), errors.As(err, &invoked):
+		return nil, false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, false
+	}
+	return scheme.WrapError(err), true
+}
+
+func primRaise(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if e, ok := args[0].(*scheme.ErrorObject); ok {
+		return nil, e
+	}
+	return nil, &RaiseError{Value: args[0]}
+}
+
+// (%guard thunk handler) calls thunk, and calls handler with the
+// condition if thunk raises one.  The handler is called in the
+// dynamic extent of the guard, so the after thunks between the raise
+// and the guard run before it.
+func primGuard(m *machine, args []scheme.Object) (scheme.Object, error) {
+	thunk, handler := args[0], args[1]
+	saved := m.winders
+	m.unwound = nil
+	value, err := m.apply(thunk, nil)
+	if err == nil {
+		return value, nil
+	}
+	cond, ok := condition(err)
+	if !ok {
+		return nil, err
+	}
+	if m.unwound != nil {
+		m.winders = m.unwound
+	}
+	m.unwound = nil
+	if err := m.rewind(saved); err != nil {
+		return nil, err
+	}
+	return m.apply(handler, []scheme.Object{cond})
+}
+
+func argErrorObject(args []scheme.Object, i int) (*scheme.ErrorObject, error) {
+	if e, ok := args[i].(*scheme.ErrorObject); ok {
+		return e, nil
+	}
+	return nil, wrongType("error object", args[i])
+}
+
+func primIsErrorObject(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.ErrorObject)
+	return scheme.NewBoolean(ok), nil
+}
+
+func primErrorObjectMessage(m *machine, args []scheme.Object) (scheme.Object, error) {
+	e, err := argErrorObject(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewString(e.Message()), nil
+}
+
+func primErrorObjectIrritants(m *machine, args []scheme.Object) (scheme.Object, error) {
+	e, err := argErrorObject(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewList(e.Irritants()...), nil
+}
+
+func primIsFileError(m *machine, args []scheme.Object) (scheme.Object, error) {
+	e, ok := args[0].(*scheme.ErrorObject)
+	return scheme.NewBoolean(ok && e.IsFileError()), nil
+}
+
+func primIsReadError(m *machine, args []scheme.Object) (scheme.Object, error) {
+	e, ok := args[0].(*scheme.ErrorObject)
+	return scheme.NewBoolean(ok && e.IsReadError()), nil
+}
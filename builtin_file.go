@@ -0,0 +1,253 @@
+package gopische
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var fileBuiltins = []builtin{
+	{"open-input-file", 1, 1, primOpenInputFile},
+	{"open-binary-input-file", 1, 1, primOpenBinaryInputFile},
+	{"call-with-input-file", 2, 2, primCallWithInputFile},
+	{"with-input-from-file", 2, 2, primWithInputFromFile},
+	{"file-exists?", 1, 1, primFileExists},
+}
+
+var fileWriteBuiltins = []builtin{
+	{"open-output-file", 1, 1, primOpenOutputFile},
+	{"open-binary-output-file", 1, 1, primOpenBinaryOutputFile},
+	{"call-with-output-file", 2, 2, primCallWithOutputFile},
+	{"with-output-to-file", 2, 2, primWithOutputToFile},
+	{"delete-file", 1, 1, primDeleteFile},
+}
+
+// WithFS makes an interpreter read files from fsys instead of the
+// file system of the host, e.g. an embed.FS or a testing/fstest.MapFS.
+// It applies to the procedures of (scheme file), Load, `load`,
+// `include` and the library path.  Paths are taken as slash-separated
+// paths in fsys, and a leading "/" is ignored.  Files cannot be
+// written or deleted, and compiled code files are not used.
+func WithFS(fsys fs.FS) Option {
+	return func(interp *Interpreter) {
+		interp.fsys = fsys
+	}
+}
+
+// fsPath converts a path given to the interpreter into a path in its
+// fs.FS.
+func fsPath(op string, name string) (string, error) {
+	p := strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+	if p == "" {
+		p = "."
+	}
+	if !fs.ValidPath(p) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return p, nil
+}
+
+// readFile reads a whole file from the file system of the interpreter.
+func (interp *Interpreter) readFile(name string) ([]byte, error) {
+	if interp.fsys == nil {
+		return os.ReadFile(name)
+	}
+	p, err := fsPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(interp.fsys, p)
+}
+
+// stat returns the information of a file in the file system of the
+// interpreter.
+func (interp *Interpreter) stat(name string) (fs.FileInfo, error) {
+	if interp.fsys == nil {
+		return os.Stat(name)
+	}
+	p, err := fsPath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(interp.fsys, p)
+}
+
+// openFile opens a file for reading in the file system of the
+// interpreter.
+func (interp *Interpreter) openFile(name string) (io.ReadCloser, error) {
+	if interp.fsys == nil {
+		return os.Open(name)
+	}
+	p, err := fsPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return interp.fsys.Open(p)
+}
+
+// createFile creates or truncates a file for writing.  It fails with
+// fs.ErrPermission when the interpreter has an fs.FS, and so do other
+// procedures writing files.
+func (interp *Interpreter) createFile(name string) (io.WriteCloser, error) {
+	if interp.fsys != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return os.Create(name)
+}
+
+func (interp *Interpreter) removeFile(name string) error {
+	if interp.fsys != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	return os.Remove(name)
+}
+
+// openInputFile opens a file as an input port, which closes the file
+// when it is closed.
+func (m *machine) openInputFile(args []scheme.Object, binary bool) (*scheme.Port, error) {
+	name, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.interp.openFile(name)
+	if err != nil {
+		return nil, scheme.NewFileError(err)
+	}
+	port := scheme.NewInputPort(name, f, binary)
+	port.OnClose(f.Close)
+	return port, nil
+}
+
+// openOutputFile opens a file as an output port.  The output is
+// buffered until the port is flushed or closed.
+func (m *machine) openOutputFile(args []scheme.Object, binary bool) (*scheme.Port, error) {
+	name, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.interp.createFile(name)
+	if err != nil {
+		return nil, scheme.NewFileError(err)
+	}
+	port := scheme.NewOutputPort(name, bufio.NewWriter(f), binary)
+	port.OnClose(f.Close)
+	return port, nil
+}
+
+// callWithPort calls proc with port, and closes the port after proc
+// returns.
+func (m *machine) callWithPort(port *scheme.Port, proc scheme.Object) (scheme.Object, error) {
+	value, err := m.apply(proc, []scheme.Object{port})
+	if closeErr := port.Close(); err == nil && closeErr != nil {
+		return nil, scheme.NewFileError(closeErr)
+	}
+	return value, err
+}
+
+// withPort calls thunk while param, one of the current port
+// parameters, holds port.  The port is closed after thunk returns.
+func (m *machine) withPort(param *scheme.Procedure, port *scheme.Port, thunk scheme.Object) (scheme.Object, error) {
+	p := param.Impl().(*parameter)
+	saved := p.value
+	p.value = port
+	value, err := m.apply(thunk, nil)
+	p.value = saved
+	if closeErr := port.Close(); err == nil && closeErr != nil {
+		return nil, scheme.NewFileError(closeErr)
+	}
+	return value, err
+}
+
+func primOpenInputFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.openInputFile(args, false)
+}
+
+func primOpenBinaryInputFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.openInputFile(args, true)
+}
+
+func primOpenOutputFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.openOutputFile(args, false)
+}
+
+func primOpenBinaryOutputFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.openOutputFile(args, true)
+}
+
+// (call-with-input-file string proc)
+func primCallWithInputFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argProcedure(args, 1); err != nil {
+		return nil, err
+	}
+	port, err := m.openInputFile(args, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.callWithPort(port, args[1])
+}
+
+// (call-with-output-file string proc)
+func primCallWithOutputFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argProcedure(args, 1); err != nil {
+		return nil, err
+	}
+	port, err := m.openOutputFile(args, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.callWithPort(port, args[1])
+}
+
+// (with-input-from-file string thunk)
+func primWithInputFromFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argProcedure(args, 1); err != nil {
+		return nil, err
+	}
+	port, err := m.openInputFile(args, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.withPort(m.interp.inputPort, port, args[1])
+}
+
+// (with-output-to-file string thunk)
+func primWithOutputToFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argProcedure(args, 1); err != nil {
+		return nil, err
+	}
+	port, err := m.openOutputFile(args, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.withPort(m.interp.outputPort, port, args[1])
+}
+
+func primFileExists(m *machine, args []scheme.Object) (scheme.Object, error) {
+	name, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.interp.stat(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, scheme.NewFileError(err)
+	}
+	return scheme.NewBoolean(err == nil), nil
+}
+
+func primDeleteFile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	name, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.interp.removeFile(name); err != nil {
+		return nil, scheme.NewFileError(err)
+	}
+	return scheme.Unspecified, nil
+}
@@ -0,0 +1,926 @@
+package gopische
+
+import (
+	"github.com/mnbi/gopische/scheme"
+)
+
+// srfi69Builtins are the procedures of SRFI 69.  The ones shared with
+// SRFI 125 accept its extended arguments too.
+var srfi69Builtins = []builtin{
+	{"make-hash-table", 0, -1, primMakeHashTable},
+	{"hash-table?", 1, 1, primIsHashTable},
+	{"alist->hash-table", 1, -1, primAlistToHashTable},
+	{"hash-table-equivalence-function", 1, 1, primHashTableEquivalenceFunction},
+	{"hash-table-hash-function", 1, 1, primHashTableHashFunction},
+	{"hash-table-ref", 2, 4, primHashTableRef},
+	{"hash-table-ref/default", 3, 3, primHashTableRefDefault},
+	{"hash-table-set!", 1, -1, primHashTableSet},
+	{"hash-table-delete!", 1, -1, primHashTableDelete},
+	{"hash-table-exists?", 2, 2, primHashTableContains},
+	{"hash-table-update!", 3, 5, primHashTableUpdate},
+	{"hash-table-update!/default", 4, 4, primHashTableUpdateDefault},
+	{"hash-table-size", 1, 1, primHashTableSize},
+	{"hash-table-keys", 1, 1, primHashTableKeys},
+	{"hash-table-values", 1, 1, primHashTableValues},
+	{"hash-table-walk", 2, 2, primHashTableWalk},
+	{"hash-table-fold", 3, 3, primHashTableFold},
+	{"hash-table->alist", 1, 1, primHashTableToAlist},
+	{"hash-table-copy", 1, 2, primHashTableCopy},
+	{"hash-table-merge!", 2, 2, primHashTableUnion},
+	{"hash", 1, 2, hashFunction(scheme.EqualHash)},
+	{"string-hash", 1, 2, primStringHash},
+	{"hash-by-identity", 1, 2, hashFunction(scheme.EqHash)},
+}
+
+// srfi125Builtins are the procedures of SRFI 125 which are not in SRFI
+// 69.  An equivalence predicate stands for a comparator.
+var srfi125Builtins = []builtin{
+	{"hash-table", 1, -1, primHashTable},
+	{"hash-table-unfold", 5, -1, primHashTableUnfold},
+	{"hash-table-contains?", 2, 2, primHashTableContains},
+	{"hash-table-empty?", 1, 1, primIsHashTableEmpty},
+	{"hash-table=?", 3, 3, primHashTableEq},
+	{"hash-table-mutable?", 1, 1, primIsHashTableMutable},
+	{"hash-table-intern!", 3, 3, primHashTableIntern},
+	{"hash-table-pop!", 1, 1, primHashTablePop},
+	{"hash-table-clear!", 1, 1, primHashTableClear},
+	{"hash-table-entries", 1, 1, primHashTableEntries},
+	{"hash-table-find", 3, 3, primHashTableFind},
+	{"hash-table-count", 2, 2, primHashTableCount},
+	{"hash-table-map", 3, 3, primHashTableMap},
+	{"hash-table-for-each", 2, 2, primHashTableForEach},
+	{"hash-table-map!", 2, 2, primHashTableMapUpdate},
+	{"hash-table-map->list", 2, 2, primHashTableMapToList},
+	{"hash-table-prune!", 2, 2, primHashTablePrune},
+	{"hash-table-empty-copy", 1, 1, primHashTableEmptyCopy},
+	{"hash-table-union!", 2, 2, primHashTableUnion},
+	{"hash-table-intersection!", 2, 2, primHashTableIntersection},
+	{"hash-table-difference!", 2, 2, primHashTableDifference},
+	{"hash-table-xor!", 2, 2, primHashTableXor},
+}
+
+func argHashTable(args []scheme.Object, i int) (*scheme.HashTable, error) {
+	if table, ok := args[i].(*scheme.HashTable); ok {
+		return table, nil
+	}
+	return nil, wrongType("hash table", args[i])
+}
+
+// argMutableHashTable returns a hash table argument to be modified.
+func argMutableHashTable(args []scheme.Object, i int) (*scheme.HashTable, error) {
+	table, err := argHashTable(args, i)
+	if err != nil {
+		return nil, err
+	}
+	if !table.IsMutable() {
+		return nil, wrongType("mutable hash table", args[i])
+	}
+	return table, nil
+}
+
+// procHasher compares keys by Scheme procedures.  The machine is the
+// one of the primitive which used the hash table last, since a hasher
+// is called only inside a primitive.
+type procHasher struct {
+	m     *machine
+	equal scheme.Object
+	hash  scheme.Object // nil for the hash of equal?
+}
+
+func (h *procHasher) Hash(key scheme.Object) (uint64, error) {
+	if h.hash == nil {
+		return scheme.EqualHash(key), nil
+	}
+	result, err := h.m.apply(h.hash, []scheme.Object{key})
+	if err != nil {
+		return 0, err
+	}
+	if n, ok := result.(*scheme.Number); ok {
+		if iv, ok := n.Value().(int64); ok {
+			return uint64(iv), nil
+		}
+	}
+	return 0, badArgument("hash function returned %s", result)
+}
+
+func (h *procHasher) Equal(a scheme.Object, b scheme.Object) (bool, error) {
+	return h.m.test(h.equal, a, b)
+}
+
+// use makes the procedures of a hash table called by a machine.
+func (m *machine) use(table *scheme.HashTable) *scheme.HashTable {
+	if h, ok := table.Hasher().(*procHasher); ok {
+		h.m = m
+	}
+	return table
+}
+
+// setEntry sets an entry of a hash table.  A new entry is accounted
+// for as a cell.
+func (m *machine) setEntry(table *scheme.HashTable, key scheme.Object, value scheme.Object) error {
+	added, err := m.use(table).Set(key, value)
+	if err != nil || !added {
+		return err
+	}
+	return m.allocCells(1)
+}
+
+// builtinHashers maps the builtin equivalence predicates to their
+// hashers, and the names of the hash functions consistent with them.
+var builtinHashers = []struct {
+	equal  string
+	hasher scheme.Hasher
+	hash   string
+}{
+	{"eq?", scheme.EqHasher, "hash-by-identity"},
+	{"eqv?", scheme.EqvHasher, "hash"},
+	{"equal?", scheme.EqualHasher, "hash"},
+	{"string=?", scheme.StringHasher, "string-hash"},
+}
+
+// newHashTable creates a hash table from the arguments of
+// `make-hash-table`:
+//
+//	[equivalence [hash]] arg ...
+//
+// The symbols weak and weak-keys in args make the keys weak.  The
+// other args, e.g. the initial capacity, are ignored.
+func (m *machine) newHashTable(args []scheme.Object) (*scheme.HashTable, error) {
+	var equal, hash scheme.Object
+	if len(args) > 0 {
+		if _, ok := args[0].(*scheme.Procedure); ok {
+			equal, args = args[0], args[1:]
+		}
+	}
+	if equal != nil && len(args) > 0 {
+		if _, ok := args[0].(*scheme.Procedure); ok {
+			hash, args = args[0], args[1:]
+		}
+	}
+	weak := false
+	for _, arg := range args {
+		if sym, ok := arg.(*scheme.Symbol); ok && (sym.Name() == "weak" || sym.Name() == "weak-keys") {
+			weak = true
+		}
+	}
+	if equal == nil {
+		return scheme.NewHashTable(scheme.EqualHasher, weak), nil
+	}
+	if hash == nil {
+		for _, b := range builtinHashers {
+			if equal == m.interp.prims[b.equal] {
+				return scheme.NewHashTable(b.hasher, weak), nil
+			}
+		}
+	}
+	return scheme.NewHashTable(&procHasher{m: m, equal: equal, hash: hash}, weak), nil
+}
+
+func primMakeHashTable(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.newHashTable(args)
+}
+
+func primIsHashTable(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.HashTable)
+	return scheme.NewBoolean(ok), nil
+}
+
+// primHashTable implements (hash-table equivalence key value ...),
+// which returns an immutable hash table.
+func primHashTable(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if len(args)%2 != 1 {
+		return nil, badArgument("odd number of keys and values")
+	}
+	if _, err := argProcedure(args, 0); err != nil {
+		return nil, err
+	}
+	table, err := m.newHashTable(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i += 2 {
+		if err := m.setEntry(table, args[i], args[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return table.Copy(false), nil
+}
+
+// primHashTableUnfold implements (hash-table-unfold stop? mapper
+// successor seed equivalence arg ...), where mapper returns a key and
+// a value.
+func primHashTableUnfold(m *machine, args []scheme.Object) (scheme.Object, error) {
+	for i := range 3 {
+		if _, err := argProcedure(args, i); err != nil {
+			return nil, err
+		}
+	}
+	table, err := m.newHashTable(args[4:])
+	if err != nil {
+		return nil, err
+	}
+	seed := args[3]
+	for {
+		stop, err := m.test(args[0], seed)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			return table, nil
+		}
+		result, err := m.apply(args[1], []scheme.Object{seed})
+		if err != nil {
+			return nil, err
+		}
+		kv := scheme.ValuesToSlice(result)
+		if len(kv) != 2 {
+			return nil, badArgument("mapper returned %d values", len(kv))
+		}
+		if err := m.setEntry(table, kv[0], kv[1]); err != nil {
+			return nil, err
+		}
+		if seed, err = m.apply(args[2], []scheme.Object{seed}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// primAlistToHashTable implements (alist->hash-table alist
+// [equivalence [hash]] arg ...).  The first association of a key is
+// taken.
+func primAlistToHashTable(m *machine, args []scheme.Object) (scheme.Object, error) {
+	alist, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	table, err := m.newHashTable(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range alist {
+		pair, ok := entry.(*scheme.Pair)
+		if !ok {
+			return nil, wrongType("pair", entry)
+		}
+		_, found, err := table.Ref(pair.Car())
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if err := m.setEntry(table, pair.Car(), pair.Cdr()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return table, nil
+}
+
+func primHashTableEquivalenceFunction(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if h, ok := table.Hasher().(*procHasher); ok {
+		return h.equal, nil
+	}
+	for _, b := range builtinHashers {
+		if table.Hasher() == b.hasher {
+			return m.interp.prims[b.equal], nil
+		}
+	}
+	return nil, badArgument("unknown hasher")
+}
+
+func primHashTableHashFunction(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if h, ok := table.Hasher().(*procHasher); ok {
+		if h.hash != nil {
+			return h.hash, nil
+		}
+		return m.interp.prims["hash"], nil
+	}
+	for _, b := range builtinHashers {
+		if table.Hasher() == b.hasher {
+			return m.interp.prims[b.hash], nil
+		}
+	}
+	return nil, badArgument("unknown hasher")
+}
+
+// primHashTableRef implements (hash-table-ref table key [failure
+// [success]]).  Without failure, a missing key is an error.
+func primHashTableRef(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	value, found, err := m.use(table).Ref(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if len(args) < 3 {
+			return nil, badArgument("key not found, %s", args[1])
+		}
+		return m.apply(args[2], nil)
+	}
+	if len(args) < 4 {
+		return value, nil
+	}
+	return m.apply(args[3], []scheme.Object{value})
+}
+
+func primHashTableRefDefault(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	value, found, err := m.use(table).Ref(args[1])
+	if err != nil || !found {
+		return args[2], err
+	}
+	return value, nil
+}
+
+// primHashTableSet implements (hash-table-set! table key value ...).
+func primHashTableSet(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(args)%2 != 1 {
+		return nil, badArgument("odd number of keys and values")
+	}
+	m.use(table)
+	for i := 1; i < len(args); i += 2 {
+		if err := m.setEntry(table, args[i], args[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return scheme.Unspecified, nil
+}
+
+// primHashTableDelete implements (hash-table-delete! table key ...),
+// which returns the number of the deleted keys.
+func primHashTableDelete(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	m.use(table)
+	var n int64
+	for _, key := range args[1:] {
+		found, err := table.Delete(key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			n++
+		}
+	}
+	return scheme.NewInteger(n), nil
+}
+
+func primHashTableContains(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, found, err := m.use(table).Ref(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(found), nil
+}
+
+// primHashTableUpdate implements (hash-table-update! table key
+// updater [failure [success]]).
+func primHashTableUpdate(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	value, err := primHashTableRef(m, append([]scheme.Object{args[0], args[1]}, args[3:]...))
+	if err != nil {
+		return nil, err
+	}
+	if value, err = m.apply(args[2], []scheme.Object{value}); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, m.setEntry(table, args[1], value)
+}
+
+// primHashTableUpdateDefault implements (hash-table-update!/default
+// table key updater default).
+func primHashTableUpdateDefault(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	value, found, err := m.use(table).Ref(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		value = args[3]
+	}
+	if value, err = m.apply(args[2], []scheme.Object{value}); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, m.setEntry(table, args[1], value)
+}
+
+// primHashTableIntern implements (hash-table-intern! table key
+// failure), which sets the value of failure to a missing key.
+func primHashTableIntern(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	value, found, err := m.use(table).Ref(args[1])
+	if err != nil || found {
+		return value, err
+	}
+	if value, err = m.apply(args[2], nil); err != nil {
+		return nil, err
+	}
+	return value, m.setEntry(table, args[1], value)
+}
+
+// primHashTablePop implements (hash-table-pop! table), which removes
+// an entry and returns its key and value.
+func primHashTablePop(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys, values := table.Entries()
+	if len(keys) == 0 {
+		return nil, badArgument("empty hash table")
+	}
+	if _, err := m.use(table).Delete(keys[0]); err != nil {
+		return nil, err
+	}
+	return scheme.NewValues(keys[0], values[0]), nil
+}
+
+func primHashTableClear(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, table.Clear()
+}
+
+func primHashTableSize(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewInteger(int64(table.Len())), nil
+}
+
+func primIsHashTableEmpty(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(table.Len() == 0), nil
+}
+
+func primIsHashTableMutable(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(table.IsMutable()), nil
+}
+
+// primHashTableEq implements (hash-table=? equivalence table1
+// table2), where equivalence compares the values.
+func primHashTableEq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	t1, err := argHashTable(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	t2, err := argHashTable(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if t1.Len() != t2.Len() {
+		return scheme.NewBoolean(false), nil
+	}
+	keys, values := t1.Entries()
+	for i, key := range keys {
+		value, found, err := m.use(t2).Ref(key)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return scheme.NewBoolean(false), nil
+		}
+		same, err := m.test(args[0], values[i], value)
+		if err != nil || !same {
+			return scheme.NewBoolean(false), err
+		}
+	}
+	return scheme.NewBoolean(true), nil
+}
+
+func primHashTableKeys(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys, _ := table.Entries()
+	return m.list(keys, scheme.EmptyList)
+}
+
+func primHashTableValues(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, values := table.Entries()
+	return m.list(values, scheme.EmptyList)
+}
+
+func primHashTableEntries(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys, values := table.Entries()
+	kl, err := m.list(keys, scheme.EmptyList)
+	if err != nil {
+		return nil, err
+	}
+	vl, err := m.list(values, scheme.EmptyList)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewValues(kl, vl), nil
+}
+
+// procAndTable returns the procedure and the hash table of the
+// arguments of SRFI 125, (proc table), or of SRFI 69, (table proc).
+func procAndTable(args []scheme.Object) (scheme.Object, *scheme.HashTable, error) {
+	if table, ok := args[0].(*scheme.HashTable); ok {
+		proc, err := argProcedure(args, 1)
+		return proc, table, err
+	}
+	proc, err := argProcedure(args, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	table, err := argHashTable(args, 1)
+	return proc, table, err
+}
+
+// walk calls fn with the entries of a hash table.  Modifying the hash
+// table in fn does not change the entries to walk.
+func walk(table *scheme.HashTable, fn func(key, value scheme.Object) error) error {
+	keys, values := table.Entries()
+	for i, key := range keys {
+		if err := fn(key, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// primHashTableForEach implements (hash-table-for-each proc table),
+// and (hash-table-walk table proc) of SRFI 69.
+func primHashTableForEach(m *machine, args []scheme.Object) (scheme.Object, error) {
+	proc, table, err := procAndTable(args)
+	if err != nil {
+		return nil, err
+	}
+	err = walk(table, func(key, value scheme.Object) error {
+		_, err := m.apply(proc, []scheme.Object{key, value})
+		return err
+	})
+	return scheme.Unspecified, err
+}
+
+func primHashTableWalk(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return primHashTableForEach(m, args)
+}
+
+// primHashTableFold implements (hash-table-fold kons knil table), and
+// (hash-table-fold table kons knil) of SRFI 69.
+func primHashTableFold(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, ok := args[0].(*scheme.HashTable); ok {
+		args = []scheme.Object{args[1], args[2], args[0]}
+	}
+	kons, err := argProcedure(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	table, err := argHashTable(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	acc := args[1]
+	err = walk(table, func(key, value scheme.Object) error {
+		var err error
+		acc, err = m.apply(kons, []scheme.Object{key, value, acc})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+func primHashTableMapToList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	proc, table, err := procAndTable(args)
+	if err != nil {
+		return nil, err
+	}
+	var result []scheme.Object
+	err = walk(table, func(key, value scheme.Object) error {
+		v, err := m.apply(proc, []scheme.Object{key, value})
+		result = append(result, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.list(result, scheme.EmptyList)
+}
+
+// primHashTableMap implements (hash-table-map proc equivalence table),
+// which returns a hash table of the keys of table compared by
+// equivalence, and the values mapped by proc.
+func primHashTableMap(m *machine, args []scheme.Object) (scheme.Object, error) {
+	proc, err := argProcedure(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := argProcedure(args, 1); err != nil {
+		return nil, err
+	}
+	table, err := argHashTable(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.newHashTable(args[1:2])
+	if err != nil {
+		return nil, err
+	}
+	err = walk(table, func(key, value scheme.Object) error {
+		v, err := m.apply(proc, []scheme.Object{value})
+		if err != nil {
+			return err
+		}
+		return m.setEntry(result, key, v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// primHashTableMapUpdate implements (hash-table-map! proc table),
+// which replaces the values by (proc key value).
+func primHashTableMapUpdate(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argMutableHashTable(args, 1); err != nil {
+		return nil, err
+	}
+	proc, table, err := procAndTable(args)
+	if err != nil {
+		return nil, err
+	}
+	err = walk(table, func(key, value scheme.Object) error {
+		v, err := m.apply(proc, []scheme.Object{key, value})
+		if err != nil {
+			return err
+		}
+		return m.setEntry(table, key, v)
+	})
+	return scheme.Unspecified, err
+}
+
+// primHashTablePrune implements (hash-table-prune! proc table), which
+// removes the entries satisfying (proc key value).
+func primHashTablePrune(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argMutableHashTable(args, 1); err != nil {
+		return nil, err
+	}
+	proc, table, err := procAndTable(args)
+	if err != nil {
+		return nil, err
+	}
+	err = walk(table, func(key, value scheme.Object) error {
+		prune, err := m.test(proc, key, value)
+		if err != nil || !prune {
+			return err
+		}
+		_, err = m.use(table).Delete(key)
+		return err
+	})
+	return scheme.Unspecified, err
+}
+
+// primHashTableFind implements (hash-table-find proc table failure),
+// which returns the first true value of (proc key value), or the
+// value of failure.
+func primHashTableFind(m *machine, args []scheme.Object) (scheme.Object, error) {
+	proc, table, err := procAndTable(args[:2])
+	if err != nil {
+		return nil, err
+	}
+	var found scheme.Object
+	err = walk(table, func(key, value scheme.Object) error {
+		v, err := m.apply(proc, []scheme.Object{key, value})
+		if err != nil {
+			return err
+		}
+		if scheme.IsTrue(v) {
+			found = v
+			return errStopMapping
+		}
+		return nil
+	})
+	if found != nil {
+		return found, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.apply(args[2], nil)
+}
+
+func primHashTableCount(m *machine, args []scheme.Object) (scheme.Object, error) {
+	proc, table, err := procAndTable(args)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	err = walk(table, func(key, value scheme.Object) error {
+		ok, err := m.test(proc, key, value)
+		if ok {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewInteger(n), nil
+}
+
+// primHashTableCopy implements (hash-table-copy table [mutable?]).
+// The copy is mutable unless mutable? is #f, as in SRFI 69.
+func primHashTableCopy(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.allocCells(table.Len()); err != nil {
+		return nil, err
+	}
+	return table.Copy(len(args) < 2 || scheme.IsTrue(args[1])), nil
+}
+
+func primHashTableEmptyCopy(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewHashTable(table.Hasher(), table.IsWeak()), nil
+}
+
+func primHashTableToAlist(m *machine, args []scheme.Object) (scheme.Object, error) {
+	table, err := argHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys, values := table.Entries()
+	if err := m.allocCells(len(keys)); err != nil {
+		return nil, err
+	}
+	alist := make([]scheme.Object, len(keys))
+	for i, key := range keys {
+		alist[i] = scheme.NewPair(key, values[i])
+	}
+	return m.list(alist, scheme.EmptyList)
+}
+
+// setOperation applies fn to the entries of the second hash table,
+// and returns the first one, which fn modifies.
+func setOperation(m *machine, args []scheme.Object, fn func(t1 *scheme.HashTable, key, value scheme.Object, found bool) error) (scheme.Object, error) {
+	t1, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	t2, err := argHashTable(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = walk(t2, func(key, value scheme.Object) error {
+		_, found, err := m.use(t1).Ref(key)
+		if err != nil {
+			return err
+		}
+		return fn(t1, key, value, found)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t1, nil
+}
+
+// primHashTableUnion adds the entries of the second hash table whose
+// keys are not in the first one.
+func primHashTableUnion(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return setOperation(m, args, func(t1 *scheme.HashTable, key, value scheme.Object, found bool) error {
+		if found {
+			return nil
+		}
+		return m.setEntry(t1, key, value)
+	})
+}
+
+// primHashTableIntersection removes the entries of the first hash
+// table whose keys are not in the second one.
+func primHashTableIntersection(m *machine, args []scheme.Object) (scheme.Object, error) {
+	t1, err := argMutableHashTable(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	t2, err := argHashTable(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = walk(t1, func(key, value scheme.Object) error {
+		_, found, err := m.use(t2).Ref(key)
+		if err != nil || found {
+			return err
+		}
+		_, err = m.use(t1).Delete(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t1, nil
+}
+
+// primHashTableDifference removes the entries of the first hash table
+// whose keys are in the second one.
+func primHashTableDifference(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return setOperation(m, args, func(t1 *scheme.HashTable, key, value scheme.Object, found bool) error {
+		if !found {
+			return nil
+		}
+		_, err := t1.Delete(key)
+		return err
+	})
+}
+
+// primHashTableXor leaves the entries whose keys are in either of the
+// hash tables, but not in both.
+func primHashTableXor(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return setOperation(m, args, func(t1 *scheme.HashTable, key, value scheme.Object, found bool) error {
+		if found {
+			_, err := t1.Delete(key)
+			return err
+		}
+		return m.setEntry(t1, key, value)
+	})
+}
+
+// hashFunction returns a primitive of (hash obj [bound]), which
+// returns a non-negative integer less than bound.
+func hashFunction(hash func(scheme.Object) uint64) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		return boundHash(hash(args[0]), args)
+	}
+}
+
+func primStringHash(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argString(args, 0); err != nil {
+		return nil, err
+	}
+	return boundHash(scheme.EqualHash(args[0]), args)
+}
+
+func boundHash(hash uint64, args []scheme.Object) (scheme.Object, error) {
+	h := int64(hash >> 1)
+	if len(args) > 1 {
+		bound, err := argInteger(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if bound <= 0 {
+			return nil, wrongType("positive integer", args[1])
+		}
+		h %= bound
+	}
+	return scheme.NewInteger(h), nil
+}
@@ -0,0 +1,566 @@
+package gopische
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var portBuiltins = []builtin{
+	{"port?", 1, 1, primIsPort},
+	{"input-port?", 1, 1, primIsInputPort},
+	{"output-port?", 1, 1, primIsOutputPort},
+	{"textual-port?", 1, 1, primIsTextualPort},
+	{"binary-port?", 1, 1, primIsBinaryPort},
+	{"input-port-open?", 1, 1, primIsInputPortOpen},
+	{"output-port-open?", 1, 1, primIsOutputPortOpen},
+	// parameter objects made by each interpreter, see newPorts
+	{"current-input-port", 0, 0, nil},
+	{"current-output-port", 0, 0, nil},
+	{"current-error-port", 0, 0, nil},
+	{"close-port", 1, 1, primClosePort},
+	{"close-input-port", 1, 1, primCloseInputPort},
+	{"close-output-port", 1, 1, primCloseOutputPort},
+	{"call-with-port", 2, 2, primCallWithPort},
+	{"eof-object", 0, 0, primEOFObject},
+	{"eof-object?", 1, 1, primIsEOFObject},
+}
+
+var stringPortBuiltins = []builtin{
+	{"open-input-string", 1, 1, primOpenInputString},
+	{"open-output-string", 0, 0, primOpenOutputString},
+	{"get-output-string", 1, 1, primGetOutputString},
+	{"open-input-bytevector", 1, 1, primOpenInputBytevector},
+	{"open-output-bytevector", 0, 0, primOpenOutputBytevector},
+	{"get-output-bytevector", 1, 1, primGetOutputBytevector},
+}
+
+var inputBuiltins = []builtin{
+	{"read-char", 0, 1, primReadChar},
+	{"peek-char", 0, 1, primPeekChar},
+	{"read-line", 0, 1, primReadLine},
+	{"read-string", 1, 2, primReadString},
+	{"char-ready?", 0, 1, primIsCharReady},
+	{"read-u8", 0, 1, primReadU8},
+	{"peek-u8", 0, 1, primPeekU8},
+	{"u8-ready?", 0, 1, primIsU8Ready},
+	{"read-bytevector", 1, 2, primReadBytevector},
+}
+
+var outputBuiltins = []builtin{
+	{"newline", 0, 1, primNewline},
+	{"write-char", 1, 2, primWriteChar},
+	{"write-string", 1, 4, primWriteString},
+	{"write-u8", 1, 2, primWriteU8},
+	{"write-bytevector", 1, 4, primWriteBytevector},
+	{"flush-output-port", 0, 1, primFlushOutputPort},
+}
+
+var readBuiltins = []builtin{
+	{"read", 0, 1, primRead},
+}
+
+var writeBuiltins = []builtin{
+	{"display", 1, 2, primDisplay},
+	{"write", 1, 2, primWrite},
+	{"write-shared", 1, 2, primWriteShared},
+	{"write-simple", 1, 2, primWriteSimple},
+}
+
+var prettyBuiltins = []builtin{
+	{"pretty-print", 1, 2, primPrettyPrint},
+}
+
+var loadBuiltins = []builtin{
+	{"load", 1, 1, primLoad},
+}
+
+// newPorts makes the parameter objects holding the current ports,
+// which are the standard input and outputs of the interpreter at
+// first.
+func (interp *Interpreter) newPorts() {
+	interp.inputPort = newPortParameter("current-input-port",
+		scheme.NewInputPort("stdin", interp.stdin, false), true)
+	interp.outputPort = newPortParameter("current-output-port",
+		scheme.NewOutputPort("stdout", interp.stdout, false), false)
+	interp.errorPort = newPortParameter("current-error-port",
+		scheme.NewOutputPort("stderr", interp.stderr, false), false)
+}
+
+// newPortParameter creates a parameter object whose converter
+// accepts only input or output ports.
+func newPortParameter(name string, port *scheme.Port, input bool) *scheme.Procedure {
+	converter := newPrimitive(builtin{name, 1, 1, func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		if p, ok := args[0].(*scheme.Port); ok && p.IsInput() == input {
+			return p, nil
+		}
+		if input {
+			return nil, wrongType("input port", args[0])
+		}
+		return nil, wrongType("output port", args[0])
+	}})
+	return scheme.NewPrimitive(name, scheme.Arity{}, &parameter{value: port, converter: converter})
+}
+
+// currentPort returns the value of a parameter object holding a port.
+func currentPort(param *scheme.Procedure) *scheme.Port {
+	return param.Impl().(*parameter).value.(*scheme.Port)
+}
+
+// portArg returns the port argument at i, or the current input or
+// output port when it is omitted.  Procedures for textual ports do not
+// accept binary ports, while the ones for binary ports accept textual
+// ports too, which are read and written by bytes in UTF-8.
+func (m *machine) portArg(args []scheme.Object, i int, input bool, binary bool) (*scheme.Port, error) {
+	var obj scheme.Object
+	switch {
+	case i < len(args):
+		obj = args[i]
+	case input:
+		obj = currentPort(m.interp.inputPort)
+	default:
+		obj = currentPort(m.interp.outputPort)
+	}
+	port, ok := obj.(*scheme.Port)
+	if ok && port.IsInput() == input && (binary || port.IsTextual()) {
+		return port, nil
+	}
+	kind := "textual "
+	if binary {
+		kind = "binary "
+	}
+	if input {
+		return nil, wrongType(kind+"input port", obj)
+	}
+	return nil, wrongType(kind+"output port", obj)
+}
+
+func argPort(args []scheme.Object, i int) (*scheme.Port, error) {
+	if port, ok := args[i].(*scheme.Port); ok {
+		return port, nil
+	}
+	return nil, wrongType("port", args[i])
+}
+
+// portResult returns a value read from a port, or the eof object at
+// the end of the input.
+func portResult(value func() scheme.Object, err error) (scheme.Object, error) {
+	if errors.Is(err, io.EOF) {
+		return scheme.EOF, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value(), nil
+}
+
+func primIsPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Port)
+	return scheme.NewBoolean(ok), nil
+}
+
+func primIsInputPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, ok := args[0].(*scheme.Port)
+	return scheme.NewBoolean(ok && port.IsInput()), nil
+}
+
+func primIsOutputPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, ok := args[0].(*scheme.Port)
+	return scheme.NewBoolean(ok && port.IsOutput()), nil
+}
+
+func primIsTextualPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, ok := args[0].(*scheme.Port)
+	return scheme.NewBoolean(ok && port.IsTextual()), nil
+}
+
+func primIsBinaryPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, ok := args[0].(*scheme.Port)
+	return scheme.NewBoolean(ok && port.IsBinary()), nil
+}
+
+func primIsInputPortOpen(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := argPort(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(port.IsInput() && port.IsOpen()), nil
+}
+
+func primIsOutputPortOpen(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := argPort(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(port.IsOutput() && port.IsOpen()), nil
+}
+
+func primClosePort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := argPort(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := port.Close(); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+// (call-with-port port proc)
+func primCallWithPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := argPort(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := argProcedure(args, 1); err != nil {
+		return nil, err
+	}
+	return m.callWithPort(port, args[1])
+}
+
+func primCloseInputPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, ok := args[0].(*scheme.Port)
+	if !ok || !port.IsInput() {
+		return nil, wrongType("input port", args[0])
+	}
+	return primClosePort(m, args)
+}
+
+func primCloseOutputPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, ok := args[0].(*scheme.Port)
+	if !ok || !port.IsOutput() {
+		return nil, wrongType("output port", args[0])
+	}
+	return primClosePort(m, args)
+}
+
+func primEOFObject(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.EOF, nil
+}
+
+func primIsEOFObject(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBoolean(args[0] == scheme.EOF), nil
+}
+
+func primReadChar(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, true, false)
+	if err != nil {
+		return nil, err
+	}
+	r, err := port.ReadChar()
+	return portResult(func() scheme.Object { return scheme.NewChar(r) }, err)
+}
+
+func primPeekChar(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, true, false)
+	if err != nil {
+		return nil, err
+	}
+	r, err := port.PeekChar()
+	return portResult(func() scheme.Object { return scheme.NewChar(r) }, err)
+}
+
+func primReadLine(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, true, false)
+	if err != nil {
+		return nil, err
+	}
+	line, err := port.ReadLine()
+	if err == nil {
+		err = m.allocString(len(line))
+	}
+	return portResult(func() scheme.Object { return scheme.NewString(line) }, err)
+}
+
+// (read [port])
+func primRead(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, true, false)
+	if err != nil {
+		return nil, err
+	}
+	datum, err := m.interp.NewReader(port).Read()
+	return portResult(func() scheme.Object { return datum }, err)
+}
+
+// (read-string k [port])
+func primReadString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	k, err := argIndex(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	port, err := m.portArg(args, 1, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if k == 0 {
+		return scheme.NewString(""), nil
+	}
+	if err := m.allocString(k * utf8.UTFMax); err != nil {
+		return nil, err
+	}
+	s, err := port.ReadString(k)
+	return portResult(func() scheme.Object { return scheme.NewString(s) }, err)
+}
+
+func primIsCharReady(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, true, false)
+	if err != nil {
+		return nil, err
+	}
+	return portReady(port)
+}
+
+func primIsU8Ready(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, true, true)
+	if err != nil {
+		return nil, err
+	}
+	return portReady(port)
+}
+
+func portReady(port *scheme.Port) (scheme.Object, error) {
+	ready, err := port.Ready()
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(ready), nil
+}
+
+func primReadU8(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, true, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := port.ReadByte()
+	return portResult(func() scheme.Object { return scheme.NewInteger(int64(b)) }, err)
+}
+
+func primPeekU8(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, true, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := port.PeekByte()
+	return portResult(func() scheme.Object { return scheme.NewInteger(int64(b)) }, err)
+}
+
+// (read-bytevector k [port])
+func primReadBytevector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	k, err := argIndex(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	port, err := m.portArg(args, 1, true, true)
+	if err != nil {
+		return nil, err
+	}
+	if k == 0 {
+		return scheme.NewBytevector([]byte{}), nil
+	}
+	if err := m.allocString(k); err != nil {
+		return nil, err
+	}
+	b, err := port.ReadBytes(k)
+	return portResult(func() scheme.Object { return scheme.NewBytevector(b) }, err)
+}
+
+func primNewline(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := port.WriteString("\n"); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+func primWriteChar(m *machine, args []scheme.Object) (scheme.Object, error) {
+	r, err := argChar(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	port, err := m.portArg(args, 1, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := port.WriteChar(r); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+// (write-string string [port [start [end]]])
+func primWriteString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argString(args, 0); err != nil {
+		return nil, err
+	}
+	port, err := m.portArg(args, 1, false, false)
+	if err != nil {
+		return nil, err
+	}
+	sub := args[:1]
+	if len(args) > 2 {
+		sub = append([]scheme.Object{args[0]}, args[2:]...)
+	}
+	s, err := primSubstring(m, sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := port.WriteString(s.(*scheme.String).Value().(string)); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+func primWriteU8(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b, err := argByte(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	port, err := m.portArg(args, 1, false, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := port.WriteByte(b); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+// (write-bytevector bytevector [port [start [end]]])
+func primWriteBytevector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b, err := argBytevector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	port, err := m.portArg(args, 1, false, true)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 2, len(b))
+	if err != nil {
+		return nil, err
+	}
+	if err := port.WriteBytes(b[start:end]); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+func primFlushOutputPort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 0, false, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := port.Flush(); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+// printTo writes the representation of obj made by print to the
+// output port given by the optional argument at i.
+func (m *machine) printTo(args []scheme.Object, i int, print func(scheme.Object) string) (scheme.Object, error) {
+	port, err := m.portArg(args, i, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := port.WriteString(print(args[0])); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+func primDisplay(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.printTo(args, 1, scheme.Display)
+}
+
+func primWrite(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.printTo(args, 1, scheme.Write)
+}
+
+func primWriteShared(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.printTo(args, 1, scheme.WriteShared)
+}
+
+func primWriteSimple(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, err := m.portArg(args, 1, false, false)
+	if err != nil {
+		return nil, err
+	}
+	s, err := scheme.WriteSimple(args[0])
+	if err != nil {
+		return nil, badArgument("%s", err)
+	}
+	if err := port.WriteString(s); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+// primPrettyPrint writes obj broken into lines by the width given by
+// WithPrettyPrint, followed by a newline.
+func primPrettyPrint(m *machine, args []scheme.Object) (scheme.Object, error) {
+	width := m.interp.prettyWidth()
+	return m.printTo(args, 1, func(obj scheme.Object) string {
+		return scheme.PrettyPrint(obj, width) + "\n"
+	})
+}
+
+func primOpenInputString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	s, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewStringInputPort(s), nil
+}
+
+func primOpenOutputString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewStringOutputPort(), nil
+}
+
+func primGetOutputString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, ok := args[0].(*scheme.Port)
+	if ok && port.IsTextual() {
+		if b, ok := port.Output(); ok {
+			return m.newString(string(b))
+		}
+	}
+	return nil, wrongType("string output port", args[0])
+}
+
+func primOpenInputBytevector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	b, err := argBytevector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBytevectorInputPort(b), nil
+}
+
+func primOpenOutputBytevector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBytevectorOutputPort(), nil
+}
+
+func primGetOutputBytevector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	port, ok := args[0].(*scheme.Port)
+	if ok && port.IsBinary() {
+		if b, ok := port.Output(); ok {
+			return m.newBytevector(b)
+		}
+	}
+	return nil, wrongType("bytevector output port", args[0])
+}
+
+func primLoad(m *machine, args []scheme.Object) (scheme.Object, error) {
+	path, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.interp.load(m, path, m.toplevel); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
@@ -0,0 +1,369 @@
+package gopische
+
+import (
+	"github.com/mnbi/gopische/scheme"
+)
+
+var listBuiltins = []builtin{
+	{"pair?", 1, 1, primIsPair},
+	{"null?", 1, 1, primIsNull},
+	{"list?", 1, 1, primIsList},
+	{"cons", 2, 2, primCons},
+	{"car", 1, 1, primCar},
+	{"cdr", 1, 1, primCdr},
+	{"set-car!", 2, 2, primSetCar},
+	{"set-cdr!", 2, 2, primSetCdr},
+	{"caar", 1, 1, cxr("aa")},
+	{"cadr", 1, 1, cxr("ad")},
+	{"cdar", 1, 1, cxr("da")},
+	{"cddr", 1, 1, cxr("dd")},
+	{"list", 0, -1, primList},
+	{"make-list", 1, 2, primMakeList},
+	{"length", 1, 1, primLength},
+	{"append", 0, -1, primAppend},
+	{"reverse", 1, 1, primReverse},
+	{"list-tail", 2, 2, primListTail},
+	{"list-ref", 2, 2, primListRef},
+	{"list-copy", 1, 1, primListCopy},
+	{"memq", 2, 2, primMemq},
+	{"memv", 2, 2, primMemv},
+	{"member", 2, 3, primMember},
+	{"assq", 2, 2, primAssq},
+	{"assv", 2, 2, primAssv},
+	{"assoc", 2, 3, primAssoc},
+}
+
+func primIsPair(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Pair)
+	return scheme.NewBoolean(ok), nil
+}
+
+func primIsNull(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBoolean(args[0] == scheme.EmptyList), nil
+}
+
+func primIsList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBoolean(scheme.IsList(args[0])), nil
+}
+
+func primCons(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if err := m.allocCells(1); err != nil {
+		return nil, err
+	}
+	return scheme.NewPair(args[0], args[1]), nil
+}
+
+func primCar(m *machine, args []scheme.Object) (scheme.Object, error) {
+	pair, err := argPair(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return pair.Car(), nil
+}
+
+func primCdr(m *machine, args []scheme.Object) (scheme.Object, error) {
+	pair, err := argPair(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return pair.Cdr(), nil
+}
+
+func primSetCar(m *machine, args []scheme.Object) (scheme.Object, error) {
+	pair, err := argPair(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	pair.SetCar(args[1])
+	return scheme.Unspecified, nil
+}
+
+func primSetCdr(m *machine, args []scheme.Object) (scheme.Object, error) {
+	pair, err := argPair(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	pair.SetCdr(args[1])
+	return scheme.Unspecified, nil
+}
+
+// cxr creates a composition of car and cdr.  The path is read from
+// right to left as the name of the procedure, e.g. "ad" for cadr.
+func cxr(path string) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		obj := args[0]
+		for i := len(path) - 1; i >= 0; i-- {
+			pair, ok := obj.(*scheme.Pair)
+			if !ok {
+				return nil, wrongType("pair", obj)
+			}
+			if path[i] == 'a' {
+				obj = pair.Car()
+			} else {
+				obj = pair.Cdr()
+			}
+		}
+		return obj, nil
+	}
+}
+
+func primList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if err := m.allocCells(len(args)); err != nil {
+		return nil, err
+	}
+	return scheme.NewList(args...), nil
+}
+
+func primMakeList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	k, err := argIndex(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.allocCells(k); err != nil {
+		return nil, err
+	}
+	var fill scheme.Object = scheme.Unspecified
+	if len(args) > 1 {
+		fill = args[1]
+	}
+	var list scheme.Object = scheme.EmptyList
+	for i := 0; i < k; i++ {
+		list = scheme.NewPair(fill, list)
+	}
+	return list, nil
+}
+
+func primLength(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if !scheme.IsList(args[0]) {
+		return nil, wrongType("list", args[0])
+	}
+	elems, _ := scheme.ListToSlice(args[0])
+	return scheme.NewInteger(int64(len(elems))), nil
+}
+
+func primAppend(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if len(args) == 0 {
+		return scheme.EmptyList, nil
+	}
+	result := args[len(args)-1]
+	for i := len(args) - 2; i >= 0; i-- {
+		elems, err := argList(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.allocCells(len(elems)); err != nil {
+			return nil, err
+		}
+		result = buildList(elems, result)
+	}
+	return result, nil
+}
+
+func primReverse(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.allocCells(len(elems)); err != nil {
+		return nil, err
+	}
+	var result scheme.Object = scheme.EmptyList
+	for _, elem := range elems {
+		result = scheme.NewPair(elem, result)
+	}
+	return result, nil
+}
+
+func listTail(args []scheme.Object) (scheme.Object, error) {
+	k, err := argIndex(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	list := args[0]
+	for i := 0; i < k; i++ {
+		pair, ok := list.(*scheme.Pair)
+		if !ok {
+			return nil, badArgument("index out of range, %d", k)
+		}
+		list = pair.Cdr()
+	}
+	return list, nil
+}
+
+func primListTail(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return listTail(args)
+}
+
+func primListRef(m *machine, args []scheme.Object) (scheme.Object, error) {
+	tail, err := listTail(args)
+	if err != nil {
+		return nil, err
+	}
+	pair, ok := tail.(*scheme.Pair)
+	if !ok {
+		return nil, badArgument("index out of range, %s", args[1])
+	}
+	return pair.Car(), nil
+}
+
+// tortoise follows a list at half the speed of a walk over it, so that
+// the walk notices a circular list.
+type tortoise struct {
+	slow scheme.Object
+	odd  bool
+	met  bool
+}
+
+// meets moves the tortoise along after the walk moves to obj, and
+// reports whether they have met, i.e. the list is circular.
+func (t *tortoise) meets(obj scheme.Object) bool {
+	if t.met {
+		return true
+	}
+	if t.odd {
+		t.slow = t.slow.(*scheme.Pair).Cdr()
+	}
+	t.odd = !t.odd
+	t.met = t.slow == obj
+	return t.met
+}
+
+// tortoises creates a tortoise for each of lists.
+func tortoises(lists []scheme.Object) []tortoise {
+	walks := make([]tortoise, len(lists))
+	for i, list := range lists {
+		walks[i].slow = list
+	}
+	return walks
+}
+
+func primListCopy(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var elems []scheme.Object
+	obj := args[0]
+	t := tortoise{slow: obj}
+	for {
+		pair, ok := obj.(*scheme.Pair)
+		if !ok {
+			break
+		}
+		elems = append(elems, pair.Car())
+		obj = pair.Cdr()
+		if t.meets(obj) {
+			return nil, wrongType("list", args[0])
+		}
+	}
+	if err := m.allocCells(len(elems)); err != nil {
+		return nil, err
+	}
+	return buildList(elems, obj), nil
+}
+
+// member returns the first sublist of list whose car is equivalent to
+// obj.
+func member(obj scheme.Object, list scheme.Object, equiv func(a, b scheme.Object) (bool, error)) (scheme.Object, error) {
+	start, t := list, tortoise{slow: list}
+	for list != scheme.EmptyList {
+		pair, ok := list.(*scheme.Pair)
+		if !ok {
+			return nil, wrongType("list", list)
+		}
+		found, err := equiv(obj, pair.Car())
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return list, nil
+		}
+		list = pair.Cdr()
+		if t.meets(list) {
+			return nil, wrongType("list", start)
+		}
+	}
+	return scheme.False, nil
+}
+
+// assoc returns the first pair in alist whose car is equivalent to
+// obj.
+func assoc(obj scheme.Object, alist scheme.Object, equiv func(a, b scheme.Object) (bool, error)) (scheme.Object, error) {
+	start, t := alist, tortoise{slow: alist}
+	for alist != scheme.EmptyList {
+		pair, ok := alist.(*scheme.Pair)
+		if !ok {
+			return nil, wrongType("list", alist)
+		}
+		entry, ok := pair.Car().(*scheme.Pair)
+		if !ok {
+			return nil, wrongType("pair", pair.Car())
+		}
+		found, err := equiv(obj, entry.Car())
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return entry, nil
+		}
+		alist = pair.Cdr()
+		if t.meets(alist) {
+			return nil, wrongType("list", start)
+		}
+	}
+	return scheme.False, nil
+}
+
+// equivalence wraps a Go predicate for member and assoc.
+func equivalence(pred func(a, b scheme.Object) bool) func(a, b scheme.Object) (bool, error) {
+	return func(a, b scheme.Object) (bool, error) {
+		return pred(a, b), nil
+	}
+}
+
+// userEquivalence returns the equivalence given as the optional third
+// argument, or equal? when it is omitted.
+func userEquivalence(m *machine, args []scheme.Object) (func(a, b scheme.Object) (bool, error), error) {
+	if len(args) < 3 {
+		return equivalence(scheme.Equal), nil
+	}
+	proc, err := argProcedure(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return func(a, b scheme.Object) (bool, error) {
+		result, err := m.apply(proc, []scheme.Object{a, b})
+		if err != nil {
+			return false, err
+		}
+		return scheme.IsTrue(result), nil
+	}, nil
+}
+
+func primMemq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return member(args[0], args[1], equivalence(scheme.Eq))
+}
+
+func primMemv(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return member(args[0], args[1], equivalence(scheme.Eqv))
+}
+
+func primMember(m *machine, args []scheme.Object) (scheme.Object, error) {
+	equiv, err := userEquivalence(m, args)
+	if err != nil {
+		return nil, err
+	}
+	return member(args[0], args[1], equiv)
+}
+
+func primAssq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return assoc(args[0], args[1], equivalence(scheme.Eq))
+}
+
+func primAssv(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return assoc(args[0], args[1], equivalence(scheme.Eqv))
+}
+
+func primAssoc(m *machine, args []scheme.Object) (scheme.Object, error) {
+	equiv, err := userEquivalence(m, args)
+	if err != nil {
+		return nil, err
+	}
+	return assoc(args[0], args[1], equiv)
+}
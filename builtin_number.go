@@ -0,0 +1,970 @@
+package gopische
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+	"math/cmplx"
+	"strconv"
+	"strings"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var numberBuiltins = []builtin{
+	{"number?", 1, 1, primIsNumber},
+	{"complex?", 1, 1, primIsNumber},
+	{"real?", 1, 1, primIsReal},
+	{"integer?", 1, 1, primIsInteger},
+	{"exact?", 1, 1, primIsExact},
+	{"inexact?", 1, 1, primIsInexact},
+	{"exact-integer?", 1, 1, primIsExactInteger},
+	{"=", 1, -1, primNumEq},
+	{"<", 1, -1, primNumLt},
+	{">", 1, -1, primNumGt},
+	{"<=", 1, -1, primNumLe},
+	{">=", 1, -1, primNumGe},
+	{"zero?", 1, 1, primIsZero},
+	{"positive?", 1, 1, primIsPositive},
+	{"negative?", 1, 1, primIsNegative},
+	{"odd?", 1, 1, primIsOdd},
+	{"even?", 1, 1, primIsEven},
+	{"max", 1, -1, primMax},
+	{"min", 1, -1, primMin},
+	{"+", 0, -1, primAdd},
+	{"*", 0, -1, primMul},
+	{"-", 1, -1, primSub},
+	{"/", 1, -1, primDiv},
+	{"abs", 1, 1, primAbs},
+	{"numerator", 1, 1, primNumerator},
+	{"denominator", 1, 1, primDenominator},
+	{"quotient", 2, 2, primQuotient},
+	{"remainder", 2, 2, primRemainder},
+	{"modulo", 2, 2, primModulo},
+	{"floor", 1, 1, primFloor},
+	{"ceiling", 1, 1, primCeiling},
+	{"truncate", 1, 1, primTruncate},
+	{"round", 1, 1, primRound},
+	{"square", 1, 1, primSquare},
+	{"sqrt", 1, 1, primSqrt},
+	{"expt", 2, 2, primExpt},
+	{"exact", 1, 1, primExact},
+	{"inexact", 1, 1, primInexact},
+	{"exact->inexact", 1, 1, primInexact},
+	{"inexact->exact", 1, 1, primExact},
+	{"number->string", 1, 2, primNumberToString},
+	{"string->number", 1, 2, primStringToNumber},
+}
+
+var inexactBuiltins = []builtin{
+	{"exp", 1, 1, primExp},
+	{"log", 1, 2, primLog},
+	{"sin", 1, 1, primSin},
+	{"cos", 1, 1, primCos},
+	{"tan", 1, 1, primTan},
+	{"asin", 1, 1, primAsin},
+	{"acos", 1, 1, primAcos},
+	{"atan", 1, 2, primAtan},
+	{"finite?", 1, 1, primIsFinite},
+	{"infinite?", 1, 1, primIsInfinite},
+	{"nan?", 1, 1, primIsNaN},
+}
+
+// numeric levels in the tower which this implementation supports.
+// Exact integers and ratios are the exact numbers.
+const (
+	levelInt = iota
+	levelRatio
+	levelFloat
+	levelComplex
+)
+
+func numLevel(n *scheme.Number) int {
+	switch n.Value().(type) {
+	case int64:
+		return levelInt
+	case *big.Rat:
+		return levelRatio
+	case float64:
+		return levelFloat
+	}
+	return levelComplex
+}
+
+func toFloat(n *scheme.Number) float64 {
+	switch v := n.Value().(type) {
+	case int64:
+		return float64(v)
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	case complex128:
+		return real(v)
+	}
+	return math.NaN()
+}
+
+// toRat returns the value of an exact number.
+func toRat(n *scheme.Number) *big.Rat {
+	if r, ok := n.Value().(*big.Rat); ok {
+		return r
+	}
+	return new(big.Rat).SetInt64(n.Value().(int64))
+}
+
+// ratNumber makes an exact number of r, which fails if r is an integer
+// which does not fit in 64 bits.
+func ratNumber(r *big.Rat) (*scheme.Number, error) {
+	n, ok := scheme.NewExact(r)
+	if !ok {
+		return nil, errOverflow
+	}
+	return n, nil
+}
+
+// intNumber makes an exact integer of i.
+func intNumber(i *big.Int) (*scheme.Number, error) {
+	return ratNumber(new(big.Rat).SetInt(i))
+}
+
+func toComplex(n *scheme.Number) complex128 {
+	if v, ok := n.Value().(complex128); ok {
+		return v
+	}
+	return complex(toFloat(n), 0)
+}
+
+func argNumber(args []scheme.Object, i int) (*scheme.Number, error) {
+	if n, ok := args[i].(*scheme.Number); ok {
+		return n, nil
+	}
+	return nil, wrongType("number", args[i])
+}
+
+func argReal(args []scheme.Object, i int) (*scheme.Number, error) {
+	n, err := argNumber(args, i)
+	if err != nil {
+		return nil, err
+	}
+	if numLevel(n) == levelComplex {
+		return nil, wrongType("real number", args[i])
+	}
+	return n, nil
+}
+
+func argNumbers(args []scheme.Object) ([]*scheme.Number, error) {
+	nums := make([]*scheme.Number, len(args))
+	for i := range args {
+		var err error
+		if nums[i], err = argNumber(args, i); err != nil {
+			return nil, err
+		}
+	}
+	return nums, nil
+}
+
+func argReals(args []scheme.Object) ([]*scheme.Number, error) {
+	nums := make([]*scheme.Number, len(args))
+	for i := range args {
+		var err error
+		if nums[i], err = argReal(args, i); err != nil {
+			return nil, err
+		}
+	}
+	return nums, nil
+}
+
+// errOverflow is returned when the result of an operation on exact
+// integers does not fit in 64 bits.
+var errOverflow = badArgument("integer overflow")
+
+// arith applies an operation at the higher level of two numbers.  iop
+// reports false when the result overflows.  rop sets its first
+// argument to the result of the others, as the methods of big.Rat do.
+func arith(a *scheme.Number, b *scheme.Number,
+	iop func(int64, int64) (int64, bool),
+	rop func(*big.Rat, *big.Rat, *big.Rat) *big.Rat,
+	fop func(float64, float64) float64,
+	cop func(complex128, complex128) complex128) (*scheme.Number, error) {
+	switch max(numLevel(a), numLevel(b)) {
+	case levelInt:
+		v, ok := iop(a.Value().(int64), b.Value().(int64))
+		if !ok {
+			return nil, errOverflow
+		}
+		return scheme.NewInteger(v), nil
+	case levelRatio:
+		return ratNumber(rop(new(big.Rat), toRat(a), toRat(b)))
+	case levelFloat:
+		return scheme.NewFloat(fop(toFloat(a), toFloat(b))), nil
+	}
+	return normalizeComplex(cop(toComplex(a), toComplex(b))), nil
+}
+
+// addInt, subInt and mulInt return the result of an operation, and
+// whether it does not overflow.
+func addInt(x, y int64) (int64, bool) {
+	v := x + y
+	return v, (v > x) == (y > 0)
+}
+
+func subInt(x, y int64) (int64, bool) {
+	v := x - y
+	return v, (v < x) == (y > 0)
+}
+
+func mulInt(x, y int64) (int64, bool) {
+	hi, lo := bits.Mul64(abs64(x), abs64(y))
+	if (x < 0) != (y < 0) {
+		return -int64(lo), hi == 0 && lo <= 1<<63
+	}
+	return int64(lo), hi == 0 && lo < 1<<63
+}
+
+// abs64 returns the absolute value of x, which is representable as an
+// unsigned integer even for math.MinInt64.
+func abs64(x int64) uint64 {
+	if x < 0 {
+		return uint64(-x)
+	}
+	return uint64(x)
+}
+
+// normalizeComplex makes a complex number with no imaginary part a
+// real number.
+func normalizeComplex(c complex128) *scheme.Number {
+	if imag(c) == 0 {
+		return scheme.NewFloat(real(c))
+	}
+	return scheme.NewComplex(c)
+}
+
+func numAdd(a, b *scheme.Number) (*scheme.Number, error) {
+	return arith(a, b, addInt, (*big.Rat).Add,
+		func(x, y float64) float64 { return x + y },
+		func(x, y complex128) complex128 { return x + y })
+}
+
+func numSub(a, b *scheme.Number) (*scheme.Number, error) {
+	return arith(a, b, subInt, (*big.Rat).Sub,
+		func(x, y float64) float64 { return x - y },
+		func(x, y complex128) complex128 { return x - y })
+}
+
+func numMul(a, b *scheme.Number) (*scheme.Number, error) {
+	return arith(a, b, mulInt, (*big.Rat).Mul,
+		func(x, y float64) float64 { return x * y },
+		func(x, y complex128) complex128 { return x * y })
+}
+
+// numDiv divides exact numbers into an exact number, a ratio unless
+// the quotient is an integer.
+func numDiv(a, b *scheme.Number) (*scheme.Number, error) {
+	switch max(numLevel(a), numLevel(b)) {
+	case levelInt, levelRatio:
+		y := toRat(b)
+		if y.Sign() == 0 {
+			return nil, badArgument("division by zero")
+		}
+		return ratNumber(new(big.Rat).Quo(toRat(a), y))
+	case levelFloat:
+		return scheme.NewFloat(toFloat(a) / toFloat(b)), nil
+	}
+	return normalizeComplex(toComplex(a) / toComplex(b)), nil
+}
+
+// numCompare returns -1, 0 or 1 as a is less than, equal to or
+// greater than b.
+func numCompare(a, b *scheme.Number) int {
+	if numLevel(a) == levelInt && numLevel(b) == levelInt {
+		x, y := a.Value().(int64), b.Value().(int64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	if isExact(a) && isExact(b) {
+		return toRat(a).Cmp(toRat(b))
+	}
+	x, y := toFloat(a), toFloat(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func numEqual(a, b *scheme.Number) bool {
+	if numLevel(a) == levelComplex || numLevel(b) == levelComplex {
+		return toComplex(a) == toComplex(b)
+	}
+	return numCompare(a, b) == 0 && !math.IsNaN(toFloat(a))
+}
+
+func isExact(n *scheme.Number) bool {
+	return numLevel(n) <= levelRatio
+}
+
+func isInteger(n *scheme.Number) bool {
+	switch v := n.Value().(type) {
+	case int64:
+		return true
+	case float64:
+		return v == math.Trunc(v) && !math.IsInf(v, 0)
+	}
+	return false
+}
+
+func primIsNumber(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Number)
+	return scheme.NewBoolean(ok), nil
+}
+
+func primIsReal(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, ok := args[0].(*scheme.Number)
+	return scheme.NewBoolean(ok && numLevel(n) != levelComplex), nil
+}
+
+func primIsInteger(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, ok := args[0].(*scheme.Number)
+	return scheme.NewBoolean(ok && isInteger(n)), nil
+}
+
+func primIsExact(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(isExact(n)), nil
+}
+
+func primIsInexact(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(!isExact(n)), nil
+}
+
+func primIsExactInteger(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, ok := args[0].(*scheme.Number)
+	return scheme.NewBoolean(ok && numLevel(n) == levelInt), nil
+}
+
+func primNumEq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	nums, err := argNumbers(args)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(nums); i++ {
+		if !numEqual(nums[i-1], nums[i]) {
+			return scheme.False, nil
+		}
+	}
+	return scheme.True, nil
+}
+
+// compareChain checks that every adjacent pair of arguments satisfies
+// ok.
+func compareChain(args []scheme.Object, ok func(int) bool) (scheme.Object, error) {
+	nums, err := argReals(args)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(nums); i++ {
+		if math.IsNaN(toFloat(nums[i-1])) || math.IsNaN(toFloat(nums[i])) {
+			return scheme.False, nil
+		}
+		if !ok(numCompare(nums[i-1], nums[i])) {
+			return scheme.False, nil
+		}
+	}
+	return scheme.True, nil
+}
+
+func primNumLt(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return compareChain(args, func(c int) bool { return c < 0 })
+}
+
+func primNumGt(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return compareChain(args, func(c int) bool { return c > 0 })
+}
+
+func primNumLe(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return compareChain(args, func(c int) bool { return c <= 0 })
+}
+
+func primNumGe(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return compareChain(args, func(c int) bool { return c >= 0 })
+}
+
+func primIsZero(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	// A ratio is never zero, even if it is too small for a float.
+	return scheme.NewBoolean(numLevel(n) != levelRatio && toComplex(n) == 0), nil
+}
+
+func primIsPositive(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argReal(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(numCompare(n, scheme.NewInteger(0)) > 0), nil
+}
+
+func primIsNegative(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argReal(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(numCompare(n, scheme.NewInteger(0)) < 0), nil
+}
+
+// integerValue returns the value of an integer, which may be inexact.
+func integerValue(args []scheme.Object, i int) (float64, bool, error) {
+	n, err := argNumber(args, i)
+	if err != nil {
+		return 0, false, err
+	}
+	if !isInteger(n) {
+		return 0, false, wrongType("integer", args[i])
+	}
+	return toFloat(n), isExact(n), nil
+}
+
+func primIsOdd(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, _, err := integerValue(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(math.Mod(v, 2) != 0), nil
+}
+
+func primIsEven(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, _, err := integerValue(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(math.Mod(v, 2) == 0), nil
+}
+
+// extremum returns the maximum (sign > 0) or minimum (sign < 0) of
+// the arguments.  The result is inexact if any argument is inexact.
+func extremum(args []scheme.Object, sign int) (scheme.Object, error) {
+	nums, err := argReals(args)
+	if err != nil {
+		return nil, err
+	}
+	result, exact := nums[0], isExact(nums[0])
+	for _, n := range nums[1:] {
+		exact = exact && isExact(n)
+		if numCompare(n, result)*sign > 0 || math.IsNaN(toFloat(n)) {
+			result = n
+		}
+	}
+	if !exact {
+		return scheme.NewFloat(toFloat(result)), nil
+	}
+	return result, nil
+}
+
+func primMax(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return extremum(args, 1)
+}
+
+func primMin(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return extremum(args, -1)
+}
+
+func primAdd(m *machine, args []scheme.Object) (scheme.Object, error) {
+	nums, err := argNumbers(args)
+	if err != nil {
+		return nil, err
+	}
+	result := scheme.NewInteger(0)
+	for _, n := range nums {
+		if result, err = numAdd(result, n); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func primMul(m *machine, args []scheme.Object) (scheme.Object, error) {
+	nums, err := argNumbers(args)
+	if err != nil {
+		return nil, err
+	}
+	result := scheme.NewInteger(1)
+	for _, n := range nums {
+		if result, err = numMul(result, n); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func primSub(m *machine, args []scheme.Object) (scheme.Object, error) {
+	nums, err := argNumbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 1 {
+		return numSub(scheme.NewInteger(0), nums[0])
+	}
+	result := nums[0]
+	for _, n := range nums[1:] {
+		if result, err = numSub(result, n); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func primDiv(m *machine, args []scheme.Object) (scheme.Object, error) {
+	nums, err := argNumbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 1 {
+		return numDiv(scheme.NewInteger(1), nums[0])
+	}
+	result := nums[0]
+	for _, n := range nums[1:] {
+		if result, err = numDiv(result, n); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func primAbs(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argReal(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if numCompare(n, scheme.NewInteger(0)) < 0 {
+		return numSub(scheme.NewInteger(0), n)
+	}
+	return n, nil
+}
+
+// integerDivision applies a division operation on integers.  The
+// result is inexact if any argument is inexact.
+func integerDivision(args []scheme.Object,
+	iop func(int64, int64) int64,
+	fop func(float64, float64) float64) (scheme.Object, error) {
+	x, xExact, err := integerValue(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	y, yExact, err := integerValue(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if y == 0 {
+		return nil, badArgument("division by zero")
+	}
+	if xExact && yExact {
+		if x == math.MinInt64 && y == -1 {
+			return nil, errOverflow
+		}
+		return scheme.NewInteger(iop(int64(x), int64(y))), nil
+	}
+	return scheme.NewFloat(fop(x, y)), nil
+}
+
+func primQuotient(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return integerDivision(args,
+		func(x, y int64) int64 { return x / y },
+		func(x, y float64) float64 { return math.Trunc(x / y) })
+}
+
+func primRemainder(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return integerDivision(args,
+		func(x, y int64) int64 { return x % y },
+		math.Mod)
+}
+
+func primModulo(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return integerDivision(args,
+		func(x, y int64) int64 {
+			r := x % y
+			if r != 0 && (r < 0) != (y < 0) {
+				r += y
+			}
+			return r
+		},
+		func(x, y float64) float64 {
+			r := math.Mod(x, y)
+			if r != 0 && (r < 0) != (y < 0) {
+				r += y
+			}
+			return r
+		})
+}
+
+// rounding applies a rounding function.  Exact integers are returned
+// as they are.  rfn rounds a ratio r whose floor is q, where half
+// compares the rest r - q with 1/2.
+func rounding(args []scheme.Object, fn func(float64) float64, rfn func(r *big.Rat, q *big.Int, half int) bool) (scheme.Object, error) {
+	n, err := argReal(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch v := n.Value().(type) {
+	case int64:
+		return n, nil
+	case *big.Rat:
+		// rfn tells whether the result is q + 1 rather than q.
+		q, rest := new(big.Int).DivMod(v.Num(), v.Denom(), new(big.Int))
+		if rfn(v, q, rest.Lsh(rest, 1).Cmp(v.Denom())) {
+			q.Add(q, big.NewInt(1))
+		}
+		return intNumber(q)
+	}
+	return scheme.NewFloat(fn(toFloat(n))), nil
+}
+
+func primFloor(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return rounding(args, math.Floor, func(r *big.Rat, q *big.Int, half int) bool { return false })
+}
+
+func primCeiling(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return rounding(args, math.Ceil, func(r *big.Rat, q *big.Int, half int) bool { return true })
+}
+
+func primTruncate(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return rounding(args, math.Trunc, func(r *big.Rat, q *big.Int, half int) bool { return r.Sign() < 0 })
+}
+
+func primRound(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return rounding(args, math.RoundToEven, func(r *big.Rat, q *big.Int, half int) bool {
+		return half > 0 || (half == 0 && q.Bit(0) == 1)
+	})
+}
+
+func primSquare(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return numMul(n, n)
+}
+
+func primSqrt(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch numLevel(n) {
+	case levelInt:
+		v := n.Value().(int64)
+		if v >= 0 {
+			r := int64(math.Sqrt(float64(v)))
+			if r*r == v {
+				return scheme.NewInteger(r), nil
+			}
+		}
+	case levelRatio:
+		r := n.Value().(*big.Rat)
+		if r.Sign() > 0 {
+			num, den := new(big.Int).Sqrt(r.Num()), new(big.Int).Sqrt(r.Denom())
+			if new(big.Int).Mul(num, num).Cmp(r.Num()) == 0 && new(big.Int).Mul(den, den).Cmp(r.Denom()) == 0 {
+				return ratNumber(new(big.Rat).SetFrac(num, den))
+			}
+		}
+	case levelComplex:
+		return normalizeComplex(cmplx.Sqrt(toComplex(n))), nil
+	}
+	if v := toFloat(n); v < 0 {
+		return scheme.NewComplex(complex(0, math.Sqrt(-v))), nil
+	}
+	return scheme.NewFloat(math.Sqrt(toFloat(n))), nil
+}
+
+func primExpt(m *machine, args []scheme.Object) (scheme.Object, error) {
+	base, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := argNumber(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if numLevel(base) == levelInt && numLevel(exp) == levelInt && exp.Value().(int64) >= 0 {
+		b, e := base.Value().(int64), exp.Value().(int64)
+		result := int64(1)
+		for ok := true; e > 0; e >>= 1 {
+			if e&1 == 1 {
+				if result, ok = mulInt(result, b); !ok {
+					return nil, errOverflow
+				}
+			}
+			if e > 1 {
+				if b, ok = mulInt(b, b); !ok {
+					return nil, errOverflow
+				}
+			}
+		}
+		return scheme.NewInteger(result), nil
+	}
+	if isExact(base) && numLevel(exp) == levelInt {
+		return exactExpt(toRat(base), exp.Value().(int64))
+	}
+	if numLevel(base) == levelComplex || numLevel(exp) == levelComplex {
+		return normalizeComplex(cmplx.Pow(toComplex(base), toComplex(exp))), nil
+	}
+	return scheme.NewFloat(math.Pow(toFloat(base), toFloat(exp))), nil
+}
+
+// maxExptBits limits the size of the result of an exact expt, so that
+// it cannot exhaust the memory.
+const maxExptBits = 1 << 20
+
+// exactExpt raises an exact number r to an integer power e.
+func exactExpt(r *big.Rat, e int64) (scheme.Object, error) {
+	if r.Sign() == 0 && e < 0 {
+		return nil, badArgument("division by zero")
+	}
+	bits := max(r.Num().BitLen(), r.Denom().BitLen())
+	if bits > 1 && int64(abs64(e)) > maxExptBits/int64(bits) {
+		return nil, errOverflow
+	}
+	k := big.NewInt(int64(abs64(e)))
+	num, den := new(big.Int).Exp(r.Num(), k, nil), new(big.Int).Exp(r.Denom(), k, nil)
+	if e < 0 {
+		num, den = den, num
+	}
+	return ratNumber(new(big.Rat).SetFrac(num, den))
+}
+
+// primExact converts an inexact number into the exact number of the
+// same value, which is a ratio if it is not an integer.
+func primExact(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argReal(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if isExact(n) {
+		return n, nil
+	}
+	v := toFloat(n)
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil, badArgument("no exact representation, %s", n)
+	}
+	return ratNumber(new(big.Rat).SetFloat64(v))
+}
+
+func primInexact(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if isExact(n) {
+		return scheme.NewFloat(toFloat(n)), nil
+	}
+	return n, nil
+}
+
+// primNumerator returns the numerator of a rational number in lowest
+// terms, which is inexact if the number is.
+func primNumerator(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return ratioPart(args, (*big.Rat).Num)
+}
+
+// primDenominator returns the denominator, which is positive.
+func primDenominator(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return ratioPart(args, (*big.Rat).Denom)
+}
+
+func ratioPart(args []scheme.Object, part func(*big.Rat) *big.Int) (scheme.Object, error) {
+	n, err := argReal(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if isExact(n) {
+		return intNumber(part(toRat(n)))
+	}
+	v := toFloat(n)
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil, wrongType("rational number", args[0])
+	}
+	f, _ := new(big.Float).SetInt(part(new(big.Rat).SetFloat64(v))).Float64()
+	return scheme.NewFloat(f), nil
+}
+
+// argRadix returns the optional radix argument at i, 10 by default.
+func argRadix(args []scheme.Object, i int) (int, error) {
+	if len(args) <= i {
+		return 10, nil
+	}
+	radix, err := argIndex(args, i)
+	if err != nil {
+		return 0, err
+	}
+	if radix < 2 || radix > 36 {
+		return 0, badArgument("bad radix, %d", radix)
+	}
+	return radix, nil
+}
+
+func primNumberToString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	radix, err := argRadix(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if iv, ok := n.Value().(int64); ok {
+		return m.newString(strconv.FormatInt(iv, radix))
+	}
+	if r, ok := n.Value().(*big.Rat); ok {
+		return m.newString(r.Num().Text(radix) + "/" + r.Denom().Text(radix))
+	}
+	if radix != 10 {
+		return nil, badArgument("radix %d is not supported for inexact numbers", radix)
+	}
+	return m.newString(n.String())
+}
+
+func primStringToNumber(m *machine, args []scheme.Object) (scheme.Object, error) {
+	s, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	radix, err := argRadix(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := parseNumber(s, radix); ok {
+		return n, nil
+	}
+	return scheme.False, nil
+}
+
+// parseNumber converts a numeric literal into a number.
+func parseNumber(s string, radix int) (*scheme.Number, bool) {
+	if s == "" || strings.ContainsAny(s, "_") {
+		return nil, false
+	}
+	if iv, err := strconv.ParseInt(s, radix, 64); err == nil {
+		return scheme.NewInteger(iv), true
+	}
+	if r, ok := scheme.ParseRational(s, radix); ok {
+		return scheme.NewExact(r)
+	}
+	if radix != 10 {
+		return nil, false
+	}
+	if fv, err := strconv.ParseFloat(s, 64); err == nil {
+		return scheme.NewFloat(fv), true
+	}
+	if cv, err := strconv.ParseComplex(s, 128); err == nil {
+		return scheme.NewComplex(cv), true
+	}
+	return nil, false
+}
+
+// inexactFunc applies a function of the inexact library.
+func inexactFunc(args []scheme.Object, fop func(float64) float64, cop func(complex128) complex128) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if numLevel(n) == levelComplex {
+		return normalizeComplex(cop(toComplex(n))), nil
+	}
+	return scheme.NewFloat(fop(toFloat(n))), nil
+}
+
+func primExp(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return inexactFunc(args, math.Exp, cmplx.Exp)
+}
+
+func primLog(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if len(args) == 2 {
+		x, err := argReal(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		base, err := argReal(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return scheme.NewFloat(math.Log(toFloat(x)) / math.Log(toFloat(base))), nil
+	}
+	return inexactFunc(args, math.Log, cmplx.Log)
+}
+
+func primSin(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return inexactFunc(args, math.Sin, cmplx.Sin)
+}
+
+func primCos(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return inexactFunc(args, math.Cos, cmplx.Cos)
+}
+
+func primTan(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return inexactFunc(args, math.Tan, cmplx.Tan)
+}
+
+func primAsin(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return inexactFunc(args, math.Asin, cmplx.Asin)
+}
+
+func primAcos(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return inexactFunc(args, math.Acos, cmplx.Acos)
+}
+
+func primAtan(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if len(args) == 2 {
+		y, err := argReal(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		x, err := argReal(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return scheme.NewFloat(math.Atan2(toFloat(y), toFloat(x))), nil
+	}
+	return inexactFunc(args, math.Atan, cmplx.Atan)
+}
+
+func primIsFinite(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	c := toComplex(n)
+	return scheme.NewBoolean(!cmplx.IsInf(c) && !cmplx.IsNaN(c)), nil
+}
+
+func primIsInfinite(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(cmplx.IsInf(toComplex(n))), nil
+}
+
+func primIsNaN(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argNumber(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(cmplx.IsNaN(toComplex(n))), nil
+}
@@ -0,0 +1,100 @@
+package gopische
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var processBuiltins = []builtin{
+	{"command-line", 0, 0, primCommandLine},
+	{"get-environment-variable", 1, 1, primGetEnvironmentVariable},
+	{"get-environment-variables", 0, 0, primGetEnvironmentVariables},
+}
+
+var exitBuiltins = []builtin{
+	{"exit", 0, 1, primExit},
+	{"emergency-exit", 0, 1, primEmergencyExit},
+}
+
+// ExitError is returned when Scheme code calls `exit`.  An
+// interpreter never terminates the process by itself; the host
+// decides what to do with the exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit with status %d", e.Code)
+}
+
+func primCommandLine(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems := make([]scheme.Object, len(m.interp.args))
+	for i, arg := range m.interp.args {
+		elems[i] = scheme.NewString(arg)
+	}
+	return scheme.NewList(elems...), nil
+}
+
+func primGetEnvironmentVariable(m *machine, args []scheme.Object) (scheme.Object, error) {
+	name, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		return scheme.NewString(value), nil
+	}
+	return scheme.False, nil
+}
+
+func primGetEnvironmentVariables(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var elems []scheme.Object
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		elems = append(elems, scheme.NewPair(scheme.NewString(name), scheme.NewString(value)))
+	}
+	return scheme.NewList(elems...), nil
+}
+
+// primExit runs the outstanding dynamic-wind after thunks, and exits.
+func primExit(m *machine, args []scheme.Object) (scheme.Object, error) {
+	exit, err := exitError(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.rewind(nil); err != nil {
+		return nil, err
+	}
+	return nil, exit
+}
+
+// primEmergencyExit exits without running the after thunks.
+func primEmergencyExit(m *machine, args []scheme.Object) (scheme.Object, error) {
+	exit, err := exitError(args)
+	if err != nil {
+		return nil, err
+	}
+	return nil, exit
+}
+
+// exitError returns the error of exiting with the optional argument
+// of `exit`: #t or none for success, #f for failure, or an integer.
+func exitError(args []scheme.Object) (*ExitError, error) {
+	if len(args) == 0 {
+		return &ExitError{Code: 0}, nil
+	}
+	switch obj := args[0].(type) {
+	case *scheme.Boolean:
+		if scheme.IsTrue(obj) {
+			return &ExitError{Code: 0}, nil
+		}
+		return &ExitError{Code: 1}, nil
+	}
+	code, err := argInteger(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ExitError{Code: int(code)}, nil
+}
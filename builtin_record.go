@@ -0,0 +1,185 @@
+package gopische
+
+import (
+	"strings"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// recordBuiltins are the procedural interface of records, which
+// `define-record-type` is expanded into.
+var recordBuiltins = []builtin{
+	{"make-record-type", 2, 2, primMakeRecordType},
+	{"record?", 1, 1, primIsRecord},
+	{"record-constructor", 1, 2, primRecordConstructor},
+	{"record-predicate", 1, 1, primRecordPredicate},
+	{"record-accessor", 2, 2, primRecordAccessor},
+	{"record-modifier", 2, 2, primRecordModifier},
+}
+
+// recordTypeName strips the angle brackets which conventionally
+// surround the name of a record type, e.g. <point>.
+func recordTypeName(name string) string {
+	if len(name) > 2 && strings.HasPrefix(name, "<") && strings.HasSuffix(name, ">") {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+func primMakeRecordType(m *machine, args []scheme.Object) (scheme.Object, error) {
+	name, err := argSymbol(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := argList(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(elems))
+	for i, elem := range elems {
+		sym, ok := elem.(*scheme.Symbol)
+		if !ok {
+			return nil, wrongType("symbol", elem)
+		}
+		fields[i] = sym.Name()
+	}
+	return scheme.NewRecordType(recordTypeName(name.Name()), fields), nil
+}
+
+func primIsRecord(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Record)
+	return scheme.NewBoolean(ok), nil
+}
+
+// primRecordConstructor creates a procedure which takes the values of
+// the given fields, or of all fields when they are omitted.
+func primRecordConstructor(m *machine, args []scheme.Object) (scheme.Object, error) {
+	rt, err := argRecordType(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]int, len(rt.Fields()))
+	for i := range indices {
+		indices[i] = i
+	}
+	if len(args) > 1 {
+		elems, err := argList(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		indices = indices[:0]
+		for _, elem := range elems {
+			i, err := fieldIndex(rt, elem)
+			if err != nil {
+				return nil, err
+			}
+			indices = append(indices, i)
+		}
+	}
+	return recordConstructor(rt, indices), nil
+}
+
+func recordConstructor(rt *scheme.RecordType, indices []int) *scheme.Procedure {
+	return newPrimitive(builtin{"", len(indices), len(indices), func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		rec := scheme.NewRecord(rt)
+		for i, index := range indices {
+			if err := rec.SetField(index, args[i]); err != nil {
+				return nil, badArgument("%s", err)
+			}
+		}
+		return rec, nil
+	}})
+}
+
+func primRecordPredicate(m *machine, args []scheme.Object) (scheme.Object, error) {
+	rt, err := argRecordType(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return recordPredicate(rt), nil
+}
+
+func recordPredicate(rt *scheme.RecordType) *scheme.Procedure {
+	return newPrimitive(builtin{"", 1, 1, func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		rec, ok := args[0].(*scheme.Record)
+		return scheme.NewBoolean(ok && rec.Type() == rt), nil
+	}})
+}
+
+func primRecordAccessor(m *machine, args []scheme.Object) (scheme.Object, error) {
+	rt, err := argRecordType(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := fieldIndex(rt, args[1])
+	if err != nil {
+		return nil, err
+	}
+	return recordAccessor(rt, i), nil
+}
+
+func recordAccessor(rt *scheme.RecordType, index int) *scheme.Procedure {
+	return newPrimitive(builtin{"", 1, 1, func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		rec, err := argRecord(args, 0, rt)
+		if err != nil {
+			return nil, err
+		}
+		value, err := rec.Field(index)
+		if err != nil {
+			return nil, badArgument("%s", err)
+		}
+		return value, nil
+	}})
+}
+
+func primRecordModifier(m *machine, args []scheme.Object) (scheme.Object, error) {
+	rt, err := argRecordType(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := fieldIndex(rt, args[1])
+	if err != nil {
+		return nil, err
+	}
+	return recordModifier(rt, i), nil
+}
+
+func recordModifier(rt *scheme.RecordType, index int) *scheme.Procedure {
+	return newPrimitive(builtin{"", 2, 2, func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		rec, err := argRecord(args, 0, rt)
+		if err != nil {
+			return nil, err
+		}
+		if err := rec.SetField(index, args[1]); err != nil {
+			return nil, badArgument("%s", err)
+		}
+		return scheme.Unspecified, nil
+	}})
+}
+
+func fieldIndex(rt *scheme.RecordType, name scheme.Object) (int, error) {
+	sym, ok := name.(*scheme.Symbol)
+	if !ok {
+		return 0, wrongType("symbol", name)
+	}
+	i := rt.FieldIndex(sym.Name())
+	if i < 0 {
+		return 0, badArgument("no such field of %s, %s", rt.Name(), sym.Name())
+	}
+	return i, nil
+}
+
+func argRecordType(args []scheme.Object, i int) (*scheme.RecordType, error) {
+	if rt, ok := args[i].(*scheme.RecordType); ok {
+		return rt, nil
+	}
+	return nil, wrongType("record type", args[i])
+}
+
+// argRecord returns an argument which must be an instance of rt.
+func argRecord(args []scheme.Object, i int, rt *scheme.RecordType) (*scheme.Record, error) {
+	if rec, ok := args[i].(*scheme.Record); ok && rec.Type() == rt {
+		return rec, nil
+	}
+	return nil, wrongType(rt.Name(), args[i])
+}
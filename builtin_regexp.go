@@ -0,0 +1,359 @@
+package gopische
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// regexpBuiltins are the procedures of (gopische regexp), which are
+// named after SRFI 115.  Patterns are strings of the RE2 syntax of
+// Go's regexp package instead of SREs.  Indexes count characters.
+var regexpBuiltins = []builtin{
+	{"regexp", 1, 1, primRegexp},
+	{"regexp?", 1, 1, primIsRegexp},
+	{"regexp-matches", 2, 4, regexpMatch(false)},
+	{"regexp-match", 2, 4, regexpMatch(false)},
+	{"regexp-matches?", 2, 4, regexpMatch(true)},
+	{"regexp-search", 2, 4, primRegexpSearch},
+	{"regexp-replace", 3, 5, regexpReplace(false)},
+	{"regexp-replace-all", 3, 5, regexpReplace(true)},
+	{"regexp-split", 2, 4, primRegexpSplit},
+	{"regexp-extract", 2, 4, primRegexpExtract},
+	{"regexp-match?", 1, 1, primIsRegexpMatch},
+	{"regexp-match-count", 1, 1, primRegexpMatchCount},
+	{"regexp-match-submatch", 2, 2, primRegexpMatchSubmatch},
+	{"regexp-match-submatch-start", 2, 2, regexpMatchSpan(true)},
+	{"regexp-match-submatch-end", 2, 2, regexpMatchSpan(false)},
+	{"regexp-match->list", 1, 1, primRegexpMatchToList},
+	{"regexp-match->alist", 1, 1, primRegexpMatchToAlist},
+}
+
+// argRegexp returns a regexp argument, compiling a string.
+func argRegexp(args []scheme.Object, i int) (*scheme.Regexp, error) {
+	switch v := args[i].(type) {
+	case *scheme.Regexp:
+		return v, nil
+	case *scheme.String:
+		re, err := scheme.NewRegexp(v.Value().(string))
+		if err != nil {
+			return nil, badArgument("bad regexp, %s", err)
+		}
+		return re, nil
+	}
+	return nil, wrongType("regexp", args[i])
+}
+
+func argRegexpMatch(args []scheme.Object, i int) (*scheme.RegexpMatch, error) {
+	if match, ok := args[i].(*scheme.RegexpMatch); ok {
+		return match, nil
+	}
+	return nil, wrongType("regexp match", args[i])
+}
+
+// argSubmatch returns the index of a submatch given by an integer or
+// by a name, a symbol or a string.
+func argSubmatch(match *scheme.RegexpMatch, args []scheme.Object, i int) (int, error) {
+	var name string
+	switch v := args[i].(type) {
+	case *scheme.Symbol:
+		name = v.Name()
+	case *scheme.String:
+		name = v.Value().(string)
+	default:
+		n, err := argIndex(args, i)
+		if err != nil {
+			return 0, err
+		}
+		if n >= match.Len() {
+			return 0, badArgument("no submatch, %d", n)
+		}
+		return n, nil
+	}
+	n := match.Regexp().Regexp().SubexpIndex(name)
+	if n < 0 {
+		return 0, badArgument("no submatch, %s", name)
+	}
+	return n, nil
+}
+
+// argText returns a string argument at i, and the byte offsets of
+// the optional start and end arguments following it.
+func argText(args []scheme.Object, i int) (string, int, int, error) {
+	s, err := argString(args, i)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	from, to, err := textRange(s, args, i+1)
+	return s, from, to, err
+}
+
+// textRange returns the byte offsets in s of the optional start and
+// end arguments at i and i+1, which count characters.
+func textRange(s string, args []scheme.Object, i int) (int, int, error) {
+	start, end, err := argRange(args, i, utf8.RuneCountInString(s))
+	if err != nil {
+		return 0, 0, err
+	}
+	return byteOffset(s, start), byteOffset(s, end), nil
+}
+
+// byteOffset returns the byte offset of the n-th character of s.
+func byteOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+func primRegexp(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return argRegexp(args, 0)
+}
+
+func primIsRegexp(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Regexp)
+	return scheme.NewBoolean(ok), nil
+}
+
+// regexpMatch returns a primitive of (regexp-matches re string [start
+// end]), which matches re with the whole substring.  It returns a
+// match object or #f, or a boolean if test is true.
+func regexpMatch(test bool) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		re, err := argRegexp(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		s, from, to, err := argText(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		match := re.Match(s, from, to)
+		if test || match == nil {
+			return scheme.NewBoolean(match != nil), nil
+		}
+		return match, nil
+	}
+}
+
+// primRegexpSearch implements (regexp-search re string [start end]),
+// which returns the leftmost match in the substring, or #f.
+func primRegexpSearch(m *machine, args []scheme.Object) (scheme.Object, error) {
+	re, err := argRegexp(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, from, to, err := argText(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if match := re.Search(s, from, to); match != nil {
+		return match, nil
+	}
+	return scheme.False, nil
+}
+
+// substitute returns the replacement of a match.  subst is a template
+// expanded by the submatches, $1, ${name} and so on, or a procedure
+// which takes the match object and returns a string.
+func (m *machine) substitute(match *scheme.RegexpMatch, subst scheme.Object) (string, error) {
+	switch v := subst.(type) {
+	case *scheme.String:
+		return match.Expand(v.Value().(string)), nil
+	case *scheme.Procedure:
+		result, err := m.apply(v, []scheme.Object{match})
+		if err != nil {
+			return "", err
+		}
+		if s, ok := result.(*scheme.String); ok {
+			return s.Value().(string), nil
+		}
+		return "", badArgument("replacement is not a string, %s", result)
+	}
+	return "", wrongType("string or procedure", subst)
+}
+
+// regexpReplace returns a primitive of (regexp-replace re string subst
+// [start end]), which replaces the first match in the substring, or
+// all of them if all is true.  It returns the whole string replaced.
+func regexpReplace(all bool) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		re, err := argRegexp(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		s, err := argString(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		from, to, err := textRange(s, args, 3)
+		if err != nil {
+			return nil, err
+		}
+		var matches []*scheme.RegexpMatch
+		if all {
+			matches = re.SearchAll(s, from, to)
+		} else if match := re.Search(s, from, to); match != nil {
+			matches = append(matches, match)
+		}
+		var b strings.Builder
+		last := 0
+		for _, match := range matches {
+			repl, err := m.substitute(match, args[2])
+			if err != nil {
+				return nil, err
+			}
+			start, end := match.Offsets()
+			b.WriteString(s[last:start])
+			b.WriteString(repl)
+			last = end
+		}
+		b.WriteString(s[last:])
+		return m.newString(b.String())
+	}
+}
+
+// primRegexpSplit implements (regexp-split re string [start end]),
+// which returns the substrings between the matches.
+func primRegexpSplit(m *machine, args []scheme.Object) (scheme.Object, error) {
+	re, err := argRegexp(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, from, to, err := argText(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return m.stringList(re.Regexp().Split(s[from:to], -1))
+}
+
+// primRegexpExtract implements (regexp-extract re string [start end]),
+// which returns the matched substrings.
+func primRegexpExtract(m *machine, args []scheme.Object) (scheme.Object, error) {
+	re, err := argRegexp(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, from, to, err := argText(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return m.stringList(re.Regexp().FindAllString(s[from:to], -1))
+}
+
+// stringList builds a list of strings.
+func (m *machine) stringList(strs []string) (scheme.Object, error) {
+	elems := make([]scheme.Object, len(strs))
+	for i, s := range strs {
+		var err error
+		if elems[i], err = m.newString(s); err != nil {
+			return nil, err
+		}
+	}
+	return m.list(elems, scheme.EmptyList)
+}
+
+func primIsRegexpMatch(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.RegexpMatch)
+	return scheme.NewBoolean(ok), nil
+}
+
+// primRegexpMatchCount returns the number of the submatches, not
+// including the whole match.
+func primRegexpMatchCount(m *machine, args []scheme.Object) (scheme.Object, error) {
+	match, err := argRegexpMatch(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewInteger(int64(match.Len() - 1)), nil
+}
+
+// submatch returns the i-th submatch as a string, or #f if it did not
+// match.
+func (m *machine) submatch(match *scheme.RegexpMatch, i int) (scheme.Object, error) {
+	s, ok := match.Submatch(i)
+	if !ok {
+		return scheme.False, nil
+	}
+	return m.newString(s)
+}
+
+// primRegexpMatchSubmatch implements (regexp-match-submatch match
+// field), where field is an index or a name.
+func primRegexpMatchSubmatch(m *machine, args []scheme.Object) (scheme.Object, error) {
+	match, err := argRegexpMatch(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := argSubmatch(match, args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return m.submatch(match, i)
+}
+
+// regexpMatchSpan returns a primitive which returns the start, or the
+// end, of a submatch, or #f if it did not match.
+func regexpMatchSpan(start bool) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		match, err := argRegexpMatch(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		i, err := argSubmatch(match, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		s, e, ok := match.Span(i)
+		if !ok {
+			return scheme.False, nil
+		}
+		if start {
+			return scheme.NewInteger(int64(s)), nil
+		}
+		return scheme.NewInteger(int64(e)), nil
+	}
+}
+
+// primRegexpMatchToList returns the submatches, from the whole match.
+func primRegexpMatchToList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	match, err := argRegexpMatch(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	elems := make([]scheme.Object, match.Len())
+	for i := range elems {
+		if elems[i], err = m.submatch(match, i); err != nil {
+			return nil, err
+		}
+	}
+	return m.list(elems, scheme.EmptyList)
+}
+
+// primRegexpMatchToAlist returns the named submatches as an alist of
+// symbols and strings, or #f if they did not match.
+func primRegexpMatchToAlist(m *machine, args []scheme.Object) (scheme.Object, error) {
+	match, err := argRegexpMatch(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var alist []scheme.Object
+	for i, name := range match.Regexp().Regexp().SubexpNames() {
+		if name == "" {
+			continue
+		}
+		s, err := m.submatch(match, i)
+		if err != nil {
+			return nil, err
+		}
+		alist = append(alist, scheme.NewPair(m.interp.symbols.Intern(name), s))
+	}
+	if err := m.allocCells(len(alist)); err != nil {
+		return nil, err
+	}
+	return m.list(alist, scheme.EmptyList)
+}
@@ -0,0 +1,390 @@
+package gopische
+
+import (
+	"github.com/mnbi/gopische/scheme"
+)
+
+// srfi132Builtins are the procedures of SRFI 132.  The linear-update
+// procedures on lists are the same as the pure ones, and the ones on
+// vectors modify the vectors in place.  vector-select! and
+// vector-separate! sort the range instead of partitioning it.
+var srfi132Builtins = []builtin{
+	{"list-sorted?", 2, 2, primIsListSorted},
+	{"list-merge", 3, 3, primListMerge},
+	{"list-merge!", 3, 3, primListMerge},
+	{"list-sort", 2, 2, primListSort},
+	{"list-sort!", 2, 2, primListSort},
+	{"list-stable-sort", 2, 2, primListSort},
+	{"list-stable-sort!", 2, 2, primListSort},
+	{"list-delete-neighbor-dups", 2, 2, primListDeleteNeighborDups},
+	{"list-delete-neighbor-dups!", 2, 2, primListDeleteNeighborDups},
+	{"vector-sorted?", 2, 4, primIsVectorSorted},
+	{"vector-merge", 3, 7, primVectorMerge},
+	{"vector-merge!", 4, 9, primVectorMergeTo},
+	{"vector-sort", 2, 4, primVectorSort},
+	{"vector-sort!", 2, 4, primVectorSortTo},
+	{"vector-stable-sort", 2, 4, primVectorSort},
+	{"vector-stable-sort!", 2, 4, primVectorSortTo},
+	{"vector-delete-neighbor-dups", 2, 4, primVectorDeleteNeighborDups},
+	{"vector-delete-neighbor-dups!", 2, 4, primVectorDeleteNeighborDupsTo},
+	{"vector-find-median", 3, 4, vectorFindMedian(false)},
+	{"vector-find-median!", 3, 4, vectorFindMedian(true)},
+	{"vector-select!", 3, 5, primVectorSelect},
+	{"vector-separate!", 3, 5, primVectorSeparate},
+}
+
+// mergeSort sorts elems stably by a Scheme procedure less.  It works
+// on copies of elems, so that elems is left as it is when less fails
+// or escapes by a continuation.
+func (m *machine) mergeSort(less scheme.Object, elems []scheme.Object) ([]scheme.Object, error) {
+	src := append([]scheme.Object(nil), elems...)
+	dst := make([]scheme.Object, len(src))
+	for width := 1; width < len(src); width *= 2 {
+		for lo := 0; lo < len(src); lo += 2 * width {
+			mid := min(lo+width, len(src))
+			hi := min(lo+2*width, len(src))
+			if err := m.merge(less, dst[lo:hi], src[lo:mid], src[mid:hi]); err != nil {
+				return nil, err
+			}
+		}
+		src, dst = dst, src
+	}
+	return src, nil
+}
+
+// merge merges sorted a and b into dst.  The elements of a come first
+// among equal ones.
+func (m *machine) merge(less scheme.Object, dst []scheme.Object, a []scheme.Object, b []scheme.Object) error {
+	i, j, k := 0, 0, 0
+	for i < len(a) && j < len(b) {
+		// An element of b is taken only if it is less than the one of a.
+		lt, err := m.test(less, b[j], a[i])
+		if err != nil {
+			return err
+		}
+		if lt {
+			dst[k] = b[j]
+			j++
+		} else {
+			dst[k] = a[i]
+			i++
+		}
+		k++
+	}
+	k += copy(dst[k:], a[i:])
+	copy(dst[k:], b[j:])
+	return nil
+}
+
+// primIsListSorted implements (list-sorted? < list).
+func primIsListSorted(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := argList(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(elems); i++ {
+		lt, err := m.test(args[0], elems[i], elems[i-1])
+		if err != nil {
+			return nil, err
+		}
+		if lt {
+			return scheme.NewBoolean(false), nil
+		}
+	}
+	return scheme.NewBoolean(true), nil
+}
+
+// primListMerge implements (list-merge < list1 list2).
+func primListMerge(m *machine, args []scheme.Object) (scheme.Object, error) {
+	a, err := argList(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	b, err := argList(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	merged := make([]scheme.Object, len(a)+len(b))
+	if err := m.merge(args[0], merged, a, b); err != nil {
+		return nil, err
+	}
+	return m.list(merged, scheme.EmptyList)
+}
+
+// primListSort implements (list-sort < list), which is stable.
+func primListSort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argProcedure(args, 0); err != nil {
+		return nil, err
+	}
+	elems, err := argList(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := m.mergeSort(args[0], elems)
+	if err != nil {
+		return nil, err
+	}
+	return m.list(sorted, scheme.EmptyList)
+}
+
+// primListDeleteNeighborDups implements (list-delete-neighbor-dups =
+// list), which keeps the first of adjacent equal elements.
+func primListDeleteNeighborDups(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := argList(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.deleteNeighborDups(args[0], elems)
+	if err != nil {
+		return nil, err
+	}
+	return m.list(result, scheme.EmptyList)
+}
+
+// deleteNeighborDups returns elems without the elements equal to the
+// ones just before them by a Scheme procedure eq.
+func (m *machine) deleteNeighborDups(eq scheme.Object, elems []scheme.Object) ([]scheme.Object, error) {
+	result := []scheme.Object{}
+	for i, elem := range elems {
+		if i > 0 {
+			same, err := m.test(eq, result[len(result)-1], elem)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		result = append(result, elem)
+	}
+	return result, nil
+}
+
+// argVectorRange returns a vector argument at i, and the optional
+// start and end arguments at j and j+1.
+func argVectorRange(args []scheme.Object, i int, j int) ([]scheme.Object, int, int, error) {
+	v, err := argVector(args, i)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	start, end, err := argRange(args, j, len(v))
+	return v, start, end, err
+}
+
+// primIsVectorSorted implements (vector-sorted? < vector [start end]).
+func primIsVectorSorted(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, start, end, err := argVectorRange(args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	for i := start + 1; i < end; i++ {
+		lt, err := m.test(args[0], v[i], v[i-1])
+		if err != nil {
+			return nil, err
+		}
+		if lt {
+			return scheme.NewBoolean(false), nil
+		}
+	}
+	return scheme.NewBoolean(true), nil
+}
+
+// primVectorMerge implements (vector-merge < vector1 vector2 [start1
+// end1 start2 end2]), which returns a new vector.
+func primVectorMerge(m *machine, args []scheme.Object) (scheme.Object, error) {
+	a, start1, end1, err := argVectorRange(args, 1, 3)
+	if err != nil {
+		return nil, err
+	}
+	b, start2, end2, err := argVectorRange(args, 2, 5)
+	if err != nil {
+		return nil, err
+	}
+	merged := make([]scheme.Object, end1-start1+end2-start2)
+	if err := m.merge(args[0], merged, a[start1:end1], b[start2:end2]); err != nil {
+		return nil, err
+	}
+	return m.newVector(merged)
+}
+
+// primVectorMergeTo implements (vector-merge! < to from1 from2 [start
+// start1 end1 start2 end2]), which writes the merged elements into to
+// from start.
+func primVectorMergeTo(m *machine, args []scheme.Object) (scheme.Object, error) {
+	to, err := argVector(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	start, _, err := argRange(args, 4, len(to))
+	if err != nil {
+		return nil, err
+	}
+	a, start1, end1, err := argVectorRange(args, 2, 5)
+	if err != nil {
+		return nil, err
+	}
+	b, start2, end2, err := argVectorRange(args, 3, 7)
+	if err != nil {
+		return nil, err
+	}
+	merged := make([]scheme.Object, end1-start1+end2-start2)
+	if len(merged) > len(to)-start {
+		return nil, badArgument("index out of range, %d", start)
+	}
+	// The sources may overlap the destination, so they are merged
+	// aside at first.
+	if err := m.merge(args[0], merged, a[start1:end1], b[start2:end2]); err != nil {
+		return nil, err
+	}
+	copy(to[start:], merged)
+	return scheme.Unspecified, nil
+}
+
+// primVectorSort implements (vector-sort < vector [start end]), which
+// returns a new vector of the sorted range.  It is stable.
+func primVectorSort(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argProcedure(args, 0); err != nil {
+		return nil, err
+	}
+	v, start, end, err := argVectorRange(args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := m.mergeSort(args[0], v[start:end])
+	if err != nil {
+		return nil, err
+	}
+	return m.newVector(sorted)
+}
+
+// primVectorSortTo implements (vector-sort! vector < [start end]),
+// which sorts the range in place.  It is stable.
+func primVectorSortTo(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argProcedure(args, 1); err != nil {
+		return nil, err
+	}
+	v, start, end, err := argVectorRange(args, 0, 2)
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := m.mergeSort(args[1], v[start:end])
+	if err != nil {
+		return nil, err
+	}
+	copy(v[start:], sorted)
+	return scheme.Unspecified, nil
+}
+
+// primVectorDeleteNeighborDups implements (vector-delete-neighbor-dups
+// = vector [start end]), which returns a new vector.
+func primVectorDeleteNeighborDups(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, start, end, err := argVectorRange(args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.deleteNeighborDups(args[0], v[start:end])
+	if err != nil {
+		return nil, err
+	}
+	return m.newVector(result)
+}
+
+// primVectorDeleteNeighborDupsTo implements
+// (vector-delete-neighbor-dups! = vector [start end]), which moves the
+// kept elements to the front of the range.  It returns the end of
+// them.
+func primVectorDeleteNeighborDupsTo(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, start, end, err := argVectorRange(args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.deleteNeighborDups(args[0], v[start:end])
+	if err != nil {
+		return nil, err
+	}
+	copy(v[start:], result)
+	return scheme.NewInteger(int64(start + len(result))), nil
+}
+
+// vectorFindMedian returns a primitive of (vector-find-median < vector
+// knil [mean]), which returns knil for an empty vector, and the mean of
+// the two middle elements for a vector of even length.  mean is the
+// arithmetic mean by default.  vector-find-median! also sorts vector.
+func vectorFindMedian(sort bool) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		if _, err := argProcedure(args, 0); err != nil {
+			return nil, err
+		}
+		v, err := argVector(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		sorted, err := m.mergeSort(args[0], v)
+		if err != nil {
+			return nil, err
+		}
+		if sort {
+			copy(v, sorted)
+		}
+		n := len(sorted)
+		switch {
+		case n == 0:
+			return args[2], nil
+		case n%2 == 1:
+			return sorted[n/2], nil
+		case len(args) > 3:
+			return m.apply(args[3], []scheme.Object{sorted[n/2-1], sorted[n/2]})
+		}
+		sum, err := primAdd(m, sorted[n/2-1:n/2+1])
+		if err != nil {
+			return nil, err
+		}
+		return primDiv(m, []scheme.Object{sum, scheme.NewInteger(2)})
+	}
+}
+
+// sortRange sorts the range of (proc < vector k [start end]) in place,
+// and returns it with k, which must be less than the length of the
+// range if below, or at most it otherwise.
+func (m *machine) sortRange(args []scheme.Object, below bool) ([]scheme.Object, int, error) {
+	if _, err := argProcedure(args, 0); err != nil {
+		return nil, 0, err
+	}
+	v, start, end, err := argVectorRange(args, 1, 3)
+	if err != nil {
+		return nil, 0, err
+	}
+	k, err := argIndex(args, 2)
+	if err != nil {
+		return nil, 0, err
+	}
+	if k > end-start || (below && k == end-start) {
+		return nil, 0, badArgument("index out of range, %d", k)
+	}
+	sorted, err := m.mergeSort(args[0], v[start:end])
+	if err != nil {
+		return nil, 0, err
+	}
+	copy(v[start:], sorted)
+	return sorted, k, nil
+}
+
+// primVectorSelect implements (vector-select! < vector k [start end]),
+// which returns the k-th smallest element of the range.
+func primVectorSelect(m *machine, args []scheme.Object) (scheme.Object, error) {
+	sorted, k, err := m.sortRange(args, true)
+	if err != nil {
+		return nil, err
+	}
+	return sorted[k], nil
+}
+
+// primVectorSeparate implements (vector-separate! < vector k [start
+// end]), which moves the k smallest elements to the front of the
+// range.
+func primVectorSeparate(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, _, err := m.sortRange(args, false); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
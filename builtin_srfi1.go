@@ -0,0 +1,1324 @@
+package gopische
+
+import (
+	"slices"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// srfi1Builtins are the procedures of SRFI 1 which are not in (scheme
+// base).  The linear-update procedures, whose names end with "!", are
+// the same as the pure ones, as SRFI 1 allows.
+var srfi1Builtins = []builtin{
+	// constructors
+	{"xcons", 2, 2, primXcons},
+	{"cons*", 1, -1, primConsStar},
+	{"list-tabulate", 2, 2, primListTabulate},
+	{"circular-list", 1, -1, primCircularList},
+	{"iota", 1, 3, primIota},
+	// predicates
+	{"proper-list?", 1, 1, primIsList},
+	{"circular-list?", 1, 1, primIsCircularList},
+	{"dotted-list?", 1, 1, primIsDottedList},
+	{"not-pair?", 1, 1, primIsNotPair},
+	{"null-list?", 1, 1, primIsNullList},
+	{"list=", 1, -1, primListEq},
+	// selectors
+	{"caaar", 1, 1, cxr("aaa")},
+	{"caadr", 1, 1, cxr("aad")},
+	{"cadar", 1, 1, cxr("ada")},
+	{"caddr", 1, 1, cxr("add")},
+	{"cdaar", 1, 1, cxr("daa")},
+	{"cdadr", 1, 1, cxr("dad")},
+	{"cddar", 1, 1, cxr("dda")},
+	{"cdddr", 1, 1, cxr("ddd")},
+	{"caaaar", 1, 1, cxr("aaaa")},
+	{"caaadr", 1, 1, cxr("aaad")},
+	{"caadar", 1, 1, cxr("aada")},
+	{"caaddr", 1, 1, cxr("aadd")},
+	{"cadaar", 1, 1, cxr("adaa")},
+	{"cadadr", 1, 1, cxr("adad")},
+	{"caddar", 1, 1, cxr("adda")},
+	{"cadddr", 1, 1, cxr("addd")},
+	{"cdaaar", 1, 1, cxr("daaa")},
+	{"cdaadr", 1, 1, cxr("daad")},
+	{"cdadar", 1, 1, cxr("dada")},
+	{"cdaddr", 1, 1, cxr("dadd")},
+	{"cddaar", 1, 1, cxr("ddaa")},
+	{"cddadr", 1, 1, cxr("ddad")},
+	{"cdddar", 1, 1, cxr("ddda")},
+	{"cddddr", 1, 1, cxr("dddd")},
+	{"first", 1, 1, nth(0)},
+	{"second", 1, 1, nth(1)},
+	{"third", 1, 1, nth(2)},
+	{"fourth", 1, 1, nth(3)},
+	{"fifth", 1, 1, nth(4)},
+	{"sixth", 1, 1, nth(5)},
+	{"seventh", 1, 1, nth(6)},
+	{"eighth", 1, 1, nth(7)},
+	{"ninth", 1, 1, nth(8)},
+	{"tenth", 1, 1, nth(9)},
+	{"car+cdr", 1, 1, primCarCdr},
+	{"take", 2, 2, primTake},
+	{"take!", 2, 2, primTake},
+	{"drop", 2, 2, primListTail},
+	{"take-right", 2, 2, primTakeRight},
+	{"drop-right", 2, 2, primDropRight},
+	{"drop-right!", 2, 2, primDropRight},
+	{"split-at", 2, 2, primSplitAt},
+	{"split-at!", 2, 2, primSplitAt},
+	{"last", 1, 1, primLast},
+	{"last-pair", 1, 1, primLastPair},
+	// miscellaneous
+	{"length+", 1, 1, primLengthPlus},
+	{"concatenate", 1, 1, primConcatenate},
+	{"concatenate!", 1, 1, primConcatenate},
+	{"append!", 0, -1, primAppend},
+	{"reverse!", 1, 1, primReverse},
+	{"append-reverse", 2, 2, primAppendReverse},
+	{"append-reverse!", 2, 2, primAppendReverse},
+	{"zip", 1, -1, primZip},
+	{"unzip1", 1, 1, unzip(1)},
+	{"unzip2", 1, 1, unzip(2)},
+	{"unzip3", 1, 1, unzip(3)},
+	{"unzip4", 1, 1, unzip(4)},
+	{"unzip5", 1, 1, unzip(5)},
+	{"count", 2, -1, primCount},
+	// fold, unfold and map
+	{"fold", 3, -1, primFold},
+	{"fold-right", 3, -1, primFoldRight},
+	{"pair-fold", 3, -1, primPairFold},
+	{"pair-fold-right", 3, -1, primPairFoldRight},
+	{"reduce", 3, 3, primReduce},
+	{"reduce-right", 3, 3, primReduceRight},
+	{"unfold", 4, 5, primUnfold},
+	{"unfold-right", 4, 5, primUnfoldRight},
+	{"append-map", 2, -1, primAppendMap},
+	{"append-map!", 2, -1, primAppendMap},
+	{"pair-for-each", 2, -1, primPairForEach},
+	{"filter-map", 2, -1, primFilterMap},
+	{"map-in-order", 2, -1, primMap},
+	// filtering and partitioning
+	{"filter", 2, 2, primFilter},
+	{"filter!", 2, 2, primFilter},
+	{"remove", 2, 2, primRemove},
+	{"remove!", 2, 2, primRemove},
+	{"partition", 2, 2, primPartition},
+	{"partition!", 2, 2, primPartition},
+	// searching
+	{"find", 2, 2, primFind},
+	{"find-tail", 2, 2, primFindTail},
+	{"any", 2, -1, primAny},
+	{"every", 2, -1, primEvery},
+	{"list-index", 2, -1, primListIndex},
+	{"take-while", 2, 2, primTakeWhile},
+	{"take-while!", 2, 2, primTakeWhile},
+	{"drop-while", 2, 2, primDropWhile},
+	{"span", 2, 2, primSpan},
+	{"span!", 2, 2, primSpan},
+	{"break", 2, 2, primBreak},
+	{"break!", 2, 2, primBreak},
+	// deletion
+	{"delete", 2, 3, primDelete},
+	{"delete!", 2, 3, primDelete},
+	{"delete-duplicates", 1, 2, primDeleteDuplicates},
+	{"delete-duplicates!", 1, 2, primDeleteDuplicates},
+	// association lists
+	{"alist-cons", 3, 3, primAlistCons},
+	{"alist-copy", 1, 1, primAlistCopy},
+	{"alist-delete", 2, 3, primAlistDelete},
+	{"alist-delete!", 2, 3, primAlistDelete},
+	// sets as lists
+	{"lset<=", 1, -1, primLsetLe},
+	{"lset=", 1, -1, primLsetEq},
+	{"lset-adjoin", 2, -1, primLsetAdjoin},
+	{"lset-union", 1, -1, primLsetUnion},
+	{"lset-union!", 1, -1, primLsetUnion},
+	{"lset-intersection", 2, -1, primLsetIntersection},
+	{"lset-intersection!", 2, -1, primLsetIntersection},
+	{"lset-difference", 2, -1, primLsetDifference},
+	{"lset-difference!", 2, -1, primLsetDifference},
+	{"lset-xor", 1, -1, primLsetXor},
+	{"lset-xor!", 1, -1, primLsetXor},
+	{"lset-diff+intersection", 2, -1, primLsetDiffIntersection},
+	{"lset-diff+intersection!", 2, -1, primLsetDiffIntersection},
+}
+
+// srfi1BaseBuiltins returns the builtins of (scheme base) which SRFI 1
+// exports as well.
+func srfi1BaseBuiltins() []builtin {
+	names := []string{
+		"cons", "list", "make-list", "list-copy",
+		"pair?", "null?",
+		"car", "cdr", "set-car!", "set-cdr!", "caar", "cadr", "cdar", "cddr",
+		"list-ref", "list-tail", "length", "append", "reverse",
+		"map", "for-each",
+		"member", "memq", "memv", "assoc", "assq", "assv",
+	}
+	var result []builtin
+	for _, b := range slices.Concat(listBuiltins, controlBuiltins) {
+		if slices.Contains(names, b.name) {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+// list builds a list of elems ending with tail.
+func (m *machine) list(elems []scheme.Object, tail scheme.Object) (scheme.Object, error) {
+	if err := m.allocCells(len(elems)); err != nil {
+		return nil, err
+	}
+	return buildList(elems, tail), nil
+}
+
+// test calls a predicate.
+func (m *machine) test(pred scheme.Object, args ...scheme.Object) (bool, error) {
+	result, err := m.apply(pred, args)
+	if err != nil {
+		return false, err
+	}
+	return scheme.IsTrue(result), nil
+}
+
+// prefix returns the elements of the pairs of a list, and the object
+// which ends it.  It fails if the list is circular.
+func prefix(list scheme.Object) ([]scheme.Object, scheme.Object, error) {
+	var elems []scheme.Object
+	start, t := list, tortoise{slow: list}
+	for {
+		pair, ok := list.(*scheme.Pair)
+		if !ok {
+			return elems, list, nil
+		}
+		elems = append(elems, pair.Car())
+		list = pair.Cdr()
+		if t.meets(list) {
+			return nil, nil, wrongType("list", start)
+		}
+	}
+}
+
+// isCircular tells whether a list is circular.
+func isCircular(list scheme.Object) bool {
+	slow, fast := list, list
+	for {
+		for range 2 {
+			pair, ok := fast.(*scheme.Pair)
+			if !ok {
+				return false
+			}
+			fast = pair.Cdr()
+		}
+		slow = slow.(*scheme.Pair).Cdr()
+		if fast == slow {
+			return true
+		}
+	}
+}
+
+func primXcons(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return primCons(m, []scheme.Object{args[1], args[0]})
+}
+
+// (cons* elem ... tail)
+func primConsStar(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.list(args[:len(args)-1], args[len(args)-1])
+}
+
+func primListTabulate(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argIndex(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.allocCells(n); err != nil {
+		return nil, err
+	}
+	elems := make([]scheme.Object, n)
+	for i := range elems {
+		if elems[i], err = m.apply(args[1], []scheme.Object{scheme.NewInteger(int64(i))}); err != nil {
+			return nil, err
+		}
+	}
+	return buildList(elems, scheme.EmptyList), nil
+}
+
+func primCircularList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	list, err := m.list(args, scheme.EmptyList)
+	if err != nil {
+		return nil, err
+	}
+	last := list.(*scheme.Pair)
+	for next, ok := last.Cdr().(*scheme.Pair); ok; next, ok = last.Cdr().(*scheme.Pair) {
+		last = next
+	}
+	last.SetCdr(list)
+	return list, nil
+}
+
+// (iota count [start [step]]) returns the numbers start + i * step.
+func primIota(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argIndex(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var start, step scheme.Object = scheme.NewInteger(0), scheme.NewInteger(1)
+	if len(args) > 1 {
+		if start, err = argNumber(args, 1); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) > 2 {
+		if step, err = argNumber(args, 2); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.allocCells(n); err != nil {
+		return nil, err
+	}
+	elems := make([]scheme.Object, n)
+	for i := range elems {
+		offset, err := primMul(m, []scheme.Object{scheme.NewInteger(int64(i)), step})
+		if err != nil {
+			return nil, err
+		}
+		if elems[i], err = primAdd(m, []scheme.Object{start, offset}); err != nil {
+			return nil, err
+		}
+	}
+	return buildList(elems, scheme.EmptyList), nil
+}
+
+func primIsCircularList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return scheme.NewBoolean(isCircular(args[0])), nil
+}
+
+func primIsDottedList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if isCircular(args[0]) {
+		return scheme.False, nil
+	}
+	_, tail, _ := prefix(args[0])
+	return scheme.NewBoolean(tail != scheme.EmptyList), nil
+}
+
+func primIsNotPair(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Pair)
+	return scheme.NewBoolean(!ok), nil
+}
+
+func primIsNullList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, ok := args[0].(*scheme.Pair); ok {
+		return scheme.False, nil
+	}
+	if args[0] == scheme.EmptyList {
+		return scheme.True, nil
+	}
+	return nil, wrongType("list", args[0])
+}
+
+// (list= elt= list ...)
+func primListEq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	for i := 2; i < len(args); i++ {
+		a, err := argList(args, i-1)
+		if err != nil {
+			return nil, err
+		}
+		b, err := argList(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if len(a) != len(b) {
+			return scheme.False, nil
+		}
+		for j := range a {
+			if same, err := m.test(args[0], a[j], b[j]); err != nil || !same {
+				return scheme.False, err
+			}
+		}
+	}
+	return scheme.True, nil
+}
+
+// nth creates a selector of the i-th element of a list.
+func nth(i int) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		return primListRef(m, []scheme.Object{args[0], scheme.NewInteger(int64(i))})
+	}
+}
+
+func primCarCdr(m *machine, args []scheme.Object) (scheme.Object, error) {
+	pair, err := argPair(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewValues(pair.Car(), pair.Cdr()), nil
+}
+
+// take returns the first k elements of a list, counting a cell for
+// each of them.
+func take(m *machine, args []scheme.Object) ([]scheme.Object, error) {
+	k, err := argIndex(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.allocCells(k); err != nil {
+		return nil, err
+	}
+	elems := make([]scheme.Object, k)
+	list := args[0]
+	for i := range elems {
+		pair, ok := list.(*scheme.Pair)
+		if !ok {
+			return nil, badArgument("index out of range, %s", args[1])
+		}
+		elems[i] = pair.Car()
+		list = pair.Cdr()
+	}
+	return elems, nil
+}
+
+func primTake(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := take(m, args)
+	if err != nil {
+		return nil, err
+	}
+	return buildList(elems, scheme.EmptyList), nil
+}
+
+// (take-right list k) returns the last k pairs of a list.
+func primTakeRight(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lead, err := listTail(args)
+	if err != nil {
+		return nil, err
+	}
+	lag := args[0]
+	t := tortoise{slow: lead}
+	for {
+		pair, ok := lead.(*scheme.Pair)
+		if !ok {
+			return lag, nil
+		}
+		lead = pair.Cdr()
+		lag = lag.(*scheme.Pair).Cdr()
+		if t.meets(lead) {
+			return nil, wrongType("list", args[0])
+		}
+	}
+}
+
+func primDropRight(m *machine, args []scheme.Object) (scheme.Object, error) {
+	k, err := argIndex(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	elems, _, err := prefix(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if k > len(elems) {
+		return nil, badArgument("index out of range, %s", args[1])
+	}
+	return m.list(elems[:len(elems)-k], scheme.EmptyList)
+}
+
+func primSplitAt(m *machine, args []scheme.Object) (scheme.Object, error) {
+	head, err := primTake(m, args)
+	if err != nil {
+		return nil, err
+	}
+	tail, err := listTail(args)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewValues(head, tail), nil
+}
+
+func primLast(m *machine, args []scheme.Object) (scheme.Object, error) {
+	last, err := primLastPair(m, args)
+	if err != nil {
+		return nil, err
+	}
+	return last.(*scheme.Pair).Car(), nil
+}
+
+func primLastPair(m *machine, args []scheme.Object) (scheme.Object, error) {
+	last, err := argPair(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	t := tortoise{slow: last}
+	for next, ok := last.Cdr().(*scheme.Pair); ok; next, ok = last.Cdr().(*scheme.Pair) {
+		last = next
+		if t.meets(last) {
+			return nil, wrongType("list", args[0])
+		}
+	}
+	return last, nil
+}
+
+// (length+ list) returns #f for a circular list.
+func primLengthPlus(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if isCircular(args[0]) {
+		return scheme.False, nil
+	}
+	elems, _, _ := prefix(args[0])
+	return scheme.NewInteger(int64(len(elems))), nil
+}
+
+func primConcatenate(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lists, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return primAppend(m, lists)
+}
+
+// (append-reverse rev-head tail)
+func primAppendReverse(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(elems)
+	return m.list(elems, args[1])
+}
+
+func primZip(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var tuples []scheme.Object
+	err := mapLists(args, func(elems []scheme.Object) error {
+		tuple, err := m.list(elems, scheme.EmptyList)
+		tuples = append(tuples, tuple)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.list(tuples, scheme.EmptyList)
+}
+
+// unzip creates a procedure which returns n lists of the i-th
+// elements of the lists in a list.
+func unzip(n int) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		tuples, err := argList(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		columns := make([][]scheme.Object, n)
+		for _, tuple := range tuples {
+			elems, err := take(m, []scheme.Object{tuple, scheme.NewInteger(int64(n))})
+			if err != nil {
+				return nil, err
+			}
+			for i := range columns {
+				columns[i] = append(columns[i], elems[i])
+			}
+		}
+		lists := make([]scheme.Object, n)
+		for i, column := range columns {
+			if lists[i], err = m.list(column, scheme.EmptyList); err != nil {
+				return nil, err
+			}
+		}
+		return scheme.NewValues(lists...), nil
+	}
+}
+
+// (count pred list1 list2 ...)
+func primCount(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var n int64
+	err := mapLists(args[1:], func(elems []scheme.Object) error {
+		ok, err := m.test(args[0], elems...)
+		if ok {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewInteger(n), nil
+}
+
+// (fold kons knil list1 list2 ...) calls (kons elem1 elem2 ... acc)
+// from the left.
+func primFold(m *machine, args []scheme.Object) (scheme.Object, error) {
+	acc := args[1]
+	err := mapLists(args[2:], func(elems []scheme.Object) error {
+		var err error
+		acc, err = m.apply(args[0], append(elems, acc))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// (fold-right kons knil list1 list2 ...) calls (kons elem1 elem2 ...
+// acc) from the right.
+func primFoldRight(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var tuples [][]scheme.Object
+	err := mapLists(args[2:], func(elems []scheme.Object) error {
+		tuples = append(tuples, elems)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	acc := args[1]
+	for i := len(tuples) - 1; i >= 0; i-- {
+		if acc, err = m.apply(args[0], append(tuples[i], acc)); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// mapPairs calls fn with the i-th pairs of lists until the shortest
+// list runs out, and fails when all the lists are circular.  The next pairs are taken before calling fn, so fn
+// may modify the pairs.
+func mapPairs(lists []scheme.Object, fn func([]scheme.Object) error) error {
+	rests := append([]scheme.Object{}, lists...)
+	walks := tortoises(lists)
+	for {
+		pairs := make([]scheme.Object, len(rests))
+		circular := true
+		for i, list := range rests {
+			pair, ok := list.(*scheme.Pair)
+			if !ok {
+				if list != scheme.EmptyList {
+					return wrongType("list", lists[i])
+				}
+				return nil
+			}
+			pairs[i] = pair
+			rests[i] = pair.Cdr()
+			circular = walks[i].meets(rests[i]) && circular
+		}
+		if err := fn(pairs); err != nil {
+			return err
+		}
+		if circular {
+			return wrongType("list", lists[0])
+		}
+	}
+}
+
+func primPairFold(m *machine, args []scheme.Object) (scheme.Object, error) {
+	acc := args[1]
+	err := mapPairs(args[2:], func(pairs []scheme.Object) error {
+		var err error
+		acc, err = m.apply(args[0], append(pairs, acc))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+func primPairFoldRight(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var tuples [][]scheme.Object
+	err := mapPairs(args[2:], func(pairs []scheme.Object) error {
+		tuples = append(tuples, pairs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	acc := args[1]
+	for i := len(tuples) - 1; i >= 0; i-- {
+		if acc, err = m.apply(args[0], append(tuples[i], acc)); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// (reduce f ridentity list) is fold with the first element as the
+// initial value, or ridentity for the empty list.
+func primReduce(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := argList(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 {
+		return args[1], nil
+	}
+	acc := elems[0]
+	for _, elem := range elems[1:] {
+		if acc, err = m.apply(args[0], []scheme.Object{elem, acc}); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+func primReduceRight(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := argList(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 {
+		return args[1], nil
+	}
+	acc := elems[len(elems)-1]
+	for i := len(elems) - 2; i >= 0; i-- {
+		if acc, err = m.apply(args[0], []scheme.Object{elems[i], acc}); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// (unfold stop? mapper successor seed [tail-gen])
+func primUnfold(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var elems []scheme.Object
+	seed := args[3]
+	for {
+		stop, err := m.test(args[0], seed)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			break
+		}
+		elem, err := m.apply(args[1], []scheme.Object{seed})
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		if seed, err = m.apply(args[2], []scheme.Object{seed}); err != nil {
+			return nil, err
+		}
+	}
+	var tail scheme.Object = scheme.EmptyList
+	if len(args) > 4 {
+		var err error
+		if tail, err = m.apply(args[4], []scheme.Object{seed}); err != nil {
+			return nil, err
+		}
+	}
+	return m.list(elems, tail)
+}
+
+// (unfold-right stop? mapper successor seed [tail])
+func primUnfoldRight(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var acc scheme.Object = scheme.EmptyList
+	if len(args) > 4 {
+		acc = args[4]
+	}
+	seed := args[3]
+	for {
+		stop, err := m.test(args[0], seed)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			return acc, nil
+		}
+		elem, err := m.apply(args[1], []scheme.Object{seed})
+		if err != nil {
+			return nil, err
+		}
+		if acc, err = primCons(m, []scheme.Object{elem, acc}); err != nil {
+			return nil, err
+		}
+		if seed, err = m.apply(args[2], []scheme.Object{seed}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func primAppendMap(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var results []scheme.Object
+	err := mapLists(args[1:], func(elems []scheme.Object) error {
+		result, err := m.apply(args[0], elems)
+		results = append(results, result)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return primAppend(m, results)
+}
+
+func primPairForEach(m *machine, args []scheme.Object) (scheme.Object, error) {
+	err := mapPairs(args[1:], func(pairs []scheme.Object) error {
+		_, err := m.apply(args[0], pairs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+func primFilterMap(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var results []scheme.Object
+	err := mapLists(args[1:], func(elems []scheme.Object) error {
+		result, err := m.apply(args[0], elems)
+		if err == nil && scheme.IsTrue(result) {
+			results = append(results, result)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.list(results, scheme.EmptyList)
+}
+
+// partition splits the elements of a list by whether they satisfy a
+// predicate.
+func partition(m *machine, args []scheme.Object) (in, out []scheme.Object, err error) {
+	elems, err := argList(args, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, elem := range elems {
+		ok, err := m.test(args[0], elem)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			in = append(in, elem)
+		} else {
+			out = append(out, elem)
+		}
+	}
+	return in, out, nil
+}
+
+func primFilter(m *machine, args []scheme.Object) (scheme.Object, error) {
+	in, _, err := partition(m, args)
+	if err != nil {
+		return nil, err
+	}
+	return m.list(in, scheme.EmptyList)
+}
+
+func primRemove(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, out, err := partition(m, args)
+	if err != nil {
+		return nil, err
+	}
+	return m.list(out, scheme.EmptyList)
+}
+
+func primPartition(m *machine, args []scheme.Object) (scheme.Object, error) {
+	in, out, err := partition(m, args)
+	if err != nil {
+		return nil, err
+	}
+	ins, err := m.list(in, scheme.EmptyList)
+	if err != nil {
+		return nil, err
+	}
+	outs, err := m.list(out, scheme.EmptyList)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewValues(ins, outs), nil
+}
+
+func primFind(m *machine, args []scheme.Object) (scheme.Object, error) {
+	tail, err := primFindTail(m, args)
+	if err != nil {
+		return nil, err
+	}
+	if pair, ok := tail.(*scheme.Pair); ok {
+		return pair.Car(), nil
+	}
+	return scheme.False, nil
+}
+
+// (find-tail pred list) returns the first pair whose car satisfies
+// pred.
+func primFindTail(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var tail scheme.Object = scheme.False
+	err := mapPairs(args[1:], func(pairs []scheme.Object) error {
+		ok, err := m.test(args[0], pairs[0].(*scheme.Pair).Car())
+		if ok {
+			tail = pairs[0]
+			return errStopMapping
+		}
+		return err
+	})
+	if err != nil && err != errStopMapping {
+		return nil, err
+	}
+	return tail, nil
+}
+
+// (any pred list1 list2 ...) returns the first true value of pred.
+func primAny(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var found scheme.Object = scheme.False
+	err := mapLists(args[1:], func(elems []scheme.Object) error {
+		result, err := m.apply(args[0], elems)
+		if err != nil {
+			return err
+		}
+		if scheme.IsTrue(result) {
+			found = result
+			return errStopMapping
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// (every pred list1 list2 ...) returns the last value of pred, or #f
+// if any is false.
+func primEvery(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var last scheme.Object = scheme.True
+	err := mapLists(args[1:], func(elems []scheme.Object) error {
+		var err error
+		if last, err = m.apply(args[0], elems); err != nil {
+			return err
+		}
+		if !scheme.IsTrue(last) {
+			return errStopMapping
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+func primListIndex(m *machine, args []scheme.Object) (scheme.Object, error) {
+	var index scheme.Object = scheme.False
+	i := 0
+	err := mapLists(args[1:], func(elems []scheme.Object) error {
+		ok, err := m.test(args[0], elems...)
+		if ok {
+			index = scheme.NewInteger(int64(i))
+			return errStopMapping
+		}
+		i++
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// span returns the longest prefix of a list whose elements satisfy a
+// predicate, or do not when negated, and the rest.
+func span(m *machine, args []scheme.Object, negated bool) ([]scheme.Object, scheme.Object, error) {
+	var head []scheme.Object
+	list := args[1]
+	t := tortoise{slow: list}
+	for {
+		pair, ok := list.(*scheme.Pair)
+		if !ok {
+			if list != scheme.EmptyList {
+				return nil, nil, wrongType("list", args[1])
+			}
+			return head, list, nil
+		}
+		ok, err := m.test(args[0], pair.Car())
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok == negated {
+			return head, list, nil
+		}
+		head = append(head, pair.Car())
+		list = pair.Cdr()
+		if t.meets(list) {
+			return nil, nil, wrongType("list", args[1])
+		}
+	}
+}
+
+func primTakeWhile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	head, _, err := span(m, args, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.list(head, scheme.EmptyList)
+}
+
+func primDropWhile(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, tail, err := span(m, args, false)
+	return tail, err
+}
+
+func spanValues(m *machine, args []scheme.Object, negated bool) (scheme.Object, error) {
+	head, tail, err := span(m, args, negated)
+	if err != nil {
+		return nil, err
+	}
+	list, err := m.list(head, scheme.EmptyList)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewValues(list, tail), nil
+}
+
+func primSpan(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return spanValues(m, args, false)
+}
+
+func primBreak(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return spanValues(m, args, true)
+}
+
+// (delete x list [=]) removes the elements e for which (= x e).
+func primDelete(m *machine, args []scheme.Object) (scheme.Object, error) {
+	equiv, err := userEquivalence(m, args)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := argList(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	var kept []scheme.Object
+	for _, elem := range elems {
+		same, err := equiv(args[0], elem)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			kept = append(kept, elem)
+		}
+	}
+	return m.list(kept, scheme.EmptyList)
+}
+
+// (delete-duplicates list [=]) keeps the first of equivalent elements.
+func primDeleteDuplicates(m *machine, args []scheme.Object) (scheme.Object, error) {
+	// userEquivalence takes the equivalence as the third argument.
+	equiv, err := userEquivalence(m, append([]scheme.Object{nil}, args...))
+	if err != nil {
+		return nil, err
+	}
+	elems, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var kept []scheme.Object
+	for _, elem := range elems {
+		found, err := containsBy(kept, func(k scheme.Object) (bool, error) { return equiv(k, elem) })
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			kept = append(kept, elem)
+		}
+	}
+	return m.list(kept, scheme.EmptyList)
+}
+
+// containsBy tells whether an element satisfies a Go predicate.
+func containsBy(elems []scheme.Object, pred func(scheme.Object) (bool, error)) (bool, error) {
+	for _, elem := range elems {
+		if ok, err := pred(elem); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// (alist-cons key datum alist)
+func primAlistCons(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.list([]scheme.Object{scheme.NewPair(args[0], args[1])}, args[2])
+}
+
+func primAlistCopy(m *machine, args []scheme.Object) (scheme.Object, error) {
+	entries, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	copies := make([]scheme.Object, len(entries))
+	for i := range entries {
+		pair, err := argPair(entries, i)
+		if err != nil {
+			return nil, err
+		}
+		copies[i] = scheme.NewPair(pair.Car(), pair.Cdr())
+	}
+	// the copies of the entries
+	if err := m.allocCells(len(entries)); err != nil {
+		return nil, err
+	}
+	return m.list(copies, scheme.EmptyList)
+}
+
+// (alist-delete key alist [=]) removes the entries e for which (= key
+// (car e)).
+func primAlistDelete(m *machine, args []scheme.Object) (scheme.Object, error) {
+	equiv, err := userEquivalence(m, args)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := argList(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	var kept []scheme.Object
+	for i, entry := range entries {
+		pair, err := argPair(entries, i)
+		if err != nil {
+			return nil, err
+		}
+		same, err := equiv(args[0], pair.Car())
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			kept = append(kept, entry)
+		}
+	}
+	return m.list(kept, scheme.EmptyList)
+}
+
+// lsets returns the lists given to an lset procedure after its
+// equivalence.
+func lsets(args []scheme.Object) ([][]scheme.Object, error) {
+	lists := make([][]scheme.Object, len(args)-1)
+	for i := range lists {
+		elems, err := argList(args, i+1)
+		if err != nil {
+			return nil, err
+		}
+		lists[i] = elems
+	}
+	return lists, nil
+}
+
+// lsetContains tells whether (= x e) for an element e of set.
+func lsetContains(m *machine, eq scheme.Object, set []scheme.Object, x scheme.Object) (bool, error) {
+	return containsBy(set, func(e scheme.Object) (bool, error) { return m.test(eq, x, e) })
+}
+
+// lsetSubset tells whether every element of a is in b.
+func lsetSubset(m *machine, eq scheme.Object, a, b []scheme.Object) (bool, error) {
+	for _, x := range a {
+		if ok, err := lsetContains(m, eq, b, x); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func primLsetLe(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lists, err := lsets(args)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(lists); i++ {
+		if ok, err := lsetSubset(m, args[0], lists[i-1], lists[i]); err != nil || !ok {
+			return scheme.False, err
+		}
+	}
+	return scheme.True, nil
+}
+
+func primLsetEq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lists, err := lsets(args)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(lists); i++ {
+		if ok, err := lsetSubset(m, args[0], lists[i-1], lists[i]); err != nil || !ok {
+			return scheme.False, err
+		}
+		if ok, err := lsetSubset(m, args[0], lists[i], lists[i-1]); err != nil || !ok {
+			return scheme.False, err
+		}
+	}
+	return scheme.True, nil
+}
+
+// lsetAdjoin conses the elements of elems onto set unless they are in
+// it already.
+func lsetAdjoin(m *machine, eq scheme.Object, set scheme.Object, elems []scheme.Object) (scheme.Object, error) {
+	for _, elem := range elems {
+		members, _, err := prefix(set)
+		if err != nil {
+			return nil, err
+		}
+		found, err := containsBy(members, func(e scheme.Object) (bool, error) { return m.test(eq, e, elem) })
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if set, err = primCons(m, []scheme.Object{elem, set}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return set, nil
+}
+
+// (lset-adjoin = list elt ...)
+func primLsetAdjoin(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if _, err := argList(args, 1); err != nil {
+		return nil, err
+	}
+	return lsetAdjoin(m, args[0], args[1], args[2:])
+}
+
+func primLsetUnion(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lists, err := lsets(args)
+	if err != nil {
+		return nil, err
+	}
+	var union scheme.Object = scheme.EmptyList
+	for i, elems := range lists {
+		switch {
+		case union == scheme.EmptyList:
+			union = args[i+1]
+		case len(elems) > 0 && args[i+1] != union:
+			if union, err = lsetAdjoin(m, args[0], union, elems); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return union, nil
+}
+
+// lsetDiffIntersection splits the elements of the first list by
+// whether they are in any of the others.
+func lsetDiffIntersection(m *machine, eq scheme.Object, lists [][]scheme.Object) (diff, inter []scheme.Object, err error) {
+	for _, x := range lists[0] {
+		found := false
+		for _, other := range lists[1:] {
+			if found, err = lsetContains(m, eq, other, x); err != nil {
+				return nil, nil, err
+			}
+			if found {
+				break
+			}
+		}
+		if found {
+			inter = append(inter, x)
+		} else {
+			diff = append(diff, x)
+		}
+	}
+	return diff, inter, nil
+}
+
+// (lset-intersection = list1 list2 ...) keeps the elements of list1
+// which are in all of the others.
+func primLsetIntersection(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lists, err := lsets(args)
+	if err != nil {
+		return nil, err
+	}
+	var kept []scheme.Object
+	for _, x := range lists[0] {
+		in := true
+		for _, other := range lists[1:] {
+			if in, err = lsetContains(m, args[0], other, x); err != nil {
+				return nil, err
+			}
+			if !in {
+				break
+			}
+		}
+		if in {
+			kept = append(kept, x)
+		}
+	}
+	return m.list(kept, scheme.EmptyList)
+}
+
+func primLsetDifference(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lists, err := lsets(args)
+	if err != nil {
+		return nil, err
+	}
+	diff, _, err := lsetDiffIntersection(m, args[0], lists)
+	if err != nil {
+		return nil, err
+	}
+	return m.list(diff, scheme.EmptyList)
+}
+
+func primLsetDiffIntersection(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lists, err := lsets(args)
+	if err != nil {
+		return nil, err
+	}
+	diff, inter, err := lsetDiffIntersection(m, args[0], lists)
+	if err != nil {
+		return nil, err
+	}
+	diffs, err := m.list(diff, scheme.EmptyList)
+	if err != nil {
+		return nil, err
+	}
+	inters, err := m.list(inter, scheme.EmptyList)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewValues(diffs, inters), nil
+}
+
+// primLsetXor folds the lists by the symmetric difference as the
+// reference implementation of SRFI 1, so that the order of the
+// elements is the same.
+func primLsetXor(m *machine, args []scheme.Object) (scheme.Object, error) {
+	lists, err := lsets(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) == 0 {
+		return scheme.EmptyList, nil
+	}
+	xor := args[1]
+	for _, b := range lists[1:] {
+		a, _, err := prefix(xor)
+		if err != nil {
+			return nil, err
+		}
+		aMinusB, aAndB, err := lsetDiffIntersection(m, args[0], [][]scheme.Object{a, b})
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(aMinusB) == 0:
+			bMinusA, _, err := lsetDiffIntersection(m, args[0], [][]scheme.Object{b, a})
+			if err != nil {
+				return nil, err
+			}
+			xor, err = m.list(bMinusA, scheme.EmptyList)
+			if err != nil {
+				return nil, err
+			}
+		case len(aAndB) == 0:
+			xor, err = m.list(b, xor)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			if xor, err = m.list(aMinusB, scheme.EmptyList); err != nil {
+				return nil, err
+			}
+			for _, x := range b {
+				found, err := lsetContains(m, args[0], aAndB, x)
+				if err != nil {
+					return nil, err
+				}
+				if !found {
+					if xor, err = primCons(m, []scheme.Object{x, xor}); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	return xor, nil
+}
@@ -0,0 +1,185 @@
+package gopische
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var symbolBuiltins = []builtin{
+	{"symbol?", 1, 1, primIsSymbol},
+	{"symbol=?", 1, -1, primSymbolEq},
+	{"symbol->string", 1, 1, primSymbolToString},
+	{"string->symbol", 1, 1, primStringToSymbol},
+}
+
+var stringBuiltins = []builtin{
+	{"string?", 1, 1, primIsString},
+	{"string-length", 1, 1, primStringLength},
+	{"string-append", 0, -1, primStringAppend},
+	{"substring", 2, 3, primSubstring},
+	{"string-copy", 1, 3, primSubstring},
+	{"string=?", 1, -1, stringCompare(func(c int) bool { return c == 0 })},
+	{"string<?", 1, -1, stringCompare(func(c int) bool { return c < 0 })},
+	{"string>?", 1, -1, stringCompare(func(c int) bool { return c > 0 })},
+	{"string<=?", 1, -1, stringCompare(func(c int) bool { return c <= 0 })},
+	{"string>=?", 1, -1, stringCompare(func(c int) bool { return c >= 0 })},
+}
+
+var charBuiltins = []builtin{
+	{"char?", 1, 1, primIsChar},
+	{"char->integer", 1, 1, primCharToInteger},
+	{"integer->char", 1, 1, primIntegerToChar},
+}
+
+// newString creates a string object, counting its size.
+func (m *machine) newString(s string) (scheme.Object, error) {
+	if err := m.allocString(len(s)); err != nil {
+		return nil, err
+	}
+	return scheme.NewString(s), nil
+}
+
+func primIsSymbol(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Symbol)
+	return scheme.NewBoolean(ok), nil
+}
+
+func primSymbolEq(m *machine, args []scheme.Object) (scheme.Object, error) {
+	first, err := argSymbol(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i++ {
+		sym, err := argSymbol(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if sym.Name() != first.Name() {
+			return scheme.False, nil
+		}
+	}
+	return scheme.True, nil
+}
+
+func primSymbolToString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	sym, err := argSymbol(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.newString(sym.Name())
+}
+
+func primStringToSymbol(m *machine, args []scheme.Object) (scheme.Object, error) {
+	s, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.interp.symbols.Intern(s), nil
+}
+
+func primIsString(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.String)
+	return scheme.NewBoolean(ok), nil
+}
+
+func primStringLength(m *machine, args []scheme.Object) (scheme.Object, error) {
+	s, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewInteger(int64(utf8.RuneCountInString(s))), nil
+}
+
+func primStringAppend(m *machine, args []scheme.Object) (scheme.Object, error) {
+	strs := make([]string, len(args))
+	size := 0
+	for i := range args {
+		var err error
+		if strs[i], err = argString(args, i); err != nil {
+			return nil, err
+		}
+		size += len(strs[i])
+	}
+	if err := m.allocString(size); err != nil {
+		return nil, err
+	}
+	return scheme.NewString(strings.Join(strs, "")), nil
+}
+
+// primSubstring implements both (substring string start end) and
+// (string-copy string [start [end]]).  Indexes count characters, not
+// bytes.
+func primSubstring(m *machine, args []scheme.Object) (scheme.Object, error) {
+	s, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	start, end := 0, len(runes)
+	if len(args) > 1 {
+		if start, err = argIndex(args, 1); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) > 2 {
+		if end, err = argIndex(args, 2); err != nil {
+			return nil, err
+		}
+	}
+	if start > end || end > len(runes) {
+		return nil, badArgument("index out of range, [%d, %d)", start, end)
+	}
+	return m.newString(string(runes[start:end]))
+}
+
+func stringCompare(ok func(int) bool) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		prev, err := argString(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		result := true
+		for i := 1; i < len(args); i++ {
+			s, err := argString(args, i)
+			if err != nil {
+				return nil, err
+			}
+			result = result && ok(strings.Compare(prev, s))
+			prev = s
+		}
+		return scheme.NewBoolean(result), nil
+	}
+}
+
+func argChar(args []scheme.Object, i int) (rune, error) {
+	if c, ok := args[i].(*scheme.Char); ok {
+		return c.Rune(), nil
+	}
+	return 0, wrongType("character", args[i])
+}
+
+func primIsChar(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Char)
+	return scheme.NewBoolean(ok), nil
+}
+
+func primCharToInteger(m *machine, args []scheme.Object) (scheme.Object, error) {
+	r, err := argChar(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewInteger(int64(r)), nil
+}
+
+func primIntegerToChar(m *machine, args []scheme.Object) (scheme.Object, error) {
+	n, err := argInteger(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > utf8.MaxRune || !utf8.ValidRune(rune(n)) {
+		return nil, badArgument("not a Unicode scalar value, %d", n)
+	}
+	return scheme.NewChar(rune(n)), nil
+}
@@ -0,0 +1,430 @@
+package gopische
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// textBuiltins are the string procedures of (gopische string), after
+// SRFI 13 and SRFI 130.  Indexes count characters, not bytes.  A
+// character or a predicate on characters stands for a character set.
+var textBuiltins = []builtin{
+	{"string-index", 2, 4, primStringIndex},
+	{"string-search-forward", 2, 3, primStringSearchForward},
+	{"string-contains", 2, 4, primStringContains},
+	{"string-prefix?", 2, 2, primIsStringPrefix},
+	{"string-suffix?", 2, 2, primIsStringSuffix},
+	{"string-join", 1, 3, primStringJoin},
+	{"string-split", 2, 4, primStringSplit},
+	{"string-tokenize", 1, 4, primStringTokenize},
+	{"string-trim", 1, 4, stringTrim(true, true)},
+	{"string-trim-left", 1, 4, stringTrim(true, false)},
+	{"string-trim-right", 1, 4, stringTrim(false, true)},
+	{"string-pad", 2, 5, stringPad(true)},
+	{"string-pad-right", 2, 5, stringPad(false)},
+	{"string-fold", 3, 5, primStringFold},
+}
+
+// argRunes returns a string argument as characters.
+func argRunes(args []scheme.Object, i int) ([]rune, error) {
+	s, err := argString(args, i)
+	if err != nil {
+		return nil, err
+	}
+	return []rune(s), nil
+}
+
+// charMatcher returns a function which tells whether a character
+// matches obj, a character or a predicate.
+func (m *machine) charMatcher(obj scheme.Object) (func(rune) (bool, error), error) {
+	switch v := obj.(type) {
+	case *scheme.Char:
+		c := v.Rune()
+		return func(r rune) (bool, error) { return r == c, nil }, nil
+	case *scheme.Procedure:
+		return func(r rune) (bool, error) { return m.test(v, scheme.NewChar(r)) }, nil
+	}
+	return nil, wrongType("character or predicate", obj)
+}
+
+// optionalMatcher returns the matcher of the argument at i, or the
+// one of whitespaces if it is missing.
+func (m *machine) optionalMatcher(args []scheme.Object, i int) (func(rune) (bool, error), error) {
+	if len(args) > i {
+		return m.charMatcher(args[i])
+	}
+	return func(r rune) (bool, error) { return unicode.IsSpace(r), nil }, nil
+}
+
+// indexOf returns the index of pattern in runes at or after start, or
+// -1.
+func indexOf(runes []rune, pattern []rune, start int) int {
+	for i := start; i+len(pattern) <= len(runes); i++ {
+		if slices.Equal(runes[i:i+len(pattern)], pattern) {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexObject(i int) scheme.Object {
+	if i < 0 {
+		return scheme.False
+	}
+	return scheme.NewInteger(int64(i))
+}
+
+// primStringIndex implements (string-index string char/pred [start
+// end]), which returns the index of the first matching character, or
+// #f.
+func primStringIndex(m *machine, args []scheme.Object) (scheme.Object, error) {
+	runes, err := argRunes(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	match, err := m.charMatcher(args[1])
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 2, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	for i := start; i < end; i++ {
+		ok, err := match(runes[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return scheme.NewInteger(int64(i)), nil
+		}
+	}
+	return scheme.False, nil
+}
+
+// primStringSearchForward implements (string-search-forward pattern
+// string [start]), which returns the index of pattern in string, or
+// #f.
+func primStringSearchForward(m *machine, args []scheme.Object) (scheme.Object, error) {
+	pattern, err := argRunes(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	runes, err := argRunes(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	start, _, err := argRange(args, 2, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	return indexObject(indexOf(runes, pattern, start)), nil
+}
+
+// primStringContains implements (string-contains string pattern
+// [start end]), which returns the index of pattern in the substring,
+// or #f.
+func primStringContains(m *machine, args []scheme.Object) (scheme.Object, error) {
+	runes, err := argRunes(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := argRunes(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 2, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	return indexObject(indexOf(runes[:end], pattern, start)), nil
+}
+
+// primIsStringPrefix implements (string-prefix? prefix string).
+func primIsStringPrefix(m *machine, args []scheme.Object) (scheme.Object, error) {
+	prefix, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := argString(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(strings.HasPrefix(s, prefix)), nil
+}
+
+// primIsStringSuffix implements (string-suffix? suffix string).
+func primIsStringSuffix(m *machine, args []scheme.Object) (scheme.Object, error) {
+	suffix, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := argString(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewBoolean(strings.HasSuffix(s, suffix)), nil
+}
+
+// argGrammar returns the optional grammar argument at i, which is one
+// of infix (the default), strict-infix, prefix and suffix.
+func argGrammar(args []scheme.Object, i int) (string, error) {
+	if len(args) <= i {
+		return "infix", nil
+	}
+	sym, err := argSymbol(args, i)
+	if err != nil {
+		return "", err
+	}
+	switch sym.Name() {
+	case "infix", "strict-infix", "prefix", "suffix":
+		return sym.Name(), nil
+	}
+	return "", badArgument("unknown grammar, %s", sym)
+}
+
+// primStringJoin implements (string-join list [delimiter [grammar]]).
+// The delimiter defaults to a space.
+func primStringJoin(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	strs := make([]string, len(elems))
+	for i := range elems {
+		if strs[i], err = argString(elems, i); err != nil {
+			return nil, err
+		}
+	}
+	delim := " "
+	if len(args) > 1 {
+		if delim, err = argString(args, 1); err != nil {
+			return nil, err
+		}
+	}
+	grammar, err := argGrammar(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.Join(strs, delim)
+	switch grammar {
+	case "strict-infix":
+		if len(strs) == 0 {
+			return nil, badArgument("empty list with strict-infix")
+		}
+	case "prefix":
+		if len(strs) > 0 {
+			s = delim + s
+		}
+	case "suffix":
+		if len(strs) > 0 {
+			s += delim
+		}
+	}
+	return m.newString(s)
+}
+
+// primStringSplit implements (string-split string delimiter [grammar
+// [limit]]), where delimiter is a string or a character.  An empty
+// delimiter splits string into characters.  At most limit splits are
+// made if it is given.
+func primStringSplit(m *machine, args []scheme.Object) (scheme.Object, error) {
+	s, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var delim string
+	if c, ok := args[1].(*scheme.Char); ok {
+		delim = string(c.Rune())
+	} else if delim, err = argString(args, 1); err != nil {
+		return nil, err
+	}
+	grammar, err := argGrammar(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	limit := -1
+	if len(args) > 3 {
+		if limit, err = argIndex(args, 3); err != nil {
+			return nil, err
+		}
+	}
+	if s == "" {
+		if grammar == "strict-infix" {
+			return nil, badArgument("empty string with strict-infix")
+		}
+		return scheme.EmptyList, nil
+	}
+	if grammar == "prefix" {
+		s = strings.TrimPrefix(s, delim)
+	}
+	if grammar == "suffix" {
+		s = strings.TrimSuffix(s, delim)
+	}
+	var parts []string
+	if limit < 0 {
+		parts = strings.Split(s, delim)
+	} else {
+		parts = strings.SplitN(s, delim, limit+1)
+	}
+	if err := m.allocString(len(s)); err != nil {
+		return nil, err
+	}
+	elems := make([]scheme.Object, len(parts))
+	for i, p := range parts {
+		elems[i] = scheme.NewString(p)
+	}
+	return m.list(elems, scheme.EmptyList)
+}
+
+// primStringTokenize implements (string-tokenize string [char/pred
+// [start end]]), which returns the maximal substrings of matching
+// characters.  They are the ones other than whitespaces by default.
+func primStringTokenize(m *machine, args []scheme.Object) (scheme.Object, error) {
+	runes, err := argRunes(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	match := func(r rune) (bool, error) { return !unicode.IsSpace(r), nil }
+	if len(args) > 1 {
+		if match, err = m.charMatcher(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	start, end, err := argRange(args, 2, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	var tokens []scheme.Object
+	from := -1
+	for i := start; i <= end; i++ {
+		ok := false
+		if i < end {
+			if ok, err = match(runes[i]); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case ok && from < 0:
+			from = i
+		case !ok && from >= 0:
+			token, err := m.newString(string(runes[from:i]))
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			from = -1
+		}
+	}
+	return m.list(tokens, scheme.EmptyList)
+}
+
+// stringTrim returns a primitive of (string-trim string [char/pred
+// [start end]]), which removes the matching characters, whitespaces
+// by default, from the left and/or the right of the substring.
+func stringTrim(left bool, right bool) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		runes, err := argRunes(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		match, err := m.optionalMatcher(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		start, end, err := argRange(args, 2, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		for left && start < end {
+			ok, err := match(runes[start])
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			start++
+		}
+		for right && start < end {
+			ok, err := match(runes[end-1])
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			end--
+		}
+		return m.newString(string(runes[start:end]))
+	}
+}
+
+// stringPad returns a primitive of (string-pad string n [char [start
+// end]]), which makes the substring n characters long by adding char,
+// a space by default, or by dropping characters.  string-pad works on
+// the left, and string-pad-right on the right.
+func stringPad(left bool) primitiveFunc {
+	return func(m *machine, args []scheme.Object) (scheme.Object, error) {
+		runes, err := argRunes(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		n, err := argIndex(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		pad := ' '
+		if len(args) > 2 {
+			if pad, err = argChar(args, 2); err != nil {
+				return nil, err
+			}
+		}
+		start, end, err := argRange(args, 3, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		if err := m.allocString(n); err != nil {
+			return nil, err
+		}
+		runes = runes[start:end]
+		if len(runes) >= n {
+			if left {
+				return scheme.NewString(string(runes[len(runes)-n:])), nil
+			}
+			return scheme.NewString(string(runes[:n])), nil
+		}
+		padding := strings.Repeat(string(pad), n-len(runes))
+		if left {
+			return scheme.NewString(padding + string(runes)), nil
+		}
+		return scheme.NewString(string(runes) + padding), nil
+	}
+}
+
+// primStringFold implements (string-fold kons knil string [start
+// end]), which calls (kons char acc) from the left.
+func primStringFold(m *machine, args []scheme.Object) (scheme.Object, error) {
+	kons, err := argProcedure(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	runes, err := argRunes(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 3, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	acc := args[1]
+	for _, r := range runes[start:end] {
+		if acc, err = m.apply(kons, []scheme.Object{scheme.NewChar(r), acc}); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
@@ -0,0 +1,247 @@
+package gopische
+
+import (
+	"slices"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var vectorBuiltins = []builtin{
+	{"vector?", 1, 1, primIsVector},
+	{"make-vector", 1, 2, primMakeVector},
+	{"vector", 0, -1, primVector},
+	{"vector-length", 1, 1, primVectorLength},
+	{"vector-ref", 2, 2, primVectorRef},
+	{"vector-set!", 3, 3, primVectorSet},
+	{"vector->list", 1, 3, primVectorToList},
+	{"list->vector", 1, 1, primListToVector},
+	{"vector-fill!", 2, 4, primVectorFill},
+	{"vector-copy", 1, 3, primVectorCopy},
+	{"vector-copy!", 3, 5, primVectorCopyTo},
+	{"vector-append", 0, -1, primVectorAppend},
+	{"vector-map", 2, -1, primVectorMap},
+	{"vector-for-each", 2, -1, primVectorForEach},
+}
+
+// newVector creates a vector holding elems, counting a cell for each
+// element.
+func (m *machine) newVector(elems []scheme.Object) (scheme.Object, error) {
+	if err := m.allocCells(len(elems)); err != nil {
+		return nil, err
+	}
+	return scheme.NewVector(elems), nil
+}
+
+func argVector(args []scheme.Object, i int) ([]scheme.Object, error) {
+	if v, ok := args[i].(*scheme.Vector); ok {
+		return v.Elements(), nil
+	}
+	return nil, wrongType("vector", args[i])
+}
+
+func primIsVector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	_, ok := args[0].(*scheme.Vector)
+	return scheme.NewBoolean(ok), nil
+}
+
+// (make-vector k [fill])
+func primMakeVector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	k, err := argIndex(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var fill scheme.Object = scheme.Unspecified
+	if len(args) > 1 {
+		fill = args[1]
+	}
+	if err := m.allocCells(k); err != nil {
+		return nil, err
+	}
+	elems := make([]scheme.Object, k)
+	for i := range elems {
+		elems[i] = fill
+	}
+	return scheme.NewVector(elems), nil
+}
+
+func primVector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	return m.newVector(append([]scheme.Object{}, args...))
+}
+
+func primVectorLength(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, err := argVector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewInteger(int64(len(v))), nil
+}
+
+func primVectorRef(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, err := argVector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	k, err := argIndex(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if k >= len(v) {
+		return nil, badArgument("index out of range, %d", k)
+	}
+	return v[k], nil
+}
+
+func primVectorSet(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, err := argVector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	k, err := argIndex(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if k >= len(v) {
+		return nil, badArgument("index out of range, %d", k)
+	}
+	v[k] = args[2]
+	return scheme.Unspecified, nil
+}
+
+// (vector->list vector [start [end]])
+func primVectorToList(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, err := argVector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 1, len(v))
+	if err != nil {
+		return nil, err
+	}
+	return m.list(v[start:end], scheme.EmptyList)
+}
+
+func primListToVector(m *machine, args []scheme.Object) (scheme.Object, error) {
+	elems, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.newVector(elems)
+}
+
+// (vector-fill! vector fill [start [end]])
+func primVectorFill(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, err := argVector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 2, len(v))
+	if err != nil {
+		return nil, err
+	}
+	for i := start; i < end; i++ {
+		v[i] = args[1]
+	}
+	return scheme.Unspecified, nil
+}
+
+// (vector-copy vector [start [end]])
+func primVectorCopy(m *machine, args []scheme.Object) (scheme.Object, error) {
+	v, err := argVector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 1, len(v))
+	if err != nil {
+		return nil, err
+	}
+	return m.newVector(slices.Clone(v[start:end]))
+}
+
+// (vector-copy! to at from [start [end]]), where the source and the
+// destination may overlap.
+func primVectorCopyTo(m *machine, args []scheme.Object) (scheme.Object, error) {
+	to, err := argVector(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	at, err := argIndex(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	from, err := argVector(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := argRange(args, 3, len(from))
+	if err != nil {
+		return nil, err
+	}
+	if at > len(to) || end-start > len(to)-at {
+		return nil, badArgument("index out of range, %d", at)
+	}
+	copy(to[at:], from[start:end])
+	return scheme.Unspecified, nil
+}
+
+func primVectorAppend(m *machine, args []scheme.Object) (scheme.Object, error) {
+	result := []scheme.Object{}
+	for i := range args {
+		v, err := argVector(args, i)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v...)
+	}
+	return m.newVector(result)
+}
+
+// mapVectors calls fn with the i-th elements of the vector arguments
+// from 1 until the shortest vector runs out.
+func mapVectors(args []scheme.Object, fn func([]scheme.Object) error) error {
+	vectors := make([][]scheme.Object, len(args)-1)
+	n := -1
+	for i := range vectors {
+		v, err := argVector(args, i+1)
+		if err != nil {
+			return err
+		}
+		vectors[i] = v
+		if n < 0 || len(v) < n {
+			n = len(v)
+		}
+	}
+	for k := 0; k < n; k++ {
+		elems := make([]scheme.Object, len(vectors))
+		for i, v := range vectors {
+			elems[i] = v[k]
+		}
+		if err := fn(elems); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func primVectorMap(m *machine, args []scheme.Object) (scheme.Object, error) {
+	results := []scheme.Object{}
+	err := mapVectors(args, func(elems []scheme.Object) error {
+		result, err := m.apply(args[0], elems)
+		results = append(results, result)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.newVector(results)
+}
+
+func primVectorForEach(m *machine, args []scheme.Object) (scheme.Object, error) {
+	err := mapVectors(args, func(elems []scheme.Object) error {
+		_, err := m.apply(args[0], elems)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
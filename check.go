@@ -0,0 +1,80 @@
+package gopische
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mnbi/gopische/lexer"
+	"github.com/mnbi/gopische/scheme"
+)
+
+// CheckError is an error found by Check, with the line where it is
+// found.
+type CheckError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// Check reads the expressions in src and expands them without
+// evaluating them, so that errors in the syntax are found before
+// running the code, e.g. by an editor.  The source is read from file,
+// which included files are relative to.  An error in reading stops
+// the check, but one in expanding does not.
+func (interp *Interpreter) Check(src string, file string) []*CheckError {
+	l, err := lexer.Analyze(src)
+	if err != nil {
+		var e *lexer.Error
+		errors.As(err, &e)
+		return []*CheckError{{File: file, Line: e.Line, Err: e.Err}}
+	}
+	p := &parser{l: l, file: file, symbols: interp.symbols}
+	x := &expander{interp: interp}
+
+	var errs []*CheckError
+	for {
+		tk, ok, err := p.next()
+		if err != nil {
+			return append(errs, &CheckError{File: file, Line: p.line, Err: err})
+		}
+		if !ok {
+			break
+		}
+		p.labels = nil
+		datum, err := p.parse(tk)
+		if err != nil {
+			return append(errs, &CheckError{File: file, Line: p.line, Err: err})
+		}
+		if _, err := x.expand(datum); err != nil {
+			line := tk.Line
+			var syntax *SyntaxError
+			if errors.As(err, &syntax) {
+				if pair, ok := syntax.Form.(*scheme.Pair); ok && pair.Location() != nil {
+					line = pair.Location().Line
+				}
+			}
+			errs = append(errs, &CheckError{File: file, Line: line, Err: err})
+		}
+	}
+	return errs
+}
+
+// Names returns the names of the variables in the global environment
+// in sorted order.
+func (interp *Interpreter) Names() []string {
+	names := make([]string, 0, len(interp.global.vars))
+	for name := range interp.global.vars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
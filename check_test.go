@@ -0,0 +1,41 @@
+// gopische/check_test.go
+
+package gopische
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		id       int
+		src      string
+		expected []int // the lines of the errors
+	}{
+		{1, "(define (f x) x)\n(f 1)", nil},
+		{2, "(define x 1)\n(if)\n(let ((x)) x)", []int{2, 3}},
+		{3, "(a\n  \"b", []int{2}},
+		{4, "(a)\n\n(b . c d)", []int{3}},
+		{5, "(define x\n  (lambda))", []int{2}},
+		{6, "(undefined-variable)", nil},
+	}
+
+	for _, tc := range tests {
+		var lines []int
+		for _, e := range New().Check(tc.src, "test.scm") {
+			if e.File != "test.scm" {
+				t.Fatalf("tests[%d] - wrong file, got=%s", tc.id, e.File)
+			}
+			lines = append(lines, e.Line)
+		}
+		if !slices.Equal(lines, tc.expected) {
+			t.Fatalf("tests[%d] - wrong lines, expected=%v, got=%v", tc.id, tc.expected, lines)
+		}
+	}
+
+	names := New().Names()
+	if !slices.IsSorted(names) || !slices.Contains(names, "car") {
+		t.Fatalf("wrong names, got=%v", names)
+	}
+}
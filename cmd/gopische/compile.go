@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mnbi/gopische"
+)
+
+// compileCommand precompiles the Scheme sources (.scm and .sld) in the given
+// files and directories into compiled code files.  It returns the
+// exit status.
+func compileCommand(paths []string) int {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	interp := gopische.New(gopische.WithLibraryPath(libraryPath("")...))
+	status := 0
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (filepath.Ext(path) != ".scm" && filepath.Ext(path) != ".sld") {
+				return nil
+			}
+			if err := interp.Compile(path); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				status = 1
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mnbi/gopische/dap"
+)
+
+// dapCommand runs a debug adapter over the standard input and
+// output.  It returns the exit status.
+func dapCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "usage: gopische dap\n")
+		return 2
+	}
+	if err := dap.Serve(os.Stdin, os.Stdout, libraryPath("")...); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mnbi/gopische/format"
+)
+
+// fmtCommand formats the Scheme sources in the given files, or the
+// standard input without files, and prints them.  With -w, it writes
+// them back to the files instead, and with -d, it prints their diffs.
+// It returns the exit status.
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the files instead of the standard output")
+	diff := flags.Bool("d", false, "print diffs instead of the formatted sources")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gopische fmt [-w] [-d] [file]...\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "cannot use -w with the standard input\n")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = formatFile("<standard input>", src, false, *diff)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			err = formatFile(path, src, *write, *diff)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// formatFile formats src read from path, and writes it back to path,
+// prints its diff, or prints it.
+func formatFile(path string, src []byte, write, diff bool) error {
+	res, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if diff && !bytes.Equal(src, res) {
+		fmt.Print(unifiedDiff(path, src, res))
+	}
+	if write && !bytes.Equal(src, res) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, res, info.Mode().Perm())
+	}
+	if !write && !diff {
+		_, err = os.Stdout.Write(res)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/mnbi/gopische"
+)
+
+// listen serves REPL sessions on the address given by -listen, after
+// loading the script if any.  It returns the exit status.
+func listen(args []string) int {
+	script := ""
+	if len(args) > 0 {
+		script = args[0]
+	}
+	interp := gopische.New(
+		gopische.WithCodeCache(!*noCacheFlag),
+		gopische.WithLibraryPath(libraryPath(script)...),
+		gopische.WithPrettyPrint(*prettyFlag),
+	)
+	if script != "" {
+		if err := interp.Load(script); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+	}
+
+	network, address := "tcp", *listenFlag
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", path
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	defer l.Close()
+	fmt.Fprintf(os.Stderr, "serving REPL sessions on %s\n", l.Addr())
+
+	server := &gopische.REPLServer{Interp: interp, Token: *tokenFlag, IdleTimeout: *idleFlag}
+	if err := server.Serve(l); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mnbi/gopische/lsp"
+)
+
+// lspCommand runs a language server over the standard input and
+// output.  It returns the exit status.
+func lspCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "usage: gopische lsp\n")
+		return 2
+	}
+	if err := lsp.Serve(os.Stdin, os.Stdout, libraryPath("")...); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
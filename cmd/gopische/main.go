@@ -1,19 +1,56 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/mnbi/gopische"
-	//	"github.com/mnbi/gopische/lexer"
 )
 
 var (
 	versionFlag = flag.Bool("v", false, "show version")
 	usageFlag   = flag.Bool("h", false, "show usage")
+	noCacheFlag = flag.Bool("no-cache", false, "do not use compiled code files (.gsc)")
+	prettyFlag  = flag.Int("pretty", 0, "pretty-print results in the REPL to fit in `width` columns")
+	listenFlag  = flag.String("listen", "", "serve REPL sessions on a TCP `address`, or on a Unix socket by unix:path")
+	tokenFlag   = flag.String("token", "", "require REPL sessions to send the `token` first")
+	idleFlag    = flag.Duration("idle-timeout", 0, "close REPL sessions idle for the `duration`")
+	includeDirs pathList
 )
 
+func init() {
+	flag.Var(&includeDirs, "I", "add a directory to the library search path")
+}
+
+// pathList is a flag which may be given more than once.
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, string(os.PathListSeparator))
+}
+
+func (p *pathList) Set(dir string) error {
+	*p = append(*p, dir)
+	return nil
+}
+
+// libraryPath returns the directories given by -I, then the ones in
+// GOPISCHE_PATH, and then the directory of the script.
+func libraryPath(script string) []string {
+	dirs := append([]string{}, includeDirs...)
+	if env := os.Getenv("GOPISCHE_PATH"); env != "" {
+		dirs = append(dirs, filepath.SplitList(env)...)
+	}
+	if script != "" {
+		return append(dirs, filepath.Dir(script))
+	}
+	return append(dirs, ".")
+}
+
 func main() {
 	flag.Usage = gopische.Usage
 	flag.Parse()
@@ -28,13 +65,49 @@ func main() {
 
 	args := flag.Args()
 
+	if len(args) > 0 && args[0] == "compile" {
+		os.Exit(compileCommand(args[1:]))
+	}
+
+	if len(args) > 0 && args[0] == "fmt" {
+		os.Exit(fmtCommand(args[1:]))
+	}
+
+	if len(args) > 0 && args[0] == "lsp" {
+		os.Exit(lspCommand(args[1:]))
+	}
+
+	if len(args) > 0 && args[0] == "dap" {
+		os.Exit(dapCommand(args[1:]))
+	}
+
+	if len(args) > 0 && args[0] == "nrepl" {
+		os.Exit(nreplCommand(args[1:]))
+	}
+
+	if *listenFlag != "" {
+		os.Exit(listen(args))
+	}
+
 	if len(args) > 0 {
-		fmt.Fprintf(os.Stderr, "ARGS:")
-		for _, arg := range args {
-			fmt.Fprintf(os.Stderr, " %s", arg)
+		interp := gopische.New(
+			gopische.WithCodeCache(!*noCacheFlag),
+			gopische.WithLibraryPath(libraryPath(args[0])...),
+		)
+		err := interp.Load(args[0])
+		var exit *gopische.ExitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.Code)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
 		}
-		fmt.Fprintf(os.Stderr, "\n")
 	} else {
-		gopische.Repl()
+		interp := gopische.New(
+			gopische.WithLibraryPath(libraryPath("")...),
+			gopische.WithPrettyPrint(*prettyFlag),
+		)
+		os.Exit(interp.Repl())
 	}
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/mnbi/gopische"
+	"github.com/mnbi/gopische/nrepl"
+)
+
+// nreplCommand serves the message-based REPL protocol over the
+// standard input and output, or on an address.  It returns the exit
+// status.
+func nreplCommand(args []string) int {
+	flags := flag.NewFlagSet("nrepl", flag.ExitOnError)
+	address := flags.String("listen", "", "serve on a TCP `address`, or on a Unix socket by unix:path")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gopische nrepl [-listen address]\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// Outside of evaluations, the output must not mix with messages.
+	interp := gopische.New(
+		gopische.WithStdout(os.Stderr),
+		gopische.WithLibraryPath(libraryPath("")...),
+	)
+	server := &nrepl.Server{Interp: interp}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	if *address == "" {
+		err = server.Serve(ctx, os.Stdin, os.Stdout)
+	} else {
+		network, addr := "tcp", *address
+		if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+			network, addr = "unix", path
+		}
+		var l net.Listener
+		if l, err = net.Listen(network, addr); err == nil {
+			fmt.Fprintf(os.Stderr, "serving nREPL on %s\n", l.Addr())
+			err = server.ServeListener(ctx, l)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,381 @@
+package gopische
+
+import (
+	"github.com/mnbi/gopische/scheme"
+)
+
+// opcode is an operation of the virtual machine.  The VM has an
+// operand stack; instructions push their results on it.
+type opcode uint8
+
+const (
+	opConst        opcode = iota // push consts[a]
+	opLocalRef                   // push the variable at the lexical address a, named consts[b]
+	opLocalSet                   // pop a value into the variable at a, push unspecified
+	opGlobalRef                  // push the global variable named consts[a]
+	opGlobalSet                  // pop a value into the global variable, push unspecified
+	opGlobalDefine               // pop a value and define the global variable, push unspecified
+	opPop                        // discard the top of the stack
+	opJump                       // jump to a
+	opJumpIfFalse                // pop a value, jump to a when it is #f
+	opClosure                    // push a closure of children[a]
+	opCall                       // call a procedure with a arguments
+	opTailCall                   // call a procedure with a arguments, in a tail position
+	opReturn                     // return the top of the stack to the caller
+	opEnter                      // pop a values into a new frame, for ((lambda ...) args)
+	opLeave                      // discard the innermost frame
+)
+
+var opcodeNames = [...]string{
+	opConst:        "CONST",
+	opLocalRef:     "LREF",
+	opLocalSet:     "LSET",
+	opGlobalRef:    "GREF",
+	opGlobalSet:    "GSET",
+	opGlobalDefine: "GDEF",
+	opPop:          "POP",
+	opJump:         "JUMP",
+	opJumpIfFalse:  "JUMPF",
+	opClosure:      "CLOSURE",
+	opCall:         "CALL",
+	opTailCall:     "TCALL",
+	opReturn:       "RETURN",
+	opEnter:        "ENTER",
+	opLeave:        "LEAVE",
+}
+
+func (op opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return "ILLEGAL"
+}
+
+type instruction struct {
+	op opcode
+	a  int32
+	b  int32
+}
+
+// A lexical address packs the depth of a frame and the index of a
+// variable in it.
+const addressShift = 16
+
+func lexicalAddress(depth int, index int) int32 {
+	return int32(depth<<addressShift | index)
+}
+
+func splitAddress(a int32) (depth int, index int) {
+	return int(a >> addressShift), int(a & (1<<addressShift - 1))
+}
+
+// code is a compiled lambda expression, or a compiled top-level
+// expression which has no parameters.
+type code struct {
+	name     string
+	nparams  int
+	rest     bool
+	instrs   []instruction
+	lines    []int32 // source line of each instruction, 0 if unknown
+	consts   []scheme.Object
+	children []*code
+	loc      *scheme.Location
+
+	// the names of the parameters, and of the variables of the frames
+	// which ENTER creates, for debuggers
+	params []string
+	scopes [][]string
+}
+
+func (c *code) arity() scheme.Arity {
+	return scheme.Arity{Required: c.nparams, Rest: c.rest}
+}
+
+// scope is the compile time view of a frame.
+type scope struct {
+	names []string
+	outer *scope
+}
+
+// resolve returns the lexical address of a variable.  It returns
+// false for a global variable.
+func (s *scope) resolve(name string) (int, int, bool) {
+	for depth := 0; s != nil; depth, s = depth+1, s.outer {
+		for i := len(s.names) - 1; i >= 0; i-- {
+			if s.names[i] == name {
+				return depth, i, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// compiler translates an expanded expression into code.  It assumes
+// the expression consists of the core forms, which the expander has
+// already checked.
+type compiler struct {
+	code *code
+	line int32
+}
+
+// compile translates a top-level expression.
+func compile(expr scheme.Object) (*code, error) {
+	return compileIn(expr, nil)
+}
+
+// compileIn translates an expression in the scope of local variables.
+func compileIn(expr scheme.Object, s *scope) (*code, error) {
+	c := &compiler{code: &code{}}
+	if x, ok := expr.(*scheme.Pair); ok {
+		c.code.loc = x.Location()
+	}
+	if err := c.compile(expr, s, true); err != nil {
+		return nil, err
+	}
+	return c.code, nil
+}
+
+func (c *compiler) emit(op opcode, a int32, b int32) int {
+	c.code.instrs = append(c.code.instrs, instruction{op: op, a: a, b: b})
+	c.code.lines = append(c.code.lines, c.line)
+	return len(c.code.instrs) - 1
+}
+
+// patch sets the target of a jump to the next instruction.
+func (c *compiler) patch(at int) {
+	c.code.instrs[at].a = int32(len(c.code.instrs))
+}
+
+func (c *compiler) constant(obj scheme.Object) int32 {
+	for i, k := range c.code.consts {
+		if k == obj {
+			return int32(i)
+		}
+	}
+	c.code.consts = append(c.code.consts, obj)
+	return int32(len(c.code.consts) - 1)
+}
+
+// compile emits instructions which push the value of expr.  In a tail
+// position, they return the value instead.
+func (c *compiler) compile(expr scheme.Object, s *scope, tail bool) error {
+	switch x := expr.(type) {
+	case *scheme.Symbol:
+		c.variableRef(x, s)
+	case *scheme.Pair:
+		if loc := x.Location(); loc != nil {
+			saved := c.line
+			c.line = int32(loc.Line)
+			defer func() { c.line = saved }()
+		}
+		var err error
+		switch keyword(x) {
+		case "quote":
+			c.emit(opConst, c.constant(cadr(x)), 0)
+		case "if":
+			return c.compileIf(x, s, tail)
+		case "define":
+			err = c.compileDefine(x, s)
+		case "set!":
+			err = c.compileSet(x, s)
+		case "lambda":
+			err = c.compileLambda(x, s)
+		case "begin":
+			body, _ := scheme.ListToSlice(x.Cdr())
+			return c.compileSequence(body, s, tail)
+		default:
+			return c.compileApplication(x, s, tail)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		c.emit(opConst, c.constant(expr), 0)
+	}
+	if tail {
+		c.emit(opReturn, 0, 0)
+	}
+	return nil
+}
+
+// keyword returns the name of the symbol at the head of a form, or
+// the empty string.
+func keyword(form *scheme.Pair) string {
+	if sym, ok := form.Car().(*scheme.Symbol); ok {
+		return sym.Name()
+	}
+	return ""
+}
+
+func (c *compiler) variableRef(sym *scheme.Symbol, s *scope) {
+	if depth, i, ok := s.resolve(sym.Name()); ok {
+		c.emit(opLocalRef, lexicalAddress(depth, i), c.constant(sym))
+	} else {
+		c.emit(opGlobalRef, c.constant(sym), 0)
+	}
+}
+
+func (c *compiler) compileSequence(body []scheme.Object, s *scope, tail bool) error {
+	if len(body) == 0 {
+		c.emit(opConst, c.constant(scheme.Unspecified), 0)
+		if tail {
+			c.emit(opReturn, 0, 0)
+		}
+		return nil
+	}
+	for _, e := range body[:len(body)-1] {
+		if err := c.compile(e, s, false); err != nil {
+			return err
+		}
+		c.emit(opPop, 0, 0)
+	}
+	return c.compile(body[len(body)-1], s, tail)
+}
+
+func (c *compiler) compileIf(x *scheme.Pair, s *scope, tail bool) error {
+	if err := c.compile(cadr(x), s, false); err != nil {
+		return err
+	}
+	jumpToElse := c.emit(opJumpIfFalse, 0, 0)
+	rest := cddr(x).(*scheme.Pair)
+	if err := c.compile(rest.Car(), s, tail); err != nil {
+		return err
+	}
+	jumpToEnd := -1
+	if !tail {
+		jumpToEnd = c.emit(opJump, 0, 0)
+	}
+	c.patch(jumpToElse)
+	if alt, ok := rest.Cdr().(*scheme.Pair); ok {
+		if err := c.compile(alt.Car(), s, tail); err != nil {
+			return err
+		}
+	} else {
+		c.emit(opConst, c.constant(scheme.Unspecified), 0)
+		if tail {
+			c.emit(opReturn, 0, 0)
+		}
+	}
+	if jumpToEnd >= 0 {
+		c.patch(jumpToEnd)
+	}
+	return nil
+}
+
+func (c *compiler) compileDefine(x *scheme.Pair, s *scope) error {
+	if s != nil {
+		return &SyntaxError{Form: x, Message: "definition in an expression context"}
+	}
+	if err := c.compileValue(caddr(x), cadr(x).(*scheme.Symbol), s); err != nil {
+		return err
+	}
+	c.emit(opGlobalDefine, c.constant(cadr(x)), 0)
+	return nil
+}
+
+func (c *compiler) compileSet(x *scheme.Pair, s *scope) error {
+	sym := cadr(x).(*scheme.Symbol)
+	if err := c.compileValue(caddr(x), sym, s); err != nil {
+		return err
+	}
+	if depth, i, ok := s.resolve(sym.Name()); ok {
+		c.emit(opLocalSet, lexicalAddress(depth, i), c.constant(sym))
+	} else {
+		c.emit(opGlobalSet, c.constant(sym), 0)
+	}
+	return nil
+}
+
+// compileValue compiles the value of a variable.  The code of a
+// lambda expression is named after the variable.
+func (c *compiler) compileValue(expr scheme.Object, sym *scheme.Symbol, s *scope) error {
+	if err := c.compile(expr, s, false); err != nil {
+		return err
+	}
+	if isForm(expr, "lambda") {
+		c.code.children[len(c.code.children)-1].name = sym.Name()
+	}
+	return nil
+}
+
+// formals returns the names of the parameters of a lambda expression.
+func formals(obj scheme.Object) (names []string, rest bool) {
+	for {
+		switch v := obj.(type) {
+		case *scheme.Symbol:
+			return append(names, v.Name()), true
+		case *scheme.Pair:
+			names = append(names, v.Car().(*scheme.Symbol).Name())
+			obj = v.Cdr()
+		default:
+			return names, false
+		}
+	}
+}
+
+func (c *compiler) compileLambda(x *scheme.Pair, s *scope) error {
+	names, rest := formals(cadr(x))
+	child := &compiler{code: &code{loc: x.Location(), rest: rest, params: names}, line: c.line}
+	child.code.nparams = len(names)
+	if rest {
+		child.code.nparams--
+	}
+	body, _ := scheme.ListToSlice(cddr(x))
+	if err := child.compileSequence(body, &scope{names: names, outer: s}, true); err != nil {
+		return err
+	}
+	c.code.children = append(c.code.children, child.code)
+	c.emit(opClosure, int32(len(c.code.children)-1), 0)
+	return nil
+}
+
+func (c *compiler) compileApplication(x *scheme.Pair, s *scope, tail bool) error {
+	args, ok := scheme.ListToSlice(x.Cdr())
+	if !ok {
+		return badSyntax(x)
+	}
+
+	// ((lambda (v ...) body...) e ...) binds variables without
+	// creating a closure, which is what let and its friends become.
+	if isForm(x.Car(), "lambda") {
+		lambda := x.Car().(*scheme.Pair)
+		names, rest := formals(cadr(lambda))
+		if !rest && len(names) == len(args) {
+			if err := c.compileEach(args, s); err != nil {
+				return err
+			}
+			c.code.scopes = append(c.code.scopes, names)
+			c.emit(opEnter, int32(len(args)), int32(len(c.code.scopes)-1))
+			body, _ := scheme.ListToSlice(cddr(lambda))
+			if err := c.compileSequence(body, &scope{names: names, outer: s}, tail); err != nil {
+				return err
+			}
+			if !tail {
+				c.emit(opLeave, 0, 0)
+			}
+			return nil
+		}
+	}
+
+	if err := c.compile(x.Car(), s, false); err != nil {
+		return err
+	}
+	if err := c.compileEach(args, s); err != nil {
+		return err
+	}
+	if tail {
+		c.emit(opTailCall, int32(len(args)), 0)
+	} else {
+		c.emit(opCall, int32(len(args)), 0)
+	}
+	return nil
+}
+
+func (c *compiler) compileEach(exprs []scheme.Object, s *scope) error {
+	for _, e := range exprs {
+		if err := c.compile(e, s, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package gopische
+
+import (
+	"github.com/mnbi/gopische/scheme"
+)
+
+// winder is an entry of the dynamic-wind stack.
+type winder struct {
+	before scheme.Object
+	after  scheme.Object
+	parent *winder
+	depth  int
+}
+
+func newWinder(before scheme.Object, after scheme.Object, parent *winder) *winder {
+	w := &winder{before: before, after: after, parent: parent, depth: 1}
+	if parent != nil {
+		w.depth = parent.depth + 1
+	}
+	return w
+}
+
+func (w *winder) level() int {
+	if w == nil {
+		return 0
+	}
+	return w.depth
+}
+
+// continuation is the body of a procedure created by call/cc.  A
+// continuation captured by the VM holds the state of the run where it
+// is created, so that it can be resumed any number of times.  One
+// created by the tree-walker has no state, and it can only escape to
+// its call/cc while the call is active.
+type continuation struct {
+	run     *vmRun // nil if created by the tree-walker
+	stack   []scheme.Object
+	frames  []vmFrame
+	code    *code
+	pc      int
+	env     *frame
+	global  *environment
+	ret     bool // true if call/cc is called in a tail position
+	winders *winder
+}
+
+func newContinuation(k *continuation) *scheme.Procedure {
+	return scheme.NewPrimitive("", scheme.Arity{Rest: true}, k)
+}
+
+// continuationInvoked carries values to a continuation through Go
+// functions between the invocation and the place which resumes it.
+type continuationInvoked struct {
+	k     *continuation
+	value scheme.Object
+}
+
+func (e *continuationInvoked) Error() string {
+	return "continuation invoked out of its extent"
+}
+
+// throw invokes a continuation from Go code.  The returned error must
+// be passed back to the caller as it is.
+func (m *machine) throw(k *continuation, args []scheme.Object) error {
+	if err := m.rewind(k.winders); err != nil {
+		return err
+	}
+	values := append([]scheme.Object(nil), args...)
+	return &continuationInvoked{k: k, value: scheme.NewValues(values...)}
+}
+
+// rewind runs the after thunks of the current dynamic extent and the
+// before thunks of the target one, to move into the target.
+func (m *machine) rewind(to *winder) error {
+	common, target := m.winders, to
+	for common.level() > target.level() {
+		common = common.parent
+	}
+	for target.level() > common.level() {
+		target = target.parent
+	}
+	for common != target {
+		common, target = common.parent, target.parent
+	}
+
+	for m.winders != common {
+		w := m.winders
+		m.winders = w.parent
+		if _, err := m.apply(w.after, nil); err != nil {
+			return err
+		}
+	}
+	var path []*winder
+	for w := to; w != common; w = w.parent {
+		path = append(path, w)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		if _, err := m.apply(path[i].before, nil); err != nil {
+			return err
+		}
+		m.winders = path[i]
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+// dap/server.go
+
+// Package dap implements a server of the Debug Adapter Protocol for
+// Scheme programs, which `gopische dap` runs over the standard input
+// and output.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mnbi/gopische"
+	"github.com/mnbi/gopische/scheme"
+)
+
+// threadID is the ID of the only thread, which runs the program.
+const threadID = 1
+
+var errNotStopped = errors.New("the program is not stopped")
+
+type server struct {
+	libraryPath []string
+	debugger    *gopische.Debugger
+
+	// the program, which starts when both launch and configurationDone
+	// are requested
+	program     string
+	stopOnEntry bool
+	launched    bool
+	configured  bool
+	cancel      context.CancelFunc
+	done        chan struct{} // closed when the program finishes
+
+	// While the program stops, its goroutine runs the functions sent
+	// to calls, until it receives a step from resume.
+	calls  chan func()
+	resume chan gopische.Step
+
+	// a function run after the response to a request is written
+	after func()
+
+	mu          sync.Mutex // guards the fields below
+	out         io.Writer
+	seq         int
+	stop        *gopische.Stop
+	terminating bool
+}
+
+type handler func(s *server, args json.RawMessage) (any, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":        handleInitialize,
+		"launch":            handleLaunch,
+		"setBreakpoints":    handleSetBreakpoints,
+		"configurationDone": handleConfigurationDone,
+		"threads":           handleThreads,
+		"stackTrace":        handleStackTrace,
+		"scopes":            handleScopes,
+		"variables":         handleVariables,
+		"evaluate":          handleEvaluate,
+		"continue":          handleStep(gopische.Continue),
+		"next":              handleStep(gopische.StepOver),
+		"stepIn":            handleStep(gopische.StepIn),
+		"stepOut":           handleStep(gopische.StepOut),
+		"pause":             handlePause,
+	}
+}
+
+// Serve reads requests from r and writes responses and events to w
+// until the client sends `disconnect` or r ends.  Libraries imported
+// by the program are searched in its directory, and then in
+// libraryPath.
+func Serve(r io.Reader, w io.Writer, libraryPath ...string) error {
+	s := &server{
+		out:         w,
+		libraryPath: libraryPath,
+		calls:       make(chan func()),
+		resume:      make(chan gopische.Step),
+	}
+	s.debugger = gopische.NewDebugger(s.stopped)
+	defer s.terminate()
+
+	br := bufio.NewReader(r)
+	for {
+		content, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return fmt.Errorf("bad message: %w", err)
+		}
+		if req.Command == "disconnect" {
+			s.terminate()
+			return s.reply(req, nil, nil)
+		}
+
+		var body any
+		h, ok := handlers[req.Command]
+		if ok {
+			body, err = h(s, req.Arguments)
+		} else {
+			err = fmt.Errorf("unknown command: %s", req.Command)
+		}
+		if err := s.reply(req, body, err); err != nil {
+			return err
+		}
+		if s.after != nil {
+			s.after()
+			s.after = nil
+		}
+	}
+}
+
+func (s *server) reply(req request, body any, err error) error {
+	res := response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		res.Message = err.Error()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	res.Seq = s.seq
+	return writeMessage(s.out, res)
+}
+
+func (s *server) event(name string, body any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	// A client gone is noticed by reading requests.
+	_ = writeMessage(s.out, event{Seq: s.seq, Type: "event", Event: name, Body: body})
+}
+
+// decode reads the arguments of a request.
+func decode[T any](args json.RawMessage) (T, error) {
+	var v T
+	if len(args) == 0 {
+		return v, nil
+	}
+	if err := json.Unmarshal(args, &v); err != nil {
+		return v, fmt.Errorf("bad arguments: %w", err)
+	}
+	return v, nil
+}
+
+func handleInitialize(s *server, args json.RawMessage) (any, error) {
+	s.after = func() { s.event("initialized", nil) }
+	return capabilities{SupportsConfigurationDoneRequest: true, SupportsEvaluateForHovers: true}, nil
+}
+
+func handleLaunch(s *server, args json.RawMessage) (any, error) {
+	a, err := decode[launchArguments](args)
+	if err != nil {
+		return nil, err
+	}
+	if a.Program == "" {
+		return nil, errors.New("no program to launch")
+	}
+	if s.launched {
+		return nil, errors.New("the program is already launched")
+	}
+	s.program, s.stopOnEntry, s.launched = a.Program, a.StopOnEntry, true
+	s.after = s.start
+	return nil, nil
+}
+
+func handleConfigurationDone(s *server, args json.RawMessage) (any, error) {
+	s.configured = true
+	s.after = s.start
+	return nil, nil
+}
+
+// start runs the program when it is launched and configured.
+func (s *server) start() {
+	if !s.launched || !s.configured || s.done != nil {
+		return
+	}
+	interp := gopische.New(
+		gopische.WithStdin(strings.NewReader("")),
+		gopische.WithStdout(&output{s: s, category: "stdout"}),
+		gopische.WithStderr(&output{s: s, category: "stderr"}),
+		gopische.WithLibraryPath(append([]string{filepath.Dir(s.program)}, s.libraryPath...)...),
+		gopische.WithDebugger(s.debugger),
+	)
+	if s.stopOnEntry {
+		s.debugger.Pause()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		load, _ := interp.Lookup("load")
+		_, err := interp.Apply(ctx, load, scheme.NewString(s.program))
+		code := 0
+		var exit *gopische.ExitError
+		switch {
+		case errors.As(err, &exit):
+			code = exit.Code
+		case err != nil:
+			code = 1
+			s.event("output", outputEvent{Category: "stderr", Output: err.Error() + "\n"})
+		}
+		s.event("exited", exitedEvent{ExitCode: code})
+		s.event("terminated", nil)
+	}()
+}
+
+// terminate stops the program and waits for it to finish.
+func (s *server) terminate() {
+	s.mu.Lock()
+	s.terminating = true
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if s.done == nil {
+		return
+	}
+	s.cancel()
+	if stop != nil {
+		s.resume <- gopische.Continue
+	}
+	<-s.done
+}
+
+// stopped is called in the goroutine of the program when it stops.
+func (s *server) stopped(stop *gopische.Stop) gopische.Step {
+	s.mu.Lock()
+	if s.terminating {
+		s.mu.Unlock()
+		return gopische.Continue
+	}
+	s.stop = stop
+	reason := stop.Reason
+	if s.stopOnEntry && reason == "pause" {
+		reason = "entry"
+	}
+	s.stopOnEntry = false
+	s.mu.Unlock()
+
+	s.event("stopped", stoppedEvent{Reason: reason, ThreadID: threadID, AllThreadsStopped: true})
+	for {
+		select {
+		case call := <-s.calls:
+			call()
+		case step := <-s.resume:
+			return step
+		}
+	}
+}
+
+// inspect calls fn with the stop of the program in its goroutine.
+func (s *server) inspect(fn func(stop *gopische.Stop) error) error {
+	s.mu.Lock()
+	stop := s.stop
+	s.mu.Unlock()
+	if stop == nil {
+		return errNotStopped
+	}
+	done := make(chan error)
+	s.calls <- func() { done <- fn(stop) }
+	return <-done
+}
+
+// output sends what the program writes to the client.
+type output struct {
+	s        *server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.s.event("output", outputEvent{Category: o.category, Output: string(p)})
+	return len(p), nil
+}
+
+func handleSetBreakpoints(s *server, args json.RawMessage) (any, error) {
+	a, err := decode[setBreakpointsArguments](args)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]int, len(a.Breakpoints))
+	result := setBreakpointsResponse{Breakpoints: []breakpoint{}}
+	for i, bp := range a.Breakpoints {
+		lines[i] = bp.Line
+		result.Breakpoints = append(result.Breakpoints, breakpoint{Verified: true, Line: bp.Line})
+	}
+	s.debugger.SetBreakpoints(a.Source.Path, lines)
+	return result, nil
+}
+
+func handleThreads(s *server, args json.RawMessage) (any, error) {
+	return threadsResponse{Threads: []thread{{ID: threadID, Name: "main"}}}, nil
+}
+
+// A stack frame and its local variables are referred to by the index
+// of the frame plus 1, which is valid while the program stops.
+
+// frame returns the stack frame of an ID.
+func frame(stop *gopische.Stop, id int) (*gopische.StackFrame, error) {
+	if id < 1 || id > len(stop.Frames) {
+		return nil, fmt.Errorf("no stack frame: %d", id)
+	}
+	return stop.Frames[id-1], nil
+}
+
+func handleStackTrace(s *server, args json.RawMessage) (any, error) {
+	a, err := decode[stackTraceArguments](args)
+	if err != nil {
+		return nil, err
+	}
+	var result stackTraceResponse
+	err = s.inspect(func(stop *gopische.Stop) error {
+		result.TotalFrames = len(stop.Frames)
+		result.StackFrames = []stackFrame{}
+		for i, f := range stop.Frames {
+			if i < a.StartFrame || (a.Levels > 0 && i >= a.StartFrame+a.Levels) {
+				continue
+			}
+			sf := stackFrame{ID: i + 1, Name: f.Name, Line: f.Line, Column: 1}
+			if f.File != "" {
+				path := f.File
+				if abs, err := filepath.Abs(path); err == nil {
+					path = abs
+				}
+				sf.Source = &source{Name: filepath.Base(path), Path: path}
+			}
+			result.StackFrames = append(result.StackFrames, sf)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func handleScopes(s *server, args json.RawMessage) (any, error) {
+	a, err := decode[scopesArguments](args)
+	if err != nil {
+		return nil, err
+	}
+	err = s.inspect(func(stop *gopische.Stop) error {
+		_, err := frame(stop, a.FrameID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scopesResponse{Scopes: []scope{{Name: "Locals", VariablesReference: a.FrameID}}}, nil
+}
+
+func handleVariables(s *server, args json.RawMessage) (any, error) {
+	a, err := decode[variablesArguments](args)
+	if err != nil {
+		return nil, err
+	}
+	result := variablesResponse{Variables: []variable{}}
+	err = s.inspect(func(stop *gopische.Stop) error {
+		f, err := frame(stop, a.VariablesReference)
+		if err != nil {
+			return err
+		}
+		for _, v := range f.Locals() {
+			result.Variables = append(result.Variables, variable{Name: v.Name, Value: scheme.Write(v.Value)})
+		}
+		return nil
+	})
+	return result, err
+}
+
+func handleEvaluate(s *server, args json.RawMessage) (any, error) {
+	a, err := decode[evaluateArguments](args)
+	if err != nil {
+		return nil, err
+	}
+	var result evaluateResponse
+	err = s.inspect(func(stop *gopische.Stop) error {
+		// the innermost frame by default
+		f, err := frame(stop, max(a.FrameID, 1))
+		if err != nil {
+			return err
+		}
+		value, err := stop.Eval(f, a.Expression)
+		if err != nil {
+			return err
+		}
+		result.Result = scheme.Write(value)
+		return nil
+	})
+	return result, err
+}
+
+// handleStep returns a handler which resumes the program by a step.
+func handleStep(step gopische.Step) handler {
+	return func(s *server, args json.RawMessage) (any, error) {
+		s.mu.Lock()
+		stop := s.stop
+		s.stop = nil
+		s.mu.Unlock()
+		if stop == nil {
+			return nil, errNotStopped
+		}
+		// The response goes before the next stopped event.
+		s.after = func() { s.resume <- step }
+		if step == gopische.Continue {
+			return continueResponse{AllThreadsContinued: true}, nil
+		}
+		return nil, nil
+	}
+}
+
+func handlePause(s *server, args json.RawMessage) (any, error) {
+	s.debugger.Pause()
+	return nil, nil
+}
@@ -0,0 +1,258 @@
+// gopische/dap/server_test.go
+
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client is a scripted client, which talks to a server over pipes.
+type client struct {
+	t        *testing.T
+	w        io.Writer
+	seq      int
+	messages chan map[string]any
+	output   strings.Builder
+}
+
+func newClient(t *testing.T) (*client, chan error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(inR, outW)
+		outW.Close()
+	}()
+
+	c := &client{t: t, w: inW, messages: make(chan map[string]any, 100)}
+	go func() {
+		defer close(c.messages)
+		r := bufio.NewReader(outR)
+		for {
+			content, err := readMessage(r)
+			if err != nil {
+				return
+			}
+			var msg map[string]any
+			if err := json.Unmarshal(content, &msg); err != nil {
+				t.Errorf("bad message: %s", content)
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { inW.Close() })
+	return c, served
+}
+
+func (c *client) send(command string, args any) int {
+	c.t.Helper()
+	c.seq++
+	req := map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args}
+	if err := writeMessage(c.w, req); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.seq
+}
+
+// next returns the next message except outputs, which are collected.
+func (c *client) next() map[string]any {
+	c.t.Helper()
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				c.t.Fatal("the server closed the connection")
+			}
+			if msg["event"] == "output" {
+				c.output.WriteString(msg["body"].(map[string]any)["output"].(string))
+				continue
+			}
+			return msg
+		case <-time.After(5 * time.Second):
+			c.t.Fatal("timeout")
+		}
+	}
+}
+
+// request sends a request and returns the body of its response.
+func (c *client) request(command string, args any) map[string]any {
+	c.t.Helper()
+	seq := c.send(command, args)
+	msg := c.next()
+	if msg["type"] != "response" || msg["request_seq"] != float64(seq) {
+		c.t.Fatalf("%s: unexpected message: %v", command, msg)
+	}
+	if msg["success"] != true {
+		c.t.Fatalf("%s: failed: %v", command, msg["message"])
+	}
+	body, _ := msg["body"].(map[string]any)
+	return body
+}
+
+// expectEvent waits for an event and returns its body.
+func (c *client) expectEvent(name string) map[string]any {
+	c.t.Helper()
+	msg := c.next()
+	if msg["type"] != "event" || msg["event"] != name {
+		c.t.Fatalf("expected %s event: %v", name, msg)
+	}
+	body, _ := msg["body"].(map[string]any)
+	return body
+}
+
+// where returns the name and the line of the innermost frame.
+func (c *client) where() (string, int) {
+	c.t.Helper()
+	frames := c.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	top := frames[0].(map[string]any)
+	return top["name"].(string), int(top["line"].(float64))
+}
+
+// locals returns the local variables of a frame.
+func (c *client) locals(frameID int) map[string]string {
+	c.t.Helper()
+	scopes := c.request("scopes", map[string]any{"frameId": frameID})["scopes"].([]any)
+	ref := scopes[0].(map[string]any)["variablesReference"]
+	vars := make(map[string]string)
+	for _, v := range c.request("variables", map[string]any{"variablesReference": ref})["variables"].([]any) {
+		v := v.(map[string]any)
+		vars[v["name"].(string)] = v["value"].(string)
+	}
+	return vars
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "main.scm")
+	src := strings.Join([]string{
+		"(define (square x)",
+		"  (* x x))",
+		"(define (sum-squares a b)",
+		"  (let ((s (square a)))",
+		"    (+ s (square b))))",
+		"(display (sum-squares 3 4))",
+		"(newline)",
+		"(display \"done\")",
+	}, "\n")
+	if err := os.WriteFile(program, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, served := newClient(t)
+	c.request("initialize", map[string]any{"adapterID": "gopische"})
+	c.expectEvent("initialized")
+	c.request("launch", map[string]any{"program": program})
+	bps := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []any{map[string]any{"line": 5}},
+	})["breakpoints"].([]any)
+	if len(bps) != 1 || bps[0].(map[string]any)["verified"] != true {
+		t.Errorf("unexpected breakpoints: %v", bps)
+	}
+	c.request("configurationDone", nil)
+
+	if reason := c.expectEvent("stopped")["reason"]; reason != "breakpoint" {
+		t.Errorf("stopped by %v, expected breakpoint", reason)
+	}
+	frames := c.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	var trace []string
+	for _, f := range frames {
+		f := f.(map[string]any)
+		trace = append(trace, fmt.Sprintf("%s:%v", f["name"], f["line"]))
+		if src, _ := f["source"].(map[string]any); src == nil || src["path"] != program {
+			t.Errorf("unexpected source of %v", f)
+		}
+	}
+	if got := strings.Join(trace, " "); got != "sum-squares:5 top level:6" {
+		t.Errorf("unexpected stack trace: %s", got)
+	}
+	vars := c.locals(1)
+	if vars["s"] != "9" || vars["a"] != "3" || vars["b"] != "4" || len(vars) != 3 {
+		t.Errorf("unexpected local variables: %v", vars)
+	}
+	result := c.request("evaluate", map[string]any{"expression": "(list s (* a b))", "frameId": 1})["result"]
+	if result != "(9 12)" {
+		t.Errorf("evaluated to %v, expected (9 12)", result)
+	}
+	if seq := c.send("evaluate", map[string]any{"expression": "(car s)", "frameId": 1}); c.next()["success"] != false {
+		t.Errorf("request %d: an error should fail", seq)
+	}
+
+	steps := []struct {
+		command string
+		name    string
+		line    int
+		locals  map[string]string
+	}{
+		{"stepIn", "square", 2, map[string]string{"x": "4"}},
+		{"stepOut", "sum-squares", 5, map[string]string{"s": "9", "a": "3", "b": "4"}},
+		{"next", "top level", 6, map[string]string{}},
+		{"next", "top level", 7, map[string]string{}},
+		{"next", "top level", 8, map[string]string{}},
+	}
+	for i, tt := range steps {
+		c.request(tt.command, map[string]any{"threadId": 1})
+		if reason := c.expectEvent("stopped")["reason"]; reason != "step" {
+			t.Errorf("steps[%d] - stopped by %v, expected step", i, reason)
+		}
+		if name, line := c.where(); name != tt.name || line != tt.line {
+			t.Errorf("steps[%d] - stopped at %s:%d, expected %s:%d", i, name, line, tt.name, tt.line)
+		}
+		if vars := c.locals(1); !maps.Equal(vars, tt.locals) {
+			t.Errorf("steps[%d] - unexpected local variables: %v", i, vars)
+		}
+	}
+
+	c.request("continue", map[string]any{"threadId": 1})
+	if code := c.expectEvent("exited")["exitCode"]; code != float64(0) {
+		t.Errorf("exited with %v", code)
+	}
+	c.expectEvent("terminated")
+	if got := c.output.String(); got != "25\ndone" {
+		t.Errorf("unexpected output: %q", got)
+	}
+	c.request("disconnect", nil)
+	if err := <-served; err != nil {
+		t.Errorf("fail to serve: %s", err)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "loop.scm")
+	if err := os.WriteFile(program, []byte("(let loop ()\n  (loop))\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, served := newClient(t)
+	c.request("initialize", nil)
+	c.expectEvent("initialized")
+	c.request("configurationDone", nil)
+	c.request("launch", map[string]any{"program": program, "stopOnEntry": true})
+	if reason := c.expectEvent("stopped")["reason"]; reason != "entry" {
+		t.Errorf("stopped by %v, expected entry", reason)
+	}
+	if name, line := c.where(); name != "top level" || line != 1 {
+		t.Errorf("stopped at %s:%d, expected top level:1", name, line)
+	}
+
+	// The program, which never ends, is interrupted.
+	c.send("disconnect", nil)
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("fail to serve: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,276 @@
+package gopische
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// Step tells a debugger how an evaluation goes on after it stops.
+type Step int
+
+const (
+	// Continue runs until a breakpoint.
+	Continue Step = iota
+	// StepIn stops at the next line, in a called procedure too.
+	StepIn
+	// StepOver stops at the next line of the same procedure, or in
+	// its caller after it returns.
+	StepOver
+	// StepOut stops in the caller after the procedure returns.
+	StepOut
+)
+
+// Debugger stops evaluations on the VM at breakpoints and after
+// steps, and calls a function which inspects them while they stop.
+// The tree walker does not support debuggers.
+type Debugger struct {
+	stopped func(s *Stop) Step
+
+	mu          sync.Mutex
+	breakpoints map[string]map[int]bool // lines by absolute paths of files
+	paths       map[string]string       // absolute paths of files
+	pause       bool
+
+	// the step which goes on, and where it started
+	step  Step
+	depth int
+	code  *code
+	at    int32
+
+	// whether Stop.Eval is running, which never stops
+	evaluating bool
+}
+
+// NewDebugger returns a debugger which calls stopped whenever an
+// evaluation stops.  The evaluation waits for stopped to return, and
+// then goes on by the step which it returns.
+func NewDebugger(stopped func(s *Stop) Step) *Debugger {
+	return &Debugger{
+		stopped:     stopped,
+		breakpoints: make(map[string]map[int]bool),
+		paths:       make(map[string]string),
+	}
+}
+
+// WithDebugger attaches a debugger to the evaluations of an
+// interpreter.
+func WithDebugger(d *Debugger) Option {
+	return func(interp *Interpreter) {
+		interp.debugger = d
+	}
+}
+
+// SetBreakpoints replaces the breakpoints in a source file by the
+// lines, which count from 1.
+func (d *Debugger) SetBreakpoints(file string, lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	set := make(map[int]bool)
+	for _, line := range lines {
+		set[line] = true
+	}
+	d.breakpoints[d.absPath(file)] = set
+}
+
+// Pause stops the evaluation at the next line.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pause = true
+}
+
+// absPath returns the absolute path of a file, which is cached since
+// it is needed whenever a line starts.
+func (d *Debugger) absPath(file string) string {
+	if abs, ok := d.paths[file]; ok {
+		return abs
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		abs = filepath.Clean(file)
+	}
+	d.paths[file] = abs
+	return abs
+}
+
+// line is called by the VM before it runs the first instruction of a
+// line, or the instruction after a call which has returned.  It stops
+// the evaluation if it should.
+func (d *Debugger) line(vm *vm, returned bool) {
+	line := vm.code.lines[vm.pc]
+	if line == 0 || d.evaluating {
+		return
+	}
+	depth := vm.m.depth
+	// the start of a top-level expression
+	toplevel := vm.pc == 0 && vm.env == nil
+	// A return to the middle of a line is only where a step ends.
+	next := !returned || vm.pc > 0 && vm.code.lines[vm.pc-1] != line
+
+	d.mu.Lock()
+	var reason string
+	if loc := vm.code.loc; next && loc != nil && d.breakpoints[d.absPath(loc.File)][int(line)] {
+		reason = "breakpoint"
+	} else if next && d.pause {
+		reason = "pause"
+	} else {
+		var stop bool
+		switch d.step {
+		case StepIn:
+			stop = next || depth < d.depth
+		case StepOver:
+			stop = depth < d.depth || next && depth == d.depth && (vm.code == d.code && line != d.at || toplevel)
+		case StepOut:
+			stop = depth < d.depth || depth == d.depth && toplevel
+		}
+		if stop {
+			reason = "step"
+		}
+	}
+	if reason == "" {
+		d.mu.Unlock()
+		return
+	}
+	d.pause = false
+	d.mu.Unlock()
+
+	step := d.stopped(&Stop{Reason: reason, Frames: vm.stackFrames(), m: vm.m})
+
+	d.mu.Lock()
+	d.step, d.depth, d.code, d.at = step, depth, vm.code, line
+	d.mu.Unlock()
+}
+
+// Stop is an evaluation stopped by a debugger.
+type Stop struct {
+	// Reason is "breakpoint", "step" or "pause".
+	Reason string
+	// Frames are the frames of the procedures being called, the
+	// innermost first.
+	Frames []*StackFrame
+
+	m *machine
+}
+
+// StackFrame is an activation of a procedure, or of a top-level
+// expression.
+type StackFrame struct {
+	Name string
+	File string // "" if unknown
+	Line int    // 0 if unknown
+
+	env    *frame
+	global *environment
+}
+
+// Variable is a local variable of a stack frame.
+type Variable struct {
+	Name  string
+	Value scheme.Object
+}
+
+// stackFrames returns the frames of the current run and of the outer
+// runs, which saved their registers.
+func (vm *vm) stackFrames() []*StackFrame {
+	frames := []*StackFrame{newStackFrame(vm.code, vm.pc, vm.env, vm.global)}
+	i := len(vm.frames) - 1
+	for r := vm.run; r != nil; r = r.parent {
+		for ; i >= r.fbase; i-- {
+			// The pc of a frame is after the call.
+			if f := vm.frames[i]; f.kind == returnFrame {
+				frames = append(frames, newStackFrame(f.code, f.pc-1, f.env, f.global))
+			}
+		}
+		if r.code != nil {
+			frames = append(frames, newStackFrame(r.code, r.pc-1, r.env, r.global))
+		}
+	}
+	return frames
+}
+
+func newStackFrame(c *code, pc int, env *frame, global *environment) *StackFrame {
+	f := &StackFrame{Name: c.name, env: env, global: global}
+	if f.Name == "" {
+		f.Name = "top level"
+	}
+	if c.loc != nil {
+		f.File = c.loc.File
+	}
+	if pc >= 0 && pc < len(c.lines) {
+		f.Line = int(c.lines[pc])
+	}
+	return f
+}
+
+// Locals returns the local variables visible in a frame, the innermost
+// first.  Variables not initialized yet are left out.
+func (f *StackFrame) Locals() []Variable {
+	var vars []Variable
+	seen := make(map[string]bool)
+	for env := f.env; env != nil; env = env.outer {
+		for i, name := range env.names {
+			if seen[name] || i >= len(env.vars) {
+				continue
+			}
+			seen[name] = true
+			if value := env.vars[i]; value != scheme.Undefined {
+				vars = append(vars, Variable{Name: name, Value: value})
+			}
+		}
+	}
+	return vars
+}
+
+// scope returns the compile time view of the frames of a stack frame.
+func (f *StackFrame) scope() *scope {
+	var scopes []*scope
+	for env := f.env; env != nil; env = env.outer {
+		scopes = append(scopes, &scope{names: env.names})
+	}
+	for i := 0; i+1 < len(scopes); i++ {
+		scopes[i].outer = scopes[i+1]
+	}
+	if len(scopes) == 0 {
+		return nil
+	}
+	return scopes[0]
+}
+
+// Eval evaluates expressions in a stack frame, where its local
+// variables are visible, and returns the value of the last one.  It
+// must be called before the stopped function returns, in the same
+// goroutine.  Breakpoints are ignored while it runs.
+func (s *Stop) Eval(f *StackFrame, src string) (scheme.Object, error) {
+	m := s.m
+	interp := m.interp
+	data, err := read(src, "", interp.symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	interp.debugger.evaluating = true
+	unwound := m.unwound
+	defer func() {
+		interp.debugger.evaluating = false
+		m.unwound = unwound
+	}()
+
+	x := &expander{interp: interp}
+	return interp.run(m, len(data), func(i int) (scheme.Object, error) {
+		expr, err := x.expand(data[i])
+		if err != nil {
+			return nil, err
+		}
+		c, err := compileIn(expr, f.scope())
+		if err != nil {
+			return nil, err
+		}
+		return m.vm.execute(func() (bool, scheme.Object, error) {
+			vm := m.vm
+			vm.code, vm.pc, vm.env, vm.global = c, 0, f.env, f.global
+			return false, nil, nil
+		})
+	})
+}
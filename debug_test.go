@@ -0,0 +1,111 @@
+// gopische/debug_test.go
+
+package gopische
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestDebugger(t *testing.T) {
+	src := strings.Join([]string{
+		"(define (fact n)",
+		"  (if (= n 0)",
+		"      1",
+		"      (* n (fact (- n 1)))))",
+		"(define (loop i acc)",
+		"  (let ((acc (+ acc i)))",
+		"    (if (< i 3)",
+		"        (loop (+ i 1) acc)",
+		"        acc)))",
+		"(fact 2)",
+		"(loop 1 0)",
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "test.scm")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id          int
+		breakpoints []int
+		steps       []Step
+		expected    []string // the lines and the locals where it stops
+	}{
+		{1, []int{3, 4}, nil, []string{"fact:4 n=2", "fact:4 n=1"}},
+		{2, []int{2}, nil, []string{"fact:2 n=2", "fact:2 n=1", "fact:2 n=0"}},
+		{3, []int{7}, nil, []string{"loop:7 acc=1 i=1", "loop:7 acc=3 i=2", "loop:7 acc=6 i=3"}},
+		{4, []int{10}, []Step{StepIn, StepOver, StepIn, StepOut},
+			[]string{"top level:10", "fact:2 n=2", "fact:4 n=2", "fact:2 n=1", "fact:4 n=2"}},
+		{5, []int{10}, []Step{StepOver, StepOver}, []string{"top level:10", "top level:11"}},
+		{6, []int{7}, []Step{StepOver, StepOver, StepOut},
+			[]string{"loop:7 acc=1 i=1", "loop:8 acc=1 i=1", "loop:6 i=2 acc=1", "loop:7 acc=3 i=2", "loop:7 acc=6 i=3"}},
+	}
+
+	for _, tc := range tests {
+		var stops []string
+		d := NewDebugger(func(s *Stop) Step {
+			f := s.Frames[0]
+			stop := fmt.Sprintf("%s:%d", f.Name, f.Line)
+			for _, v := range f.Locals() {
+				stop += fmt.Sprintf(" %s=%s", v.Name, scheme.Write(v.Value))
+			}
+			stops = append(stops, stop)
+			if len(stops) <= len(tc.steps) {
+				return tc.steps[len(stops)-1]
+			}
+			return Continue
+		})
+		d.SetBreakpoints(path, tc.breakpoints)
+		if err := New(WithDebugger(d)).Load(path); err != nil {
+			t.Fatalf("tests[%d] - %s", tc.id, err)
+		}
+		if !slices.Equal(stops, tc.expected) {
+			t.Errorf("tests[%d] - wrong stops, expected=%q, got=%q", tc.id, tc.expected, stops)
+		}
+	}
+}
+
+func TestStopEval(t *testing.T) {
+	var results []string
+	d := NewDebugger(func(s *Stop) Step {
+		if f := s.Frames[0]; f.Name != "f" || f.Line != 3 {
+			return StepIn
+		}
+		for _, src := range []string{"(+ x y)", "(set! x 10) x", "(car x)", "(define z 1)"} {
+			value, err := s.Eval(s.Frames[0], src)
+			if err != nil {
+				results = append(results, "error")
+				continue
+			}
+			results = append(results, scheme.Write(value))
+		}
+		return Continue
+	})
+	d.Pause()
+
+	path := filepath.Join(t.TempDir(), "test.scm")
+	src := "(define (f x)\n  (let ((y 2))\n    (* x y)))\n(define value (f 3))"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	interp := New(WithDebugger(d))
+	if err := interp.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := interp.Lookup("value")
+	expected := []string{"5", "10", "error", "error"}
+	if !slices.Equal(results, expected) {
+		t.Errorf("wrong results, expected=%q, got=%q", expected, results)
+	}
+	// The assignment has changed the variable of the frame.
+	if scheme.Write(value) != "20" {
+		t.Errorf("wrong value, expected=20, got=%s", value)
+	}
+}
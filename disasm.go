@@ -0,0 +1,97 @@
+package gopische
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// disassemble writes the instructions of code in a readable form,
+// followed by the codes of lambda expressions in it.
+func disassemble(w io.Writer, c *code, title string) {
+	header := title
+	if c.nparams > 0 || c.rest {
+		header += fmt.Sprintf(" (params: %d", c.nparams)
+		if c.rest {
+			header += ", rest"
+		}
+		header += ")"
+	}
+	if c.loc != nil {
+		header += " at " + c.loc.String()
+	}
+	fmt.Fprintf(w, "; %s\n", header)
+
+	for pc, ins := range c.instrs {
+		line := fmt.Sprintf("%4d  %-8s%s", pc, ins.op, operands(c, ins))
+		fmt.Fprint(w, strings.TrimRight(line, " "))
+		if c.lines[pc] > 0 && (pc == 0 || c.lines[pc] != c.lines[pc-1]) {
+			fmt.Fprintf(w, "\t; line %d", c.lines[pc])
+		}
+		fmt.Fprintln(w)
+	}
+	for i, child := range c.children {
+		fmt.Fprintln(w)
+		disassemble(w, child, fmt.Sprintf("%s/%d", title, i))
+	}
+}
+
+func operands(c *code, ins instruction) string {
+	switch ins.op {
+	case opConst, opGlobalRef, opGlobalSet, opGlobalDefine:
+		return c.consts[ins.a].String()
+	case opLocalRef, opLocalSet:
+		depth, i := splitAddress(ins.a)
+		return fmt.Sprintf("%d.%d %s", depth, i, c.consts[ins.b])
+	case opJump, opJumpIfFalse, opCall, opTailCall, opEnter:
+		return fmt.Sprint(ins.a)
+	case opClosure:
+		return fmt.Sprintf("#%d", ins.a)
+	}
+	return ""
+}
+
+// disassembleDatum writes the code of a procedure bound to a symbol,
+// or the code compiled from an expression.
+func (interp *Interpreter) disassembleDatum(w io.Writer, datum scheme.Object) error {
+	if sym, ok := datum.(*scheme.Symbol); ok {
+		if value, ok := interp.global.lookup(sym.Name()); ok {
+			if proc, ok := value.(*scheme.Procedure); ok {
+				if impl, ok := proc.Impl().(*vmClosure); ok {
+					disassemble(w, impl.code, sym.Name())
+					return nil
+				}
+			}
+		}
+	}
+	x := &expander{interp: interp}
+	expr, err := x.expand(datum)
+	if err != nil {
+		return err
+	}
+	c, err := compile(expr)
+	if err != nil {
+		return err
+	}
+	disassemble(w, c, "toplevel")
+	return nil
+}
+
+// Disassemble returns the bytecode which the expression in src is
+// compiled into.  For a variable bound to a compiled procedure, it
+// returns the code of the procedure.
+func (interp *Interpreter) Disassemble(src string) (string, error) {
+	data, err := read(src, "", interp.symbols)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, datum := range data {
+		if err := interp.disassembleDatum(&sb, datum); err != nil {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
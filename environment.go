@@ -0,0 +1,64 @@
+package gopische
+
+import (
+	"github.com/mnbi/gopische/scheme"
+)
+
+// environment holds variable bindings of a frame.  The global
+// environment is the outermost one, which has no outer frame.
+type environment struct {
+	vars  map[string]*binding
+	outer *environment
+}
+
+// binding is the location of a variable.  Importing a library shares
+// bindings between environments, so that the importer sees the
+// assignments in the library.
+type binding struct {
+	value scheme.Object
+}
+
+func newEnvironment(outer *environment) *environment {
+	return &environment{vars: make(map[string]*binding), outer: outer}
+}
+
+// lookup searches a variable from the innermost frame to the global
+// one.
+func (env *environment) lookup(name string) (scheme.Object, bool) {
+	if b := env.binding(name); b != nil {
+		return b.value, true
+	}
+	return nil, false
+}
+
+// binding returns the binding of a variable, or nil.
+func (env *environment) binding(name string) *binding {
+	for e := env; e != nil; e = e.outer {
+		if b, ok := e.vars[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// define binds a variable in the frame.  A variable already bound in
+// the frame gets a new binding, which leaves the old one to the
+// environments which share it.
+func (env *environment) define(name string, value scheme.Object) {
+	env.vars[name] = &binding{value: value}
+}
+
+// alias binds a variable to an existing binding.
+func (env *environment) alias(name string, b *binding) {
+	env.vars[name] = b
+}
+
+// set modifies the value of a bound variable.  It returns false when
+// the variable is not bound.
+func (env *environment) set(name string, value scheme.Object) bool {
+	if b := env.binding(name); b != nil {
+		b.value = value
+		return true
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package gopische
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// primitiveFunc is the signature of procedures implemented in Go.
+type primitiveFunc func(m *machine, args []scheme.Object) (scheme.Object, error)
+
+// primitive is the body of a procedure implemented in Go.
+type primitive struct {
+	fn  primitiveFunc
+	ctl controlKind // how the VM calls it, see builtin_control.go
+}
+
+// closure is the body of a procedure created by a lambda expression.
+type closure struct {
+	params []string
+	rest   string // empty if the procedure has no rest parameter
+	body   []scheme.Object
+	env    *environment
+}
+
+// argumentError is returned by a primitive when it is given a wrong
+// argument.  The name of the primitive is prepended to the message
+// when the error leaves the primitive.
+type argumentError struct {
+	msg string
+}
+
+func (e *argumentError) Error() string {
+	return e.msg
+}
+
+func wrongType(expected string, obj scheme.Object) error {
+	emsg := fmt.Sprintf("wrong type argument, expected %s, got %s", expected, obj)
+	return &argumentError{msg: emsg}
+}
+
+func badArgument(format string, a ...any) error {
+	return &argumentError{msg: fmt.Sprintf(format, a...)}
+}
+
+// machine holds the state of an evaluation started by Eval or
+// EvalObject.
+type machine struct {
+	interp *Interpreter
+	ctx    context.Context
+
+	// resources consumed so far, see limits.go
+	steps       int64
+	depth       int
+	cells       int64
+	stringBytes int64
+
+	vm      *vm
+	winders *winder // the dynamic-wind stack
+	unwound *winder // the dynamic-wind stack where an error is raised
+
+	// the environment of the running top-level expression, which
+	// `import` binds variables in
+	toplevel *environment
+}
+
+func newMachine(interp *Interpreter, ctx context.Context) *machine {
+	m := &machine{interp: interp, ctx: ctx}
+	m.vm = &vm{m: m}
+	return m
+}
+
+// eval evaluates an expanded expression in env.
+func (m *machine) eval(expr scheme.Object, env *environment) (scheme.Object, error) {
+	if err := m.enter(); err != nil {
+		return nil, err
+	}
+	value, err := m.exec(expr, env)
+	m.leave()
+	return value, err
+}
+
+// exec is the body of eval.  Expressions in tail positions are
+// evaluated in the loop, so that tail calls do not consume the Go
+// stack.
+func (m *machine) exec(expr scheme.Object, env *environment) (scheme.Object, error) {
+	for {
+		if err := m.step(); err != nil {
+			return nil, err
+		}
+		switch x := expr.(type) {
+		case *scheme.Symbol:
+			return m.lookup(x, env)
+		case *scheme.Pair:
+			if sym, ok := x.Car().(*scheme.Symbol); ok {
+				switch sym.Name() {
+				case "quote":
+					return cadr(x), nil
+				case "if":
+					test, err := m.eval(cadr(x), env)
+					if err != nil {
+						return nil, err
+					}
+					rest := cddr(x).(*scheme.Pair)
+					if scheme.IsTrue(test) {
+						expr = rest.Car()
+					} else if alt, ok := rest.Cdr().(*scheme.Pair); ok {
+						expr = alt.Car()
+					} else {
+						return scheme.Unspecified, nil
+					}
+					continue
+				case "define":
+					name := cadr(x).(*scheme.Symbol).Name()
+					value, err := m.eval(caddr(x), env)
+					if err != nil {
+						return nil, err
+					}
+					nameProcedure(value, name)
+					env.define(name, value)
+					return scheme.Unspecified, nil
+				case "set!":
+					name := cadr(x).(*scheme.Symbol).Name()
+					value, err := m.eval(caddr(x), env)
+					if err != nil {
+						return nil, err
+					}
+					if !env.set(name, value) {
+						return nil, fmt.Errorf("unbound variable: %s", name)
+					}
+					nameProcedure(value, name)
+					return scheme.Unspecified, nil
+				case "lambda":
+					return m.makeClosure(x, env)
+				case "begin":
+					body, _ := scheme.ListToSlice(x.Cdr())
+					if len(body) == 0 {
+						return scheme.Unspecified, nil
+					}
+					for _, e := range body[:len(body)-1] {
+						if _, err := m.eval(e, env); err != nil {
+							return nil, err
+						}
+					}
+					expr = body[len(body)-1]
+					continue
+				}
+			}
+
+			fn, err := m.eval(x.Car(), env)
+			if err != nil {
+				return nil, err
+			}
+			var args []scheme.Object
+			for rest := x.Cdr(); rest != scheme.EmptyList; {
+				pair, ok := rest.(*scheme.Pair)
+				if !ok {
+					return nil, fmt.Errorf("improper argument list: %s", x)
+				}
+				arg, err := m.eval(pair.Car(), env)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				rest = pair.Cdr()
+			}
+
+			proc, ok := fn.(*scheme.Procedure)
+			if !ok {
+				return nil, fmt.Errorf("not applicable: %s", fn)
+			}
+			switch impl := proc.Impl().(type) {
+			case *primitive:
+				return m.callPrimitive(proc, impl, args)
+			case *closure:
+				if env, err = impl.bind(m, proc, args); err != nil {
+					return nil, err
+				}
+				for _, e := range impl.body[:len(impl.body)-1] {
+					if _, err := m.eval(e, env); err != nil {
+						return nil, err
+					}
+				}
+				expr = impl.body[len(impl.body)-1]
+				continue
+			default:
+				return m.apply(proc, args)
+			}
+		default:
+			// self-evaluating
+			return expr, nil
+		}
+	}
+}
+
+func (m *machine) lookup(sym *scheme.Symbol, env *environment) (scheme.Object, error) {
+	value, ok := env.lookup(sym.Name())
+	if !ok {
+		return nil, fmt.Errorf("unbound variable: %s", sym.Name())
+	}
+	if value == scheme.Undefined {
+		return nil, fmt.Errorf("variable used before its definition: %s", sym.Name())
+	}
+	return value, nil
+}
+
+// apply calls a procedure with arguments.  Primitives use it to call
+// procedures given as their arguments.
+func (m *machine) apply(fn scheme.Object, args []scheme.Object) (scheme.Object, error) {
+	proc, ok := fn.(*scheme.Procedure)
+	if !ok {
+		return nil, fmt.Errorf("not applicable: %s", fn)
+	}
+	switch impl := proc.Impl().(type) {
+	case *primitive:
+		return m.callPrimitive(proc, impl, args)
+	case *closure:
+		env, err := impl.bind(m, proc, args)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range impl.body[:len(impl.body)-1] {
+			if _, err := m.eval(e, env); err != nil {
+				return nil, err
+			}
+		}
+		return m.eval(impl.body[len(impl.body)-1], env)
+	case *vmClosure:
+		return m.vm.apply(proc, args)
+	case *continuation:
+		return nil, m.throw(impl, args)
+	case *parameter:
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%s: wrong number of arguments, %d", proc, len(args))
+		}
+		return impl.value, nil
+	}
+	return nil, fmt.Errorf("not applicable: %s", fn)
+}
+
+func (m *machine) callPrimitive(proc *scheme.Procedure, p *primitive, args []scheme.Object) (scheme.Object, error) {
+	if !proc.Arity().Accepts(len(args)) {
+		return nil, fmt.Errorf("%s: wrong number of arguments, %d", proc.Name(), len(args))
+	}
+	value, err := p.fn(m, args)
+	if err != nil {
+		var ae *argumentError
+		if errors.As(err, &ae) {
+			return nil, fmt.Errorf("%s: %s", proc.Name(), ae.msg)
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// makeClosure creates a procedure from (lambda formals body...).
+func (m *machine) makeClosure(x *scheme.Pair, env *environment) (scheme.Object, error) {
+	c := &closure{env: env}
+	formals := cadr(x)
+	for {
+		if formals == scheme.EmptyList {
+			break
+		}
+		if sym, ok := formals.(*scheme.Symbol); ok {
+			c.rest = sym.Name()
+			break
+		}
+		pair := formals.(*scheme.Pair)
+		c.params = append(c.params, pair.Car().(*scheme.Symbol).Name())
+		formals = pair.Cdr()
+	}
+	c.body, _ = scheme.ListToSlice(cddr(x))
+	arity := scheme.Arity{Required: len(c.params), Rest: c.rest != ""}
+	return scheme.NewClosure(arity, x.Location(), c), nil
+}
+
+// bind creates a new frame which binds the parameters to the
+// arguments.
+func (c *closure) bind(m *machine, proc *scheme.Procedure, args []scheme.Object) (*environment, error) {
+	nparams := len(c.params)
+	if !proc.Arity().Accepts(len(args)) {
+		return nil, fmt.Errorf("%s: wrong number of arguments, %d", proc, len(args))
+	}
+	env := newEnvironment(c.env)
+	for i, name := range c.params {
+		env.define(name, args[i])
+	}
+	if c.rest != "" {
+		if err := m.allocCells(len(args) - nparams); err != nil {
+			return nil, err
+		}
+		env.define(c.rest, scheme.NewList(args[nparams:]...))
+	}
+	return env, nil
+}
+
+// nameProcedure gives a name to an anonymous procedure bound to a
+// variable.
+func nameProcedure(value scheme.Object, name string) {
+	if proc, ok := value.(*scheme.Procedure); ok {
+		proc.SetName(name)
+	}
+}
+
+func cadr(obj scheme.Object) scheme.Object {
+	return obj.(*scheme.Pair).Cdr().(*scheme.Pair).Car()
+}
+
+func cddr(obj scheme.Object) scheme.Object {
+	return obj.(*scheme.Pair).Cdr().(*scheme.Pair).Cdr()
+}
+
+func caddr(obj scheme.Object) scheme.Object {
+	return cddr(obj).(*scheme.Pair).Car()
+}
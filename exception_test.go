@@ -0,0 +1,71 @@
+// gopische/exception_test.go
+
+package gopische
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, `(guard (e (#t (error-object-message e))) (error "boom" 1 2))`, `"boom"`},
+		{2, `(guard (e ((error-object? e) (error-object-irritants e))) (error "boom" 1 'x))`, "(1 x)"},
+		{3, `(guard (e ((symbol? e) (list 'caught e))) (raise 'oops))`, "(caught oops)"},
+		{4, `(guard (e ((string? e) 'outer)) (guard (e ((number? e) 'inner)) (raise "s")))`, "outer"},
+		{5, `(guard (e ((assq 'a e) => cdr) ((assq 'b e))) (raise (list (cons 'a 42))))`, "42"},
+		{6, `(guard (e (else 'caught)) (car 1))`, "caught"},
+		{7, `(guard (e (else 'caught)) (+ 1 2))`, "3"},
+		{8, `(define r '()) (guard (e (#t (set! r (cons 'handler r)))) (dynamic-wind (lambda () (set! r (cons 'before r))) (lambda () (raise 'x)) (lambda () (set! r (cons 'after r))))) r`, "(handler after before)"},
+		{9, `(define (f x) (guard (e (#t (* x 10))) (if (> x 0) (raise x) x))) (list (f 0) (f 2))`, "(0 20)"},
+		{10, `(define p (make-parameter 1)) (guard (e (#t (p))) (parameterize ((p 2)) (raise 'x)))`, "1"},
+		{11, `(read-error? (guard (e (#t e)) (error "x")))`, "#f"},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestUncaughtException(t *testing.T) {
+	_, err := New().Eval(context.Background(), `(guard (e ((string? e) e)) (raise 'oops))`)
+	var raised *RaiseError
+	if !errors.As(err, &raised) || raised.Value.String() != "oops" {
+		t.Fatalf("wrong error, expected=uncaught exception: oops, got=%v", err)
+	}
+
+	_, err = New().Eval(context.Background(), `(error "boom" 1 "two")`)
+	var e *scheme.ErrorObject
+	if !errors.As(err, &e) || e.Message() != "boom" || len(e.Irritants()) != 2 {
+		t.Fatalf("wrong error object: %v", err)
+	}
+
+	// Scheme code cannot catch exiting or hitting a limit.
+	_, err = New().Eval(context.Background(), `(guard (e (#t 'caught)) (exit 3))`)
+	var exit *ExitError
+	if !errors.As(err, &exit) {
+		t.Fatalf("exit caught by a guard: %v", err)
+	}
+	interp := New(WithLimits(Limits{MaxSteps: 1000}))
+	_, err = interp.Eval(context.Background(), `(guard (e (#t 'caught)) (let loop () (loop)))`)
+	var limit *LimitError
+	if !errors.As(err, &limit) {
+		t.Fatalf("limit caught by a guard: %v", err)
+	}
+}
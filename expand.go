@@ -0,0 +1,934 @@
+package gopische
+
+import (
+	"fmt"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// SyntaxError is returned when a special form is malformed.
+type SyntaxError struct {
+	Form    scheme.Object
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.Form)
+}
+
+func badSyntax(form scheme.Object) error {
+	return &SyntaxError{Form: form, Message: "bad syntax"}
+}
+
+// expander rewrites derived expressions into the core forms which the
+// evaluator knows:
+//
+//	(quote datum)
+//	(if test consequent [alternate])
+//	(define variable expression)
+//	(set! variable expression)
+//	(lambda formals body...)
+//	(begin expression...)
+//	(operator operand...)
+//
+// Internal definitions in a body are also rewritten into bindings of
+// an enclosing lambda expression.
+type expander struct {
+	interp   *Interpreter
+	included []string // the paths of the files read by include
+}
+
+type expandFunc func(x *expander, form *scheme.Pair) (scheme.Object, error)
+
+var specialForms map[string]expandFunc
+
+func init() {
+	specialForms = map[string]expandFunc{
+		"quote":      expandQuote,
+		"quasiquote": expandQuasiquote,
+		"lambda":     expandLambda,
+		"define":     expandDefine,
+		"set!":       expandSet,
+		"if":         expandIf,
+		"begin":      expandBegin,
+		"let":        expandLet,
+		"let*":       expandLetStar,
+		"letrec":     expandLetrec,
+		"letrec*":    expandLetrec,
+		"cond":       expandCond,
+		"case":       expandCase,
+		"and":        expandAnd,
+		"or":         expandOr,
+		"when":       expandWhen,
+		"unless":     expandUnless,
+		"do":         expandDo,
+
+		"parameterize": expandParameterize,
+		"guard":        expandGuard,
+
+		"define-record-type": expandDefineRecordType,
+
+		"import":         expandImport,
+		"define-library": expandDefineLibrary,
+		"include":        expandInclude,
+		"include-ci":     expandInclude,
+		"cond-expand":    expandCondExpand,
+	}
+}
+
+func (x *expander) expand(form scheme.Object) (scheme.Object, error) {
+	pair, ok := form.(*scheme.Pair)
+	if !ok {
+		return form, nil
+	}
+	var expanded scheme.Object
+	var err error
+	if fn, ok := specialForm(pair); ok {
+		expanded, err = fn(x, pair)
+	} else if elems, ok := scheme.ListToSlice(form); ok {
+		expanded, err = x.expandList(elems)
+	} else {
+		err = badSyntax(form)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inheritLocation(expanded, pair), nil
+}
+
+func specialForm(form *scheme.Pair) (expandFunc, bool) {
+	if sym, ok := form.Car().(*scheme.Symbol); ok {
+		fn, ok := specialForms[sym.Name()]
+		return fn, ok
+	}
+	return nil, false
+}
+
+// inheritLocation gives the location of the original form to a form
+// generated from it, so that procedures know where they are defined.
+func inheritLocation(obj scheme.Object, origin *scheme.Pair) scheme.Object {
+	if pair, ok := obj.(*scheme.Pair); ok && pair.Location() == nil {
+		pair.SetLocation(origin.Location())
+	}
+	return obj
+}
+
+func (x *expander) expandList(elems []scheme.Object) (scheme.Object, error) {
+	expanded, err := x.expandEach(elems)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewList(expanded...), nil
+}
+
+func (x *expander) expandEach(elems []scheme.Object) ([]scheme.Object, error) {
+	expanded := make([]scheme.Object, len(elems))
+	for i, elem := range elems {
+		var err error
+		if expanded[i], err = x.expand(elem); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// expandBody expands the body of a lambda expression.  Internal
+// definitions are turned into assignments to variables bound by a
+// new lambda expression, which gives them the semantics of letrec*.
+func (x *expander) expandBody(form scheme.Object, body []scheme.Object) ([]scheme.Object, error) {
+	body, err := x.spliceBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, badSyntax(form)
+	}
+
+	var names []scheme.Object
+	exprs := make([]scheme.Object, 0, len(body))
+	for _, elem := range body {
+		if isForm(elem, "define") {
+			name, value, err := x.parseDefine(elem.(*scheme.Pair))
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+			elem = scheme.NewList(x.sym("set!"), name, value)
+		}
+		expr, err := x.expand(elem)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	if len(names) == 0 {
+		return exprs, nil
+	}
+
+	inits := make([]scheme.Object, len(names))
+	for i := range inits {
+		inits[i] = scheme.Undefined
+	}
+	lambda := scheme.NewPair(x.sym("lambda"), scheme.NewPair(scheme.NewList(names...), scheme.NewList(exprs...)))
+	return []scheme.Object{scheme.NewPair(lambda, scheme.NewList(inits...))}, nil
+}
+
+// spliceBody flattens (begin ...) forms in a body, since definitions
+// may appear in them.  Forms which may expand into definitions are
+// rewritten first.
+func (x *expander) spliceBody(body []scheme.Object) ([]scheme.Object, error) {
+	var spliced []scheme.Object
+	for _, elem := range body {
+		var err error
+		switch {
+		case isForm(elem, "define-record-type"):
+			elem, err = x.recordDefinitions(elem.(*scheme.Pair))
+		case isForm(elem, "include"), isForm(elem, "include-ci"):
+			elem, err = x.include(elem.(*scheme.Pair))
+		case isForm(elem, "cond-expand"):
+			var selected []scheme.Object
+			selected, err = x.interp.condExpand(elem.(*scheme.Pair))
+			elem = scheme.NewPair(x.sym("begin"), scheme.NewList(selected...))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isForm(elem, "begin") {
+			if inner, ok := scheme.ListToSlice(elem.(*scheme.Pair).Cdr()); ok {
+				inner, err := x.spliceBody(inner)
+				if err != nil {
+					return nil, err
+				}
+				spliced = append(spliced, inner...)
+				continue
+			}
+		}
+		spliced = append(spliced, elem)
+	}
+	return spliced, nil
+}
+
+// isForm reports whether obj is a list which starts with keyword.
+func isForm(obj scheme.Object, keyword string) bool {
+	pair, ok := obj.(*scheme.Pair)
+	if !ok {
+		return false
+	}
+	sym, ok := pair.Car().(*scheme.Symbol)
+	return ok && sym.Name() == keyword
+}
+
+func (x *expander) sym(name string) *scheme.Symbol {
+	return x.interp.symbols.Intern(name)
+}
+
+// gensym returns a fresh symbol for a temporary variable.
+func (x *expander) gensym(prefix string) *scheme.Symbol {
+	x.interp.gensymCounter++
+	return scheme.NewSymbol(fmt.Sprintf("%%%s.%d", prefix, x.interp.gensymCounter))
+}
+
+// prim returns a builtin procedure.  Expanded code refers to builtins
+// directly instead of their names, so that it works even if a user
+// rebinds them.
+func (x *expander) prim(name string) *scheme.Procedure {
+	return x.interp.prims[name]
+}
+
+// args returns the elements of form except the keyword.  It fails
+// unless the number of them is between min and max.  max < 0 means
+// no upper limit.
+func args(form *scheme.Pair, min int, max int) ([]scheme.Object, error) {
+	elems, ok := scheme.ListToSlice(form.Cdr())
+	if !ok || len(elems) < min || (max >= 0 && len(elems) > max) {
+		return nil, badSyntax(form)
+	}
+	return elems, nil
+}
+
+func expandQuote(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	if _, err := args(form, 1, 1); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+func expandLambda(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	if !isFormals(elems[0]) {
+		return nil, badSyntax(form)
+	}
+	body, err := x.expandBody(form, elems[1:])
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewPair(form.Car(), scheme.NewPair(elems[0], scheme.NewList(body...))), nil
+}
+
+// isFormals reports whether obj is a valid parameter list of a lambda
+// expression.
+func isFormals(obj scheme.Object) bool {
+	for {
+		switch v := obj.(type) {
+		case *scheme.Symbol:
+			return true
+		case *scheme.Pair:
+			if _, ok := v.Car().(*scheme.Symbol); !ok {
+				return false
+			}
+			obj = v.Cdr()
+		default:
+			return obj == scheme.EmptyList
+		}
+	}
+}
+
+// parseDefine normalizes (define (name . formals) body...) into the
+// name and a lambda expression.
+func (x *expander) parseDefine(form *scheme.Pair) (*scheme.Symbol, scheme.Object, error) {
+	elems, err := args(form, 1, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch target := elems[0].(type) {
+	case *scheme.Symbol:
+		switch len(elems) {
+		case 1:
+			return target, scheme.Unspecified, nil
+		case 2:
+			return target, elems[1], nil
+		}
+	case *scheme.Pair:
+		if len(elems) < 2 {
+			break
+		}
+		lambda := inheritLocation(scheme.NewPair(x.sym("lambda"), scheme.NewPair(target.Cdr(), form.Cdr().(*scheme.Pair).Cdr())), form)
+		// curried define: (define ((name a) b) ...)
+		inner := scheme.NewList(form.Car(), target.Car(), lambda)
+		if _, ok := target.Car().(*scheme.Pair); ok {
+			return x.parseDefine(inner.(*scheme.Pair))
+		}
+		if _, ok := target.Car().(*scheme.Symbol); ok {
+			return target.Car().(*scheme.Symbol), lambda, nil
+		}
+	}
+	return nil, nil, badSyntax(form)
+}
+
+func expandDefine(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	name, value, err := x.parseDefine(form)
+	if err != nil {
+		return nil, err
+	}
+	if value, err = x.expand(value); err != nil {
+		return nil, err
+	}
+	return scheme.NewList(form.Car(), name, value), nil
+}
+
+func expandSet(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := elems[0].(*scheme.Symbol); !ok {
+		return nil, badSyntax(form)
+	}
+	value, err := x.expand(elems[1])
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewList(form.Car(), elems[0], value), nil
+}
+
+func expandIf(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := x.expandEach(elems)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewPair(form.Car(), scheme.NewList(expanded...)), nil
+}
+
+func expandBegin(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := x.expandEach(elems)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewPair(form.Car(), scheme.NewList(expanded...)), nil
+}
+
+// parseBindings splits ((variable init) ...) into variables and
+// initial values.
+func parseBindings(form scheme.Object, bindings scheme.Object) ([]scheme.Object, []scheme.Object, error) {
+	elems, ok := scheme.ListToSlice(bindings)
+	if !ok {
+		return nil, nil, badSyntax(form)
+	}
+	vars := make([]scheme.Object, len(elems))
+	inits := make([]scheme.Object, len(elems))
+	for i, elem := range elems {
+		binding, ok := scheme.ListToSlice(elem)
+		if !ok || len(binding) != 2 {
+			return nil, nil, badSyntax(form)
+		}
+		if _, ok := binding[0].(*scheme.Symbol); !ok {
+			return nil, nil, badSyntax(form)
+		}
+		vars[i], inits[i] = binding[0], binding[1]
+	}
+	return vars, inits, nil
+}
+
+// (let ((v e) ...) body...) => ((lambda (v ...) body...) e ...)
+// (let name ((v e) ...) body...) => ((letrec ((name (lambda (v ...) body...))) name) e ...)
+func expandLet(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	if name, ok := elems[0].(*scheme.Symbol); ok {
+		if len(elems) < 3 {
+			return nil, badSyntax(form)
+		}
+		vars, inits, err := parseBindings(form, elems[1])
+		if err != nil {
+			return nil, err
+		}
+		lambda := inheritLocation(scheme.NewPair(x.sym("lambda"), scheme.NewPair(scheme.NewList(vars...), scheme.NewList(elems[2:]...))), form)
+		letrec := scheme.NewList(x.sym("letrec"), scheme.NewList(scheme.NewList(name, lambda)), name)
+		return x.expand(scheme.NewPair(letrec, scheme.NewList(inits...)))
+	}
+	vars, inits, err := parseBindings(form, elems[0])
+	if err != nil {
+		return nil, err
+	}
+	lambda := inheritLocation(scheme.NewPair(x.sym("lambda"), scheme.NewPair(scheme.NewList(vars...), scheme.NewList(elems[1:]...))), form)
+	return x.expand(scheme.NewPair(lambda, scheme.NewList(inits...)))
+}
+
+// (let* ((v1 e1) (v2 e2) ...) body...) => (let ((v1 e1)) (let* ((v2 e2) ...) body...))
+func expandLetStar(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	bindings, ok := scheme.ListToSlice(elems[0])
+	if !ok {
+		return nil, badSyntax(form)
+	}
+	body := scheme.NewList(elems[1:]...)
+	if len(bindings) <= 1 {
+		return x.expand(scheme.NewPair(x.sym("let"), scheme.NewPair(elems[0], body)))
+	}
+	inner := scheme.NewPair(form.Car(), scheme.NewPair(scheme.NewList(bindings[1:]...), body))
+	return x.expand(scheme.NewList(x.sym("let"), scheme.NewList(bindings[0]), inner))
+}
+
+// (letrec ((v e) ...) body...) => (let ((v <undefined>) ...) (set! v e) ... (let () body...))
+func expandLetrec(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	vars, inits, err := parseBindings(form, elems[0])
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]scheme.Object, len(vars))
+	body := make([]scheme.Object, 0, len(vars)+1)
+	for i, v := range vars {
+		bindings[i] = scheme.NewList(v, scheme.Undefined)
+		body = append(body, scheme.NewList(x.sym("set!"), v, inits[i]))
+	}
+	body = append(body, scheme.NewPair(x.sym("let"), scheme.NewPair(scheme.EmptyList, scheme.NewList(elems[1:]...))))
+	return x.expand(scheme.NewPair(x.sym("let"), scheme.NewPair(scheme.NewList(bindings...), scheme.NewList(body...))))
+}
+
+func expandCond(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	clauses, err := args(form, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := x.condClauses(form, clauses)
+	if err != nil {
+		return nil, err
+	}
+	return x.expand(expr)
+}
+
+// condClauses rewrites cond clauses into nested if expressions.
+func (x *expander) condClauses(form scheme.Object, clauses []scheme.Object) (scheme.Object, error) {
+	if len(clauses) == 0 {
+		return scheme.Unspecified, nil
+	}
+	clause, ok := scheme.ListToSlice(clauses[0])
+	if !ok || len(clause) == 0 {
+		return nil, badSyntax(form)
+	}
+	if isKeyword(clause[0], "else") {
+		if len(clauses) > 1 || len(clause) < 2 {
+			return nil, badSyntax(form)
+		}
+		return scheme.NewPair(x.sym("begin"), scheme.NewList(clause[1:]...)), nil
+	}
+	rest, err := x.condClauses(form, clauses[1:])
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(clause) == 1:
+		// (test) => (let ((t test)) (if t t rest))
+		t := x.gensym("t")
+		return scheme.NewList(x.sym("let"), scheme.NewList(scheme.NewList(t, clause[0])),
+			scheme.NewList(x.sym("if"), t, t, rest)), nil
+	case isKeyword(clause[1], "=>"):
+		// (test => receiver) => (let ((t test)) (if t (receiver t) rest))
+		if len(clause) != 3 {
+			return nil, badSyntax(form)
+		}
+		t := x.gensym("t")
+		return scheme.NewList(x.sym("let"), scheme.NewList(scheme.NewList(t, clause[0])),
+			scheme.NewList(x.sym("if"), t, scheme.NewList(clause[2], t), rest)), nil
+	default:
+		then := scheme.NewPair(x.sym("begin"), scheme.NewList(clause[1:]...))
+		return scheme.NewList(x.sym("if"), clause[0], then, rest), nil
+	}
+}
+
+func isKeyword(obj scheme.Object, keyword string) bool {
+	sym, ok := obj.(*scheme.Symbol)
+	return ok && sym.Name() == keyword
+}
+
+// (case key ((d ...) e ...) ... (else e ...))
+// => (let ((t key)) (cond ((memv t '(d ...)) e ...) ... (else e ...)))
+func expandCase(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 1, -1)
+	if err != nil {
+		return nil, err
+	}
+	t := x.gensym("key")
+	clauses := make([]scheme.Object, 0, len(elems)-1)
+	for _, elem := range elems[1:] {
+		clause, ok := scheme.ListToSlice(elem)
+		if !ok || len(clause) < 2 {
+			return nil, badSyntax(form)
+		}
+		var test scheme.Object
+		if isKeyword(clause[0], "else") {
+			test = clause[0]
+		} else {
+			if !scheme.IsList(clause[0]) {
+				return nil, badSyntax(form)
+			}
+			test = scheme.NewList(x.prim("memv"), t, scheme.NewList(x.sym("quote"), clause[0]))
+		}
+		body := clause[1:]
+		if isKeyword(body[0], "=>") {
+			if len(body) != 2 {
+				return nil, badSyntax(form)
+			}
+			body = []scheme.Object{scheme.NewList(body[1], t)}
+		}
+		clauses = append(clauses, scheme.NewPair(test, scheme.NewList(body...)))
+	}
+	cond := scheme.NewPair(x.sym("cond"), scheme.NewList(clauses...))
+	return x.expand(scheme.NewList(x.sym("let"), scheme.NewList(scheme.NewList(t, elems[0])), cond))
+}
+
+func expandAnd(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	switch len(elems) {
+	case 0:
+		return scheme.True, nil
+	case 1:
+		return x.expand(elems[0])
+	}
+	rest := scheme.NewPair(form.Car(), scheme.NewList(elems[1:]...))
+	return x.expand(scheme.NewList(x.sym("if"), elems[0], rest, scheme.False))
+}
+
+func expandOr(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	switch len(elems) {
+	case 0:
+		return scheme.False, nil
+	case 1:
+		return x.expand(elems[0])
+	}
+	t := x.gensym("t")
+	rest := scheme.NewPair(form.Car(), scheme.NewList(elems[1:]...))
+	return x.expand(scheme.NewList(x.sym("let"), scheme.NewList(scheme.NewList(t, elems[0])),
+		scheme.NewList(x.sym("if"), t, t, rest)))
+}
+
+func expandWhen(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	body := scheme.NewPair(x.sym("begin"), scheme.NewList(elems[1:]...))
+	return x.expand(scheme.NewList(x.sym("if"), elems[0], body))
+}
+
+func expandUnless(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	body := scheme.NewPair(x.sym("begin"), scheme.NewList(elems[1:]...))
+	return x.expand(scheme.NewList(x.sym("if"), elems[0], scheme.Unspecified, body))
+}
+
+// (do ((var init step) ...) (test expr ...) command ...)
+// => (let loop ((var init) ...)
+//
+//	(if test (begin expr ...) (begin command ... (loop step ...))))
+func expandDo(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	specs, ok := scheme.ListToSlice(elems[0])
+	if !ok {
+		return nil, badSyntax(form)
+	}
+	bindings := make([]scheme.Object, len(specs))
+	steps := make([]scheme.Object, len(specs))
+	for i, spec := range specs {
+		parts, ok := scheme.ListToSlice(spec)
+		if !ok || len(parts) < 2 || len(parts) > 3 {
+			return nil, badSyntax(form)
+		}
+		bindings[i] = scheme.NewList(parts[0], parts[1])
+		steps[i] = parts[0]
+		if len(parts) == 3 {
+			steps[i] = parts[2]
+		}
+	}
+	exit, ok := scheme.ListToSlice(elems[1])
+	if !ok || len(exit) == 0 {
+		return nil, badSyntax(form)
+	}
+
+	loop := x.gensym("loop")
+	result := scheme.NewPair(x.sym("begin"), scheme.NewPair(scheme.Unspecified, scheme.NewList(exit[1:]...)))
+	commands := append(append([]scheme.Object{}, elems[2:]...), scheme.NewPair(loop, scheme.NewList(steps...)))
+	body := scheme.NewList(x.sym("if"), exit[0], result, scheme.NewPair(x.sym("begin"), scheme.NewList(commands...)))
+	return x.expand(scheme.NewList(x.sym("let"), loop, scheme.NewList(bindings...), body))
+}
+
+// (parameterize ((param value) ...) body ...)
+// => ((lambda (swap) (dynamic-wind swap (lambda () body ...) swap))
+//
+//	(%parameterize (list param ...) (list value ...)))
+func expandParameterize(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	specs, ok := scheme.ListToSlice(elems[0])
+	if !ok {
+		return nil, badSyntax(form)
+	}
+	params := []scheme.Object{x.prim("list")}
+	values := []scheme.Object{x.prim("list")}
+	for _, spec := range specs {
+		parts, ok := scheme.ListToSlice(spec)
+		if !ok || len(parts) != 2 {
+			return nil, badSyntax(form)
+		}
+		params = append(params, parts[0])
+		values = append(values, parts[1])
+	}
+
+	swap := x.gensym("swap")
+	thunk := scheme.NewPair(x.sym("lambda"), scheme.NewPair(scheme.EmptyList, scheme.NewList(elems[1:]...)))
+	wind := scheme.NewList(x.prim("dynamic-wind"), swap, thunk, swap)
+	call := scheme.NewList(x.prim("%parameterize"), scheme.NewList(params...), scheme.NewList(values...))
+	return x.expand(scheme.NewList(scheme.NewList(x.sym("lambda"), scheme.NewList(swap), wind), call))
+}
+
+// (guard (var clause ...) body ...)
+// => (%guard (lambda () body ...)
+//
+//	(lambda (var) (cond clause ... (else (raise var)))))
+//
+// The else clause is added unless the clauses have one.
+func expandGuard(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := scheme.ListToSlice(elems[0])
+	if !ok || len(spec) < 1 {
+		return nil, badSyntax(form)
+	}
+	v, ok := spec[0].(*scheme.Symbol)
+	if !ok {
+		return nil, badSyntax(form)
+	}
+	clauses := spec[1:]
+	if len(clauses) == 0 || !isElseClause(clauses[len(clauses)-1]) {
+		reraise := scheme.NewList(x.prim("raise"), v)
+		clauses = append(clauses, scheme.NewList(x.sym("else"), reraise))
+	}
+
+	thunk := scheme.NewPair(x.sym("lambda"), scheme.NewPair(scheme.EmptyList, scheme.NewList(elems[1:]...)))
+	cond := scheme.NewPair(x.sym("cond"), scheme.NewList(clauses...))
+	handler := scheme.NewList(x.sym("lambda"), scheme.NewList(v), cond)
+	return x.expand(scheme.NewList(x.prim("%guard"), thunk, handler))
+}
+
+func isElseClause(clause scheme.Object) bool {
+	pair, ok := clause.(*scheme.Pair)
+	return ok && isKeyword(pair.Car(), "else")
+}
+
+func expandQuasiquote(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return x.quasi(elems[0], 1)
+}
+
+// quasi expands a quasiquoted template at the nesting level depth.
+func (x *expander) quasi(tmpl scheme.Object, depth int) (scheme.Object, error) {
+	if v, ok := tmpl.(*scheme.Vector); ok {
+		// A vector is expanded as the list of its elements.
+		list, err := x.quasi(scheme.NewList(v.Elements()...), depth)
+		if err != nil {
+			return nil, err
+		}
+		if isForm(list, "quote") {
+			return x.quote(tmpl), nil
+		}
+		return scheme.NewList(x.prim("list->vector"), list), nil
+	}
+	pair, ok := tmpl.(*scheme.Pair)
+	if !ok {
+		return x.quote(tmpl), nil
+	}
+
+	switch {
+	case isForm(pair, "unquote"):
+		elems, err := args(pair, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		if depth == 1 {
+			return x.expand(elems[0])
+		}
+		return x.quasiList(pair.Car(), elems[0], depth-1)
+	case isForm(pair, "quasiquote"):
+		elems, err := args(pair, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		return x.quasiList(pair.Car(), elems[0], depth+1)
+	case isForm(pair.Car(), "unquote-splicing") && depth == 1:
+		elems, err := args(pair.Car().(*scheme.Pair), 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		spliced, err := x.expand(elems[0])
+		if err != nil {
+			return nil, err
+		}
+		rest, err := x.quasi(pair.Cdr(), depth)
+		if err != nil {
+			return nil, err
+		}
+		return scheme.NewList(x.prim("append"), spliced, rest), nil
+	}
+
+	car, err := x.quasi(pair.Car(), depth)
+	if err != nil {
+		return nil, err
+	}
+	cdr, err := x.quasi(pair.Cdr(), depth)
+	if err != nil {
+		return nil, err
+	}
+	if isForm(car, "quote") && isForm(cdr, "quote") {
+		return x.quote(scheme.NewPair(cadr(car), cadr(cdr))), nil
+	}
+	return scheme.NewList(x.prim("cons"), car, cdr), nil
+}
+
+// quasiList builds (keyword template) in a nested quasiquotation.
+func (x *expander) quasiList(keyword scheme.Object, tmpl scheme.Object, depth int) (scheme.Object, error) {
+	inner, err := x.quasi(tmpl, depth)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewList(x.prim("list"), x.quote(keyword), inner), nil
+}
+
+func (x *expander) quote(datum scheme.Object) scheme.Object {
+	return scheme.NewList(x.sym("quote"), datum)
+}
+
+func expandDefineRecordType(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	defs, err := x.recordDefinitions(form)
+	if err != nil {
+		return nil, err
+	}
+	return x.expand(defs)
+}
+
+// recordDefinitions rewrites a record type definition into
+// definitions with the procedural interface of records:
+//
+//	(define-record-type <point> (make-point x y) point?
+//	  (x point-x set-point-x!) (y point-y))
+//	=> (begin
+//	     (define <point> (make-record-type '<point> '(x y)))
+//	     (define make-point (record-constructor <point> '(x y)))
+//	     (define point? (record-predicate <point>))
+//	     (define point-x (record-accessor <point> 'x))
+//	     (define set-point-x! (record-modifier <point> 'x))
+//	     (define point-y (record-accessor <point> 'y)))
+//
+// The constructor may be a bare name, which takes all fields, or #f
+// for no constructor.
+func (x *expander) recordDefinitions(form *scheme.Pair) (scheme.Object, error) {
+	elems, err := args(form, 3, -1)
+	if err != nil {
+		return nil, err
+	}
+	typeName, ok := elems[0].(*scheme.Symbol)
+	if !ok {
+		return nil, badSyntax(form)
+	}
+	quote := func(obj scheme.Object) scheme.Object {
+		return scheme.NewList(x.sym("quote"), obj)
+	}
+	define := func(name scheme.Object, proc string, args ...scheme.Object) scheme.Object {
+		call := scheme.NewPair(x.prim(proc), scheme.NewList(args...))
+		return scheme.NewList(x.sym("define"), name, call)
+	}
+
+	var fields []scheme.Object
+	var accessors []scheme.Object
+	for _, elem := range elems[3:] {
+		spec, ok := scheme.ListToSlice(elem)
+		if !ok || len(spec) < 2 || len(spec) > 3 || !allSymbols(spec) {
+			return nil, badSyntax(form)
+		}
+		fields = append(fields, spec[0])
+		accessors = append(accessors, define(spec[1], "record-accessor", typeName, quote(spec[0])))
+		if len(spec) == 3 {
+			accessors = append(accessors, define(spec[2], "record-modifier", typeName, quote(spec[0])))
+		}
+	}
+
+	defs := []scheme.Object{define(typeName, "make-record-type", quote(typeName), quote(scheme.NewList(fields...)))}
+	switch ctor := elems[1].(type) {
+	case *scheme.Symbol:
+		defs = append(defs, define(ctor, "record-constructor", typeName))
+	case *scheme.Pair:
+		spec, ok := scheme.ListToSlice(ctor)
+		if !ok || !allSymbols(spec) {
+			return nil, badSyntax(form)
+		}
+		defs = append(defs, define(spec[0], "record-constructor", typeName, quote(scheme.NewList(spec[1:]...))))
+	default:
+		if ctor != scheme.False {
+			return nil, badSyntax(form)
+		}
+	}
+	if _, ok := elems[2].(*scheme.Symbol); !ok {
+		return nil, badSyntax(form)
+	}
+	defs = append(defs, define(elems[2], "record-predicate", typeName))
+	defs = append(defs, accessors...)
+	return scheme.NewPair(x.sym("begin"), scheme.NewList(defs...)), nil
+}
+
+func allSymbols(elems []scheme.Object) bool {
+	for _, elem := range elems {
+		if _, ok := elem.(*scheme.Symbol); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// (import set ...) becomes a call to %import with the quoted import
+// sets.  It imports into the environment where it is evaluated.
+func expandImport(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	sets, err := args(form, 1, -1)
+	if err != nil {
+		return nil, err
+	}
+	call := []scheme.Object{x.prim("%import")}
+	for _, set := range sets {
+		call = append(call, x.quote(set))
+	}
+	return scheme.NewList(call...), nil
+}
+
+// (define-library name declaration ...) becomes a call to
+// %define-library with the quoted form and the directory of the
+// source, which included files are relative to.
+func expandDefineLibrary(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	if _, err := args(form, 1, -1); err != nil {
+		return nil, err
+	}
+	dir := scheme.NewString(sourceDir(form))
+	return scheme.NewList(x.prim("%define-library"), x.quote(form), dir), nil
+}
+
+func expandInclude(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	included, err := x.include(form)
+	if err != nil {
+		return nil, err
+	}
+	return x.expand(included)
+}
+
+// include reads the files of (include file ...) into a begin form.
+func (x *expander) include(form *scheme.Pair) (scheme.Object, error) {
+	files, err := args(form, 1, -1)
+	if err != nil {
+		return nil, err
+	}
+	data, paths, err := x.interp.readIncludes(files, sourceDir(form), keyword(form) == "include-ci")
+	if err != nil {
+		return nil, err
+	}
+	x.included = append(x.included, paths...)
+	return scheme.NewPair(x.sym("begin"), scheme.NewList(data...)), nil
+}
+
+// (cond-expand (requirement body...) ...) becomes the body of the
+// first clause whose requirement is fulfilled when it is expanded.
+func expandCondExpand(x *expander, form *scheme.Pair) (scheme.Object, error) {
+	body, err := x.interp.condExpand(form)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return scheme.Unspecified, nil
+	}
+	return x.expand(scheme.NewPair(x.sym("begin"), scheme.NewList(body...)))
+}
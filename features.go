@@ -0,0 +1,162 @@
+package gopische
+
+import (
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var featureBuiltins = []builtin{
+	{"features", 0, 0, primFeatures},
+}
+
+// srfiFeatures maps the feature identifiers of SRFIs to the builtin
+// libraries which implement them.
+var srfiFeatures = []struct{ feature, library string }{
+	{"srfi-1", "(srfi 1)"},
+	{"srfi-69", "(srfi 69)"},
+	{"srfi-125", "(srfi 125)"},
+	{"srfi-132", "(srfi 132)"},
+}
+
+// defaultFeatures returns the feature identifiers of the
+// implementation.  An SRFI is included only when s allows its
+// library.
+func defaultFeatures(s *Sandbox) []string {
+	features := []string{
+		"r7rs",
+		"exact-closed",
+		"ratios",
+		"full-unicode",
+	}
+	for _, srfi := range srfiFeatures {
+		if s.allows(findLibrary(srfi.library)) {
+			features = append(features, srfi.feature)
+		}
+	}
+	return append(features,
+		name,
+		name+"-"+version,
+		runtime.GOOS,
+		runtime.GOARCH,
+	)
+}
+
+// WithFeatures adds feature identifiers, which `cond-expand` tests
+// and `features` returns.
+func WithFeatures(features ...string) Option {
+	return func(interp *Interpreter) {
+		interp.features = append(interp.features, features...)
+	}
+}
+
+func primFeatures(m *machine, args []scheme.Object) (scheme.Object, error) {
+	features := make([]scheme.Object, len(m.interp.features))
+	for i, f := range m.interp.features {
+		features[i] = m.interp.symbols.Intern(f)
+	}
+	return scheme.NewList(features...), nil
+}
+
+// fulfills tests a feature requirement of `cond-expand`:
+//
+//	feature-identifier
+//	(library library-name)
+//	(and requirement ...)
+//	(or requirement ...)
+//	(not requirement)
+func (interp *Interpreter) fulfills(req scheme.Object) (bool, error) {
+	if sym, ok := req.(*scheme.Symbol); ok {
+		return slices.Contains(interp.features, sym.Name()), nil
+	}
+	pair, ok := req.(*scheme.Pair)
+	if !ok {
+		return false, &SyntaxError{Form: req, Message: "bad feature requirement"}
+	}
+	elems, ok := scheme.ListToSlice(req)
+	if !ok {
+		return false, badSyntax(req)
+	}
+	switch keyword(pair) {
+	case "library":
+		if len(elems) != 2 {
+			return false, badSyntax(req)
+		}
+		return interp.hasLibrary(elems[1]), nil
+	case "and":
+		for _, r := range elems[1:] {
+			if ok, err := interp.fulfills(r); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case "or":
+		for _, r := range elems[1:] {
+			if ok, err := interp.fulfills(r); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	case "not":
+		if len(elems) != 2 {
+			return false, badSyntax(req)
+		}
+		ok, err := interp.fulfills(elems[1])
+		return !ok, err
+	}
+	return false, &SyntaxError{Form: req, Message: "bad feature requirement"}
+}
+
+// hasLibrary reports whether a library can be imported, without
+// loading it.
+func (interp *Interpreter) hasLibrary(spec scheme.Object) bool {
+	name, rel, err := libraryName(spec)
+	if err != nil {
+		return false
+	}
+	if _, ok := interp.libraries[name]; ok {
+		return true
+	}
+	if b := findLibrary(name); b != nil {
+		return interp.sandbox.allows(b)
+	}
+	for _, dir := range interp.libraryPath {
+		for _, ext := range libraryExts {
+			if _, err := interp.stat(filepath.Join(dir, rel+ext)); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// condExpand returns the body of the first clause of a `cond-expand`
+// whose requirement is fulfilled.  The clause `else` always is.
+func (interp *Interpreter) condExpand(form *scheme.Pair) ([]scheme.Object, error) {
+	clauses, ok := scheme.ListToSlice(form.Cdr())
+	if !ok {
+		return nil, badSyntax(form)
+	}
+	for i, clause := range clauses {
+		elems, ok := scheme.ListToSlice(clause)
+		if !ok || len(elems) == 0 {
+			return nil, badSyntax(form)
+		}
+		if sym, ok := elems[0].(*scheme.Symbol); ok && sym.Name() == "else" {
+			if i != len(clauses)-1 {
+				return nil, &SyntaxError{Form: form, Message: "else clause must be last"}
+			}
+			return elems[1:], nil
+		}
+		ok, err := interp.fulfills(elems[0])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return elems[1:], nil
+		}
+	}
+	return nil, nil
+}
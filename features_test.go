@@ -0,0 +1,91 @@
+// gopische/features_test.go
+
+package gopische
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestCondExpand(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(cond-expand (r7rs 'yes) (else 'no))", "yes"},
+		{2, "(cond-expand (no-such-feature 'yes) (else 'no))", "no"},
+		{3, "(cond-expand ((and gopische full-unicode) 1) (else 2))", "1"},
+		{4, "(cond-expand ((or no-such-feature " + runtime.GOOS + ") 1) (else 2))", "1"},
+		{5, "(cond-expand ((not gopische) 1) (else 2))", "2"},
+		{6, "(cond-expand ((library (scheme base)) 1) (else 2))", "1"},
+		{7, "(cond-expand ((library (no such)) 1) (else 2))", "2"},
+		{8, "(cond-expand (gopische (define x 1) (define y 2))) (+ x y)", "3"},
+		{9, "(define (f) (cond-expand (r7rs (define a 10))) a) (f)", "10"},
+		{10, "(cond-expand (embedded 'host) (else 'none))", "host"},
+		{11, "(and (memq 'r7rs (features)) (memq '" + runtime.GOARCH + " (features)) #t)", "#t"},
+		{12, "(define-library (l) (export v) (cond-expand (gopische (import (scheme base))) (else)) (cond-expand ((not r7rs) (begin (define v 0))) (else (begin (define v (+ 1 1)))))) (import (l)) v", "2"},
+		{13, "(cond-expand ((and exact-closed ratios) (/ 1 2)) (else 'none))", "1/2"},
+		{14, "(cond-expand ((and srfi-1 srfi-69 srfi-125 srfi-132) 'all) (else 'none))", "all"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithFeatures("embedded"))
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestCondExpandError(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(cond-expand (else 1) (r7rs 2))"},
+		{2, "(cond-expand (\"r7rs\" 1))"},
+		{3, "(cond-expand ((nand r7rs) 1))"},
+		{4, "(cond-expand ((library) 1))"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
+
+func TestSandboxFeatures(t *testing.T) {
+	sandbox, err := NewSandbox("(scheme base)", "(srfi 69)")
+	if err != nil {
+		t.Fatalf("fail to create a sandbox: %s", err)
+	}
+
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(list (and (memq 'srfi-69 (features)) #t) (memq 'srfi-1 (features)) (memq 'srfi-125 (features)) (memq 'srfi-132 (features)))", "(#t #f #f #f)"},
+		{2, "(cond-expand (srfi-1 'yes) (else 'no))", "no"},
+		{3, "(cond-expand ((and r7rs srfi-69) 'yes) (else 'no))", "yes"},
+		{4, "(cond-expand (embedded 'host) (else 'none))", "host"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithFeatures("embedded"), WithSandbox(sandbox))
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// gopische/file_test.go
+
+package gopische
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestFilePort(t *testing.T) {
+	dir := t.TempDir()
+	path := strconv.Quote(filepath.Join(dir, "test.txt"))
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, `(define p (open-output-file ` + path + `)) (write-string "line 1\nline 2\n" p) (close-port p) (file-exists? ` + path + `)`, "#t"},
+		{2, `(define p (open-input-file ` + path + `)) (read-line p) (read-line p)`, `"line 2"`},
+		{3, `(call-with-input-file ` + path + ` (lambda (p) (read-string 4 p)))`, `"line"`},
+		{4, `(with-input-from-file ` + path + ` read-line)`, `"line 1"`},
+		{5, `(with-output-to-file ` + path + ` (lambda () (display "replaced") 'done))`, "done"},
+		{6, `(call-with-input-file ` + path + ` read-line)`, `"replaced"`},
+		{7, `(call-with-output-file ` + path + ` (lambda (p) (write-u8 65 p)))`, "#<unspecified>"},
+		{8, `(define p (open-binary-input-file ` + path + `)) (list (read-u8 p) (eof-object? (read-u8 p)))`, "(65 #t)"},
+		{9, `(define p (open-binary-output-file ` + path + `)) (write-bytevector #u8(1 2) p) (close-port p) (call-with-port (open-binary-input-file ` + path + `) (lambda (p) (read-bytevector 4 p)))`, "#u8(1 2)"},
+		{10, `(define p (open-input-file ` + path + `)) (call-with-port p read-u8) (input-port-open? p)`, "#f"},
+		{11, `(delete-file ` + path + `) (file-exists? ` + path + `)`, "#f"},
+	}
+
+	interp := New()
+	for _, tc := range tests {
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestFileError(t *testing.T) {
+	path := strconv.Quote(filepath.Join(t.TempDir(), "missing.txt"))
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, `(guard (e ((file-error? e) 'file-error)) (open-input-file ` + path + `))`, "file-error"},
+		{2, `(guard (e ((file-error? e) (error-object-irritants e))) (delete-file ` + path + `))`, "(" + path + ")"},
+		{3, `(guard (e ((file-error? e) 'file-error)) (with-input-from-file ` + path + ` read-line))`, "file-error"},
+		{4, `(guard (e ((file-error? e) 'file-error) (else 'other)) (error "not a file error"))`, "other"},
+	}
+
+	for _, tc := range tests {
+		value, err := New().Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+
+	_, err := New().Eval(context.Background(), `(open-input-file `+path+`)`)
+	var e *scheme.ErrorObject
+	if !errors.As(err, &e) || !e.IsFileError() || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("not a file error caused by fs.ErrNotExist: %v", err)
+	}
+}
+
+func TestWithFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data/hello.txt":     {Data: []byte("hello\n")},
+		"lib/util/math.sld":  {Data: []byte("(define-library (util math) (export double) (import (scheme base)) (begin (define (double x) (* x 2))))")},
+		"scripts/main.scm":   {Data: []byte("(define loaded 'yes)")},
+		"scripts/header.scm": {Data: []byte("(define included 1)")},
+	}
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, `(call-with-input-file "data/hello.txt" read-line)`, `"hello"`},
+		{2, `(call-with-input-file "/data/hello.txt" read-line)`, `"hello"`},
+		{3, `(list (file-exists? "data/hello.txt") (file-exists? "data/none.txt"))`, "(#t #f)"},
+		{4, `(load "scripts/main.scm") loaded`, "yes"},
+		{5, `(include "scripts/header.scm") included`, "1"},
+		{6, `(import (util math)) (double 21)`, "42"},
+		{7, `(guard (e ((file-error? e) 'denied)) (open-output-file "data/new.txt"))`, "denied"},
+		{8, `(guard (e ((file-error? e) 'denied)) (delete-file "data/hello.txt"))`, "denied"},
+		{9, `(guard (e ((file-error? e) 'invalid)) (open-input-file "../etc/passwd"))`, "invalid"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithFS(fsys), WithLibraryPath("lib"))
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+
+	// The host file system is not visible.
+	path := filepath.Join(t.TempDir(), "host.txt")
+	if err := os.WriteFile(path, []byte("host"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	interp := New(WithFS(fsys))
+	if err := interp.Load(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("loaded a host file: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// format/format.go
+
+// Package format formats Scheme source code in the canonical layout,
+// as `gopische fmt` does.
+package format
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mnbi/gopische/lexer"
+	"github.com/mnbi/gopische/scheme"
+	"github.com/mnbi/gopische/token"
+)
+
+// Source formats Scheme source code.  Line breaks between data are
+// kept, and the rest of the layout is canonical:
+//
+//   - data in a line are separated by a space, and no spaces follow
+//     an opening parenthesis or precede a closing one;
+//   - a closing parenthesis follows the last element of its list;
+//   - a line in a list is indented by two columns for the body of a
+//     special form such as `define`, under the first argument of a
+//     call when it is in the first line, and under the first element
+//     otherwise;
+//   - comments are kept, including datum comments, and a run of blank
+//     lines becomes one.
+//
+// Formatting the result again does not change it.
+func Source(src []byte) ([]byte, error) {
+	l, err := lexer.AnalyzeTrivia(string(src))
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{lexer: l}
+	root := &node{}
+	for {
+		n, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			break
+		}
+		root.elems = append(root.elems, n)
+	}
+	root.end = parseTrivia(l.Trailing(), len(root.elems) == 0)
+
+	f := &formatter{}
+	for i, n := range root.elems {
+		f.element(n, i == 0, 0)
+	}
+	f.end(root.end, 0, true)
+	if f.sb.Len() > 0 {
+		f.write("\n")
+	}
+	return []byte(f.sb.String()), nil
+}
+
+// trivia is the whitespaces and comments before a token.
+type trivia struct {
+	trailing string   // a comment in the line of the previous token
+	lines    []string // comments in their own lines, "" for blank lines
+	newline  bool     // whether the token starts a line
+}
+
+// parseTrivia reads the whitespaces and comments before a token.
+// first tells that no tokens precede them.
+func parseTrivia(s string, first bool) trivia {
+	var t trivia
+	newlines := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\n':
+			newlines++
+		case ';':
+			j := strings.IndexAny(s[i:], "\r\n")
+			if j < 0 {
+				j = len(s) - i
+			}
+			comment := strings.TrimRight(s[i:i+j], " \t")
+			if newlines == 0 && !first {
+				t.trailing = comment
+			} else {
+				if newlines > 1 {
+					t.lines = append(t.lines, "")
+				}
+				t.lines = append(t.lines, comment)
+			}
+			newlines = 0
+			i += j - 1
+		}
+	}
+	if newlines > 1 {
+		t.lines = append(t.lines, "")
+	}
+	t.newline = newlines > 0 || t.trailing != "" || len(t.lines) > 0
+	return t
+}
+
+// comments reports whether there are comments in their own lines.
+func (t trivia) comments() bool {
+	return slices.ContainsFunc(t.lines, func(line string) bool { return line != "" })
+}
+
+// node is a datum in the source.
+type node struct {
+	tok    *token.Token // an atom, an opening parenthesis or a prefix
+	before trivia
+	elems  []*node // the elements of a list, or the datum of a prefix
+	end    trivia  // the trivia before the closing parenthesis
+}
+
+type parser struct {
+	lexer *lexer.Lexer
+	read  int // the number of tokens read so far
+}
+
+func (p *parser) next() (*token.Token, trivia, bool) {
+	tk, ok := p.lexer.NextToken()
+	if !ok {
+		return nil, trivia{}, false
+	}
+	t := parseTrivia(tk.Trivia, p.read == 0)
+	p.read++
+	return tk, t, true
+}
+
+// parse reads a datum.  It returns nil at the end of the source.
+func (p *parser) parse() (*node, error) {
+	tk, t, ok := p.next()
+	if !ok {
+		return nil, nil
+	}
+	return p.parseNode(tk, t)
+}
+
+func (p *parser) parseNode(tk *token.Token, t trivia) (*node, error) {
+	n := &node{tok: tk, before: t}
+	switch tk.TokenType {
+	case token.LPAREN:
+		for {
+			tk, t, ok := p.next()
+			if !ok {
+				return nil, errors.New("unterminated list")
+			}
+			if tk.TokenType == token.RPAREN {
+				n.end = t
+				return n, nil
+			}
+			elem, err := p.parseNode(tk, t)
+			if err != nil {
+				return nil, err
+			}
+			n.elems = append(n.elems, elem)
+		}
+	case token.RPAREN:
+		return nil, errors.New("unexpected ')'")
+	case token.QUOTE, token.QUASIQUOTE, token.UNQUOTE, token.UNQUOTE_SPLICING, token.BYTEVECTOR, token.VECTOR, token.LABEL, token.DATUM_COMMENT:
+		tk, t, ok := p.next()
+		if !ok {
+			return nil, errors.New("no datum after " + n.tok.Literal)
+		}
+		datum, err := p.parseNode(tk, t)
+		if err != nil {
+			return nil, err
+		}
+		n.elems = []*node{datum}
+	}
+	return n, nil
+}
+
+type formatter struct {
+	sb     strings.Builder
+	column int
+	blank  bool // whether a blank line precedes the next line
+}
+
+func (f *formatter) write(s string) {
+	f.sb.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		f.column = utf8.RuneCountInString(s[i+1:])
+	} else {
+		f.column += utf8.RuneCountInString(s)
+	}
+}
+
+func (f *formatter) newline(indent int) {
+	if f.sb.Len() > 0 {
+		f.write("\n")
+		if f.blank {
+			f.write("\n")
+		}
+	}
+	f.blank = false
+	f.write(strings.Repeat(" ", indent))
+}
+
+// element writes a datum, which is the first one in a list if first
+// is true.  A datum in a new line is indented to indent.  It returns
+// the column where the datum starts.
+func (f *formatter) element(n *node, first bool, indent int) int {
+	t := n.before
+	if t.trailing != "" {
+		f.write(" " + t.trailing)
+	}
+	switch {
+	case t.trailing != "" || t.comments() || (t.newline && !first):
+		// blank lines are dropped at the start of a list or the source,
+		// but kept after comments there
+		commented := false
+		for _, line := range t.lines {
+			if line == "" {
+				f.blank = !first || commented
+				continue
+			}
+			f.newline(indent)
+			f.write(line)
+			commented = true
+		}
+		f.newline(indent)
+	case !first:
+		f.write(" ")
+	}
+	column := f.column
+	f.datum(n)
+	return column
+}
+
+func (f *formatter) datum(n *node) {
+	switch n.tok.TokenType {
+	case token.LPAREN:
+		f.list(n)
+	case token.EMPTY_LIST:
+		f.write("()")
+	case token.QUOTE, token.QUASIQUOTE, token.UNQUOTE, token.UNQUOTE_SPLICING, token.BYTEVECTOR, token.VECTOR, token.LABEL, token.DATUM_COMMENT:
+		f.write(n.tok.Literal)
+		f.element(n.elems[0], true, f.column)
+	default:
+		f.write(n.tok.Literal)
+	}
+}
+
+func (f *formatter) list(n *node) {
+	open := f.column
+	f.write("(")
+
+	// The lines in a list are indented under the first element, or
+	// under the first argument in the line of a procedure name.
+	indent, align := open+1, false
+	if len(n.elems) > 0 && n.elems[0].tok.TokenType == token.SYMBOL {
+		if _, special := scheme.BodyIndent(n.elems[0].tok.Literal); special {
+			indent = open + 2
+		} else {
+			align = len(n.elems) > 1 && !n.elems[1].before.newline
+		}
+	}
+	for i, elem := range n.elems {
+		column := f.element(elem, i == 0, indent)
+		if i == 1 && align {
+			indent = column
+		}
+	}
+	f.end(n.end, indent, false)
+	f.write(")")
+}
+
+// end writes the comments at the end of a list, or at the end of the
+// source if top is true.
+func (f *formatter) end(t trivia, indent int, top bool) {
+	if t.trailing != "" {
+		f.write(" " + t.trailing)
+	}
+	for _, line := range t.lines {
+		if line == "" {
+			f.blank = top && f.sb.Len() > 0
+			continue
+		}
+		f.newline(indent)
+		f.write(line)
+	}
+	if !top && (t.trailing != "" || t.comments()) {
+		f.newline(indent)
+	}
+}
@@ -0,0 +1,56 @@
+// gopische/format/format_test.go
+
+package format
+
+import (
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		id       int
+		input    string
+		expected string
+	}{
+		{1, "(define   (f x)   x)", "(define (f x) x)\n"},
+		{2, "( a  b )\n", "(a b)\n"},
+		{3, "(define (f x)\n(g x)\n    )", "(define (f x)\n  (g x))\n"},
+		{4, "(if (< n 2)\nn\n(f n))", "(if (< n 2)\n    n\n    (f n))\n"},
+		{5, "(foo\nbar baz)", "(foo\n bar baz)\n"},
+		{6, "(let loop ((i 0)\n(j 1))\n(loop i j))", "(let loop ((i 0)\n           (j 1))\n  (loop i j))\n"},
+		{7, "'(1 2\n3)", "'(1 2\n  3)\n"},
+		{8, "(a) ; note  \n(b)", "(a) ; note\n(b)\n"},
+		{9, "(a\n   ; own line\n b)", "(a\n ; own line\n b)\n"},
+		{10, "(a\n\n\n\nb)", "(a\n\n b)\n"},
+		{11, "(\n\na)", "(a)\n"},
+		{12, ";; header\n\n\n(a)\n\n\n\n(b)\n\n", ";; header\n\n(a)\n\n(b)\n"},
+		{13, "(a b ; last\n)", "(a b ; last\n   )\n"},
+		{14, "(define s \"x\n  y\") (f s)", "(define s \"x\n  y\") (f s)\n"},
+		{15, "#u8(1\n2) #0=(a . #0#)", "#u8(1\n    2) #0=(a . #0#)\n"},
+		{16, "(when x\n(display |a b|)\n#\\( ( ))", "(when x\n  (display |a b|)\n  #\\( ())\n"},
+		{17, "", ""},
+		{18, "; only a comment", "; only a comment\n"},
+		{19, "#(1\n2) #0=#(a  #0#)", "#(1\n  2) #0=#(a #0#)\n"},
+		{20, "(f 1 #;  (g\n2) 3)\n#;\n(h)", "(f 1 #;(g\n        2) 3)\n#;(h)\n"},
+	}
+
+	for _, tc := range tests {
+		got, err := Source([]byte(tc.input))
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to format %q: %s", tc.id, tc.input, err)
+		}
+		if string(got) != tc.expected {
+			t.Fatalf("tests[%d] - wrong result, expected=%q, got=%q", tc.id, tc.expected, got)
+		}
+		again, err := Source(got)
+		if err != nil || string(again) != string(got) {
+			t.Fatalf("tests[%d] - not idempotent, got=%q", tc.id, again)
+		}
+	}
+
+	for i, src := range []string{"(a", ")", "'", `"unterminated`, "(a #;)"} {
+		if _, err := Source([]byte(src)); err == nil {
+			t.Fatalf("tests[%d] - no error for %q", 100+i, src)
+		}
+	}
+}
@@ -15,10 +15,21 @@ var revision = "HEAD"
 func Usage() {
 	fmt.Fprintf(os.Stderr, "%s\n", description)
 	fmt.Fprintf(os.Stderr, "usage: %s [options] [file]\n", name)
+	fmt.Fprintf(os.Stderr, "       %s -listen address [-token token] [-idle-timeout duration] [file]\n", name)
+	fmt.Fprintf(os.Stderr, "       %s compile [dir|file]...\n", name)
+	fmt.Fprintf(os.Stderr, "       %s fmt [-w] [-d] [file]...\n", name)
+	fmt.Fprintf(os.Stderr, "       %s lsp\n", name)
+	fmt.Fprintf(os.Stderr, "       %s dap\n", name)
+	fmt.Fprintf(os.Stderr, "       %s nrepl [-listen address]\n", name)
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
+// Version returns the version of gopische.
+func Version() string {
+	return version
+}
+
 func ShowVersion() {
 	fmt.Fprintf(os.Stderr, "%s version %s (rev:%s)\n", name, version, revision)
 	os.Exit(2)
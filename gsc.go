@@ -0,0 +1,604 @@
+package gopische
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// A compiled code file (.gsc) holds the codes of the top-level
+// expressions of a source file, so that loading the source again
+// skips reading, expanding and compiling it.  The file consists of
+//
+//	header:  magic, format version, gopische version, the path,
+//	         modification time and size of the source, and the ones
+//	         of each included file
+//	symbols: the names of the symbols which the codes refer to
+//	codes:   the compiled top-level expressions in order
+//
+// Integers are varints.  Constants refer to symbols by their indices
+// in the symbol table, and to builtin procedures by their names.
+const (
+	gscMagic   = "GSC\x00"
+	gscVersion = 6
+	gscExt     = ".gsc"
+)
+
+var errStaleCache = errors.New("stale compiled code")
+
+// kinds of constants
+const (
+	constEmptyList byte = iota
+	constFalse
+	constTrue
+	constUnspecified
+	constUndefined
+	constInteger
+	constFloat
+	constComplex
+	constString
+	constSymbol
+	constPair
+	constPrimitive
+	constChar
+	constBytevector
+	constVector
+	constRational
+)
+
+// gscHeader identifies the source which a compiled code file is made
+// from.
+type gscHeader struct {
+	version  string
+	path     string
+	mtime    int64
+	size     int64
+	includes []gscInclude
+}
+
+// gscInclude identifies a file included by the source.  The compiled
+// code file is stale when any of them is modified.
+type gscInclude struct {
+	path  string
+	mtime int64
+	size  int64
+}
+
+func sourceHeader(path string, info os.FileInfo) gscHeader {
+	// The path is absolute, so that a source compiled by a relative
+	// path is found from the library path.
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return gscHeader{version: version + "/" + revision, path: path, mtime: info.ModTime().UnixNano(), size: info.Size()}
+}
+
+// statInclude returns the current state of an included file.
+func statInclude(path string) (gscInclude, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return gscInclude{}, err
+	}
+	return gscInclude{path: path, mtime: info.ModTime().UnixNano(), size: info.Size()}, nil
+}
+
+// cachePath returns the path of the compiled code file of a source,
+// which keeps the extension of the source, e.g. foo.sld.gsc, so that
+// foo.sld and foo.scm have their own files.
+func cachePath(path string) string {
+	return path + gscExt
+}
+
+type gscEncoder struct {
+	interp  *Interpreter
+	buf     bytes.Buffer
+	symbols []*scheme.Symbol
+	indices map[*scheme.Symbol]int
+
+	// the pairs and the vectors being written, to find cycles
+	writing map[scheme.Object]bool
+}
+
+// encodeCodes serializes codes.  It fails if a constant cannot be
+// written, e.g. a procedure which is not a builtin or a cyclic list.
+func (interp *Interpreter) encodeCodes(w io.Writer, h gscHeader, codes []*code) error {
+	e := &gscEncoder{interp: interp, indices: make(map[*scheme.Symbol]int), writing: make(map[scheme.Object]bool)}
+	e.uint(uint64(len(codes)))
+	for _, c := range codes {
+		if err := e.code(c); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	head := &gscEncoder{}
+	head.buf.WriteString(gscMagic)
+	head.uint(gscVersion)
+	head.string(h.version)
+	head.string(h.path)
+	head.int(h.mtime)
+	head.int(h.size)
+	head.uint(uint64(len(h.includes)))
+	for _, inc := range h.includes {
+		head.string(inc.path)
+		head.int(inc.mtime)
+		head.int(inc.size)
+	}
+	head.uint(uint64(len(e.symbols)))
+	for _, sym := range e.symbols {
+		head.string(sym.Name())
+		interned, ok := interp.symbols.Lookup(sym.Name())
+		head.bool(ok && interned == sym)
+	}
+	if _, err := bw.Write(head.buf.Bytes()); err != nil {
+		return err
+	}
+	if _, err := bw.Write(e.buf.Bytes()); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (e *gscEncoder) uint(v uint64) {
+	e.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (e *gscEncoder) int(v int64) {
+	e.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (e *gscEncoder) bool(v bool) {
+	if v {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *gscEncoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *gscEncoder) strings(ss []string) {
+	e.uint(uint64(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *gscEncoder) symbol(sym *scheme.Symbol) {
+	i, ok := e.indices[sym]
+	if !ok {
+		i = len(e.symbols)
+		e.symbols = append(e.symbols, sym)
+		e.indices[sym] = i
+	}
+	e.uint(uint64(i))
+}
+
+func (e *gscEncoder) code(c *code) error {
+	e.string(c.name)
+	e.uint(uint64(c.nparams))
+	e.bool(c.rest)
+	if c.loc != nil {
+		e.string(c.loc.File)
+		e.uint(uint64(c.loc.Line))
+	} else {
+		e.string("")
+		e.uint(0)
+	}
+
+	e.strings(c.params)
+	e.uint(uint64(len(c.scopes)))
+	for _, names := range c.scopes {
+		e.strings(names)
+	}
+
+	e.uint(uint64(len(c.consts)))
+	for _, k := range c.consts {
+		if err := e.constant(k); err != nil {
+			return err
+		}
+	}
+	e.uint(uint64(len(c.instrs)))
+	for i, ins := range c.instrs {
+		e.buf.WriteByte(byte(ins.op))
+		e.int(int64(ins.a))
+		e.int(int64(ins.b))
+		e.int(int64(c.lines[i]))
+	}
+	e.uint(uint64(len(c.children)))
+	for _, child := range c.children {
+		if err := e.code(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *gscEncoder) constant(obj scheme.Object) error {
+	switch obj.(type) {
+	case *scheme.Pair, *scheme.Vector:
+		if e.writing[obj] {
+			return fmt.Errorf("cannot compile a cyclic constant")
+		}
+		e.writing[obj] = true
+		defer delete(e.writing, obj)
+	}
+	switch v := obj.(type) {
+	case *scheme.Boolean:
+		if v == scheme.True {
+			e.buf.WriteByte(constTrue)
+		} else {
+			e.buf.WriteByte(constFalse)
+		}
+	case *scheme.Char:
+		e.buf.WriteByte(constChar)
+		e.uint(uint64(v.Rune()))
+	case *scheme.Bytevector:
+		e.buf.WriteByte(constBytevector)
+		e.string(string(v.Bytes()))
+	case *scheme.String:
+		e.buf.WriteByte(constString)
+		e.string(v.Value().(string))
+	case *scheme.Symbol:
+		e.buf.WriteByte(constSymbol)
+		e.symbol(v)
+	case *scheme.Number:
+		switch n := v.Value().(type) {
+		case int64:
+			e.buf.WriteByte(constInteger)
+			e.int(n)
+		case float64:
+			e.buf.WriteByte(constFloat)
+			e.uint(math.Float64bits(n))
+		case complex128:
+			e.buf.WriteByte(constComplex)
+			e.uint(math.Float64bits(real(n)))
+			e.uint(math.Float64bits(imag(n)))
+		case *big.Rat:
+			e.buf.WriteByte(constRational)
+			e.string(n.RatString())
+		default:
+			return fmt.Errorf("cannot compile a constant: %s", obj)
+		}
+	case *scheme.Pair:
+		e.buf.WriteByte(constPair)
+		if err := e.constant(v.Car()); err != nil {
+			return err
+		}
+		return e.constant(v.Cdr())
+	case *scheme.Vector:
+		e.buf.WriteByte(constVector)
+		e.uint(uint64(len(v.Elements())))
+		for _, elem := range v.Elements() {
+			if err := e.constant(elem); err != nil {
+				return err
+			}
+		}
+	case *scheme.Procedure:
+		if e.interp.prims[v.Name()] != v {
+			return fmt.Errorf("cannot compile a constant: %s", obj)
+		}
+		e.buf.WriteByte(constPrimitive)
+		e.string(v.Name())
+	default:
+		switch obj {
+		case scheme.EmptyList:
+			e.buf.WriteByte(constEmptyList)
+		case scheme.Unspecified:
+			e.buf.WriteByte(constUnspecified)
+		case scheme.Undefined:
+			e.buf.WriteByte(constUndefined)
+		default:
+			return fmt.Errorf("cannot compile a constant: %s", obj)
+		}
+	}
+	return nil
+}
+
+type gscDecoder struct {
+	interp  *Interpreter
+	r       *bufio.Reader
+	symbols []*scheme.Symbol
+	err     error
+}
+
+// decodeCodes reads codes compiled from the source identified by h.
+// It returns errStaleCache when the file is made from another source
+// or by another version, or an included file is modified.
+func (interp *Interpreter) decodeCodes(r io.Reader, h gscHeader) ([]*code, error) {
+	d := &gscDecoder{interp: interp, r: bufio.NewReader(r)}
+	magic := make([]byte, len(gscMagic))
+	if _, err := io.ReadFull(d.r, magic); err != nil || string(magic) != gscMagic {
+		return nil, fmt.Errorf("not a compiled code file")
+	}
+	if d.uint() != gscVersion || d.string() != h.version || d.string() != h.path || d.int() != h.mtime || d.int() != h.size {
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, errStaleCache
+	}
+	for range d.length() {
+		inc := gscInclude{path: d.string()}
+		inc.mtime = d.int()
+		inc.size = d.int()
+		if d.err != nil {
+			return nil, d.err
+		}
+		if cur, err := statInclude(inc.path); err != nil || cur != inc {
+			return nil, errStaleCache
+		}
+	}
+
+	d.symbols = make([]*scheme.Symbol, d.length())
+	for i := range d.symbols {
+		name := d.string()
+		if d.bool() {
+			d.symbols[i] = interp.symbols.Intern(name)
+		} else {
+			d.symbols[i] = scheme.NewSymbol(name)
+		}
+	}
+	codes := make([]*code, d.length())
+	for i := range codes {
+		codes[i] = d.code()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return codes, nil
+}
+
+// fail records the first error.  Later reads return zero values.
+func (d *gscDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *gscDecoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	d.fail(err)
+	return v
+}
+
+func (d *gscDecoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.fail(err)
+	return v
+}
+
+func (d *gscDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.fail(err)
+	return b
+}
+
+func (d *gscDecoder) bool() bool {
+	return d.byte() != 0
+}
+
+// length reads the number of elements which follow.  It guards
+// allocations against a broken file.
+func (d *gscDecoder) length() int {
+	n := d.uint()
+	if n > math.MaxInt32 {
+		d.fail(fmt.Errorf("broken compiled code file"))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *gscDecoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(d.r, buf)
+	d.fail(err)
+	return string(buf)
+}
+
+func (d *gscDecoder) strings() []string {
+	n := d.length()
+	if n == 0 || d.err != nil {
+		return nil
+	}
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
+
+func (d *gscDecoder) code() *code {
+	c := &code{name: d.string(), nparams: d.length(), rest: d.bool()}
+	if file, line := d.string(), d.length(); line > 0 {
+		c.loc = &scheme.Location{File: file, Line: line}
+	}
+
+	c.params = d.strings()
+	c.scopes = make([][]string, d.length())
+	for i := range c.scopes {
+		c.scopes[i] = d.strings()
+	}
+
+	c.consts = make([]scheme.Object, d.length())
+	for i := range c.consts {
+		c.consts[i] = d.constant()
+	}
+	n := d.length()
+	c.instrs = make([]instruction, n)
+	c.lines = make([]int32, n)
+	for i := range c.instrs {
+		c.instrs[i] = instruction{op: opcode(d.byte()), a: int32(d.int()), b: int32(d.int())}
+		c.lines[i] = int32(d.int())
+	}
+	c.children = make([]*code, d.length())
+	for i := range c.children {
+		c.children[i] = d.code()
+	}
+	if d.err == nil {
+		d.check(c)
+	}
+	return c
+}
+
+// check validates the operands of instructions, so that a broken file
+// does not crash the VM.
+func (d *gscDecoder) check(c *code) {
+	for _, ins := range c.instrs {
+		var ok bool
+		switch ins.op {
+		case opConst, opGlobalRef, opGlobalSet, opGlobalDefine:
+			ok = int(ins.a) < len(c.consts) && ins.a >= 0
+			if ok && ins.op != opConst {
+				_, ok = c.consts[ins.a].(*scheme.Symbol)
+			}
+		case opLocalRef, opLocalSet:
+			ok = ins.a >= 0 && int(ins.b) < len(c.consts) && ins.b >= 0
+			if ok {
+				_, ok = c.consts[ins.b].(*scheme.Symbol)
+			}
+		case opJump, opJumpIfFalse:
+			ok = ins.a >= 0 && int(ins.a) <= len(c.instrs)
+		case opClosure:
+			ok = ins.a >= 0 && int(ins.a) < len(c.children)
+		case opCall, opTailCall:
+			ok = ins.a >= 0
+		case opEnter:
+			ok = ins.a >= 0 && ins.b >= 0 && int(ins.b) < len(c.scopes) && len(c.scopes[ins.b]) == int(ins.a)
+		case opPop, opReturn, opLeave:
+			ok = true
+		}
+		if !ok {
+			d.fail(fmt.Errorf("broken compiled code file"))
+			return
+		}
+	}
+}
+
+func (d *gscDecoder) constant() scheme.Object {
+	switch kind := d.byte(); kind {
+	case constEmptyList:
+		return scheme.EmptyList
+	case constFalse:
+		return scheme.False
+	case constTrue:
+		return scheme.True
+	case constUnspecified:
+		return scheme.Unspecified
+	case constUndefined:
+		return scheme.Undefined
+	case constInteger:
+		return scheme.NewInteger(d.int())
+	case constFloat:
+		return scheme.NewFloat(math.Float64frombits(d.uint()))
+	case constComplex:
+		re := math.Float64frombits(d.uint())
+		im := math.Float64frombits(d.uint())
+		return scheme.NewComplex(complex(re, im))
+	case constChar:
+		return scheme.NewChar(rune(d.uint()))
+	case constRational:
+		if r, ok := scheme.ParseRational(d.string(), 10); ok {
+			if n, ok := scheme.NewExact(r); ok {
+				return n
+			}
+		}
+		d.fail(fmt.Errorf("broken compiled code file"))
+	case constBytevector:
+		return scheme.NewBytevector([]byte(d.string()))
+	case constString:
+		return scheme.NewString(d.string())
+	case constSymbol:
+		i := d.length()
+		if i >= len(d.symbols) {
+			d.fail(fmt.Errorf("broken compiled code file"))
+			return scheme.Unspecified
+		}
+		return d.symbols[i]
+	case constPair:
+		car := d.constant()
+		return scheme.NewPair(car, d.constant())
+	case constVector:
+		n := d.length()
+		var elems []scheme.Object
+		for i := 0; i < n && d.err == nil; i++ {
+			elems = append(elems, d.constant())
+		}
+		return scheme.NewVector(elems)
+	case constPrimitive:
+		name := d.string()
+		if proc, ok := d.interp.prims[name]; ok {
+			return proc
+		}
+		// compiled by a version which has another set of builtins
+		d.fail(errStaleCache)
+	default:
+		d.fail(fmt.Errorf("broken compiled code file"))
+	}
+	return scheme.Unspecified
+}
+
+// readCache reads the compiled code file of a source if it is up to
+// date.
+func (interp *Interpreter) readCache(path string, info os.FileInfo) ([]*code, error) {
+	f, err := os.Open(cachePath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return interp.decodeCodes(f, sourceHeader(path, info))
+}
+
+// writeCache writes the compiled code file of a source.  It writes a
+// temporary file and renames it, so that a reader never sees a partial
+// file.
+func (interp *Interpreter) writeCache(path string, info os.FileInfo, codes []*code, included []string) error {
+	h := sourceHeader(path, info)
+	for _, p := range included {
+		inc, err := statInclude(p)
+		if err != nil {
+			return err
+		}
+		h.includes = append(h.includes, inc)
+	}
+	dst := cachePath(path)
+	f, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	err = interp.encodeCodes(f, h, codes)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
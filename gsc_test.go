@@ -0,0 +1,181 @@
+// gopische/gsc_test.go
+
+package gopische
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestCodeCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lib.scm")
+	src := "(define x '(1 2.5 \"s\" (a . b) #t ())) (define c #\\x3bb) (define v '#(1 (2) #(\"s\") #())) (define (f n) (let loop ((i 0) (acc '())) (if (= i n) acc (loop (+ i 1) (cons i acc)))))"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "x", "(1 2.5 \"s\" (a . b) #t ())"},
+		{2, "(f 3)", "(2 1 0)"},
+		{3, "(eq? (cdr (car (cdr (cdr (cdr x))))) 'b)", "#t"},
+		{4, "c", `#\λ`},
+		{5, "v", `#(1 (2) #("s") #())`},
+	}
+
+	// The first load writes the cache, and the second one reads it.
+	for i := 0; i < 2; i++ {
+		interp := New(WithCodeCache(true))
+		if err := interp.Load(path); err != nil {
+			t.Fatalf("fail to load: %s", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "lib.scm.gsc")); err != nil {
+			t.Fatalf("no compiled code file: %s", err)
+		}
+		for _, tc := range tests {
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestCodeCacheStale(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "v.scm")
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(src string) {
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	value := func() string {
+		interp := New(WithCodeCache(true))
+		if err := interp.Load(path); err != nil {
+			t.Fatalf("fail to load: %s", err)
+		}
+		v, _ := interp.Lookup("v")
+		return v.String()
+	}
+
+	write("(define v 1)")
+	if err := New().Compile(path); err != nil {
+		t.Fatalf("fail to compile: %s", err)
+	}
+
+	// A source with the same time and size is not recompiled.
+	write("(define v 2)")
+	if v := value(); v != "1" {
+		t.Fatalf("compiled code file not used, got=%s", v)
+	}
+
+	write("(define v 30)")
+	if v := value(); v != "30" {
+		t.Fatalf("stale compiled code file used, got=%s", v)
+	}
+
+	// A broken file is ignored.
+	if err := os.WriteFile(filepath.Join(dir, "v.scm.gsc"), []byte("GSC\x00\x01broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if v := value(); v != "30" {
+		t.Fatalf("broken compiled code file used, got=%s", v)
+	}
+}
+
+func TestCodeCacheExtensions(t *testing.T) {
+	dir := t.TempDir()
+	for ext, src := range map[string]string{".scm": "(define v 'scm)", ".sld": "(define v 'sld)"} {
+		if err := os.WriteFile(filepath.Join(dir, "foo"+ext), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both sources are loaded twice, so that the second ones read the
+	// compiled code files.
+	for i := 0; i < 2; i++ {
+		for _, ext := range []string{".scm", ".sld"} {
+			interp := New(WithCodeCache(true))
+			if err := interp.Load(filepath.Join(dir, "foo"+ext)); err != nil {
+				t.Fatalf("fail to load: %s", err)
+			}
+			if v, _ := interp.Lookup("v"); v.String() != ext[1:] {
+				t.Fatalf("wrong value of foo%s, expected=%s, got=%s", ext, ext[1:], v)
+			}
+		}
+	}
+}
+
+func TestCodeCacheInclude(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.scm")
+	if err := os.WriteFile(path, []byte(`(include "v.scm")`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	write := func(src string) {
+		if err := os.WriteFile(filepath.Join(dir, "v.scm"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	value := func() string {
+		interp := New(WithCodeCache(true))
+		if err := interp.Load(path); err != nil {
+			t.Fatalf("fail to load: %s", err)
+		}
+		v, _ := interp.Lookup("v")
+		return v.String()
+	}
+
+	write("(define v 1)")
+	if v := value(); v != "1" {
+		t.Fatalf("wrong value, expected=1, got=%s", v)
+	}
+	write("(define v 20)")
+	if v := value(); v != "20" {
+		t.Fatalf("compiled code file used after the included file is modified, got=%s", v)
+	}
+	if err := os.Remove(filepath.Join(dir, "v.scm")); err != nil {
+		t.Fatal(err)
+	}
+	interp := New(WithCodeCache(true))
+	if err := interp.Load(path); err == nil {
+		t.Fatalf("compiled code file used after the included file is removed")
+	}
+}
+
+func TestEncodeCodesError(t *testing.T) {
+	interp := New()
+	if _, err := interp.Eval(context.Background(), "(define (f) 1)"); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := interp.Lookup("f")
+	c := &code{consts: []scheme.Object{f}, instrs: []instruction{{op: opConst}, {op: opReturn}}, lines: []int32{0, 0}}
+	var buf bytes.Buffer
+	if err := interp.encodeCodes(&buf, gscHeader{}, []*code{c}); err == nil {
+		t.Fatalf("no error for a closure in constants")
+	}
+
+	v := scheme.NewVector([]scheme.Object{scheme.EmptyList})
+	v.Elements()[0] = scheme.NewList(v)
+	c = &code{consts: []scheme.Object{v}, instrs: []instruction{{op: opConst}, {op: opReturn}}, lines: []int32{0, 0}}
+	if err := interp.encodeCodes(&buf, gscHeader{}, []*code{c}); err == nil {
+		t.Fatalf("no error for a cyclic constant")
+	}
+}
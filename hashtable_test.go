@@ -0,0 +1,106 @@
+// gopische/hashtable_test.go
+
+package gopische
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHashTables(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		// constructors and predicates
+		{1, "(hash-table? (make-hash-table))", "#t"},
+		{2, "(map hash-table? (list '() \"a\" car))", "(#f #f #f)"},
+		{3, "(let ((h (make-hash-table))) (hash-table-set! h '(1 2) 'a) (hash-table-ref h (list 1 2)))", "a"},
+		{4, "(let ((h (make-hash-table eq?))) (hash-table-set! h (list 1) 'a) (hash-table-ref/default h (list 1) 'none))", "none"},
+		{5, "(let ((h (make-hash-table string=? string-hash 100))) (hash-table-set! h \"ab\" 1 \"cd\" 2) (hash-table-ref h (string-append \"a\" \"b\")))", "1"},
+		{6, "(let ((h (make-hash-table (lambda (a b) (= (modulo a 10) (modulo b 10))) (lambda (x) (modulo x 10))))) (hash-table-set! h 13 'a) (list (hash-table-ref/default h 23 #f) (hash-table-ref/default h 24 #f)))", "(a #f)"},
+		{7, "(let ((h (make-hash-table (lambda (a b) (eqv? a b))))) (hash-table-set! h 1 'a) (hash-table-ref h 1))", "a"},
+		{8, "(hash-table->alist (alist->hash-table '((a . 1) (b . 2) (a . 3)) eq?))", "((a . 1) (b . 2))"},
+		{9, "(let ((h (hash-table equal? 'a 1 'b 2))) (list (hash-table-size h) (hash-table-mutable? h)))", "(2 #f)"},
+		{10, "(hash-table->alist (hash-table-unfold (lambda (i) (> i 3)) (lambda (i) (values i (* i i))) (lambda (i) (+ i 1)) 1 eqv?))", "((1 . 1) (2 . 4) (3 . 9))"},
+		{11, "(let ((h (make-hash-table eqv?))) (list (eq? (hash-table-equivalence-function h) eqv?) (eq? (hash-table-hash-function h) hash)))", "(#t #t)"},
+		// accessors
+		{20, "(hash-table-ref (make-hash-table) 'a (lambda () 'missing))", "missing"},
+		{21, "(let ((h (make-hash-table))) (hash-table-set! h 'a 1) (hash-table-ref h 'a (lambda () 0) (lambda (x) (* x 10))))", "10"},
+		{22, "(let ((h (make-hash-table))) (hash-table-set! h 'a 1) (list (hash-table-exists? h 'a) (hash-table-contains? h 'b)))", "(#t #f)"},
+		{23, "(let ((h (make-hash-table))) (hash-table-set! h 'a 1 'b 2 'c 3) (list (hash-table-delete! h 'a 'c 'd) (hash-table-keys h)))", "(2 (b))"},
+		{24, "(let ((h (make-hash-table))) (hash-table-set! h 'a 1) (hash-table-update! h 'a (lambda (x) (+ x 1))) (hash-table-update!/default h 'b (lambda (x) (* x 2)) 5) (hash-table->alist h))", "((a . 2) (b . 10))"},
+		{25, "(let ((h (make-hash-table))) (hash-table-update! h 'a (lambda (x) (+ x 1)) (lambda () 0)) (hash-table-ref h 'a))", "1"},
+		{26, "(let ((h (make-hash-table))) (list (hash-table-intern! h 'a (lambda () 1)) (hash-table-intern! h 'a (lambda () 2))))", "(1 1)"},
+		{27, "(let ((h (make-hash-table))) (hash-table-set! h 'a 1 'b 2) (call-with-values (lambda () (hash-table-pop! h)) (lambda (k v) (list k v (hash-table-size h)))))", "(a 1 1)"},
+		{28, "(let ((h (make-hash-table))) (hash-table-set! h 'a 1) (hash-table-clear! h) (list (hash-table-size h) (hash-table-empty? h)))", "(0 #t)"},
+		// the whole hash table
+		{30, "(let ((h (alist->hash-table '((a . 1) (b . 2))))) (list (hash-table-keys h) (hash-table-values h)))", "((a b) (1 2))"},
+		{31, "(call-with-values (lambda () (hash-table-entries (alist->hash-table '((a . 1) (b . 2))))) list)", "((a b) (1 2))"},
+		{32, "(let ((h (alist->hash-table '((a . 1) (b . 2)))) (acc '())) (hash-table-walk h (lambda (k v) (set! acc (cons k acc)))) (hash-table-for-each (lambda (k v) (set! acc (cons v acc))) h) acc)", "(2 1 b a)"},
+		{33, "(let ((h (alist->hash-table '((a . 1) (b . 2))))) (list (hash-table-fold h (lambda (k v acc) (+ v acc)) 0) (hash-table-fold (lambda (k v acc) (cons k acc)) '() h)))", "(3 (b a))"},
+		{34, "(hash-table-map->list (lambda (k v) (cons v k)) (alist->hash-table '((a . 1) (b . 2))))", "((1 . a) (2 . b))"},
+		{35, "(let ((h (alist->hash-table '((a . 1) (b . 2))))) (hash-table-map! (lambda (k v) (* v 10)) h) (hash-table->alist h))", "((a . 10) (b . 20))"},
+		{36, "(hash-table->alist (hash-table-map (lambda (v) (- v)) eq? (alist->hash-table '((a . 1)))))", "((a . -1))"},
+		{37, "(let ((h (alist->hash-table '((a . 1) (b . 2) (c . 3))))) (hash-table-prune! (lambda (k v) (odd? v)) h) (hash-table->alist h))", "((b . 2))"},
+		{38, "(let ((h (alist->hash-table '((a . 1) (b . 2) (c . 3))))) (list (hash-table-find (lambda (k v) (and (even? v) k)) h (lambda () #f)) (hash-table-find (lambda (k v) (> v 5)) h (lambda () 'none)) (hash-table-count (lambda (k v) (odd? v)) h)))", "(b none 2)"},
+		{39, "(list (hash-table=? = (alist->hash-table '((a . 1))) (alist->hash-table '((a . 1.0)))) (hash-table=? eqv? (alist->hash-table '((a . 1))) (alist->hash-table '((a . 1.0)))))", "(#t #f)"},
+		// copying and conversion
+		{40, "(let* ((h (alist->hash-table '((a . 1)))) (c (hash-table-copy h))) (hash-table-set! c 'b 2) (list (hash-table-size h) (hash-table-size c) (hash-table-mutable? (hash-table-copy h #f))))", "(1 2 #f)"},
+		{41, "(let ((c (hash-table-empty-copy (alist->hash-table '((a . 1)) eq?)))) (list (hash-table-size c) (eq? (hash-table-equivalence-function c) eq?)))", "(0 #t)"},
+		// hash tables as sets
+		{50, "(hash-table->alist (hash-table-union! (alist->hash-table '((a . 1) (b . 2))) (alist->hash-table '((b . 3) (c . 4)))))", "((a . 1) (b . 2) (c . 4))"},
+		{51, "(hash-table->alist (hash-table-merge! (alist->hash-table '((a . 1))) (alist->hash-table '((c . 4)))))", "((a . 1) (c . 4))"},
+		{52, "(hash-table->alist (hash-table-intersection! (alist->hash-table '((a . 1) (b . 2))) (alist->hash-table '((b . 3) (c . 4)))))", "((b . 2))"},
+		{53, "(hash-table->alist (hash-table-difference! (alist->hash-table '((a . 1) (b . 2))) (alist->hash-table '((b . 3) (c . 4)))))", "((a . 1))"},
+		{54, "(hash-table->alist (hash-table-xor! (alist->hash-table '((a . 1) (b . 2))) (alist->hash-table '((b . 3) (c . 4)))))", "((a . 1) (c . 4))"},
+		// hash functions
+		{60, "(list (= (hash '(1 \"a\")) (hash (list 1 \"a\"))) (= (string-hash \"abc\") (string-hash (string-append \"ab\" \"c\"))))", "(#t #t)"},
+		{61, "(let ((h (hash-by-identity 'a 10))) (and (exact? h) (<= 0 h 9)))", "#t"},
+		// weak keys
+		{70, "(let ((h (make-hash-table eq? 'weak)) (k (list 1))) (hash-table-set! h k 'a) (hash-table-ref h k))", "a"},
+		// libraries
+		{80, "(import (only (srfi 69) make-hash-table hash-table-ref/default)) (hash-table-ref/default (make-hash-table) 'a 0)", "0"},
+		{81, "(import (prefix (srfi 125) h:)) (h:hash-table-size (h:hash-table eq? 'a 1))", "1"},
+		{82, "(cond-expand ((and srfi-69 srfi-125 (library (srfi 125))) 'yes) (else 'no))", "yes"},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - engine %d: fail to evaluate %s: %s", tc.id, engine, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - engine %d: wrong value, expected=%s, got=%s", tc.id, engine, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestHashTablesError(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(hash-table-ref (make-hash-table) 'a)"},
+		{2, "(hash-table-set! (hash-table eq? 'a 1) 'a 2)"},
+		{3, "(hash-table-set! (make-hash-table) 'a)"},
+		{4, "(hash-table-size '())"},
+		{5, "(hash-table-pop! (make-hash-table))"},
+		{6, "(hash-table-update! (make-hash-table) 'a car)"},
+		{7, "(hash 'a 0)"},
+		{8, "(string-hash 'a)"},
+		{9, "(let ((h (make-hash-table eq? (lambda (x) 'a)))) (hash-table-set! h 1 2))"},
+		{10, "(hash-table-clear! (hash-table-copy (make-hash-table) #f))"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
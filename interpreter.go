@@ -0,0 +1,387 @@
+package gopische
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// Interpreter evaluates Scheme expressions.  Each interpreter owns its
+// global environment, symbol table and ports, and shares nothing with
+// other interpreters.  So different interpreters can run in different
+// goroutines at the same time.  An interpreter itself must not be used
+// by several goroutines at once.
+type Interpreter struct {
+	global  *environment
+	symbols *scheme.SymbolTable
+	prims   map[string]*scheme.Procedure
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// parameter objects holding the current ports
+	inputPort  *scheme.Procedure
+	outputPort *scheme.Procedure
+	errorPort  *scheme.Procedure
+
+	limits   Limits
+	sandbox  *Sandbox
+	engine   Engine
+	debugger *Debugger
+
+	// the width which the REPL pretty-prints results in, 0 for not
+	// pretty-printing them
+	prettyPrint int
+
+	// whether Load uses compiled code files
+	codeCache bool
+
+	// the file system which files are read from, nil for the host's
+	fsys fs.FS
+
+	// libraries defined or imported so far, by their names
+	libraries        map[string]*library
+	libraryPath      []string
+	loadingLibraries map[string]bool
+
+	// feature identifiers tested by cond-expand
+	features []string
+
+	// command line arguments returned by `command-line`
+	args []string
+
+	// the global environment as a Scheme object
+	interaction *scheme.Environment
+
+	gensymCounter int
+}
+
+// Option configures an interpreter created by New.
+type Option func(*Interpreter)
+
+// WithStdin sets the source of the standard input of an interpreter.
+func WithStdin(r io.Reader) Option {
+	return func(interp *Interpreter) {
+		interp.stdin = r
+	}
+}
+
+// WithStdout sets the destination of the standard output of an
+// interpreter.
+func WithStdout(w io.Writer) Option {
+	return func(interp *Interpreter) {
+		interp.stdout = w
+	}
+}
+
+// WithStderr sets the destination of the standard error of an
+// interpreter.
+func WithStderr(w io.Writer) Option {
+	return func(interp *Interpreter) {
+		interp.stderr = w
+	}
+}
+
+// WithArgs sets the command line arguments which Scheme code gets by
+// `command-line`.  By default, they are the arguments of the process.
+func WithArgs(args []string) Option {
+	return func(interp *Interpreter) {
+		interp.args = args
+	}
+}
+
+// WithCodeCache makes Load keep compiled code files next to the
+// sources, e.g. foo.scm.gsc for foo.scm, and reuse them while the sources are not modified.
+// It takes effect only with the VM engine.
+func WithCodeCache(enabled bool) Option {
+	return func(interp *Interpreter) {
+		interp.codeCache = enabled
+	}
+}
+
+// New creates an interpreter whose global environment has the builtin
+// procedures.  By default, it uses the standard input and output of
+// the process.
+func New(opts ...Option) *Interpreter {
+	interp := &Interpreter{
+		global:  newEnvironment(nil),
+		symbols: scheme.NewSymbolTable(),
+		prims:   make(map[string]*scheme.Procedure),
+		stdin:   os.Stdin,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+		args:    os.Args,
+
+		libraries:        make(map[string]*library),
+		loadingLibraries: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(interp)
+	}
+	interp.features = append(defaultFeatures(interp.sandbox), interp.features...)
+	interp.newPorts()
+	interp.installBuiltins()
+	return interp
+}
+
+// Eval reads all expressions in src and evaluates them in order.  It
+// returns the value of the last expression.
+func (interp *Interpreter) Eval(ctx context.Context, src string) (scheme.Object, error) {
+	data, err := read(src, "", interp.symbols)
+	if err != nil {
+		return nil, err
+	}
+	return interp.evalAll(newMachine(interp, ctx), data, interp.global)
+}
+
+// EvalObject evaluates a datum as an expression.
+func (interp *Interpreter) EvalObject(ctx context.Context, obj scheme.Object) (scheme.Object, error) {
+	return interp.evalAll(newMachine(interp, ctx), []scheme.Object{obj}, interp.global)
+}
+
+// Apply calls a procedure with arguments and returns its value.
+func (interp *Interpreter) Apply(ctx context.Context, proc scheme.Object, args ...scheme.Object) (scheme.Object, error) {
+	m := newMachine(interp, ctx)
+	m.toplevel = interp.global
+	return interp.run(m, 1, func(int) (scheme.Object, error) {
+		return m.apply(proc, args)
+	})
+}
+
+// UsePorts makes ports the current input, output and error ports, and
+// returns a function which restores the previous ones.  A nil port
+// leaves the current one.
+func (interp *Interpreter) UsePorts(in, out, errOut *scheme.Port) (restore func()) {
+	params := []*parameter{
+		interp.inputPort.Impl().(*parameter),
+		interp.outputPort.Impl().(*parameter),
+		interp.errorPort.Impl().(*parameter),
+	}
+	ports := []*scheme.Port{in, out, errOut}
+	saved := make([]scheme.Object, len(params))
+	for i, p := range params {
+		saved[i] = p.value
+		if ports[i] != nil {
+			p.value = ports[i]
+		}
+	}
+	return func() {
+		for i, p := range params {
+			p.value = saved[i]
+		}
+	}
+}
+
+// CaptureOutput calls a procedure with arguments while the current
+// output port writes into a string, and returns the output with the
+// value of the procedure.  The output so far is returned even if the
+// call fails.
+func (interp *Interpreter) CaptureOutput(ctx context.Context, proc scheme.Object, args ...scheme.Object) (string, scheme.Object, error) {
+	port := scheme.NewStringOutputPort()
+	defer interp.UsePorts(nil, port, nil)()
+
+	value, err := interp.Apply(ctx, proc, args...)
+	out, _ := port.Output()
+	return string(out), value, err
+}
+
+func (interp *Interpreter) evalAll(m *machine, data []scheme.Object, env *environment) (scheme.Object, error) {
+	x := &expander{interp: interp}
+	return interp.run(m, len(data), func(i int) (scheme.Object, error) {
+		expr, err := x.expand(data[i])
+		if err != nil {
+			return nil, err
+		}
+		return m.evaluate(expr, env)
+	})
+}
+
+// run evaluates n top-level expressions in order by calling eval with
+// their indices, and returns the value of the last one.
+func (interp *Interpreter) run(m *machine, n int, eval func(i int) (scheme.Object, error)) (value scheme.Object, err error) {
+	// A bug of a primitive must not crash the host.
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf("internal error: %v", r)
+		}
+	}()
+
+	if err := m.checkContext(); err != nil {
+		return nil, err
+	}
+
+	value = scheme.Unspecified
+	for i := 0; i < n; i++ {
+		if value, err = eval(i); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// Define binds a value to a variable in the global environment.
+func (interp *Interpreter) Define(name string, value scheme.Object) {
+	nameProcedure(value, name)
+	interp.global.define(name, value)
+}
+
+// Lookup returns the value of a variable in the global environment.
+func (interp *Interpreter) Lookup(name string) (scheme.Object, bool) {
+	return interp.global.lookup(name)
+}
+
+// Load reads a source file and evaluates expressions in it.
+func (interp *Interpreter) Load(path string) error {
+	return interp.LoadContext(context.Background(), path)
+}
+
+// LoadContext is Load which stops when ctx is done.
+func (interp *Interpreter) LoadContext(ctx context.Context, path string) error {
+	return interp.load(newMachine(interp, ctx), path, interp.global)
+}
+
+// load evaluates the expressions in a source file in env.
+func (interp *Interpreter) load(m *machine, path string, env *environment) error {
+	if interp.codeCache && interp.engine == VM && interp.fsys == nil {
+		return interp.loadCompiled(m, path, env)
+	}
+	src, err := interp.readFile(path)
+	if err != nil {
+		return err
+	}
+	data, err := read(string(src), path, interp.symbols)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := interp.evalAll(m, data, env); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// loadCompiled runs the compiled code file of a source if it is up to
+// date.  Otherwise, it compiles the whole source, runs the codes, and
+// writes them for the next time.
+func (interp *Interpreter) loadCompiled(m *machine, path string, env *environment) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if codes, err := interp.readCache(path, info); err == nil {
+		_, err := interp.run(m, len(codes), func(i int) (scheme.Object, error) {
+			return m.execute(codes[i], env)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+
+	codes, included, err := interp.compileFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = interp.run(m, len(codes), func(i int) (scheme.Object, error) {
+		return m.execute(codes[i], env)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	// The cache is only an optimization.  A read-only directory
+	// must not fail loading.
+	_ = interp.writeCache(path, info, codes, included)
+	return nil
+}
+
+// compileFile reads, expands and compiles the expressions in a source
+// file.  It also returns the paths of the files included by them.
+func (interp *Interpreter) compileFile(path string) ([]*code, []string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := read(string(src), path, interp.symbols)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	x := &expander{interp: interp}
+	codes := make([]*code, len(data))
+	for i, datum := range data {
+		expr, err := x.expand(datum)
+		if err == nil {
+			codes[i], err = compile(expr)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return codes, x.included, nil
+}
+
+// Compile compiles a source file into its compiled code file, which
+// Load uses instead of the source while the source is not modified.
+func (interp *Interpreter) Compile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	codes, included, err := interp.compileFile(path)
+	if err != nil {
+		return err
+	}
+	if err := interp.writeCache(path, info, codes, included); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// NewPrimitive creates a procedure implemented in Go, so that it can
+// be given to Define.  The procedure accepts from min to max
+// arguments.  A negative max means no upper limit.
+func NewPrimitive(name string, min int, max int, fn func(args []scheme.Object) (scheme.Object, error)) *scheme.Procedure {
+	return newPrimitive(builtin{
+		name: name,
+		min:  min,
+		max:  max,
+		fn: func(m *machine, args []scheme.Object) (scheme.Object, error) {
+			return fn(args)
+		},
+	})
+}
+
+// DefineRecordType defines a record type whose instances wrap values
+// of a Go struct type, given by prototype, which is a struct value or
+// a pointer to it.  For a record type named "point" with a field "x",
+// it defines:
+//
+//	point           the record type
+//	make-point      the constructor which takes all fields
+//	point?          the predicate
+//	point-x         the accessor
+//	set-point-x!    the modifier
+//
+// Use scheme.NewGoRecord to pass a Go value to Scheme code.
+func (interp *Interpreter) DefineRecordType(name string, prototype any) (*scheme.RecordType, error) {
+	rt, err := scheme.NewGoRecordType(name, reflect.TypeOf(prototype))
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]int, len(rt.Fields()))
+	for i := range indices {
+		indices[i] = i
+	}
+	interp.Define(name, rt)
+	interp.Define("make-"+name, recordConstructor(rt, indices))
+	interp.Define(name+"?", recordPredicate(rt))
+	for i, field := range rt.Fields() {
+		interp.Define(name+"-"+field, recordAccessor(rt, i))
+		interp.Define("set-"+name+"-"+field+"!", recordModifier(rt, i))
+	}
+	return rt, nil
+}
@@ -0,0 +1,220 @@
+// gopische/interpreter_test.go
+
+package gopische
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		// self-evaluating and quote
+		{1, "1", "1"},
+		{2, "\"hoge\"", "\"hoge\""},
+		{3, "'a", "a"},
+		{4, "'(1 . 2)", "(1 . 2)"},
+		{5, "'()", "()"},
+		{6, "'(1 #;2 3 #;#(4) . #;5 6)", "(1 3 . 6)"},
+		{7, "(+ 1 #; #;(car '()) 2 3) #;(car '())", "4"},
+		// arithmetic
+		{10, "(+ 1 2 3)", "6"},
+		{11, "(- 10 1 2)", "7"},
+		{12, "(* 2 3.5)", "7.0"},
+		{13, "(/ 6 3)", "2"},
+		{14, "(< 1 2 3)", "#t"},
+		{15, "(= 1 1.0)", "#t"},
+		{16, "(modulo -7 2)", "1"},
+		{17, "(exact->inexact 1)", "1.0"},
+		{18, "(list (+ 9223372036854775806 1) (* -4611686018427387904 2) (expt -2 63) (- -1 9223372036854775807))", "(9223372036854775807 -9223372036854775808 -9223372036854775808 -9223372036854775808)"},
+		// definitions and procedures
+		{20, "(define (sq x) (* x x)) (sq 12)", "144"},
+		{21, "(define x 1) (set! x 2) x", "2"},
+		{22, "((lambda args args) 1 2)", "(1 2)"},
+		{23, "((lambda (a . rest) rest) 1 2 3)", "(2 3)"},
+		{24, "(define (f) (define a 1) (define (g) (+ a 1)) (g)) (f)", "2"},
+		{25, "(define ((adder n) m) (+ n m)) ((adder 1) 2)", "3"},
+		// derived expressions
+		{30, "(let ((a 1) (b 2)) (+ a b))", "3"},
+		{31, "(let* ((a 1) (b (+ a 1))) b)", "2"},
+		{32, "(letrec ((ev? (lambda (n) (if (= n 0) #t (od? (- n 1))))) (od? (lambda (n) (if (= n 0) #f (ev? (- n 1)))))) (ev? 100))", "#t"},
+		{33, "(let loop ((i 0) (acc '())) (if (= i 3) acc (loop (+ i 1) (cons i acc))))", "(2 1 0)"},
+		{34, "(cond ((assv 2 '((1 . a) (2 . b))) => cdr) (else 'no))", "b"},
+		{35, "(cond (#f 1) (else 2))", "2"},
+		{36, "(case (* 2 3) ((2 3 5 7) 'prime) ((1 4 6 8 9) 'composite))", "composite"},
+		{37, "(and 1 2)", "2"},
+		{38, "(or #f #f)", "#f"},
+		{39, "(do ((i 0 (+ i 1)) (s 0 (+ s i))) ((= i 5) s))", "10"},
+		{40, "(when #t 1 2)", "2"},
+		{41, "`(1 ,(+ 1 1) ,@(list 3 4))", "(1 2 3 4)"},
+		{42, "`(1 `(2 ,(3 ,(+ 1 3))))", "(1 (quasiquote (2 (unquote (3 4)))))"},
+		// lists
+		{50, "(append '(1) '(2) '(3 4) 5)", "(1 2 3 4 . 5)"},
+		{51, "(map (lambda (x) (* x x)) '(1 2 3))", "(1 4 9)"},
+		{52, "(apply + 1 2 '(3 4))", "10"},
+		{53, "(member \"b\" '(\"a\" \"b\"))", "(\"b\")"},
+		{54, "(length '(1 2 3))", "3"},
+		// strings and symbols
+		{60, "(string-length \"日本語\")", "3"},
+		{61, "(substring \"日本語\" 1 2)", "\"本\""},
+		{62, "(eq? 'a (string->symbol \"a\"))", "#t"},
+		// exact rationals
+		{70, "(list (/ 1 3) (+ 1/2 1/3) (* 2/3 3/2) (- 1/2 1/2))", "(1/3 5/6 1 0)"},
+		{71, "(list (exact 0.5) (inexact 1/4) (exact? 1/2) (eqv? 1/2 2/4) (= 1/2 0.5))", "(1/2 0.25 #t #t #t)"},
+		{72, "(list (floor -7/2) (ceiling -7/2) (truncate -7/2) (round -7/2) (round 5/2))", "(-4 -3 -3 -4 2)"},
+		{73, "(list (numerator 6/4) (denominator 6/4) (denominator 3) (numerator 0.5))", "(3 2 1 1.0)"},
+		{74, "(list (expt 2/3 2) (expt 2 -1) (sqrt 4/9) (< 1/3 1/2 1))", "(4/9 1/2 2/3 #t)"},
+		{75, "(list (string->number \"1/2\") (string->number \"-a/f\" 16) (number->string 3/4 2))", "(1/2 -2/3 \"11/100\")"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s",
+				tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "undefined-variable"},
+		{2, "(car 1)"},
+		{3, "(1 2)"},
+		{4, "((lambda (x) x))"},
+		{5, "(let ((x)) x)"},
+		{6, "(if)"},
+		{7, "(error \"boom\" 1 2)"},
+		{8, "(letrec ((a b) (b 1)) a)"},
+		{9, "(+ 1"},
+		{10, "(+ 9223372036854775807 1)"},
+		{11, "(- -9223372036854775808 1)"},
+		{12, "(* 4611686018427387904 4)"},
+		{13, "(- -9223372036854775808)"},
+		{14, "(expt 2 63)"},
+		{15, "(quotient -9223372036854775808 -1)"},
+		{16, "(exact 1e19)"},
+		{17, "1/0"},
+		{18, "'(1 #;)"},
+		{19, "'(1 #;"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	interp := New()
+	src := "(define (loop n) (if (= n 0) 'done (loop (- n 1)))) (loop 1000000)"
+	value, err := interp.Eval(context.Background(), src)
+	if err != nil {
+		t.Fatalf("fail to evaluate a tail call: %s", err)
+	}
+	if value.String() != "done" {
+		t.Fatalf("wrong value, expected=done, got=%s", value)
+	}
+}
+
+func TestDefine(t *testing.T) {
+	interp := New()
+	interp.Define("answer", scheme.NewInteger(42))
+	interp.Define("twice", NewPrimitive("twice", 1, 1, func(args []scheme.Object) (scheme.Object, error) {
+		return scheme.NewList(args[0], args[0]), nil
+	}))
+
+	value, err := interp.Eval(context.Background(), "(twice answer)")
+	if err != nil {
+		t.Fatalf("fail to evaluate: %s", err)
+	}
+	if value.String() != "(42 42)" {
+		t.Fatalf("wrong value, expected=(42 42), got=%s", value)
+	}
+	if _, err := interp.Eval(context.Background(), "(twice)"); err == nil {
+		t.Fatalf("no error for a wrong number of arguments")
+	}
+}
+
+func TestEvalObject(t *testing.T) {
+	interp := New()
+	expr := scheme.NewList(scheme.NewSymbol("+"), scheme.NewInteger(1), scheme.NewInteger(2))
+	value, err := interp.EvalObject(context.Background(), expr)
+	if err != nil {
+		t.Fatalf("fail to evaluate: %s", err)
+	}
+	if value.String() != "3" {
+		t.Fatalf("wrong value, expected=3, got=%s", value)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.scm")
+	src := "; a library\n(define (greet name)\n  (string-append \"Hello, \" name))\n(display (greet \"Scheme\"))\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	interp := New(WithStdout(&out))
+	if err := interp.Load(path); err != nil {
+		t.Fatalf("fail to load %s: %s", path, err)
+	}
+	if out.String() != "Hello, Scheme" {
+		t.Fatalf("wrong output, expected=%q, got=%q", "Hello, Scheme", out.String())
+	}
+	if _, ok := interp.Lookup("greet"); !ok {
+		t.Fatalf("greet is not defined by load")
+	}
+}
+
+// Interpreters must not share global environments even if they run
+// at the same time.
+func TestIsolatedInterpreters(t *testing.T) {
+	const n = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			interp := New()
+			src := fmt.Sprintf("(define tenant %d) (define (count k acc) (if (= k 0) acc (count (- k 1) (+ acc 1)))) (+ tenant (count 10000 0))", i)
+			value, err := interp.Eval(context.Background(), src)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if expected := fmt.Sprintf("%d", i+10000); value.String() != expected {
+				errs <- fmt.Errorf("interpreter %d: expected=%s, got=%s", i, expected, value)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
@@ -13,10 +13,15 @@ const (
 	EOS = "EOS"
 	// word scan
 	WHITE_SPACE = "WHITE_SPACE"
+	NEWLINE     = "NEWLINE"
 	LEFT_PAREN  = "LEFT_PAREN"
 	RIGHT_PAREN = "RIGHT_PAREN"
 	DOUBLE_QUOT = "DOUBLE_QUOT"
 	ESCAPE_CHAR = "ESCAPE_CHAR"
+	QUOTE_MARK  = "QUOTE_MARK" // ' and `
+	COMMA       = "COMMA"
+	AT_MARK     = "AT_MARK"
+	SEMICOLON   = "SEMICOLON"
 	// number scan
 	SIGN          = "SIGN"
 	DIGIT_ZERO    = "DIGIT_ZERO"
@@ -30,6 +35,11 @@ func IsWhitespace(r rune) bool {
 	return unicode.IsSpace(r)
 }
 
+// IsNewline reports whether r terminates a line comment.
+func IsNewline(r rune) bool {
+	return r == '\n' || r == '\r'
+}
+
 // Extended identifier characters, see 2.1 in R7RS (or R5RS).
 var extendedIdChars = [...]rune{'!', '$', '%', '&', '*', '+', '-', '.', '/', ':', '<', '=', '>', '?', '@', '^', '_', '~'}
 
@@ -20,69 +20,174 @@ type Edge struct {
 }
 
 const (
-	s1 State = iota + 1 // read '(' at start
-	s2                  // read ')' at start
-	s3                  // read a string
-	s4                  // read a symbol
-	s5                  // read an escape character in a string
-	s6                  // read the empty list
+	s1  State = iota + 1 // read '(' at start
+	s2                   // read ')' at start
+	s3                   // read a string
+	s4                   // read a symbol
+	s5                   // read an escape character in a string
+	s6                   // read the empty list
+	s7                   // read whitespaces after '('
+	s8                   // read a quote mark (' or `)
+	s9                   // read a comma
+	s10                  // read a comma followed by '@'
+	s11                  // read a line comment
 )
 
 var transition = map[Edge]State{
 	// start
 	{State: Start, Input: runeclass.EOS}:         Accept,
 	{State: Start, Input: runeclass.WHITE_SPACE}: Start,
+	{State: Start, Input: runeclass.NEWLINE}:     Start,
 	{State: Start, Input: runeclass.LEFT_PAREN}:  s1,
 	{State: Start, Input: runeclass.RIGHT_PAREN}: s2,
 	{State: Start, Input: runeclass.DOUBLE_QUOT}: s3,
 	{State: Start, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: Start, Input: runeclass.QUOTE_MARK}:  s8,
+	{State: Start, Input: runeclass.COMMA}:       s9,
+	{State: Start, Input: runeclass.AT_MARK}:     s4,
+	{State: Start, Input: runeclass.SEMICOLON}:   s11,
 	{State: Start, Input: runeclass.ANY_OTHER}:   s4,
 	// s1: read '(' at start
 	{State: s1, Input: runeclass.EOS}:         Accept,
-	{State: s1, Input: runeclass.WHITE_SPACE}: s1,
+	{State: s1, Input: runeclass.WHITE_SPACE}: s7,
+	{State: s1, Input: runeclass.NEWLINE}:     s7,
 	{State: s1, Input: runeclass.LEFT_PAREN}:  Accept,
 	{State: s1, Input: runeclass.RIGHT_PAREN}: s6,
 	{State: s1, Input: runeclass.DOUBLE_QUOT}: Accept,
 	{State: s1, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: s1, Input: runeclass.QUOTE_MARK}:  Accept,
+	{State: s1, Input: runeclass.COMMA}:       Accept,
+	{State: s1, Input: runeclass.AT_MARK}:     Accept,
+	{State: s1, Input: runeclass.SEMICOLON}:   Accept,
 	{State: s1, Input: runeclass.ANY_OTHER}:   Accept,
 	// s2: read ')' at start
 	{State: s2, Input: runeclass.EOS}:         Accept,
 	{State: s2, Input: runeclass.WHITE_SPACE}: Accept,
+	{State: s2, Input: runeclass.NEWLINE}:     Accept,
 	{State: s2, Input: runeclass.LEFT_PAREN}:  Accept,
 	{State: s2, Input: runeclass.RIGHT_PAREN}: Accept,
 	{State: s2, Input: runeclass.DOUBLE_QUOT}: Accept,
 	{State: s2, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: s2, Input: runeclass.QUOTE_MARK}:  Accept,
+	{State: s2, Input: runeclass.COMMA}:       Accept,
+	{State: s2, Input: runeclass.AT_MARK}:     Accept,
+	{State: s2, Input: runeclass.SEMICOLON}:   Accept,
 	{State: s2, Input: runeclass.ANY_OTHER}:   Accept,
 	// s3: read a string
 	{State: s3, Input: runeclass.EOS}:         Illegal,
 	{State: s3, Input: runeclass.WHITE_SPACE}: s3,
+	{State: s3, Input: runeclass.NEWLINE}:     s3,
 	{State: s3, Input: runeclass.LEFT_PAREN}:  s3,
 	{State: s3, Input: runeclass.RIGHT_PAREN}: s3,
 	{State: s3, Input: runeclass.DOUBLE_QUOT}: Accept,
 	{State: s3, Input: runeclass.ESCAPE_CHAR}: s5,
+	{State: s3, Input: runeclass.QUOTE_MARK}:  s3,
+	{State: s3, Input: runeclass.COMMA}:       s3,
+	{State: s3, Input: runeclass.AT_MARK}:     s3,
+	{State: s3, Input: runeclass.SEMICOLON}:   s3,
 	{State: s3, Input: runeclass.ANY_OTHER}:   s3,
 	// s4: read a symbol
 	{State: s4, Input: runeclass.EOS}:         Accept,
 	{State: s4, Input: runeclass.WHITE_SPACE}: Accept,
+	{State: s4, Input: runeclass.NEWLINE}:     Accept,
 	{State: s4, Input: runeclass.LEFT_PAREN}:  Accept,
 	{State: s4, Input: runeclass.RIGHT_PAREN}: Accept,
 	{State: s4, Input: runeclass.DOUBLE_QUOT}: Accept,
 	{State: s4, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: s4, Input: runeclass.QUOTE_MARK}:  Accept,
+	{State: s4, Input: runeclass.COMMA}:       Accept,
+	{State: s4, Input: runeclass.AT_MARK}:     s4,
+	{State: s4, Input: runeclass.SEMICOLON}:   Accept,
 	{State: s4, Input: runeclass.ANY_OTHER}:   s4,
 	// s5: read an escapce character in a string
 	{State: s5, Input: runeclass.EOS}:         Illegal,
 	{State: s5, Input: runeclass.WHITE_SPACE}: s3,
+	{State: s5, Input: runeclass.NEWLINE}:     s3,
 	{State: s5, Input: runeclass.LEFT_PAREN}:  s3,
 	{State: s5, Input: runeclass.RIGHT_PAREN}: s3,
 	{State: s5, Input: runeclass.DOUBLE_QUOT}: s3,
 	{State: s5, Input: runeclass.ESCAPE_CHAR}: s3,
+	{State: s5, Input: runeclass.QUOTE_MARK}:  s3,
+	{State: s5, Input: runeclass.COMMA}:       s3,
+	{State: s5, Input: runeclass.AT_MARK}:     s3,
+	{State: s5, Input: runeclass.SEMICOLON}:   s3,
 	{State: s5, Input: runeclass.ANY_OTHER}:   s3,
 	// s6: read the empyt list
 	{State: s6, Input: runeclass.EOS}:         Accept,
 	{State: s6, Input: runeclass.WHITE_SPACE}: Accept,
+	{State: s6, Input: runeclass.NEWLINE}:     Accept,
 	{State: s6, Input: runeclass.LEFT_PAREN}:  Accept,
 	{State: s6, Input: runeclass.RIGHT_PAREN}: Accept,
 	{State: s6, Input: runeclass.DOUBLE_QUOT}: Accept,
 	{State: s6, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: s6, Input: runeclass.QUOTE_MARK}:  Accept,
+	{State: s6, Input: runeclass.COMMA}:       Accept,
+	{State: s6, Input: runeclass.AT_MARK}:     Accept,
+	{State: s6, Input: runeclass.SEMICOLON}:   Accept,
 	{State: s6, Input: runeclass.ANY_OTHER}:   Accept,
+	// s7: read whitespaces after '('
+	{State: s7, Input: runeclass.EOS}:         Accept,
+	{State: s7, Input: runeclass.WHITE_SPACE}: s7,
+	{State: s7, Input: runeclass.NEWLINE}:     s7,
+	{State: s7, Input: runeclass.LEFT_PAREN}:  Accept,
+	{State: s7, Input: runeclass.RIGHT_PAREN}: s6,
+	{State: s7, Input: runeclass.DOUBLE_QUOT}: Accept,
+	{State: s7, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: s7, Input: runeclass.QUOTE_MARK}:  Accept,
+	{State: s7, Input: runeclass.COMMA}:       Accept,
+	{State: s7, Input: runeclass.AT_MARK}:     Accept,
+	{State: s7, Input: runeclass.SEMICOLON}:   Accept,
+	{State: s7, Input: runeclass.ANY_OTHER}:   Accept,
+	// s8: read a quote mark (' or `)
+	{State: s8, Input: runeclass.EOS}:         Accept,
+	{State: s8, Input: runeclass.WHITE_SPACE}: Accept,
+	{State: s8, Input: runeclass.NEWLINE}:     Accept,
+	{State: s8, Input: runeclass.LEFT_PAREN}:  Accept,
+	{State: s8, Input: runeclass.RIGHT_PAREN}: Accept,
+	{State: s8, Input: runeclass.DOUBLE_QUOT}: Accept,
+	{State: s8, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: s8, Input: runeclass.QUOTE_MARK}:  Accept,
+	{State: s8, Input: runeclass.COMMA}:       Accept,
+	{State: s8, Input: runeclass.AT_MARK}:     Accept,
+	{State: s8, Input: runeclass.SEMICOLON}:   Accept,
+	{State: s8, Input: runeclass.ANY_OTHER}:   Accept,
+	// s9: read a comma
+	{State: s9, Input: runeclass.EOS}:         Accept,
+	{State: s9, Input: runeclass.WHITE_SPACE}: Accept,
+	{State: s9, Input: runeclass.NEWLINE}:     Accept,
+	{State: s9, Input: runeclass.LEFT_PAREN}:  Accept,
+	{State: s9, Input: runeclass.RIGHT_PAREN}: Accept,
+	{State: s9, Input: runeclass.DOUBLE_QUOT}: Accept,
+	{State: s9, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: s9, Input: runeclass.QUOTE_MARK}:  Accept,
+	{State: s9, Input: runeclass.COMMA}:       Accept,
+	{State: s9, Input: runeclass.AT_MARK}:     s10,
+	{State: s9, Input: runeclass.SEMICOLON}:   Accept,
+	{State: s9, Input: runeclass.ANY_OTHER}:   Accept,
+	// s10: read a comma followed by '@'
+	{State: s10, Input: runeclass.EOS}:         Accept,
+	{State: s10, Input: runeclass.WHITE_SPACE}: Accept,
+	{State: s10, Input: runeclass.NEWLINE}:     Accept,
+	{State: s10, Input: runeclass.LEFT_PAREN}:  Accept,
+	{State: s10, Input: runeclass.RIGHT_PAREN}: Accept,
+	{State: s10, Input: runeclass.DOUBLE_QUOT}: Accept,
+	{State: s10, Input: runeclass.ESCAPE_CHAR}: Illegal,
+	{State: s10, Input: runeclass.QUOTE_MARK}:  Accept,
+	{State: s10, Input: runeclass.COMMA}:       Accept,
+	{State: s10, Input: runeclass.AT_MARK}:     Accept,
+	{State: s10, Input: runeclass.SEMICOLON}:   Accept,
+	{State: s10, Input: runeclass.ANY_OTHER}:   Accept,
+	// s11: read a line comment
+	{State: s11, Input: runeclass.EOS}:         Accept,
+	{State: s11, Input: runeclass.WHITE_SPACE}: s11,
+	{State: s11, Input: runeclass.NEWLINE}:     Start,
+	{State: s11, Input: runeclass.LEFT_PAREN}:  s11,
+	{State: s11, Input: runeclass.RIGHT_PAREN}: s11,
+	{State: s11, Input: runeclass.DOUBLE_QUOT}: s11,
+	{State: s11, Input: runeclass.ESCAPE_CHAR}: s11,
+	{State: s11, Input: runeclass.QUOTE_MARK}:  s11,
+	{State: s11, Input: runeclass.COMMA}:       s11,
+	{State: s11, Input: runeclass.AT_MARK}:     s11,
+	{State: s11, Input: runeclass.SEMICOLON}:   s11,
+	{State: s11, Input: runeclass.ANY_OTHER}:   s11,
 }
@@ -21,13 +21,13 @@ func NewWordScanner(input []rune) *WordScanner {
 	return &WordScanner{runes: input, cursor: 0, length: len(input)}
 }
 
-// The position to be read at the next ReadRune call.
+// The position to be read at the next NextRune call.
 func (ws *WordScanner) Cursor() int {
 	return ws.cursor
 }
 
 // PeekRune returns a rune at the distance position from the cursor.
-// Unlike ReadRune, the cursor won't be moved.
+// Unlike NextRune, the cursor won't be moved.
 func (ws *WordScanner) PeekRune(distance int) rune {
 	peekPos := ws.cursor + distance
 	if peekPos < 0 || peekPos >= ws.length {
@@ -36,9 +36,9 @@ func (ws *WordScanner) PeekRune(distance int) rune {
 	return ws.runes[peekPos]
 }
 
-// ReadRune returns a rune at the cursor position and move the cursor
+// NextRune returns a rune at the cursor position and move the cursor
 // forward.  It returns 0 at the end of input (as EOS).
-func (ws *WordScanner) ReadRune() rune {
+func (ws *WordScanner) NextRune() rune {
 	r := ws.PeekRune(0)
 	if r != 0 {
 		ws.cursor++
@@ -63,9 +63,10 @@ func (ws *WordScanner) NextWord() (leftPos int, rightPos int) {
 	var c runeclass.RuneClass
 
 	q := Start
+	prev := Start
 Loop:
 	for {
-		r = ws.ReadRune()
+		r = ws.NextRune()
 		c = runeClassify(r)
 
 		if debug {
@@ -73,14 +74,49 @@ Loop:
 			fmt.Printf("%d -> ", q)
 		}
 
-		q = transition[Edge{State: q, Input: c}]
+		if q == s4 && c == runeclass.ESCAPE_CHAR && ws.isCharPrefix(leftPos) {
+			// `#\` starts a character literal, and the next rune
+			// belongs to the word even if it is a delimiter.
+			if ws.NextRune() == 0 {
+				rightPos = ws.Cursor()
+				return
+			}
+			continue
+		}
+
+		if q == s4 && r == '=' && ws.isLabelPrefix(leftPos) {
+			// `#n=` is a datum label, and the datum after it, e.g.
+			// `#(...)`, starts another word.
+			rightPos = ws.Cursor()
+			return
+		}
+
+		if q == s4 && r == ';' && ws.Cursor()-leftPos == 2 && ws.runes[leftPos] == '#' {
+			// `#;` is a datum comment, which is not the start of a
+			// line comment.
+			rightPos = ws.Cursor()
+			return
+		}
+
+		if r == '|' && (q == Start || q == s4) {
+			// `|...|` encloses a symbol which may contain
+			// delimiters.
+			if !ws.skipBars() {
+				rightPos = ws.Cursor()
+				return
+			}
+			prev, q = q, s4
+			continue
+		}
+
+		prev, q = q, transition[Edge{State: q, Input: c}]
 
 		if debug {
 			fmt.Printf("%d\n", q)
 		}
 
 		switch q {
-		case Start: // skip whitespaces
+		case Start, s11: // skip whitespaces and comments
 			leftPos++
 		case s1:
 		case s2:
@@ -88,6 +124,10 @@ Loop:
 		case s4:
 		case s5:
 		case s6:
+		case s7:
+		case s8:
+		case s9:
+		case s10:
 		case Illegal: // read a character illegally since
 			// Something goes wrong, returns `false` to indicate such
 			// condition and also returns the last word which already
@@ -95,7 +135,14 @@ Loop:
 			rightPos = ws.Cursor()
 			return
 		case Accept:
-			if c != runeclass.EOS && c != runeclass.DOUBLE_QUOT {
+			switch {
+			case prev == s7:
+				// whitespaces after '(' do not belong to the word
+				ws.Unread(ws.Cursor() - (leftPos + 1))
+			case c == runeclass.EOS:
+			case prev == s3 && c == runeclass.DOUBLE_QUOT:
+				// the closing quotation mark belongs to the string
+			default:
 				ws.Unread(1)
 			}
 			rightPos = ws.Cursor()
@@ -105,6 +152,64 @@ Loop:
 	return
 }
 
+// NextTrivia reads whitespaces and comments from the cursor, which
+// NextWord skips otherwise, and returns their positions.
+func (ws *WordScanner) NextTrivia() (leftPos int, rightPos int) {
+	leftPos = ws.Cursor()
+	for {
+		switch runeClassify(ws.PeekRune(0)) {
+		case runeclass.WHITE_SPACE, runeclass.NEWLINE:
+			ws.NextRune()
+		case runeclass.SEMICOLON:
+			// a comment lasts until the end of the line, which is
+			// not a part of the comment
+			for r := ws.PeekRune(0); r != 0 && !runeclass.IsNewline(r); r = ws.PeekRune(0) {
+				ws.NextRune()
+			}
+		default:
+			return leftPos, ws.Cursor()
+		}
+	}
+}
+
+// skipBars moves the cursor after the vertical bar which closes the
+// one just read.  It returns false at the end of input.
+func (ws *WordScanner) skipBars() bool {
+	for {
+		switch ws.NextRune() {
+		case 0:
+			return false
+		case '\\':
+			if ws.NextRune() == 0 {
+				return false
+			}
+		case '|':
+			return true
+		}
+	}
+}
+
+// isCharPrefix reports whether the word which starts at left is `#\`
+// read so far.
+func (ws *WordScanner) isCharPrefix(left int) bool {
+	return ws.Cursor()-left == 2 && ws.runes[left] == '#'
+}
+
+// isLabelPrefix reports whether the word which starts at left is `#n=`
+// read so far, where n is digits.
+func (ws *WordScanner) isLabelPrefix(left int) bool {
+	digits := ws.runes[left+1 : ws.Cursor()-1]
+	if ws.runes[left] != '#' || len(digits) == 0 {
+		return false
+	}
+	for _, r := range digits {
+		if !runeclass.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
 func (ws *WordScanner) SubRunes(left int, right int) []rune {
 	if left < 0 || right > ws.length {
 		return nil
@@ -125,8 +230,18 @@ func runeClassify(r rune) (class runeclass.RuneClass) {
 		class = runeclass.DOUBLE_QUOT
 	case '\\':
 		class = runeclass.ESCAPE_CHAR
+	case '\'', '`':
+		class = runeclass.QUOTE_MARK
+	case ',':
+		class = runeclass.COMMA
+	case '@':
+		class = runeclass.AT_MARK
+	case ';':
+		class = runeclass.SEMICOLON
 	default:
-		if runeclass.IsWhitespace(r) {
+		if runeclass.IsNewline(r) {
+			class = runeclass.NEWLINE
+		} else if runeclass.IsWhitespace(r) {
 			class = runeclass.WHITE_SPACE
 		} else {
 			class = runeclass.ANY_OTHER
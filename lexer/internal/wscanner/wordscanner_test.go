@@ -51,13 +51,33 @@ func TestNextWord(t *testing.T) {
 		{21, "#f", []string{"#f"}},
 		{22, "#true", []string{"#true"}},
 		{23, "#false", []string{"#false"}},
+		// character
+		{25, `#\a`, []string{`#\a`}},
+		{26, `#\space`, []string{`#\space`}},
+		{27, `(#\( #\))`, []string{"(", `#\(`, `#\)`, ")"}},
+		{28, `#\  #\;`, []string{`#\ `, `#\;`}},
 		// string
 		{30, "\"hoge\"", []string{"\"hoge\""}},
 		{31, `"hoge\"fuga"`, []string{`"hoge\"fuga"`}},
+		// symbol enclosed by vertical bars
+		{40, "|a b|", []string{"|a b|"}},
+		{41, `(|x\|y| |(|)`, []string{"(", `|x\|y|`, "|(|", ")"}},
+		// datum label
+		{50, "#0=(a . #0#)", []string{"#0=", "(", "a", ".", "#0#", ")"}},
 		// list
 		{100, "(+ 1 2)", []string{"(", "+", "1", "2", ")"}},
 		{101, "(+ 10 234 (- 56 7) (* 8 9))",
 			[]string{"(", "+", "10", "234", "(", "-", "56", "7", ")", "(", "*", "8", "9", ")", ")"}},
+		{102, "( car x)", []string{"(", "car", "x", ")"}},
+		{103, "(\"a\" \"b\")", []string{"(", "\"a\"", "\"b\"", ")"}},
+		// quote marks
+		{110, "'a", []string{"'", "a"}},
+		{111, "`(a ,b ,@c)", []string{"`", "(", "a", ",", "b", ",@", "c", ")"}},
+		{112, "'()", []string{"'", "()"}},
+		// comments
+		{120, "; comment", nil},
+		{121, "a ; comment\nb", []string{"a", "b"}},
+		{122, "(a;comment\n)", []string{"(", "a", ")"}},
 	}
 
 	for _, tc := range tests {
@@ -73,3 +93,19 @@ func TestNextWord(t *testing.T) {
 		}
 	}
 }
+
+func TestNextTrivia(t *testing.T) {
+	s := NewWordScanner([]rune("  ; comment\n\tword ;last"))
+	expected := []string{"  ; comment\n\t", "word", " ;last", ""}
+
+	var actual []string
+	for range 2 {
+		l, r := s.NextTrivia()
+		actual = append(actual, string(s.SubRunes(l, r)))
+		l, r = s.NextWord()
+		actual = append(actual, string(s.SubRunes(l, r)))
+	}
+	if !cmpWords(expected, actual) {
+		t.Fatalf("expected=%q, got=%q", expected, actual)
+	}
+}
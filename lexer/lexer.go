@@ -3,8 +3,8 @@ package lexer
 import (
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
+	"strings"
 
 	"github.com/mnbi/gopische/lexer/internal/runeclass"
 	"github.com/mnbi/gopische/lexer/internal/wscanner"
@@ -16,20 +16,78 @@ type Lexer struct {
 	tokens []*token.Token
 	cursor int
 	input  []rune
+
+	// whether tokens keep the whitespaces and comments before them
+	keepTrivia bool
+	// whitespaces and comments after the last token
+	trailing string
 }
 
 // NewLexer accepts a string as a Scheme expression.  It analyzes the
 // input and converts it into a sequence of tokens.  If any error
-// ocurrs in the analysis, NewLexer returns nil.
+// ocurrs in the analysis, NewLexer returns nil.  Use Analyze to know
+// the error.
 func NewLexer(input string) *Lexer {
+	lexer, err := Analyze(input)
+	if err != nil {
+		return nil
+	}
+	return lexer
+}
+
+// Error is an error in the lexical analysis, with the line where it
+// occurs.
+type Error struct {
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Analyze is like NewLexer, but it returns an *Error instead of nil if
+// the analysis fails.
+func Analyze(input string) (*Lexer, error) {
 	runes := []rune(input)
 	// The number of tokens is less than the number of runes in input.
-	cap := len(runes)
-	lexer := Lexer{tokens: make([]*token.Token, 0, cap), input: runes}
-	if ok := lexer.analyze(); !ok {
+	lexer := Lexer{tokens: make([]*token.Token, 0, len(runes)), input: runes}
+	if err := lexer.analyze(); err != nil {
+		return nil, err
+	}
+	return &lexer, nil
+}
+
+// NewTriviaLexer is like NewLexer, but each token keeps the
+// whitespaces and comments before it as Trivia, so that the input can
+// be restored from the tokens, e.g. by a formatter.
+func NewTriviaLexer(input string) *Lexer {
+	lexer, err := AnalyzeTrivia(input)
+	if err != nil {
 		return nil
 	}
-	return &lexer
+	return lexer
+}
+
+// AnalyzeTrivia is like NewTriviaLexer, but it returns an *Error
+// instead of nil if the analysis fails.
+func AnalyzeTrivia(input string) (*Lexer, error) {
+	runes := []rune(input)
+	lexer := Lexer{tokens: make([]*token.Token, 0, len(runes)), input: runes, keepTrivia: true}
+	if err := lexer.analyze(); err != nil {
+		return nil, err
+	}
+	return &lexer, nil
+}
+
+// Trailing returns the whitespaces and comments after the last token,
+// which a lexer created by NewTriviaLexer keeps.
+func (l *Lexer) Trailing() string {
+	return l.trailing
 }
 
 func (l *Lexer) Length() int {
@@ -48,26 +106,39 @@ func (l *Lexer) NextToken() (tk *token.Token, ok bool) {
 	return tk, ok
 }
 
-func (l *Lexer) analyze() bool {
+func (l *Lexer) analyze() error {
 	wordScanner := wscanner.NewWordScanner(l.input)
 
 	var leftPos, rightPos int
-	var ok bool
+
+	line, lineStart, pos := 1, 0, 0
 
 	for {
+		triviaLeft, triviaRight := wordScanner.NextTrivia()
 		leftPos, rightPos = wordScanner.NextWord()
 		if leftPos == rightPos { // eos
-			ok = true
-			break
+			if l.keepTrivia {
+				l.trailing = string(l.input[triviaLeft:triviaRight])
+			}
+			return nil
 		}
-		if tk, err := l.createToken(leftPos, rightPos); err == nil {
-			l.tokens = append(l.tokens, tk)
-		} else {
-			log.Printf("fail to create token: %s\n", err)
-			return false
+		for ; pos < leftPos; pos++ {
+			if l.input[pos] == '\n' {
+				line++
+				lineStart = pos + 1
+			}
 		}
+		tk, err := l.createToken(leftPos, rightPos)
+		if err != nil {
+			return &Error{Line: line, Err: err}
+		}
+		tk.Line = line
+		tk.Column = leftPos - lineStart + 1
+		if l.keepTrivia {
+			tk.Trivia = string(l.input[triviaLeft:triviaRight])
+		}
+		l.tokens = append(l.tokens, tk)
 	}
-	return ok
 }
 
 func (l *Lexer) createToken(left int, right int) (tk *token.Token, err error) {
@@ -83,12 +154,36 @@ func (l *Lexer) createToken(left int, right int) (tk *token.Token, err error) {
 		return
 	}
 
+	if l.input[left] == '|' {
+		if sobj, err = parseBarSymbol(l.input[left:right]); err != nil {
+			return token.NewIllegalToken(lit), err
+		}
+		return token.NewToken(token.SYMBOL, lit, sobj), nil
+	}
+
 	if length == 1 {
 		switch l.input[left] {
 		case '(':
 			tt = token.LPAREN
 		case ')':
 			tt = token.RPAREN
+		case '\'':
+			tt = token.QUOTE
+		case '`':
+			tt = token.QUASIQUOTE
+		case ',':
+			tt = token.UNQUOTE
+		case '.':
+			tt = token.DOT
+		case '"':
+			err = errors.New("unterminated string")
+		case '#':
+			// "#" followed by a list starts a vector.
+			if right < len(l.input) && l.input[right] == '(' {
+				tt = token.VECTOR
+				break
+			}
+			fallthrough
 		default:
 			if runeclass.IsDigit(l.input[left]) {
 				sobj, err = parseNumber(lit)
@@ -113,13 +208,24 @@ func (l *Lexer) createToken(left int, right int) (tk *token.Token, err error) {
 	var currRune, nextRune = l.input[left], l.input[left+1]
 	switch currRune {
 	case '(':
-		if nextRune == ')' {
+		if l.input[right-1] == ')' {
 			tt = token.EMPTY_LIST
 		} else {
 			tt = token.ILLEGAL
 			err = errors.New("weird literal")
 		}
+	case ',':
+		if nextRune == '@' && length == 2 {
+			tt = token.UNQUOTE_SPLICING
+		} else {
+			tt = token.ILLEGAL
+			err = errors.New("weird literal")
+		}
 	case '"':
+		if !isClosedString(l.input[left:right]) {
+			err = errors.New("unterminated string")
+			break
+		}
 		lit := string(l.input[left+1 : right-1]) // eliminate quotation marks
 		if sobj, err = scheme.NewSchemeObject(scheme.STRING, lit); err == nil {
 			tt = token.STRING
@@ -129,6 +235,20 @@ func (l *Lexer) createToken(left int, right int) (tk *token.Token, err error) {
 			if sobj, err = parseBoolean(lit); err == nil {
 				tt = token.BOOLEAN
 			}
+		} else if nextRune == '\\' {
+			if sobj, err = scheme.ParseChar(lit); err == nil {
+				tt = token.CHARACTER
+			}
+		} else if lit == "#u8" {
+			tt = token.BYTEVECTOR
+		} else if lit == "#;" {
+			tt = token.DATUM_COMMENT
+		} else if n, ok := parseLabel(lit); ok {
+			sobj = scheme.NewInteger(n)
+			tt = token.LABEL
+			if lit[len(lit)-1] == '#' {
+				tt = token.LABEL_REF
+			}
 		} else {
 			tt = token.SYMBOL
 		}
@@ -178,6 +298,53 @@ func (l *Lexer) createToken(left int, right int) (tk *token.Token, err error) {
 	return
 }
 
+// isClosedString reports whether a string literal ends with an
+// unescaped quotation mark.
+func isClosedString(lit []rune) bool {
+	last := len(lit) - 1
+	if last < 1 || lit[last] != '"' {
+		return false
+	}
+	escapes := 0
+	for i := last - 1; i > 0 && lit[i] == '\\'; i-- {
+		escapes++
+	}
+	return escapes%2 == 0
+}
+
+// parseBarSymbol reads a symbol enclosed by vertical bars, whose name
+// may contain escape sequences as a string does.
+func parseBarSymbol(lit []rune) (scheme.Object, error) {
+	last := len(lit) - 1
+	escapes := 0
+	for i := last - 1; i > 0 && lit[i] == '\\'; i-- {
+		escapes++
+	}
+	if last < 1 || lit[last] != '|' || escapes%2 != 0 {
+		return nil, errors.New("unterminated symbol")
+	}
+	name, err := scheme.NewSchemeObject(scheme.STRING, string(lit[1:last]))
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewSymbol(name.Value().(string)), nil
+}
+
+// parseLabel reads the number of a datum label, #n= or #n#.
+func parseLabel(lit string) (int64, bool) {
+	if len(lit) < 3 || (lit[len(lit)-1] != '=' && lit[len(lit)-1] != '#') {
+		return 0, false
+	}
+	digits := lit[1 : len(lit)-1]
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	return n, err == nil
+}
+
 func parseBoolean(lit string) (sobj scheme.Object, err error) {
 	var bv bool
 
@@ -207,6 +374,17 @@ func parseNumber(lit string) (sobj scheme.Object, err error) {
 		}
 	}
 
+	if strings.ContainsRune(lit, '/') {
+		r, ok := scheme.ParseRational(lit, 10)
+		if !ok {
+			return nil, errors.New("bad rational number")
+		}
+		if sobj, ok = scheme.NewExact(r); !ok {
+			return nil, errors.New("integer overflow")
+		}
+		return sobj, nil
+	}
+
 	if fv64, err = strconv.ParseFloat(lit, 64); err == nil {
 		if sobj, err = scheme.NewSchemeObject(scheme.NUMBER, fv64); err == nil {
 			return
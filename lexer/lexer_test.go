@@ -3,6 +3,7 @@
 package lexer
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/mnbi/gopische/token"
@@ -36,6 +37,24 @@ func TestCreateToken(t *testing.T) {
 		{18, "#f", token.BOOLEAN},
 		{19, "#true", token.BOOLEAN},
 		{20, "#false", token.BOOLEAN},
+		{21, "'", token.QUOTE},
+		{22, "`", token.QUASIQUOTE},
+		{23, ",", token.UNQUOTE},
+		{24, ",@", token.UNQUOTE_SPLICING},
+		{25, ".", token.DOT},
+		{26, "( )", token.EMPTY_LIST},
+		{27, `"a\\"`, token.STRING},
+		{28, `#\a`, token.CHARACTER},
+		{29, `#\newline`, token.CHARACTER},
+		{30, `#\x3bb`, token.CHARACTER},
+		{31, `#\(`, token.CHARACTER},
+		{32, "#u8", token.BYTEVECTOR},
+		{33, "|a b|", token.SYMBOL},
+		{34, `|a\|b|`, token.SYMBOL},
+		{35, "#0=", token.LABEL},
+		{36, "#12#", token.LABEL_REF},
+		{37, "-1/2", token.NUMBER},
+		{38, "#;", token.DATUM_COMMENT},
 	}
 
 	for _, tc := range tests {
@@ -51,3 +70,81 @@ func TestCreateToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenSequence(t *testing.T) {
+	tests := []struct {
+		id       int
+		input    string
+		expected []token.TokenType
+	}{
+		{1, "#0=#(a #) #() #0=\"s\"", []token.TokenType{token.LABEL, token.VECTOR, token.LPAREN, token.SYMBOL, token.SYMBOL, token.RPAREN, token.VECTOR, token.EMPTY_LIST, token.LABEL, token.STRING}},
+		{2, "(1 #;2 #; (a) 3) #;#(b) ;c", []token.TokenType{token.LPAREN, token.NUMBER, token.DATUM_COMMENT, token.NUMBER, token.DATUM_COMMENT, token.LPAREN, token.SYMBOL, token.RPAREN, token.NUMBER, token.RPAREN, token.DATUM_COMMENT, token.VECTOR, token.LPAREN, token.SYMBOL, token.RPAREN}},
+	}
+
+	for _, tc := range tests {
+		l, err := Analyze(tc.input)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to analyze %q: %s", tc.id, tc.input, err)
+		}
+		if l.Length() != len(tc.expected) {
+			t.Fatalf("tests[%d] - wrong number of tokens, expected=%d, got=%d", tc.id, len(tc.expected), l.Length())
+		}
+		for i, tt := range tc.expected {
+			tk, _ := l.NextToken()
+			if tk.TokenType != tt {
+				t.Fatalf("tests[%d] - tokens[%d] - tokentype wrong, expected=%q, got=%q", tc.id, i, tt, tk.TokenType)
+			}
+		}
+	}
+}
+
+func TestTokenLine(t *testing.T) {
+	input := "(define x\n  \"a\nb\")\n\n; comment\ny"
+	expected := []int{1, 1, 1, 2, 3, 6}
+	columns := []int{1, 2, 9, 3, 3, 1}
+
+	l := NewLexer(input)
+	if l.Length() != len(expected) {
+		t.Fatalf("wrong number of tokens, expected=%d, got=%d", len(expected), l.Length())
+	}
+	for i, line := range expected {
+		tk, _ := l.NextToken()
+		if tk.Line != line {
+			t.Fatalf("tokens[%d] - wrong line, expected=%d, got=%d", i, line, tk.Line)
+		}
+		if tk.Column != columns[i] {
+			t.Fatalf("tokens[%d] - wrong column, expected=%d, got=%d", i, columns[i], tk.Column)
+		}
+	}
+
+	_, err := Analyze("(a\n \"b)")
+	var e *Error
+	if !errors.As(err, &e) || e.Line != 2 {
+		t.Fatalf("no error at line 2, got=%v", err)
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	input := "; head\n(a  b) ; tail\n\n  c \n; end\n"
+	expected := []string{"; head\n", "", "  ", "", " ; tail\n\n  "}
+
+	l := NewTriviaLexer(input)
+	if l.Length() != len(expected) {
+		t.Fatalf("wrong number of tokens, expected=%d, got=%d", len(expected), l.Length())
+	}
+	for i, trivia := range expected {
+		tk, _ := l.NextToken()
+		if tk.Trivia != trivia {
+			t.Fatalf("tokens[%d] - wrong trivia, expected=%q, got=%q", i, trivia, tk.Trivia)
+		}
+	}
+	if l.Trailing() != " \n; end\n" {
+		t.Fatalf("wrong trailing trivia, got=%q", l.Trailing())
+	}
+	if tk, _ := NewLexer(input).NextToken(); tk.Trivia != "" {
+		t.Fatalf("trivia kept by NewLexer, got=%q", tk.Trivia)
+	}
+	if _, err := AnalyzeTrivia("(a\n 1/0)"); err == nil {
+		t.Fatalf("no error for an illegal token")
+	}
+}
@@ -0,0 +1,423 @@
+package gopische
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// library is a set of bindings exported by a library, which is
+// defined by `define-library` or made from a builtin library.
+type library struct {
+	name    string
+	env     *environment
+	exports map[string]string // external name to internal name
+}
+
+// libraryBuiltins implement `import` and `define-library`, which the
+// expander turns into calls to them.  They are not bound to any
+// variable.
+var libraryBuiltins = []builtin{
+	{"%import", 0, -1, primImport},
+	{"%define-library", 2, 2, primDefineLibrary},
+}
+
+// libraryExts are the extensions of library files, in the order of
+// preference.
+var libraryExts = []string{".sld", ".scm"}
+
+// WithLibraryPath adds directories where `import` searches library
+// files.  The library (foo bar) is read from foo/bar.sld or
+// foo/bar.scm in one of them.
+func WithLibraryPath(dirs ...string) Option {
+	return func(interp *Interpreter) {
+		interp.libraryPath = append(interp.libraryPath, dirs...)
+	}
+}
+
+// libraryName returns the name of a library as a string, e.g.
+// "(foo bar)", and the path of its file without the extension.
+func libraryName(spec scheme.Object) (string, string, error) {
+	elems, ok := scheme.ListToSlice(spec)
+	if !ok || len(elems) == 0 {
+		return "", "", fmt.Errorf("bad library name: %s", spec)
+	}
+	parts := make([]string, len(elems))
+	for i, elem := range elems {
+		switch v := elem.(type) {
+		case *scheme.Symbol:
+			parts[i] = v.Name()
+		case *scheme.Number:
+			if n, ok := v.Value().(int64); ok && n >= 0 {
+				parts[i] = fmt.Sprint(n)
+				continue
+			}
+			return "", "", fmt.Errorf("bad library name: %s", spec)
+		default:
+			return "", "", fmt.Errorf("bad library name: %s", spec)
+		}
+	}
+	return "(" + strings.Join(parts, " ") + ")", filepath.Join(parts...), nil
+}
+
+// library returns a library, which is a builtin one, one defined
+// already, or one read from the library path.
+func (interp *Interpreter) library(m *machine, spec scheme.Object) (*library, error) {
+	name, rel, err := libraryName(spec)
+	if err != nil {
+		return nil, err
+	}
+	if lib, ok := interp.libraries[name]; ok {
+		return lib, nil
+	}
+	if b := findLibrary(name); b != nil {
+		if !interp.sandbox.allows(b) {
+			return nil, fmt.Errorf("library not available: %s", name)
+		}
+		lib := &library{name: name, env: newEnvironment(nil), exports: make(map[string]string)}
+		interp.importLibrary(lib.env, b)
+		for v := range lib.env.vars {
+			lib.exports[v] = v
+		}
+		interp.libraries[name] = lib
+		return lib, nil
+	}
+
+	if interp.loadingLibraries[name] {
+		return nil, fmt.Errorf("circular import of library: %s", name)
+	}
+	for _, dir := range interp.libraryPath {
+		for _, ext := range libraryExts {
+			path := filepath.Join(dir, rel+ext)
+			if _, err := interp.stat(path); err != nil {
+				continue
+			}
+			interp.loadingLibraries[name] = true
+			err := interp.load(m, path, newEnvironment(nil))
+			delete(interp.loadingLibraries, name)
+			if err != nil {
+				return nil, err
+			}
+			if lib, ok := interp.libraries[name]; ok {
+				return lib, nil
+			}
+			return nil, fmt.Errorf("%s: library not defined: %s", path, name)
+		}
+	}
+	return nil, fmt.Errorf("library not found: %s", name)
+}
+
+// importSet returns the bindings specified by an import set.
+func (interp *Interpreter) importSet(m *machine, spec scheme.Object) (map[string]*binding, error) {
+	elems, _ := scheme.ListToSlice(spec)
+	if pair, ok := spec.(*scheme.Pair); ok && len(elems) >= 2 {
+		if _, ok := elems[1].(*scheme.Pair); ok {
+			switch keyword(pair) {
+			case "only", "except", "prefix", "rename":
+				inner, err := interp.importSet(m, elems[1])
+				if err != nil {
+					return nil, err
+				}
+				return modifyImportSet(keyword(pair), spec, inner, elems[2:])
+			}
+		}
+	}
+
+	lib, err := interp.library(m, spec)
+	if err != nil {
+		return nil, err
+	}
+	bindings := make(map[string]*binding, len(lib.exports))
+	for external, internal := range lib.exports {
+		bindings[external] = lib.env.vars[internal]
+	}
+	return bindings, nil
+}
+
+func modifyImportSet(kind string, spec scheme.Object, set map[string]*binding, args []scheme.Object) (map[string]*binding, error) {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		if kind == "rename" {
+			continue
+		}
+		sym, ok := arg.(*scheme.Symbol)
+		if !ok {
+			return nil, &SyntaxError{Form: spec, Message: "bad import set"}
+		}
+		names[i] = sym.Name()
+	}
+
+	result := make(map[string]*binding)
+	switch kind {
+	case "only":
+		for _, name := range names {
+			b, ok := set[name]
+			if !ok {
+				return nil, fmt.Errorf("not exported: %s", name)
+			}
+			result[name] = b
+		}
+	case "except":
+		for name, b := range set {
+			result[name] = b
+		}
+		for _, name := range names {
+			if _, ok := set[name]; !ok {
+				return nil, fmt.Errorf("not exported: %s", name)
+			}
+			delete(result, name)
+		}
+	case "prefix":
+		if len(names) != 1 {
+			return nil, &SyntaxError{Form: spec, Message: "bad import set"}
+		}
+		for name, b := range set {
+			result[names[0]+name] = b
+		}
+	case "rename":
+		for name, b := range set {
+			result[name] = b
+		}
+		for _, arg := range args {
+			pair, ok := renamePair(arg)
+			if !ok {
+				return nil, &SyntaxError{Form: spec, Message: "bad import set"}
+			}
+			b, ok := set[pair[0]]
+			if !ok {
+				return nil, fmt.Errorf("not exported: %s", pair[0])
+			}
+			delete(result, pair[0])
+			result[pair[1]] = b
+		}
+	}
+	return result, nil
+}
+
+// renamePair returns the names of (from to).
+func renamePair(obj scheme.Object) ([2]string, bool) {
+	elems, ok := scheme.ListToSlice(obj)
+	if !ok || len(elems) != 2 {
+		return [2]string{}, false
+	}
+	from, ok1 := elems[0].(*scheme.Symbol)
+	to, ok2 := elems[1].(*scheme.Symbol)
+	if !ok1 || !ok2 {
+		return [2]string{}, false
+	}
+	return [2]string{from.Name(), to.Name()}, true
+}
+
+// importInto binds the variables of import sets in env.
+func (interp *Interpreter) importInto(m *machine, env *environment, specs []scheme.Object) error {
+	for _, spec := range specs {
+		bindings, err := interp.importSet(m, spec)
+		if err != nil {
+			return err
+		}
+		for name, b := range bindings {
+			env.alias(name, b)
+		}
+	}
+	return nil
+}
+
+// (%import set ...) imports into the environment of the running
+// top-level expression.
+func primImport(m *machine, args []scheme.Object) (scheme.Object, error) {
+	if err := m.interp.importInto(m, m.toplevel, args); err != nil {
+		return nil, err
+	}
+	return scheme.Unspecified, nil
+}
+
+// (%define-library form dir) defines a library.  Files included by
+// the library are relative to dir.
+func primDefineLibrary(m *machine, args []scheme.Object) (scheme.Object, error) {
+	dir, err := argString(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	form := args[0]
+	elems, ok := scheme.ListToSlice(form)
+	if !ok || len(elems) < 2 {
+		return nil, badSyntax(form)
+	}
+	name, _, err := libraryName(elems[1])
+	if err != nil {
+		return nil, err
+	}
+
+	interp := m.interp
+	lib := &library{name: name, env: newEnvironment(nil), exports: make(map[string]string)}
+	if err := interp.libraryDeclarations(m, lib, elems[2:], dir); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	for external, internal := range lib.exports {
+		if _, ok := lib.env.vars[internal]; !ok {
+			return nil, fmt.Errorf("%s: exported but not defined: %s", name, external)
+		}
+	}
+	interp.libraries[name] = lib
+	return scheme.Unspecified, nil
+}
+
+func (interp *Interpreter) libraryDeclarations(m *machine, lib *library, decls []scheme.Object, dir string) error {
+	for _, decl := range decls {
+		pair, ok := decl.(*scheme.Pair)
+		if !ok {
+			return &SyntaxError{Form: decl, Message: "bad library declaration"}
+		}
+		elems, ok := scheme.ListToSlice(decl)
+		if !ok {
+			return badSyntax(decl)
+		}
+		var err error
+		switch keyword(pair) {
+		case "export":
+			err = lib.export(decl, elems[1:])
+		case "import":
+			err = interp.importInto(m, lib.env, elems[1:])
+		case "begin":
+			err = interp.evalIn(m, lib.env, elems[1:])
+		case "include", "include-ci":
+			var data []scheme.Object
+			if data, _, err = interp.readIncludes(elems[1:], dir, keyword(pair) == "include-ci"); err == nil {
+				err = interp.evalIn(m, lib.env, data)
+			}
+		case "cond-expand":
+			var selected []scheme.Object
+			if selected, err = interp.condExpand(pair); err == nil {
+				err = interp.libraryDeclarations(m, lib, selected, dir)
+			}
+		case "include-library-declarations":
+			var data []scheme.Object
+			if data, _, err = interp.readIncludes(elems[1:], dir, false); err == nil {
+				err = interp.libraryDeclarations(m, lib, data, dir)
+			}
+		default:
+			err = &SyntaxError{Form: decl, Message: "bad library declaration"}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// export adds export specs, which are names or (rename internal
+// external).
+func (lib *library) export(decl scheme.Object, specs []scheme.Object) error {
+	for _, spec := range specs {
+		if sym, ok := spec.(*scheme.Symbol); ok {
+			lib.exports[sym.Name()] = sym.Name()
+			continue
+		}
+		if isForm(spec, "rename") {
+			if pair, ok := renamePair(spec.(*scheme.Pair).Cdr()); ok {
+				lib.exports[pair[1]] = pair[0]
+				continue
+			}
+		}
+		return &SyntaxError{Form: decl, Message: "bad export spec"}
+	}
+	return nil
+}
+
+// evalIn evaluates top-level forms in env.
+func (interp *Interpreter) evalIn(m *machine, env *environment, forms []scheme.Object) error {
+	x := &expander{interp: interp}
+	for _, form := range forms {
+		expr, err := x.expand(form)
+		if err != nil {
+			return err
+		}
+		if _, err := m.evaluate(expr, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIncludes reads the data in files, and returns them with the
+// paths of the files.  A relative path is resolved from dir.  With
+// foldCase, the names of symbols are folded into lower case, as
+// #!fold-case does.
+func (interp *Interpreter) readIncludes(files []scheme.Object, dir string, foldCase bool) ([]scheme.Object, []string, error) {
+	var data []scheme.Object
+	var paths []string
+	for _, file := range files {
+		s, ok := file.(*scheme.String)
+		if !ok {
+			return nil, nil, fmt.Errorf("bad file name: %s", file)
+		}
+		path := s.Value().(string)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if !interp.mayInclude(path) {
+			return nil, nil, fmt.Errorf("include not allowed in the sandbox: %s", path)
+		}
+		src, err := interp.readFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		elems, err := read(string(src), path, interp.symbols)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if foldCase {
+			for i := range elems {
+				elems[i] = interp.foldCase(elems[i])
+			}
+		}
+		data = append(data, elems...)
+		paths = append(paths, path)
+	}
+	return data, paths, nil
+}
+
+// mayInclude tells whether a file can be included.  A sandbox which
+// does not allow (scheme file) allows only the files in the library
+// path, unless the interpreter reads the file system of WithFS.
+func (interp *Interpreter) mayInclude(path string) bool {
+	if interp.sandbox == nil || interp.fsys != nil || interp.sandbox.allowed["(scheme file)"] {
+		return true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range interp.libraryPath {
+		if dir, err = filepath.Abs(dir); err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, abs); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (interp *Interpreter) foldCase(obj scheme.Object) scheme.Object {
+	switch v := obj.(type) {
+	case *scheme.Symbol:
+		return interp.symbols.Intern(strings.ToLower(v.Name()))
+	case *scheme.Pair:
+		pair := scheme.NewPair(interp.foldCase(v.Car()), interp.foldCase(v.Cdr()))
+		pair.SetLocation(v.Location())
+		return pair
+	}
+	return obj
+}
+
+// sourceDir returns the directory of the file where a form is read,
+// which relative paths in the form are resolved from.
+func sourceDir(form *scheme.Pair) string {
+	if loc := form.Location(); loc != nil && loc.File != "" {
+		return filepath.Dir(loc.File)
+	}
+	return "."
+}
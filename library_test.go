@@ -0,0 +1,170 @@
+// gopische/library_test.go
+
+package gopische
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const stackLibrary = `
+(define-library (data stack)
+  (export make-stack push! (rename stack-top top) size)
+  (import (scheme base))
+  (begin
+    (define size 0)
+    (define (make-stack) (list '()))
+    (define (push! s x) (set! size (+ size 1)) (set-car! s (cons x (car s))))
+    (define (stack-top s) (car (car s)))))
+`
+
+func TestDefineLibrary(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(import (data stack)) (define s (make-stack)) (push! s 1) (push! s 2) (top s)", "2"},
+		{2, "(import (prefix (data stack) st:)) (define s (st:make-stack)) (st:push! s 1) st:size", "1"},
+		{3, "(import (only (data stack) make-stack)) (procedure? make-stack)", "#t"},
+		{4, "(import (rename (data stack) (top peek))) (define s (make-stack)) (push! s 'a) (peek s)", "a"},
+		{5, "(import (except (data stack) size)) (define size 'mine) size", "mine"},
+		{6, "(eval '(procedure? top) (environment '(scheme base) '(only (data stack) top)))", "#t"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), stackLibrary); err != nil {
+			t.Fatalf("tests[%d] - fail to define the library: %s", tc.id, err)
+		}
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestDefineLibraryError(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(import (no such library))"},
+		{2, "(import (only (data stack) pop!))"},
+		{3, "(import (data stack)) (stack-top (make-stack))"},
+		{4, "(define-library (bad) (export x))"},
+		// a library sees only what it imports
+		{5, "(define-library (bad) (export f) (begin (define (f) (car '(1))))) (import (bad)) (f)"},
+		{6, "(define-library (bad) (frobnicate))"},
+		{7, "(import (rename (data stack) (pop! x)))"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), stackLibrary); err != nil {
+			t.Fatalf("tests[%d] - fail to define the library: %s", tc.id, err)
+		}
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
+
+func TestLibraryPath(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"geom/point.sld":   "(define-library (geom point) (include-library-declarations \"exports.scm\") (import (scheme base)) (include-ci \"impl.scm\"))",
+		"geom/exports.scm": "(export make-pt pt-x)",
+		"geom/impl.scm":    "(DEFINE (MAKE-PT X Y) (CONS X Y)) (define (pt-x p) (car p))",
+		"geom/v1.sld":      "(define-library (geom v1) (export v) (import (scheme base) (geom point)) (begin (define v (pt-x (make-pt 1 2)))))",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	interp := New(WithLibraryPath(dir))
+	value, err := interp.Eval(context.Background(), "(import (geom v1) (geom point)) (list v (pt-x (make-pt 3 4)))")
+	if err != nil {
+		t.Fatalf("fail to import: %s", err)
+	}
+	if value.String() != "(1 3)" {
+		t.Fatalf("wrong value, expected=(1 3), got=%s", value)
+	}
+
+	if _, err := New().Eval(context.Background(), "(import (geom point))"); err == nil {
+		t.Fatalf("no error without the library path")
+	}
+}
+
+func TestImportSandbox(t *testing.T) {
+	sandbox, err := NewSandbox("(scheme base)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interp := New(WithSandbox(sandbox))
+	if _, err := interp.Eval(context.Background(), "(import (scheme file))"); err == nil {
+		t.Fatalf("no error for a library denied by the sandbox")
+	}
+	if _, err := interp.Eval(context.Background(), "(define-library (l) (import (scheme file)))"); err == nil {
+		t.Fatalf("no error for a library importing a denied library")
+	}
+}
+
+func TestIncludeSandbox(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/geom/point.sld": "(define-library (geom point) (export x) (import (scheme base)) (include \"impl.scm\"))",
+		"lib/geom/impl.scm":  "(define x 1)",
+		"secret.scm":         "(define secret 42)",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := filepath.Join(dir, "secret.scm")
+
+	tests := []struct {
+		id       int
+		libs     []string
+		testcase string
+		allowed  bool
+	}{
+		{1, []string{"(scheme base)"}, "(import (geom point)) x", true},
+		{2, []string{"(scheme base)"}, `(include "` + secret + `") secret`, false},
+		{3, []string{"(scheme base)"}, `(include-ci "` + secret + `") secret`, false},
+		{4, []string{"(scheme base)"}, `(define-library (l) (import (scheme base)) (include "` + secret + `"))`, false},
+		{5, []string{"(scheme base)"}, `(define-library (l) (include-library-declarations "` + secret + `"))`, false},
+		{6, []string{"(scheme base)", "(scheme file)"}, `(include "` + secret + `") secret`, true},
+	}
+
+	for _, tc := range tests {
+		sandbox, err := NewSandbox(tc.libs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		interp := New(WithSandbox(sandbox), WithLibraryPath(filepath.Join(dir, "lib")))
+		_, err = interp.Eval(context.Background(), tc.testcase)
+		if tc.allowed && err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if !tc.allowed && err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
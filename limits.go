@@ -0,0 +1,127 @@
+package gopische
+
+import (
+	"fmt"
+)
+
+// Limits restricts resources which a single call of Eval, EvalObject
+// or Load may consume.  It is intended to run untrusted code.  A zero
+// field means no limit, except MaxDepth whose zero value means
+// DefaultMaxDepth.
+type Limits struct {
+	// MaxSteps limits the number of evaluation steps.
+	MaxSteps int64
+	// MaxDepth limits the depth of nested evaluations, which grows
+	// with non-tail recursive calls.
+	MaxDepth int
+	// MaxCells limits the number of pairs allocated.
+	MaxCells int64
+	// MaxStringBytes limits the total size of strings allocated.
+	MaxStringBytes int64
+}
+
+// DefaultMaxDepth is the depth limit used when Limits.MaxDepth is
+// zero.  It keeps deep recursions from exhausting the Go stack, which
+// would crash the host process.
+const DefaultMaxDepth = 100000
+
+// WithLimits sets resource limits of evaluations.
+func WithLimits(limits Limits) Option {
+	return func(interp *Interpreter) {
+		interp.limits = limits
+	}
+}
+
+// LimitKind tells which limit an evaluation hit.
+type LimitKind int
+
+const (
+	StepLimit LimitKind = iota
+	DepthLimit
+	CellLimit
+	StringBytesLimit
+)
+
+func (kind LimitKind) String() string {
+	switch kind {
+	case StepLimit:
+		return "steps"
+	case DepthLimit:
+		return "depth"
+	case CellLimit:
+		return "cells"
+	case StringBytesLimit:
+		return "string bytes"
+	}
+	return "unknown"
+}
+
+// LimitError is returned when an evaluation hits a limit given by
+// WithLimits.  Scheme code cannot catch it.
+type LimitError struct {
+	Kind  LimitKind
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("evaluation exceeded the limit of %s (%d)", e.Kind, e.Limit)
+}
+
+// checkInterval is the number of steps between checks of the context.
+const checkInterval = 1024
+
+// step counts an evaluation step.  It also checks the context of the
+// evaluation periodically.
+func (m *machine) step() error {
+	m.steps++
+	if limit := m.interp.limits.MaxSteps; limit > 0 && m.steps > limit {
+		return &LimitError{Kind: StepLimit, Limit: limit}
+	}
+	if m.steps%checkInterval == 0 {
+		return m.checkContext()
+	}
+	return nil
+}
+
+func (m *machine) checkContext() error {
+	if err := m.ctx.Err(); err != nil {
+		return fmt.Errorf("evaluation interrupted: %w", err)
+	}
+	return nil
+}
+
+// enter counts the depth of a nested evaluation.  Every successful
+// call must be paired with leave.
+func (m *machine) enter() error {
+	limit := m.interp.limits.MaxDepth
+	if limit == 0 {
+		limit = DefaultMaxDepth
+	}
+	if m.depth >= limit {
+		return &LimitError{Kind: DepthLimit, Limit: int64(limit)}
+	}
+	m.depth++
+	return nil
+}
+
+func (m *machine) leave() {
+	m.depth--
+}
+
+// allocCells accounts for n pairs about to be allocated.
+func (m *machine) allocCells(n int) error {
+	m.cells += int64(n)
+	if limit := m.interp.limits.MaxCells; limit > 0 && m.cells > limit {
+		return &LimitError{Kind: CellLimit, Limit: limit}
+	}
+	return nil
+}
+
+// allocString accounts for a string of n bytes about to be allocated.
+func (m *machine) allocString(n int) error {
+	m.stringBytes += int64(n)
+	if limit := m.interp.limits.MaxStringBytes; limit > 0 && m.stringBytes > limit {
+		return &LimitError{Kind: StringBytesLimit, Limit: limit}
+	}
+	return nil
+}
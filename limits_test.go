@@ -0,0 +1,132 @@
+// gopische/limits_test.go
+
+package gopische
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		id       int
+		limits   Limits
+		testcase string
+		expected LimitKind
+	}{
+		{1, Limits{MaxSteps: 10000}, "(define (loop) (loop)) (loop)", StepLimit},
+		{2, Limits{MaxDepth: 100}, "(define (f n) (+ 1 (f n))) (f 0)", DepthLimit},
+		{3, Limits{}, "(define (f n) (+ 1 (f n))) (f 0)", DepthLimit},
+		{4, Limits{MaxCells: 1000}, "(make-list 1001)", CellLimit},
+		{5, Limits{MaxCells: 1000}, "(let loop ((l '())) (loop (cons 1 l)))", CellLimit},
+		{6, Limits{MaxCells: 1000}, "(let loop ((l '())) (loop (append '(1 2) l)))", CellLimit},
+		{7, Limits{MaxStringBytes: 1000}, "(let loop ((s \"a\")) (loop (string-append s s)))", StringBytesLimit},
+		{8, Limits{MaxStringBytes: 1000}, "(let loop () (string-copy \"abcdefghij\") (loop))", StringBytesLimit},
+		{9, Limits{MaxCells: 1000}, "(define h (make-hash-table)) (let loop ((i 0)) (hash-table-set! h i i) (loop (+ i 1)))", CellLimit},
+		{10, Limits{MaxCells: 1000}, "(define h (make-hash-table)) (let loop ((i 0)) (hash-table-update!/default h i (lambda (x) x) 0) (loop (+ i 1)))", CellLimit},
+		{11, Limits{MaxCells: 1000}, "(hash-table-unfold (lambda (i) #f) (lambda (i) (values i i)) (lambda (i) (+ i 1)) 0 eqv?)", CellLimit},
+		{12, Limits{MaxCells: 1000}, "(define h (make-hash-table)) (do ((i 0 (+ i 1))) ((= i 400)) (hash-table-set! h i i)) (hash-table-copy h) (hash-table-copy h)", CellLimit},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithLimits(tc.limits))
+		_, err := interp.Eval(context.Background(), tc.testcase)
+		var le *LimitError
+		if !errors.As(err, &le) {
+			t.Fatalf("tests[%d] - expected a limit error, got %v", tc.id, err)
+		}
+		if le.Kind != tc.expected {
+			t.Fatalf("tests[%d] - wrong kind, expected=%s, got=%s", tc.id, tc.expected, le.Kind)
+		}
+	}
+}
+
+func TestLimitsPerEvaluation(t *testing.T) {
+	interp := New(WithLimits(Limits{MaxSteps: 10000}))
+	src := "(let loop ((i 0)) (if (< i 100) (loop (+ i 1)) i))"
+	for i := 0; i < 100; i++ {
+		if _, err := interp.Eval(context.Background(), src); err != nil {
+			t.Fatalf("limits must be counted per evaluation: %s", err)
+		}
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	interp := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := interp.Eval(ctx, "(define (loop) (loop)) (loop)")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = interp.Eval(ctx, "1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancel error, got %v", err)
+	}
+
+	// The interpreter is still usable after an interruption.
+	value, err := interp.Eval(context.Background(), "(+ 1 2)")
+	if err != nil || value.String() != "3" {
+		t.Fatalf("fail to evaluate after an interruption: %v, %v", value, err)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	interp := New()
+	interp.Define("crash", NewPrimitive("crash", 0, 0, func(args []scheme.Object) (scheme.Object, error) {
+		panic("boom")
+	}))
+	_, err := interp.Eval(context.Background(), "(crash)")
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected an internal error, got %v", err)
+	}
+}
+
+func TestDeeplyNestedInput(t *testing.T) {
+	interp := New()
+	src := strings.Repeat("(", 100000) + strings.Repeat(")", 100000)
+	if _, err := interp.Eval(context.Background(), src); err == nil {
+		t.Fatalf("expected an error for deeply nested input")
+	}
+}
+
+// Procedures walking a circular list fail instead of running forever.
+func TestCircularList(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(reverse l)"},
+		{2, "(append l '())"},
+		{3, "(list-copy l)"},
+		{4, "(memq 9 l)"},
+		{5, "(member 9 l)"},
+		{6, "(memv 9 l)"},
+		{7, "(list->vector l)"},
+		{8, "(apply + l)"},
+		{9, "(length l)"},
+		{10, "(define a (list (cons 1 2))) (set-cdr! a a) (assv 9 a)"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithLimits(Limits{MaxCells: 1000, MaxSteps: 1000000}))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := interp.Eval(ctx, "(define l (list 1 2)) (set-cdr! (cdr l) l) "+tc.testcase)
+		cancel()
+		if err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("tests[%d] - not stopped before the deadline: %s", tc.id, tc.testcase)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+// lsp/document.go
+
+package lsp
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/mnbi/gopische"
+	"github.com/mnbi/gopische/lexer"
+	"github.com/mnbi/gopische/scheme"
+	"github.com/mnbi/gopische/token"
+)
+
+// document is an open source file, which is analyzed whenever it
+// changes.
+type document struct {
+	uri   string
+	path  string
+	lines []string
+
+	tokens      []*token.Token
+	defs        []*definition
+	diagnostics []diagnostic
+
+	// an interpreter which knows the builtin procedures, and never
+	// evaluates the document
+	interp *gopische.Interpreter
+	// the bindings made by the import sets of the document
+	imports map[string]scheme.Object
+}
+
+// form is a datum made of tokens.
+type form struct {
+	tok   *token.Token // an atom, an opening parenthesis, or a prefix
+	elems []*form      // the elements of a list, or the datum of a prefix
+	close *token.Token // the closing parenthesis, nil if missing
+}
+
+// definition is a variable defined at the top level of a document.
+type definition struct {
+	name string
+	tok  *token.Token // the name in the definition
+	form *form        // the whole definition
+	kind int          // symbolFunction, symbolVariable or symbolStruct
+
+	// the formals of a procedure, and its rest one after a dot
+	params []string
+	rest   string
+}
+
+func newDocument(uri string, text string, imports *importCache) *document {
+	d := &document{uri: uri, path: uriPath(uri), lines: strings.Split(text, "\n"), imports: make(map[string]scheme.Object)}
+	d.interp = gopische.New(
+		gopische.WithStdin(strings.NewReader("")),
+		gopische.WithStdout(io.Discard),
+		gopische.WithStderr(io.Discard),
+		gopische.WithLibraryPath(append([]string{filepath.Dir(d.path)}, imports.libraryPath...)...),
+	)
+
+	for _, e := range d.interp.Check(text, d.path) {
+		d.addDiagnostic(e.Line-1, e.Err.Error())
+	}
+	l, err := lexer.Analyze(text)
+	if err != nil {
+		return d
+	}
+	for tk, ok := l.NextToken(); ok; tk, ok = l.NextToken() {
+		d.tokens = append(d.tokens, tk)
+	}
+	forms := parseForms(d.tokens)
+	d.defs = definitions(forms, nil)
+	d.importLibraries(forms, imports)
+	return d
+}
+
+func (d *document) addDiagnostic(line int, message string) {
+	line = max(0, min(line, len(d.lines)-1))
+	d.diagnostics = append(d.diagnostics, diagnostic{
+		Range: textRange{
+			Start: position{Line: line},
+			End:   position{Line: line, Character: utf16Len(d.lines[line])},
+		},
+		Severity: severityError,
+		Source:   "gopische",
+		Message:  message,
+	})
+}
+
+// parseForms builds the forms from tokens.  Missing parentheses are
+// tolerated, since a document may be in the middle of editing.  Datum
+// comments are dropped with their data.
+func parseForms(tokens []*token.Token) []*form {
+	var parse func() *form
+	i := 0
+	parse = func() *form {
+		for i < len(tokens) && tokens[i].TokenType == token.RPAREN {
+			i++
+		}
+		if i == len(tokens) {
+			return nil
+		}
+		f := &form{tok: tokens[i]}
+		i++
+		switch f.tok.TokenType {
+		case token.LPAREN:
+			for i < len(tokens) {
+				if tokens[i].TokenType == token.RPAREN {
+					f.close = tokens[i]
+					i++
+					break
+				}
+				if elem := parse(); elem != nil && !elem.comment() {
+					f.elems = append(f.elems, elem)
+				}
+			}
+		case token.QUOTE, token.QUASIQUOTE, token.UNQUOTE, token.UNQUOTE_SPLICING, token.BYTEVECTOR, token.VECTOR, token.LABEL, token.DATUM_COMMENT:
+			if datum := parse(); datum != nil && !datum.comment() {
+				f.elems = []*form{datum}
+			}
+		}
+		return f
+	}
+
+	var forms []*form
+	for f := parse(); f != nil; f = parse() {
+		if !f.comment() {
+			forms = append(forms, f)
+		}
+	}
+	return forms
+}
+
+// comment reports whether a form is a datum comment.
+func (f *form) comment() bool {
+	return f.tok.TokenType == token.DATUM_COMMENT
+}
+
+// symbol returns the name of a symbol.
+func (f *form) symbol() (string, bool) {
+	if f.tok.TokenType != token.SYMBOL {
+		return "", false
+	}
+	if sym, ok := f.tok.Value.(*scheme.Symbol); ok {
+		return sym.Name(), true
+	}
+	return f.tok.Literal, true
+}
+
+// keyword returns the name of the symbol at the head of a list.
+func (f *form) keyword() string {
+	if f.tok.TokenType != token.LPAREN || len(f.elems) == 0 {
+		return ""
+	}
+	name, _ := f.elems[0].symbol()
+	return name
+}
+
+// last returns the last token of a form.
+func (f *form) last() *token.Token {
+	if f.close != nil {
+		return f.close
+	}
+	if len(f.elems) > 0 {
+		return f.elems[len(f.elems)-1].last()
+	}
+	return f.tok
+}
+
+// definitions appends the definitions in forms to defs.  The bodies
+// of `begin` and `define-library` are at the top level too.
+func definitions(forms []*form, defs []*definition) []*definition {
+	for _, f := range forms {
+		elems := f.elems
+		switch f.keyword() {
+		case "define":
+			if len(elems) < 2 {
+				continue
+			}
+			if name, ok := elems[1].symbol(); ok {
+				def := &definition{name: name, tok: elems[1].tok, form: f, kind: symbolVariable}
+				if len(elems) > 2 && elems[2].keyword() == "lambda" && len(elems[2].elems) > 1 {
+					def.kind = symbolFunction
+					def.params, def.rest = formals(elems[2].elems[1])
+				}
+				defs = append(defs, def)
+			} else if elems[1].keyword() != "" {
+				target := elems[1]
+				name, _ := target.elems[0].symbol()
+				def := &definition{name: name, tok: target.elems[0].tok, form: f, kind: symbolFunction}
+				def.params, def.rest = formals(&form{tok: target.tok, elems: target.elems[1:]})
+				defs = append(defs, def)
+			}
+		case "define-values":
+			if len(elems) > 1 {
+				for _, v := range append([]*form{elems[1]}, elems[1].elems...) {
+					if name, ok := v.symbol(); ok {
+						defs = append(defs, &definition{name: name, tok: v.tok, form: f, kind: symbolVariable})
+					}
+				}
+			}
+		case "define-record-type":
+			for i, spec := range elems[1:] {
+				kind := symbolFunction
+				if i == 0 {
+					kind = symbolStruct
+				}
+				names := []*form{spec}
+				if i >= 3 {
+					// accessors and modifiers of a field
+					names = spec.elems[min(1, len(spec.elems)):]
+				} else if spec.keyword() != "" {
+					names = spec.elems[:1]
+				}
+				for _, n := range names {
+					if name, ok := n.symbol(); ok {
+						defs = append(defs, &definition{name: name, tok: n.tok, form: f, kind: kind})
+					}
+				}
+			}
+		case "begin":
+			defs = definitions(elems[1:], defs)
+		case "define-library":
+			for _, decl := range elems[min(2, len(elems)):] {
+				if decl.keyword() == "begin" {
+					defs = definitions(decl.elems[1:], defs)
+				}
+			}
+		}
+	}
+	return defs
+}
+
+// formals returns the names of the formals of a procedure.
+func formals(f *form) ([]string, string) {
+	if name, ok := f.symbol(); ok {
+		return nil, name
+	}
+	var params []string
+	for i, elem := range f.elems {
+		if elem.tok.TokenType == token.DOT {
+			if i+1 < len(f.elems) {
+				rest, _ := f.elems[i+1].symbol()
+				return params, rest
+			}
+			break
+		}
+		name, _ := elem.symbol()
+		params = append(params, name)
+	}
+	return params, ""
+}
+
+// signature returns how a procedure is called, e.g. (f a b . c).
+func (def *definition) signature() string {
+	if def.kind != symbolFunction || def.form.keyword() == "define-record-type" {
+		return def.name
+	}
+	s := "(" + strings.Join(append([]string{def.name}, def.params...), " ")
+	if def.rest != "" {
+		s += " . " + def.rest
+	}
+	return s + ")"
+}
+
+// importLibraries collects the bindings of the import sets of the
+// document, so that they are known.  Builtin libraries are known
+// already, and the others are loaded through the cache.
+func (d *document) importLibraries(forms []*form, imports *importCache) {
+	var sets []*form
+	for _, f := range forms {
+		switch f.keyword() {
+		case "import":
+			sets = append(sets, f)
+		case "define-library":
+			for _, decl := range f.elems[min(2, len(f.elems)):] {
+				if decl.keyword() == "import" {
+					sets = append(sets, decl)
+				}
+			}
+		}
+	}
+
+	for _, f := range sets {
+		for _, set := range f.elems[1:] {
+			if imports.isBuiltin(set) {
+				continue
+			}
+			bindings, err := imports.bindings(filepath.Dir(d.path), d.text(set))
+			if err != nil {
+				d.addDiagnostic(set.tok.Line-1, err.Error())
+			}
+			maps.Copy(d.imports, bindings)
+		}
+	}
+}
+
+// lookup returns the value of a name imported by the document, or of
+// a builtin procedure.
+func (d *document) lookup(name string) (scheme.Object, bool) {
+	if value, ok := d.imports[name]; ok {
+		return value, true
+	}
+	return d.interp.Lookup(name)
+}
+
+// names returns the names imported by the document and the ones of the
+// builtin procedures in sorted order.
+func (d *document) names() []string {
+	names := d.interp.Names()
+	for name := range d.imports {
+		if _, ok := d.interp.Lookup(name); !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// text returns the source of a form.
+func (d *document) text(f *form) string {
+	start, end := f.tok, f.last()
+	if start.Line == end.Line {
+		runes := []rune(d.lines[start.Line-1])
+		return string(runes[start.Column-1 : end.Column-1+len([]rune(end.Literal))])
+	}
+	lines := []string{string([]rune(d.lines[start.Line-1])[start.Column-1:])}
+	lines = append(lines, d.lines[start.Line:end.Line-1]...)
+	lines = append(lines, string([]rune(d.lines[end.Line-1])[:end.Column-1+len([]rune(end.Literal))]))
+	return strings.Join(lines, "\n")
+}
+
+// position returns the position of the column of a line, where both
+// count from 1.
+func (d *document) position(line int, column int) position {
+	runes := []rune(d.lines[line-1])
+	column = min(column-1, len(runes))
+	return position{Line: line - 1, Character: utf16Len(string(runes[:column]))}
+}
+
+// tokenRange returns the range of a token.
+func (d *document) tokenRange(tk *token.Token) textRange {
+	return textRange{
+		Start: d.position(tk.Line, tk.Column),
+		End:   d.position(tk.Line, tk.Column+len([]rune(tk.Literal))),
+	}
+}
+
+// formRange returns the range of a form.
+func (d *document) formRange(f *form) textRange {
+	return textRange{Start: d.tokenRange(f.tok).Start, End: d.tokenRange(f.last()).End}
+}
+
+// symbolAt returns the symbol at a position.  With touching, it also
+// returns the symbol which ends at the position, as the one being
+// completed.
+func (d *document) symbolAt(pos position, touching bool) *token.Token {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return nil
+	}
+	// the column of the position in runes, counting from 1
+	column, units := 1, 0
+	for _, r := range d.lines[pos.Line] {
+		if units += utf16.RuneLen(r); units > pos.Character {
+			break
+		}
+		column++
+	}
+	for _, tk := range d.tokens {
+		if tk.Line != pos.Line+1 || tk.TokenType != token.SYMBOL {
+			continue
+		}
+		end := tk.Column + len([]rune(tk.Literal))
+		if tk.Column <= column && (column < end || (touching && column == end)) {
+			return tk
+		}
+	}
+	return nil
+}
+
+// definition returns the definition of a name in the document.
+func (d *document) definition(name string) *definition {
+	for _, def := range d.defs {
+		if def.name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// utf16Prefix returns the first n UTF-16 code units of s.
+func utf16Prefix(s string, n int) string {
+	units := 0
+	for i, r := range s {
+		if units >= n {
+			return s[:i]
+		}
+		units += utf16.RuneLen(r)
+	}
+	return s
+}
+
+// uriPath returns the path of a file URI, or "" for other URIs.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// fileURI returns the URI of a file.
+func fileURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// arityText describes the number of arguments which a procedure takes.
+func arityText(a scheme.Arity) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case a.Rest:
+		return "at least " + plural(a.Required)
+	case a.Optional > 0:
+		return fmt.Sprintf("%d to %s", a.Required, plural(a.Required+a.Optional))
+	}
+	return plural(a.Required)
+}
@@ -0,0 +1,109 @@
+// lsp/imports.go
+
+package lsp
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mnbi/gopische"
+	"github.com/mnbi/gopische/scheme"
+	"github.com/mnbi/gopische/token"
+)
+
+// importTimeout limits the time to load the libraries of an import
+// set, and importLimits the evaluation steps.
+const importTimeout = 5 * time.Second
+
+var importLimits = gopische.Limits{MaxSteps: 1_000_000}
+
+// deniedLibraries are the builtin libraries which the libraries loaded
+// by the server cannot use, so that opening a document never touches
+// files or processes.
+var deniedLibraries = []string{"(scheme file)", "(scheme load)", "(scheme process-context)"}
+
+// importCache holds the bindings made by the import sets of documents,
+// so that a library is loaded once, not whenever a document changes.
+// The libraries are loaded by sandboxed interpreters.
+type importCache struct {
+	libraryPath []string
+	sandbox     *gopische.Sandbox
+	builtins    map[string]bool
+
+	// the bindings by the directory of a document and an import set
+	entries map[string]*importEntry
+}
+
+type importEntry struct {
+	bindings map[string]scheme.Object
+	err      error
+}
+
+func newImportCache(libraryPath []string) *importCache {
+	c := &importCache{libraryPath: libraryPath, builtins: make(map[string]bool), entries: make(map[string]*importEntry)}
+	for _, lib := range gopische.Libraries() {
+		c.builtins[lib] = true
+	}
+	c.sandbox, _ = gopische.NewSandbox(gopische.Libraries()...)
+	for _, lib := range deniedLibraries {
+		_ = c.sandbox.Deny(lib)
+	}
+	return c
+}
+
+// bindings returns the bindings which an import set makes, where set
+// is its source in a document in dir.
+func (c *importCache) bindings(dir string, set string) (map[string]scheme.Object, error) {
+	key := dir + "\x00" + set
+	if e, ok := c.entries[key]; ok {
+		return e.bindings, e.err
+	}
+	interp := gopische.New(
+		gopische.WithSandbox(c.sandbox),
+		gopische.WithLimits(importLimits),
+		gopische.WithStdin(strings.NewReader("")),
+		gopische.WithStdout(io.Discard),
+		gopische.WithStderr(io.Discard),
+		gopische.WithLibraryPath(append([]string{dir}, c.libraryPath...)...),
+	)
+	before := make(map[string]scheme.Object)
+	for _, name := range interp.Names() {
+		before[name], _ = interp.Lookup(name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeout)
+	defer cancel()
+	e := &importEntry{bindings: make(map[string]scheme.Object)}
+	if _, e.err = interp.Eval(ctx, "(import "+set+")"); e.err == nil {
+		for _, name := range interp.Names() {
+			if value, _ := interp.Lookup(name); value != before[name] {
+				e.bindings[name] = value
+			}
+		}
+	}
+	c.entries[key] = e
+	return e.bindings, e.err
+}
+
+// clear forgets all bindings, e.g. when a library may be modified.
+func (c *importCache) clear() {
+	clear(c.entries)
+}
+
+// isBuiltin tells whether an import set imports a builtin library,
+// which every document knows without loading it.
+func (c *importCache) isBuiltin(set *form) bool {
+	switch set.keyword() {
+	case "only", "except", "prefix", "rename":
+		if len(set.elems) > 1 && set.elems[1].tok.TokenType == token.LPAREN {
+			return c.isBuiltin(set.elems[1])
+		}
+	}
+	parts := make([]string, len(set.elems))
+	for i, elem := range set.elems {
+		parts[i] = elem.tok.Literal
+	}
+	return c.builtins["("+strings.Join(parts, " ")+")"]
+}
@@ -0,0 +1,342 @@
+// lsp/server.go
+
+// Package lsp implements a server of the Language Server Protocol for
+// Scheme sources, which `gopische lsp` runs over the standard input
+// and output.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+var errMethodNotFound = errors.New("method not found")
+
+type server struct {
+	out     io.Writer
+	imports *importCache
+	docs    map[string]*document
+}
+
+type handler func(s *server, params json.RawMessage) (any, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":                  handleInitialize,
+		"initialized":                 handleNothing,
+		"shutdown":                    handleNothing,
+		"textDocument/didOpen":        handleDidOpen,
+		"textDocument/didChange":      handleDidChange,
+		"textDocument/didClose":       handleDidClose,
+		"textDocument/hover":          handleHover,
+		"textDocument/definition":     handleDefinition,
+		"textDocument/completion":     handleCompletion,
+		"textDocument/documentSymbol": handleDocumentSymbol,
+	}
+}
+
+// Serve reads requests from r and writes responses to w until the
+// client sends `exit` or r ends.  Libraries imported by documents are
+// searched in the directories of the documents, and then in
+// libraryPath.  They are loaded once in a sandbox which has no access
+// to files and processes.
+func Serve(r io.Reader, w io.Writer, libraryPath ...string) error {
+	s := &server{out: w, imports: newImportCache(libraryPath), docs: make(map[string]*document)}
+	br := bufio.NewReader(r)
+	for {
+		content, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			if err := s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(req.Method, req.Params)
+		if req.ID == nil {
+			// no responses to notifications
+			continue
+		}
+		if err != nil {
+			var rerr *responseError
+			switch {
+			case errors.As(err, &rerr):
+			case errors.Is(err, errMethodNotFound):
+				rerr = &responseError{Code: codeMethodNotFound, Message: err.Error()}
+			default:
+				rerr = &responseError{Code: codeInternalError, Message: err.Error()}
+			}
+			err = s.reply(req.ID, nil, rerr)
+		} else {
+			err = s.reply(req.ID, result, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(method string, params json.RawMessage) (any, error) {
+	h, ok := handlers[method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errMethodNotFound, method)
+	}
+	return h(s, params)
+}
+
+func (s *server) reply(id json.RawMessage, result any, rerr *responseError) error {
+	res := response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if id == nil {
+		res.ID = json.RawMessage("null")
+	}
+	if rerr == nil {
+		content, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		res.Result = content
+	}
+	return writeMessage(s.out, res)
+}
+
+func (s *server) notify(method string, params any) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// decode reads the parameters of a request.
+func decode[T any](params json.RawMessage) (T, error) {
+	var v T
+	if err := json.Unmarshal(params, &v); err != nil {
+		return v, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return v, nil
+}
+
+func handleNothing(s *server, params json.RawMessage) (any, error) {
+	return nil, nil
+}
+
+func handleInitialize(s *server, params json.RawMessage) (any, error) {
+	var result initializeResult
+	result.Capabilities = serverCapabilities{
+		TextDocumentSync:       1, // the whole text of a document
+		HoverProvider:          true,
+		DefinitionProvider:     true,
+		CompletionProvider:     map[string]any{},
+		DocumentSymbolProvider: true,
+	}
+	result.ServerInfo.Name = "gopische"
+	return result, nil
+}
+
+// open analyzes a document and publishes the diagnostics.  A library
+// file being edited may change the bindings of imports, so that they
+// are loaded again.
+func (s *server) open(uri string, text string) error {
+	if filepath.Ext(uriPath(uri)) == ".sld" {
+		s.imports.clear()
+	}
+	d := newDocument(uri, text, s.imports)
+	s.docs[uri] = d
+	diagnostics := d.diagnostics
+	if diagnostics == nil {
+		diagnostics = []diagnostic{}
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func handleDidOpen(s *server, params json.RawMessage) (any, error) {
+	p, err := decode[didOpenParams](params)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.open(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func handleDidChange(s *server, params json.RawMessage) (any, error) {
+	p, err := decode[didChangeParams](params)
+	if err != nil || len(p.ContentChanges) == 0 {
+		return nil, err
+	}
+	return nil, s.open(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func handleDidClose(s *server, params json.RawMessage) (any, error) {
+	p, err := decode[didCloseParams](params)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+}
+
+// document returns the document of a request.
+func (s *server) document(uri string) (*document, error) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "document not open: " + uri}
+	}
+	return d, nil
+}
+
+func handleHover(s *server, params json.RawMessage) (any, error) {
+	p, err := decode[positionParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	tk := d.symbolAt(p.Position, false)
+	if tk == nil {
+		return nil, nil
+	}
+	name, _ := (&form{tok: tk}).symbol()
+
+	var text string
+	if def := d.definition(name); def != nil {
+		text = fmt.Sprintf("```scheme\n%s\n```\n", def.signature())
+		if def.kind == symbolFunction && def.form.keyword() == "define" {
+			text += fmt.Sprintf("procedure taking %s, ", arityText(scheme.Arity{Required: len(def.params), Rest: def.rest != ""}))
+		}
+		text += fmt.Sprintf("defined at line %d", def.tok.Line)
+	} else if value, ok := d.lookup(name); ok {
+		text = fmt.Sprintf("```scheme\n%s\n```\n", name)
+		if proc, ok := value.(*scheme.Procedure); ok {
+			text += "procedure taking " + arityText(proc.Arity())
+			if loc := proc.Location(); loc != nil && loc.File != "" {
+				text += ", defined at " + loc.String()
+			}
+		} else {
+			text += "variable: " + truncate(scheme.Write(value), 80)
+		}
+	} else {
+		return nil, nil
+	}
+	r := d.tokenRange(tk)
+	return hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: &r}, nil
+}
+
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n]) + "..."
+	}
+	return s
+}
+
+func handleDefinition(s *server, params json.RawMessage) (any, error) {
+	p, err := decode[positionParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	tk := d.symbolAt(p.Position, false)
+	if tk == nil {
+		return nil, nil
+	}
+	name, _ := (&form{tok: tk}).symbol()
+
+	if def := d.definition(name); def != nil {
+		return location{URI: d.uri, Range: d.tokenRange(def.tok)}, nil
+	}
+	// a procedure defined in a library file
+	if value, ok := d.lookup(name); ok {
+		if proc, ok := value.(*scheme.Procedure); ok {
+			if loc := proc.Location(); loc != nil && loc.File != "" {
+				start := position{Line: loc.Line - 1}
+				return location{URI: fileURI(loc.File), Range: textRange{Start: start, End: start}}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func handleCompletion(s *server, params json.RawMessage) (any, error) {
+	p, err := decode[positionParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	var prefix string
+	if tk := d.symbolAt(p.Position, true); tk != nil {
+		start := d.tokenRange(tk).Start.Character
+		prefix = utf16Prefix(tk.Literal, p.Position.Character-start)
+	}
+
+	items := []completionItem{}
+	seen := make(map[string]bool)
+	for _, def := range d.defs {
+		if seen[def.name] || !strings.HasPrefix(def.name, prefix) {
+			continue
+		}
+		seen[def.name] = true
+		kind := completionVariable
+		if def.kind == symbolFunction {
+			kind = completionFunction
+		}
+		items = append(items, completionItem{Label: def.name, Kind: kind, Detail: def.signature()})
+	}
+	for _, name := range d.names() {
+		if seen[name] || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		item := completionItem{Label: name, Kind: completionVariable}
+		if value, _ := d.lookup(name); value != nil {
+			if proc, ok := value.(*scheme.Procedure); ok {
+				item.Kind = completionFunction
+				item.Detail = arityText(proc.Arity())
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func handleDocumentSymbol(s *server, params json.RawMessage) (any, error) {
+	p, err := decode[documentSymbolParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbols := []documentSymbol{}
+	for _, def := range d.defs {
+		symbols = append(symbols, documentSymbol{
+			Name:           def.name,
+			Detail:         def.signature(),
+			Kind:           def.kind,
+			Range:          d.formRange(def.form),
+			SelectionRange: d.tokenRange(def.tok),
+		})
+	}
+	return symbols, nil
+}
@@ -0,0 +1,180 @@
+// gopische/lsp/server_test.go
+
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// session runs the server with requests, and returns the responses
+// by their IDs and the notifications.
+func session(t *testing.T, requests []string) (map[int]response, []notification) {
+	t.Helper()
+	var in bytes.Buffer
+	for _, req := range requests {
+		if err := writeMessage(&in, json.RawMessage(req)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := Serve(&in, &out); err != nil {
+		t.Fatalf("fail to serve: %s", err)
+	}
+
+	responses := make(map[int]response)
+	var notifications []notification
+	r := bufio.NewReader(&out)
+	for {
+		content, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var msg struct {
+			response
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(content, &msg); err != nil {
+			t.Fatalf("bad message: %s", content)
+		}
+		if msg.Method != "" {
+			notifications = append(notifications, notification{Method: msg.Method, Params: msg.Params})
+			continue
+		}
+		var id int
+		_ = json.Unmarshal(msg.ID, &id)
+		responses[id] = msg.response
+	}
+	return responses, notifications
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "util", "math.sld")
+	if err := os.MkdirAll(filepath.Dir(lib), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := "(define-library (util math)\n  (export double)\n  (import (scheme base))\n  (begin\n    (define (double x) (* x 2))))\n"
+	if err := os.WriteFile(lib, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	uri := fileURI(filepath.Join(dir, "main.scm"))
+	text := strings.Join([]string{
+		"(import (util math))",
+		"(define (square x) (* x x))",
+		"(define pi 3.14) #;(define tau 6.28)",
+		"(if)",
+		"(display (square (double pi)))",
+		"(squ",
+	}, "\n")
+	at := func(id int, method string, line, char int) string {
+		return `{"jsonrpc":"2.0","id":` + strconv.Itoa(id) + `,"method":"` + method + `","params":{"textDocument":{"uri":"` + uri + `"},"position":{"line":` + strconv.Itoa(line) + `,"character":` + strconv.Itoa(char) + `}}}`
+	}
+	textJSON, _ := json.Marshal(text)
+
+	responses, notifications := session(t, []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"` + uri + `","version":1,"text":` + string(textJSON) + `}}}`,
+		at(2, "textDocument/hover", 4, 12),
+		at(3, "textDocument/hover", 4, 3),
+		at(4, "textDocument/definition", 4, 12),
+		at(5, "textDocument/definition", 4, 19),
+		at(6, "textDocument/completion", 5, 4),
+		`{"jsonrpc":"2.0","id":7,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"` + uri + `"}}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"unknown/method","params":{}}`,
+		`{"jsonrpc":"2.0","id":9,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	})
+
+	tests := []struct {
+		id       int
+		expected []string // substrings of the result
+	}{
+		{1, []string{`"hoverProvider":true`, `"textDocumentSync":1`}},
+		{2, []string{`(square x)`, `procedure taking 1 argument, defined at line 2`}},
+		{3, []string{`display`, `procedure taking 1 to 2 arguments`}},
+		{4, []string{`"uri":"` + uri + `"`, `"start":{"line":1,"character":9}`, `"end":{"line":1,"character":15}`}},
+		{5, []string{`"uri":"` + fileURI(lib) + `"`, `"line":4`}},
+		{6, []string{`"label":"square"`, `"detail":"(square x)"`}},
+		{7, []string{`"name":"square"`, `"name":"pi"`, `"kind":12`, `"kind":13`}},
+		{9, []string{`null`}},
+	}
+	for _, tc := range tests {
+		res, ok := responses[tc.id]
+		if !ok || res.Error != nil {
+			t.Fatalf("tests[%d] - no result, got=%+v", tc.id, res)
+		}
+		for _, s := range tc.expected {
+			if !strings.Contains(string(res.Result), s) {
+				t.Fatalf("tests[%d] - %s not in the result %s", tc.id, s, res.Result)
+			}
+		}
+	}
+	if strings.Contains(string(responses[6].Result), `"display"`) {
+		t.Fatalf("completion not filtered by the prefix: %s", responses[6].Result)
+	}
+	if strings.Contains(string(responses[7].Result), `"tau"`) {
+		t.Fatalf("symbol in a datum comment: %s", responses[7].Result)
+	}
+	if res := responses[8]; res.Error == nil || res.Error.Code != codeMethodNotFound {
+		t.Fatalf("no error for an unknown method, got=%+v", res)
+	}
+
+	if len(notifications) != 1 || notifications[0].Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("no diagnostics published, got=%+v", notifications)
+	}
+	var diagnostics publishDiagnosticsParams
+	_ = json.Unmarshal(notifications[0].Params.(json.RawMessage), &diagnostics)
+	var lines []int
+	for _, d := range diagnostics.Diagnostics {
+		lines = append(lines, d.Range.Start.Line)
+	}
+	if len(lines) != 2 || lines[0] != 3 || lines[1] != 5 {
+		t.Fatalf("wrong diagnostics, expected at lines [3 5], got=%+v", diagnostics.Diagnostics)
+	}
+}
+
+func TestImportCache(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, src string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("util.sld", "(define-library (util) (export v) (import (scheme base)) (begin (define v 1)))")
+	write("writer.sld", `(define-library (writer) (export v) (import (scheme base) (scheme file)) (begin (define v 1) (call-with-output-file "written" (lambda (p) (write v p)))))`)
+	write("spin.sld", "(define-library (spin) (export v) (import (scheme base)) (begin (define (loop) (loop)) (define v (loop))))")
+	c := newImportCache(nil)
+
+	bindings, err := c.bindings(dir, "(util)")
+	if err != nil || bindings["v"].String() != "1" {
+		t.Fatalf("wrong bindings of (util), got=%v, %v", bindings, err)
+	}
+	// The library is not loaded again until the cache is cleared.
+	write("util.sld", "(define-library (util) (export v) (import (scheme base)) (begin (define v 2)))")
+	if bindings, _ := c.bindings(dir, "(util)"); bindings["v"].String() != "1" {
+		t.Fatalf("library loaded again, got=%v", bindings)
+	}
+	c.clear()
+	if bindings, _ := c.bindings(dir, "(util)"); bindings["v"].String() != "2" {
+		t.Fatalf("library not loaded again after clear, got=%v", bindings)
+	}
+
+	if _, err := c.bindings(dir, "(writer)"); err == nil {
+		t.Fatalf("no error for a library using (scheme file)")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "written")); err == nil {
+		t.Fatalf("a library wrote a file")
+	}
+	if _, err := c.bindings(dir, "(spin)"); err == nil {
+		t.Fatalf("no error for a library which never returns")
+	}
+}
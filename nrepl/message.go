@@ -0,0 +1,62 @@
+// nrepl/message.go
+
+package nrepl
+
+// Messages are JSON objects, one per line.  A request names its op,
+// and the responses to it carry its id and session.  The last response
+// to a request has "done" in its status.
+
+type request struct {
+	Op      string `json:"op"`
+	ID      string `json:"id,omitempty"`
+	Session string `json:"session,omitempty"`
+
+	Code        string `json:"code,omitempty"`         // eval
+	File        string `json:"file,omitempty"`         // load-file
+	Prefix      string `json:"prefix,omitempty"`       // complete
+	Sym         string `json:"sym,omitempty"`          // lookup
+	InterruptID string `json:"interrupt-id,omitempty"` // interrupt
+}
+
+type response struct {
+	ID      string   `json:"id,omitempty"`
+	Session string   `json:"session,omitempty"`
+	Status  []string `json:"status,omitempty"`
+
+	Value string `json:"value,omitempty"`
+	Out   string `json:"out,omitempty"`
+	Err   string `json:"err,omitempty"`
+	Ex    string `json:"ex,omitempty"`
+
+	NewSession  string            `json:"new-session,omitempty"`
+	Completions []completion      `json:"completions,omitempty"`
+	Info        *info             `json:"info,omitempty"`
+	Ops         map[string]any    `json:"ops,omitempty"`
+	Versions    map[string]string `json:"versions,omitempty"`
+}
+
+// kinds of completions and infos
+const (
+	kindProcedure = "procedure"
+	kindVariable  = "variable"
+)
+
+type completion struct {
+	Candidate string `json:"candidate"`
+	Type      string `json:"type"`
+}
+
+type arity struct {
+	Required int  `json:"required"`
+	Optional int  `json:"optional"`
+	Rest     bool `json:"rest"`
+}
+
+type info struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Arity *arity `json:"arity,omitempty"`
+	File  string `json:"file,omitempty"`
+	Line  int    `json:"line,omitempty"`
+	Value string `json:"value,omitempty"` // of a variable
+}
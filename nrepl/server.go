@@ -0,0 +1,424 @@
+// nrepl/server.go
+
+// Package nrepl implements a message-based REPL protocol for tools
+// such as editors, in the style of nREPL.  A client sends requests of
+// ops, e.g. eval, and receives responses carrying the values and the
+// output of the evaluations.  Sessions share the global environment of
+// an interpreter.
+package nrepl
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/mnbi/gopische"
+	"github.com/mnbi/gopische/scheme"
+)
+
+// maxMessage limits the size of a request.
+const maxMessage = 16 << 20
+
+// Server serves the protocol on an interpreter.  Evaluations run one at
+// a time, so that each of them has its own ports, and those of a session
+// run in the order of their requests.
+type Server struct {
+	Interp *gopische.Interpreter
+
+	// evaluations, and the other ops which use the interpreter
+	eval sync.Mutex
+
+	mu       sync.Mutex // guards sessions
+	sessions map[string]*session
+}
+
+// session is where evaluations run in the order of their requests,
+// which can be interrupted.  A session belongs to the connection which
+// created it.
+type session struct {
+	id    string
+	owner *conn
+
+	// evaluations waiting in the order of the requests, the first of
+	// which is running while working is true
+	jobs    []*job
+	working bool
+}
+
+// job is an evaluation requested to a session.
+type job struct {
+	req    *request
+	ctx    context.Context
+	cancel context.CancelFunc
+	run    func(ctx context.Context) (scheme.Object, error)
+}
+
+// conn is a client which the server talks to.
+type conn struct {
+	s  *Server
+	mu sync.Mutex // guards w
+	w  io.Writer
+	wg sync.WaitGroup
+
+	// the session of the requests without one, guarded by s.mu
+	defaultSession *session
+}
+
+type handler func(c *conn, ctx context.Context, req *request)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"clone":     handleClone,
+		"close":     handleClose,
+		"describe":  handleDescribe,
+		"eval":      handleEval,
+		"load-file": handleLoadFile,
+		"interrupt": handleInterrupt,
+		"complete":  handleComplete,
+		"lookup":    handleLookup,
+	}
+}
+
+// Serve reads requests from r and writes responses to w until r ends.
+// Evaluations are cancelled when ctx is done.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	c := &conn{s: s, w: w}
+	defer c.closeSessions()
+	// Running evaluations are cancelled before waiting for them.
+	defer c.wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxMessage)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			c.send(&request{}, response{Err: err.Error() + "\n", Status: []string{"error", "done"}})
+			continue
+		}
+		h, ok := handlers[req.Op]
+		if !ok {
+			c.send(&req, response{Status: []string{"unknown-op", "done"}})
+			continue
+		}
+		h(c, ctx, &req)
+	}
+	return sc.Err()
+}
+
+// ServeListener serves each connection accepted by l until ctx is done.
+func (s *Server) ServeListener(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer nc.Close()
+			closed := context.AfterFunc(ctx, func() { nc.Close() })
+			defer closed()
+			_ = s.Serve(ctx, nc, nc)
+		}()
+	}
+}
+
+// send writes a response to a request.
+func (c *conn) send(req *request, res response) {
+	res.ID, res.Session = req.ID, req.Session
+	content, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A client gone is noticed by reading requests.
+	_, _ = c.w.Write(append(content, '\n'))
+}
+
+func (c *conn) done(req *request, status ...string) {
+	c.send(req, response{Status: append(status, "done")})
+}
+
+// session returns the session of a request, which must belong to the
+// connection.  Requests without a session share the default one of the
+// connection.
+func (c *conn) session(req *request) (*session, bool) {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Session == "" {
+		if c.defaultSession == nil {
+			c.defaultSession = s.newSession(c)
+		}
+		req.Session = c.defaultSession.id
+		return c.defaultSession, true
+	}
+	sess, ok := s.sessions[req.Session]
+	return sess, ok && sess.owner == c
+}
+
+// closeSessions removes the sessions of the connection.
+func (c *conn) closeSessions() {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	for id, sess := range c.s.sessions {
+		if sess.owner == c {
+			delete(c.s.sessions, id)
+		}
+	}
+}
+
+func (s *Server) newSession(owner *conn) *session {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	sess := &session{id: hex.EncodeToString(b), owner: owner}
+	if s.sessions == nil {
+		s.sessions = make(map[string]*session)
+	}
+	s.sessions[sess.id] = sess
+	return sess
+}
+
+func handleClone(c *conn, ctx context.Context, req *request) {
+	c.s.mu.Lock()
+	sess := c.s.newSession(c)
+	c.s.mu.Unlock()
+	c.send(req, response{NewSession: sess.id, Status: []string{"done"}})
+}
+
+// handleClose removes a session, and interrupts its evaluations.
+func handleClose(c *conn, ctx context.Context, req *request) {
+	sess, ok := c.session(req)
+	if !ok {
+		c.done(req, "unknown-session")
+		return
+	}
+	s := c.s
+	s.mu.Lock()
+	for _, j := range sess.jobs {
+		j.cancel()
+	}
+	delete(s.sessions, sess.id)
+	if c.defaultSession == sess {
+		c.defaultSession = nil
+	}
+	s.mu.Unlock()
+	c.done(req, "session-closed")
+}
+
+func handleDescribe(c *conn, ctx context.Context, req *request) {
+	ops := make(map[string]any)
+	for op := range handlers {
+		ops[op] = map[string]any{}
+	}
+	c.send(req, response{
+		Ops:      ops,
+		Versions: map[string]string{"gopische": gopische.Version()},
+		Status:   []string{"done"},
+	})
+}
+
+func handleEval(c *conn, ctx context.Context, req *request) {
+	c.evaluate(ctx, req, func(ctx context.Context) (scheme.Object, error) {
+		return c.s.Interp.Eval(ctx, req.Code)
+	})
+}
+
+func handleLoadFile(c *conn, ctx context.Context, req *request) {
+	c.evaluate(ctx, req, func(ctx context.Context) (scheme.Object, error) {
+		return scheme.Unspecified, c.s.Interp.LoadContext(ctx, req.File)
+	})
+}
+
+// evaluate queues an evaluation in the session of a request.  The
+// evaluations of a session run one by one in the background, while
+// their output is sent to the client.
+func (c *conn) evaluate(ctx context.Context, req *request, run func(ctx context.Context) (scheme.Object, error)) {
+	s := c.s
+	sess, ok := c.session(req)
+	if !ok {
+		c.done(req, "unknown-session")
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	sess.jobs = append(sess.jobs, &job{req: req, ctx: ctx, cancel: cancel, run: run})
+	start := !sess.working
+	sess.working = true
+	s.mu.Unlock()
+
+	if start {
+		c.wg.Add(1)
+		go c.work(sess)
+	}
+}
+
+// work runs the evaluations of a session until none is waiting.
+func (c *conn) work(sess *session) {
+	defer c.wg.Done()
+	s := c.s
+	for {
+		s.mu.Lock()
+		if len(sess.jobs) == 0 {
+			sess.working = false
+			s.mu.Unlock()
+			return
+		}
+		j := sess.jobs[0]
+		s.mu.Unlock()
+
+		c.runJob(j)
+
+		s.mu.Lock()
+		sess.jobs = sess.jobs[1:]
+		s.mu.Unlock()
+		j.cancel()
+	}
+}
+
+// runJob runs an evaluation, and sends its result.
+func (c *conn) runJob(j *job) {
+	s, req, ctx := c.s, j.req, j.ctx
+	in := scheme.NewStringInputPort("")
+	out := scheme.NewOutputPort("out", &stream{c: c, req: req, err: false}, false)
+	errOut := scheme.NewOutputPort("err", &stream{c: c, req: req, err: true}, false)
+	var values []string
+	s.eval.Lock()
+	restore := s.Interp.UsePorts(in, out, errOut)
+	value, err := j.run(ctx)
+	restore()
+	if err == nil {
+		for _, v := range scheme.ValuesToSlice(value) {
+			if v != scheme.Unspecified {
+				values = append(values, scheme.Write(v))
+			}
+		}
+	}
+	s.eval.Unlock()
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		c.done(req, "interrupted")
+	case err != nil:
+		c.send(req, response{Err: err.Error() + "\n"})
+		c.send(req, response{Ex: err.Error(), Status: []string{"eval-error", "done"}})
+	default:
+		for _, v := range values {
+			c.send(req, response{Value: v})
+		}
+		c.done(req)
+	}
+}
+
+// stream sends the output of an evaluation.
+type stream struct {
+	c   *conn
+	req *request
+	err bool
+}
+
+func (st *stream) Write(p []byte) (int, error) {
+	if st.err {
+		st.c.send(st.req, response{Err: string(p)})
+	} else {
+		st.c.send(st.req, response{Out: string(p)})
+	}
+	return len(p), nil
+}
+
+// handleInterrupt cancels the running evaluation of the session, or the
+// evaluations of the request given by interrupt-id, running or waiting.
+func handleInterrupt(c *conn, ctx context.Context, req *request) {
+	sess, ok := c.session(req)
+	if !ok {
+		c.done(req, "unknown-session")
+		return
+	}
+	s := c.s
+	s.mu.Lock()
+	var cancels []context.CancelFunc
+	for i, j := range sess.jobs {
+		if req.InterruptID == "" && i == 0 || req.InterruptID != "" && j.req.ID == req.InterruptID {
+			cancels = append(cancels, j.cancel)
+		}
+	}
+	s.mu.Unlock()
+
+	switch {
+	case len(cancels) > 0:
+		for _, cancel := range cancels {
+			cancel()
+		}
+		c.done(req)
+	case req.InterruptID != "":
+		c.done(req, "interrupt-id-mismatch")
+	default:
+		c.done(req, "session-idle")
+	}
+}
+
+func handleComplete(c *conn, ctx context.Context, req *request) {
+	interp := c.s.Interp
+	completions := []completion{}
+	c.s.eval.Lock()
+	for _, name := range interp.Names() {
+		if !strings.HasPrefix(name, req.Prefix) {
+			continue
+		}
+		kind := kindVariable
+		if value, _ := interp.Lookup(name); value != nil {
+			if _, ok := value.(*scheme.Procedure); ok {
+				kind = kindProcedure
+			}
+		}
+		completions = append(completions, completion{Candidate: name, Type: kind})
+	}
+	c.s.eval.Unlock()
+	c.send(req, response{Completions: completions, Status: []string{"done"}})
+}
+
+func handleLookup(c *conn, ctx context.Context, req *request) {
+	c.s.eval.Lock()
+	defer c.s.eval.Unlock()
+	value, ok := c.s.Interp.Lookup(req.Sym)
+	if !ok {
+		c.done(req, "no-info")
+		return
+	}
+	in := &info{Name: req.Sym, Type: kindVariable}
+	if proc, ok := value.(*scheme.Procedure); ok {
+		a := proc.Arity()
+		in.Type = kindProcedure
+		in.Arity = &arity{Required: a.Required, Optional: a.Optional, Rest: a.Rest}
+		if loc := proc.Location(); loc != nil {
+			in.File, in.Line = loc.File, loc.Line
+		}
+	} else {
+		in.Value = scheme.Write(value)
+	}
+	c.send(req, response{Info: in, Status: []string{"done"}})
+}
@@ -0,0 +1,333 @@
+// gopische/nrepl/server_test.go
+
+package nrepl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mnbi/gopische"
+)
+
+// client is a scripted client, which talks to a server over pipes.
+type client struct {
+	t         *testing.T
+	server    *Server
+	w         io.WriteCloser
+	responses chan response
+	pending   []response // to other requests than awaited
+}
+
+func newClient(t *testing.T) *client {
+	return connect(t, &Server{Interp: gopische.New()})
+}
+
+// connect creates a client on a connection to server.
+func connect(t *testing.T, server *Server) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(context.Background(), inR, outW)
+		outW.Close()
+	}()
+
+	c := &client{t: t, server: server, w: inW, responses: make(chan response, 100)}
+	go func() {
+		defer close(c.responses)
+		sc := bufio.NewScanner(outR)
+		for sc.Scan() {
+			var res response
+			if err := json.Unmarshal(sc.Bytes(), &res); err != nil {
+				t.Errorf("bad response: %s", sc.Text())
+				return
+			}
+			c.responses <- res
+		}
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+		if err := <-served; err != nil {
+			t.Errorf("fail to serve: %s", err)
+		}
+	})
+	return c
+}
+
+func (c *client) send(req request) {
+	c.t.Helper()
+	content, err := json.Marshal(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := c.w.Write(append(content, '\n')); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// until returns the responses to a request up to the one with "done".
+// The responses to the other requests are kept for later.
+func (c *client) until(id string) []response {
+	c.t.Helper()
+	var responses []response
+	pending := c.pending
+	c.pending = nil
+	timeout := time.After(5 * time.Second)
+	for {
+		var res response
+		if len(pending) > 0 {
+			res, pending = pending[0], pending[1:]
+		} else {
+			select {
+			case r, ok := <-c.responses:
+				if !ok {
+					c.t.Fatal("the server closed the connection")
+				}
+				res = r
+			case <-timeout:
+				c.t.Fatalf("no responses to %s", id)
+			}
+		}
+		if res.ID != id {
+			c.pending = append(c.pending, res)
+			continue
+		}
+		responses = append(responses, res)
+		if slices.Contains(res.Status, "done") {
+			c.pending = append(c.pending, pending...)
+			return responses
+		}
+	}
+}
+
+// summary joins the values, outputs and statuses of responses.
+func summary(responses []response) (values, out, err string, status []string) {
+	var vs, outs, errs strings.Builder
+	for _, res := range responses {
+		if res.Value != "" {
+			vs.WriteString(res.Value + ";")
+		}
+		outs.WriteString(res.Out)
+		errs.WriteString(res.Err)
+		status = append(status, res.Status...)
+	}
+	return vs.String(), outs.String(), errs.String(), status
+}
+
+func TestServe(t *testing.T) {
+	c := newClient(t)
+
+	c.send(request{Op: "clone", ID: "1"})
+	cloned := c.until("1")
+	session := cloned[0].NewSession
+	if session == "" {
+		t.Fatalf("no new session: %+v", cloned)
+	}
+
+	src := "(define (square x)\n  (* x x))\n(define answer 42)\n"
+	path := filepath.Join(t.TempDir(), "square.scm")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id     int
+		req    request
+		values string
+		out    string
+		err    string
+		status []string
+	}{
+		{1, request{Op: "eval", Code: "(+ 1 2)"}, "3;", "", "", []string{"done"}},
+		{2, request{Op: "eval", Code: "(values 1 \"a\")"}, "1;\"a\";", "", "", []string{"done"}},
+		{3, request{Op: "eval", Code: "(display \"hi\") (write 'e (current-error-port)) 'x"}, "x;", "hi", "e", []string{"done"}},
+		{4, request{Op: "eval", Code: "(car '())"}, "", "", "car: wrong type argument, expected pair, got ()\n", []string{"eval-error", "done"}},
+		{5, request{Op: "load-file", File: path}, "", "", "", []string{"done"}},
+		{6, request{Op: "eval", Code: "(square answer)"}, "1764;", "", "", []string{"done"}},
+		{7, request{Op: "no-such-op"}, "", "", "", []string{"unknown-op", "done"}},
+		{8, request{Op: "eval", Session: "nothing", Code: "1"}, "", "", "", []string{"unknown-session", "done"}},
+		{9, request{Op: "interrupt"}, "", "", "", []string{"session-idle", "done"}},
+		{10, request{Op: "interrupt", InterruptID: "none"}, "", "", "", []string{"interrupt-id-mismatch", "done"}},
+	}
+	for _, tc := range tests {
+		id := fmt.Sprint(tc.id)
+		tc.req.ID = id
+		if tc.req.Session == "" {
+			tc.req.Session = session
+		}
+		c.send(tc.req)
+		values, out, err, status := summary(c.until(id))
+		if values != tc.values {
+			t.Errorf("tests[%d] - wrong values, expected=%q, got=%q", tc.id, tc.values, values)
+		}
+		if out != tc.out {
+			t.Errorf("tests[%d] - wrong output, expected=%q, got=%q", tc.id, tc.out, out)
+		}
+		if err != tc.err {
+			t.Errorf("tests[%d] - wrong error output, expected=%q, got=%q", tc.id, tc.err, err)
+		}
+		if !slices.Equal(status, tc.status) {
+			t.Errorf("tests[%d] - wrong status, expected=%v, got=%v", tc.id, tc.status, status)
+		}
+	}
+
+	c.send(request{Op: "complete", ID: "c", Session: session, Prefix: "squ"})
+	completions := c.until("c")[0].Completions
+	if !slices.Contains(completions, completion{Candidate: "square", Type: kindProcedure}) {
+		t.Errorf("no completion of square: %+v", completions)
+	}
+
+	lookups := []struct {
+		id       int
+		sym      string
+		expected *info
+	}{
+		{1, "square", &info{Name: "square", Type: kindProcedure, Arity: &arity{Required: 1}, File: path, Line: 1}},
+		{2, "answer", &info{Name: "answer", Type: kindVariable, Value: "42"}},
+		{3, "no-such-variable", nil},
+	}
+	for _, tc := range lookups {
+		c.send(request{Op: "lookup", ID: "l", Session: session, Sym: tc.sym})
+		got := c.until("l")[0]
+		if tc.expected == nil {
+			if !slices.Contains(got.Status, "no-info") {
+				t.Errorf("lookups[%d] - expected no-info, got=%+v", tc.id, got)
+			}
+			continue
+		}
+		if got.Info == nil {
+			t.Errorf("lookups[%d] - no info", tc.id)
+			continue
+		}
+		gotJSON, _ := json.Marshal(got.Info)
+		expectedJSON, _ := json.Marshal(tc.expected)
+		if string(gotJSON) != string(expectedJSON) {
+			t.Errorf("lookups[%d] - wrong info, expected=%s, got=%s", tc.id, expectedJSON, gotJSON)
+		}
+	}
+
+	c.send(request{Op: "describe", ID: "d"})
+	described := c.until("d")[0]
+	for op := range handlers {
+		if _, ok := described.Ops[op]; !ok {
+			t.Errorf("op %s not described", op)
+		}
+	}
+	if described.Versions["gopische"] != gopische.Version() {
+		t.Errorf("wrong versions: %v", described.Versions)
+	}
+
+	c.send(request{Op: "close", ID: "x", Session: session})
+	if _, _, _, status := summary(c.until("x")); !slices.Contains(status, "session-closed") {
+		t.Errorf("session not closed: %v", status)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	c := newClient(t)
+	c.send(request{Op: "clone", ID: "1"})
+	session := c.until("1")[0].NewSession
+
+	c.send(request{Op: "eval", ID: "loop", Session: session, Code: "(display \"start\") (let loop () (loop))"})
+	// The evaluation is running once its output comes.
+	for res := range c.responses {
+		if res.Out == "start" {
+			break
+		}
+	}
+	c.send(request{Op: "interrupt", ID: "2", Session: session, InterruptID: "loop"})
+	if _, _, _, status := summary(c.until("2")); !slices.Equal(status, []string{"done"}) {
+		t.Errorf("wrong status of interrupt: %v", status)
+	}
+	if _, _, _, status := summary(c.until("loop")); !slices.Equal(status, []string{"interrupted", "done"}) {
+		t.Errorf("wrong status of the evaluation: %v", status)
+	}
+
+	// The session is still usable.
+	c.send(request{Op: "eval", ID: "3", Session: session, Code: "(+ 1 2)"})
+	if values, _, _, _ := summary(c.until("3")); values != "3;" {
+		t.Errorf("wrong values after interrupt: %q", values)
+	}
+}
+
+func TestDefaultSession(t *testing.T) {
+	c := newClient(t)
+	sessions := func() int {
+		c.server.mu.Lock()
+		defer c.server.mu.Unlock()
+		return len(c.server.sessions)
+	}
+
+	c.send(request{Op: "eval", ID: "1", Code: "(define x 1)"})
+	first := c.until("1")
+	c.send(request{Op: "eval", ID: "2", Code: "(+ x 1)"})
+	second := c.until("2")
+	if first[0].Session == "" || first[0].Session != second[0].Session {
+		t.Errorf("no default session: %q and %q", first[0].Session, second[0].Session)
+	}
+	if n := sessions(); n != 1 {
+		t.Errorf("wrong number of sessions, expected=1, got=%d", n)
+	}
+
+	// The default session is removed with the connection.
+	c.w.Close()
+	for range c.responses {
+	}
+	if n := sessions(); n != 0 {
+		t.Errorf("default session not removed, got %d sessions", n)
+	}
+}
+
+func TestEvalOrder(t *testing.T) {
+	c := newClient(t)
+	c.send(request{Op: "eval", ID: "0", Code: "(define acc '())"})
+	for i := 1; i <= 30; i++ {
+		c.send(request{Op: "eval", ID: fmt.Sprint(i), Code: fmt.Sprintf("(set! acc (cons %d acc))", i)})
+	}
+	c.send(request{Op: "eval", ID: "last", Code: "(reverse acc)"})
+	values, _, _, _ := summary(c.until("last"))
+	expected := "(1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25 26 27 28 29 30);"
+	if values != expected {
+		t.Errorf("evaluated out of order: %s", values)
+	}
+}
+
+func TestSessionOwner(t *testing.T) {
+	server := &Server{Interp: gopische.New()}
+	a, b := connect(t, server), connect(t, server)
+
+	// The default session can be interrupted without its id.
+	a.send(request{Op: "eval", ID: "loop", Code: "(display \"start\") (let loop () (loop))"})
+	var session string
+	for res := range a.responses {
+		if res.Out == "start" {
+			session = res.Session
+			break
+		}
+	}
+
+	// Another connection cannot touch the session.
+	for _, op := range []string{"interrupt", "close"} {
+		b.send(request{Op: op, ID: op, Session: session})
+		if _, _, _, status := summary(b.until(op)); !slices.Contains(status, "unknown-session") {
+			t.Errorf("%s of another connection: %v", op, status)
+		}
+	}
+
+	a.send(request{Op: "interrupt", ID: "2"})
+	if _, _, _, status := summary(a.until("2")); !slices.Equal(status, []string{"done"}) {
+		t.Errorf("wrong status of interrupt: %v", status)
+	}
+	if _, _, _, status := summary(a.until("loop")); !slices.Equal(status, []string{"interrupted", "done"}) {
+		t.Errorf("wrong status of the evaluation: %v", status)
+	}
+}
@@ -0,0 +1,86 @@
+package gopische
+
+import (
+	"github.com/mnbi/gopische/scheme"
+)
+
+// parameter is the body of a parameter object made by
+// `make-parameter`.  Calling the object returns its value, which
+// `parameterize` changes during the dynamic extent of its body.
+type parameter struct {
+	value     scheme.Object
+	converter scheme.Object // nil if the parameter has no converter
+}
+
+var parameterBuiltins = []builtin{
+	{"make-parameter", 1, 2, primMakeParameter},
+}
+
+// parameterizeBuiltins implement `parameterize`, which the expander
+// turns into calls to them.  They are not bound to any variable.
+var parameterizeBuiltins = []builtin{
+	{"%parameterize", 2, 2, primParameterize},
+}
+
+// newParameter creates a parameter object holding value.
+func newParameter(name string, value scheme.Object) *scheme.Procedure {
+	return scheme.NewPrimitive(name, scheme.Arity{}, &parameter{value: value})
+}
+
+// (make-parameter value [converter])
+func primMakeParameter(m *machine, args []scheme.Object) (scheme.Object, error) {
+	p := &parameter{value: args[0]}
+	if len(args) == 2 {
+		if _, err := argProcedure(args, 1); err != nil {
+			return nil, err
+		}
+		value, err := m.apply(args[1], args[:1])
+		if err != nil {
+			return nil, err
+		}
+		p.value, p.converter = value, args[1]
+	}
+	return scheme.NewPrimitive("", scheme.Arity{}, p), nil
+}
+
+// (%parameterize (param ...) (value ...)) converts the values by the
+// converters of the parameters, and returns a procedure which swaps
+// the values of the parameters with them.  `parameterize` calls it
+// when its body is entered and left.
+func primParameterize(m *machine, args []scheme.Object) (scheme.Object, error) {
+	procs, err := argList(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	values, err := argList(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]*parameter, len(procs))
+	for i, proc := range procs {
+		p, ok := argParameter(proc)
+		if !ok {
+			return nil, wrongType("parameter", proc)
+		}
+		if p.converter != nil {
+			if values[i], err = m.apply(p.converter, values[i:i+1]); err != nil {
+				return nil, err
+			}
+		}
+		params[i] = p
+	}
+	return newPrimitive(builtin{"", 0, 0, func(m *machine, _ []scheme.Object) (scheme.Object, error) {
+		for i, p := range params {
+			p.value, values[i] = values[i], p.value
+		}
+		return scheme.Unspecified, nil
+	}}), nil
+}
+
+func argParameter(obj scheme.Object) (*parameter, bool) {
+	if proc, ok := obj.(*scheme.Procedure); ok {
+		p, ok := proc.Impl().(*parameter)
+		return p, ok
+	}
+	return nil, false
+}
@@ -0,0 +1,313 @@
+// gopische/port_test.go
+
+package gopische
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestPortInput(t *testing.T) {
+	tests := []struct {
+		id       int
+		input    string
+		testcase string
+		expected string
+	}{
+		{1, "abc", "(read-char)", `#\a`},
+		{2, "abc", "(peek-char) (peek-char)", `#\a`},
+		{3, "abc", "(read-char) (read-char)", `#\b`},
+		{4, "", "(eof-object? (read-char))", "#t"},
+		{5, "λx", "(char->integer (read-char))", "955"},
+		{6, "line 1\r\nline 2\n", "(read-line) (read-line)", `"line 2"`},
+		{7, "last", "(read-line) (eof-object? (read-line))", "#t"},
+		{8, "abcdef", "(read-string 4)", `"abcd"`},
+		{9, "ab", "(read-string 4)", `"ab"`},
+		{10, "", "(eof-object? (read-string 4))", "#t"},
+		{11, "AB", "(read-u8)", "65"},
+		{12, "AB", "(peek-u8) (read-u8) (read-u8)", "66"},
+		{13, "x", "(char-ready?)", "#t"},
+		{14, "", "(input-port? (current-input-port))", "#t"},
+		{15, "", "(textual-port? (current-input-port))", "#t"},
+		{16, "x", "(define p (current-input-port)) (close-port p) (input-port-open? p)", "#f"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithStdin(strings.NewReader(tc.input)))
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestPortOutput(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		stdout   string
+		stderr   string
+	}{
+		{1, `(write-char #\a) (write-char #\λ) (newline)`, "aλ\n", ""},
+		{2, `(write-string "hello")`, "hello", ""},
+		{3, `(write-string "hello" (current-output-port) 1 3)`, "el", ""},
+		{4, "(write-u8 65) (write-u8 10)", "A\n", ""},
+		{5, `(write #\space) (display #\space) (write "s") (display "s")`, `#\space "s"s`, ""},
+		{6, `(display "oops" (current-error-port)) (newline (current-error-port))`, "", "oops\n"},
+		{7, `(parameterize ((current-output-port (current-error-port))) (display 1)) (display 2)`, "2", "1"},
+		{8, "(flush-output-port) (output-port-open? (current-output-port))", "", ""},
+		{9, `(let ((l (list 1))) (let ((e (guard (x (#t x)) (error "m" l)))) (set-car! l e) (write e)))`, `#<error "m #0=(#<error \"m #0#\">)">`, ""},
+		{10, `(let ((v (vector 1))) (write-simple (list v v)))`, "(#(1) #(1))", ""},
+	}
+
+	for _, tc := range tests {
+		var stdout, stderr bytes.Buffer
+		interp := New(WithStdout(&stdout), WithStderr(&stderr))
+		if _, err := interp.Eval(context.Background(), tc.testcase); err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if stdout.String() != tc.stdout {
+			t.Fatalf("tests[%d] - wrong output, expected=%q, got=%q", tc.id, tc.stdout, stdout.String())
+		}
+		if stderr.String() != tc.stderr {
+			t.Fatalf("tests[%d] - wrong error output, expected=%q, got=%q", tc.id, tc.stderr, stderr.String())
+		}
+	}
+}
+
+func TestParameter(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(define p (make-parameter 10)) (p)", "10"},
+		{2, "(define p (make-parameter 10 (lambda (x) (* x 2)))) (p)", "20"},
+		{3, "(define p (make-parameter 1)) (parameterize ((p 2)) (p))", "2"},
+		{4, "(define p (make-parameter 1)) (parameterize ((p 2)) 'x) (p)", "1"},
+		{5, "(define p (make-parameter 1 (lambda (x) (* x 10)))) (parameterize ((p 2)) (p))", "20"},
+		{6, "(define p (make-parameter 1)) (define (f) (p)) (parameterize ((p 2)) (parameterize ((p 3)) (f)))", "3"},
+		{7, "(define p (make-parameter 1)) (call/cc (lambda (k) (parameterize ((p 2)) (k 'out)))) (p)", "1"},
+		{8, "(define p (make-parameter 1)) (parameterize ((p 2)) (define q (+ (p) 1)) q)", "3"},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestPortError(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(read-char (current-output-port))"},
+		{2, "(write-char #\\a (current-input-port))"},
+		{3, "(write-char 1)"},
+		{4, "(write-u8 256)"},
+		{5, "(define p (current-output-port)) (close-port p) (display 1 p)"},
+		{6, "(parameterize ((current-output-port 1)) #t)"},
+		{7, "(parameterize ((car 1)) #t)"},
+		{8, "((make-parameter 1) 2)"},
+		{9, "(define l (list 1)) (set-car! l l) (write-simple l)"},
+		{10, "(define l (list 1 2)) (set-cdr! (cdr l) l) (write-simple l)"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithStdin(strings.NewReader("")), WithStdout(&bytes.Buffer{}))
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
+
+func TestReplPorts(t *testing.T) {
+	input := "(define name (read-line))\nScheme\n(string-append \"Hello, \" name)\n"
+	var out bytes.Buffer
+	interp := New(WithStdin(strings.NewReader(input)), WithStdout(&out))
+	if code := interp.Repl(); code != 0 {
+		t.Fatalf("wrong exit code, expected=0, got=%d", code)
+	}
+	if !strings.Contains(out.String(), "\"Hello, Scheme\"\n") {
+		t.Fatalf("no value in the output: %q", out.String())
+	}
+}
+
+func TestStringPort(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, `(define p (open-input-string "ab")) (read-char p) (read-char p)`, `#\b`},
+		{2, `(define p (open-input-string "")) (eof-object? (read-line p))`, "#t"},
+		{3, `(define p (open-output-string)) (write 'sym p) (write-char #\space p) (write 1.5 p) (get-output-string p)`, `"sym 1.5"`},
+		{4, `(define p (open-output-string)) (parameterize ((current-output-port p)) (display 1) (display 2)) (get-output-string p)`, `"12"`},
+		{5, `(define p (open-input-bytevector #u8(1 2 3))) (read-u8 p) (read-bytevector 5 p)`, "#u8(2 3)"},
+		{6, `(define p (open-input-bytevector #u8())) (eof-object? (read-u8 p))`, "#t"},
+		{7, `(define p (open-output-bytevector)) (write-u8 1 p) (write-bytevector #u8(2 3 4) p 1) (get-output-bytevector p)`, "#u8(1 3 4)"},
+		{8, `(textual-port? (open-output-bytevector))`, "#f"},
+		{9, `(define p (open-input-string "x")) (close-port p) (input-port-open? p)`, "#f"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestBytevector(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "#u8(1 2 255)", "#u8(1 2 255)"},
+		{2, "(bytevector 1 2)", "#u8(1 2)"},
+		{3, "(make-bytevector 3 7)", "#u8(7 7 7)"},
+		{4, "(bytevector-length #u8(1 2 3))", "3"},
+		{5, "(bytevector-u8-ref #u8(1 2 3) 1)", "2"},
+		{6, "(define b (bytevector 1 2 3)) (bytevector-u8-set! b 0 9) b", "#u8(9 2 3)"},
+		{7, "(bytevector-copy #u8(1 2 3 4) 1 3)", "#u8(2 3)"},
+		{8, "(bytevector-append #u8(1) #u8() #u8(2 3))", "#u8(1 2 3)"},
+		{9, `(utf8->string #u8(206 187))`, `"λ"`},
+		{10, `(string->utf8 "abc" 1)`, "#u8(98 99)"},
+		{11, "(equal? #u8(1 2) (bytevector 1 2))", "#t"},
+		{12, "(bytevector? #u8())", "#t"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+
+	for i, src := range []string{"#u8(256)", "#u8(a)", "(bytevector -1)", "(bytevector-u8-ref #u8(1) 1)", "(utf8->string #u8(255))", "(get-output-string (open-output-bytevector))"} {
+		if _, err := New().Eval(context.Background(), src); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", 100+i, src)
+		}
+	}
+}
+
+func TestVector(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, `#(1 "a" #\b (c))`, `#(1 "a" #\b (c))`},
+		{2, "(vector 1 2)", "#(1 2)"},
+		{3, "(make-vector 3 'x)", "#(x x x)"},
+		{4, "(vector-length #(1 2 3))", "3"},
+		{5, "(vector-ref #(1 2 3) 1)", "2"},
+		{6, "(define v (vector 1 2 3)) (vector-set! v 0 9) v", "#(9 2 3)"},
+		{7, "(vector->list #(1 2 3 4) 1 3)", "(2 3)"},
+		{8, "(list->vector '(1 2))", "#(1 2)"},
+		{9, "(define v (vector 1 2 3 4)) (vector-fill! v 0 2) v", "#(1 2 0 0)"},
+		{10, "(vector-copy #(1 2 3 4) 1 3)", "#(2 3)"},
+		{11, "(define v (vector 1 2 3 4 5)) (vector-copy! v 1 v 0 3) v", "#(1 1 2 3 5)"},
+		{12, "(vector-append #(1) #() #(2 3))", "#(1 2 3)"},
+		{13, "(vector-map + #(1 2 3) #(10 20))", "#(11 22)"},
+		{14, "(let ((n 0)) (vector-for-each (lambda (x) (set! n (+ n x))) #(1 2 3)) n)", "6"},
+		{15, "(list (equal? #(1 #(2)) (vector 1 (vector 2))) (equal? #(1) #(1 2)) (eqv? #() (vector)))", "(#t #f #f)"},
+		{16, "(list (vector? #()) (vector? '()) (list? #(1)))", "(#t #f #f)"},
+		{17, "`#(1 ,(+ 1 1) ,@(list 3 4))", "#(1 2 3 4)"},
+		{18, "(let ((v `#(1 2))) (eq? v `#(1 2)))", "#f"},
+		{19, "(define h (make-hash-table equal?)) (hash-table-set! h (vector 1 2) 'v) (hash-table-ref/default h #(1 2) #f)", "v"},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - engine %d: fail to evaluate %s: %s", tc.id, engine, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - engine %d: wrong value, expected=%s, got=%s", tc.id, engine, tc.expected, value)
+			}
+		}
+	}
+
+	for i, src := range []string{"(vector-ref #(1) 1)", "(vector-ref '(1) 0)", "(make-vector -1)", "(vector-copy! (vector 1) 0 #(1 2))", "(vector-set! #(1) 1 0)", "(list->vector '(1 . 2))"} {
+		if _, err := New().Eval(context.Background(), src); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", 100+i, src)
+		}
+	}
+}
+
+func TestCaptureOutput(t *testing.T) {
+	var stdout bytes.Buffer
+	interp := New(WithStdout(&stdout))
+	if _, err := interp.Eval(context.Background(), `(define (greet name) (display "Hello, ") (display name) 'done)`); err != nil {
+		t.Fatal(err)
+	}
+	greet, _ := interp.Lookup("greet")
+
+	out, value, err := interp.CaptureOutput(context.Background(), greet, scheme.NewString("Go"))
+	if err != nil {
+		t.Fatalf("fail to call greet: %s", err)
+	}
+	if out != "Hello, Go" || value.String() != "done" {
+		t.Fatalf("wrong result, output=%q, value=%s", out, value)
+	}
+	if _, err := interp.Eval(context.Background(), `(display "after")`); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "after" {
+		t.Fatalf("output port not restored, stdout=%q", stdout.String())
+	}
+
+	fail, _ := interp.Eval(context.Background(), `(lambda () (display "partial") (car '()))`)
+	out, _, err = interp.CaptureOutput(context.Background(), fail)
+	if err == nil || out != "partial" {
+		t.Fatalf("wrong result of a failed call, output=%q, err=%v", out, err)
+	}
+}
+
+func TestPrettyPrint(t *testing.T) {
+	input := "'((1 \"one\") (2 \"two\"))\n"
+	var out bytes.Buffer
+	interp := New(WithStdin(strings.NewReader(input)), WithStdout(&out), WithPrettyPrint(10))
+	if code := interp.Repl(); code != 0 {
+		t.Fatalf("wrong exit code, expected=0, got=%d", code)
+	}
+	if !strings.Contains(out.String(), "((1 \"one\")\n (2 \"two\"))\n") {
+		t.Fatalf("no pretty-printed value in the output: %q", out.String())
+	}
+
+	value, err := New().Eval(context.Background(), `(define p (open-output-string)) (pretty-print '(define (f x) x) p) (get-output-string p)`)
+	if err != nil {
+		t.Fatalf("fail to evaluate pretty-print: %s", err)
+	}
+	if value.String() != `"(define (f x) x)\n"` {
+		t.Fatalf("wrong output of pretty-print, got=%s", value)
+	}
+}
@@ -0,0 +1,84 @@
+// gopische/procedure_test.go
+
+package gopische
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestProcedure(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(procedure? car)", "#t"},
+		{2, "(procedure? (lambda (x) x))", "#t"},
+		{3, "(procedure? 'car)", "#f"},
+		{4, "(arity car)", "(1 0 #f)"},
+		{5, "(arity member)", "(2 1 #f)"},
+		{6, "(arity list)", "(0 0 #t)"},
+		{7, "(arity (lambda (a b . c) a))", "(2 0 #t)"},
+		{8, "(define (f x) x) f", "#<procedure f>"},
+		{9, "car", "#<procedure car>"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestProcedureLocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.scm")
+	src := "(define (f x)\n  x)\n\n(define g\n  (let ((n 0))\n    (lambda () n)))\n(define (h) (let loop () 1))\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	interp := New()
+	if err := interp.Load(path); err != nil {
+		t.Fatalf("fail to load: %s", err)
+	}
+
+	tests := []struct {
+		id       int
+		name     string
+		expected string
+	}{
+		{1, "f", "#<procedure f " + path + ":1>"},
+		{2, "g", "#<procedure g " + path + ":6>"},
+		{3, "h", "#<procedure h " + path + ":7>"},
+	}
+
+	for _, tc := range tests {
+		value, _ := interp.Lookup(tc.name)
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong procedure, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestPrimitiveArity(t *testing.T) {
+	proc := NewPrimitive("f", 1, 3, func(args []scheme.Object) (scheme.Object, error) {
+		return scheme.Unspecified, nil
+	})
+	expected := scheme.Arity{Required: 1, Optional: 2}
+	if proc.Arity() != expected {
+		t.Fatalf("wrong arity, expected=%v, got=%v", expected, proc.Arity())
+	}
+	if !proc.IsPrimitive() {
+		t.Fatalf("%s must be a primitive", proc)
+	}
+}
@@ -0,0 +1,562 @@
+package gopische
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/mnbi/gopische/lexer"
+	"github.com/mnbi/gopische/scheme"
+	"github.com/mnbi/gopische/token"
+)
+
+// errIncomplete is returned by read when the input ends in the middle
+// of a datum.  The REPL uses it to wait for the rest of the input.
+var errIncomplete = errors.New("incomplete input")
+
+// maxNesting limits the nesting of lists in a datum, so that a
+// malicious input cannot exhaust the Go stack.
+const maxNesting = 10000
+
+type parser struct {
+	l        *lexer.Lexer
+	file     string
+	symbols  *scheme.SymbolTable
+	nesting  int
+	foldCase bool // set by #!fold-case, and reset by #!no-fold-case
+	line     int  // the line of the last token read
+
+	// data labeled by #n= in the datum being read
+	labels map[int64]scheme.Object
+}
+
+// read converts the input into a sequence of data.  Symbols in the
+// data are interned by symbols.  When the input comes from a file,
+// lists in the data record their locations in it.
+func read(input string, file string, symbols *scheme.SymbolTable) ([]scheme.Object, error) {
+	l, err := lexer.Analyze(input)
+	if err != nil {
+		return nil, fmt.Errorf("fail to analyze lexically: %w", err)
+	}
+	p := &parser{l: l, file: file, symbols: symbols}
+
+	var data []scheme.Object
+	for {
+		tk, ok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		p.labels = nil
+		sexp, err := p.parse(tk)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, sexp)
+	}
+	return data, nil
+}
+
+// next returns the next token.  The directives #!fold-case and
+// #!no-fold-case are consumed here, and they switch folding the names
+// of symbols into lower case.  A datum comment #; is skipped with the
+// datum after it, and an error in the datum is returned.
+func (p *parser) next() (*token.Token, bool, error) {
+	for {
+		tk, ok := p.l.NextToken()
+		if ok {
+			p.line = tk.Line
+		}
+		if !ok {
+			return nil, false, nil
+		}
+		switch {
+		case tk.TokenType == token.DATUM_COMMENT:
+			if _, err := p.parseDatum(); err != nil {
+				return nil, false, err
+			}
+		case tk.Literal == "#!fold-case" && tk.TokenType == token.SYMBOL:
+			p.foldCase = true
+		case tk.Literal == "#!no-fold-case" && tk.TokenType == token.SYMBOL:
+			p.foldCase = false
+		default:
+			return tk, true, nil
+		}
+	}
+}
+
+// parse builds a datum which starts with tk.
+func (p *parser) parse(tk *token.Token) (sexp scheme.Object, err error) {
+	switch tk.TokenType {
+	case token.NUMBER, token.STRING, token.EMPTY_LIST, token.BOOLEAN, token.CHARACTER:
+		sexp = tk.Value
+	case token.SYMBOL:
+		name := tk.Literal
+		if sym, ok := tk.Value.(*scheme.Symbol); ok && strings.HasPrefix(name, "|") {
+			name = sym.Name()
+		} else if p.foldCase {
+			name = strings.ToLower(name)
+		}
+		sexp = p.symbols.Intern(name)
+	case token.LABEL:
+		sexp, err = p.parseLabeled(tk)
+	case token.LABEL_REF:
+		n := tk.Value.Value().(int64)
+		var ok bool
+		if sexp, ok = p.labels[n]; !ok {
+			err = fmt.Errorf("fail to parse: undefined datum label %s", tk.Literal)
+		}
+	case token.BYTEVECTOR:
+		sexp, err = p.parseBytevector()
+	case token.VECTOR:
+		if p.nesting >= maxNesting {
+			return nil, errors.New("fail to parse: too deeply nested")
+		}
+		p.nesting++
+		sexp, err = p.parseVector()
+		p.nesting--
+	case token.QUOTE:
+		sexp, err = p.parseAbbreviation("quote")
+	case token.QUASIQUOTE:
+		sexp, err = p.parseAbbreviation("quasiquote")
+	case token.UNQUOTE:
+		sexp, err = p.parseAbbreviation("unquote")
+	case token.UNQUOTE_SPLICING:
+		sexp, err = p.parseAbbreviation("unquote-splicing")
+	case token.LPAREN:
+		if p.nesting >= maxNesting {
+			return nil, errors.New("fail to parse: too deeply nested")
+		}
+		p.nesting++
+		sexp, err = p.parseList()
+		p.nesting--
+		if pair, ok := sexp.(*scheme.Pair); ok && p.file != "" {
+			pair.SetLocation(&scheme.Location{File: p.file, Line: tk.Line})
+		}
+	default:
+		emsg := fmt.Sprintf("fail to parse: %s", tk)
+		err = errors.New(emsg)
+	}
+	return
+}
+
+// parseLabeled reads the datum after #n=, which #n# in it refers to.
+// A placeholder stands for the datum while it is read, and it is
+// replaced with the datum after that.
+func (p *parser) parseLabeled(tk *token.Token) (scheme.Object, error) {
+	n := tk.Value.Value().(int64)
+	if p.labels == nil {
+		p.labels = make(map[int64]scheme.Object)
+	}
+	placeholder := scheme.NewSymbol(tk.Literal)
+	p.labels[n] = placeholder
+	datum, err := p.parseDatum()
+	if err != nil {
+		return nil, err
+	}
+	if datum == placeholder {
+		return nil, fmt.Errorf("fail to parse: datum label refers to itself, %s", tk.Literal)
+	}
+	p.labels[n] = datum
+	replaceLabel(datum, placeholder, datum)
+	return datum, nil
+}
+
+// replaceLabel replaces the placeholder in the pairs and the vectors
+// of obj with the labeled datum.
+func replaceLabel(obj scheme.Object, placeholder scheme.Object, datum scheme.Object) {
+	visited := make(map[scheme.Object]bool)
+	stack := []scheme.Object{obj}
+	for len(stack) > 0 {
+		obj := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[obj] {
+			continue
+		}
+		if v, ok := obj.(*scheme.Vector); ok {
+			visited[v] = true
+			elems := v.Elements()
+			for i := range elems {
+				if elems[i] == placeholder {
+					elems[i] = datum
+				} else {
+					stack = append(stack, elems[i])
+				}
+			}
+			continue
+		}
+		pair, ok := obj.(*scheme.Pair)
+		if !ok {
+			continue
+		}
+		visited[pair] = true
+		if pair.Car() == placeholder {
+			pair.SetCar(datum)
+		} else {
+			stack = append(stack, pair.Car())
+		}
+		if pair.Cdr() == placeholder {
+			pair.SetCdr(datum)
+		} else {
+			stack = append(stack, pair.Cdr())
+		}
+	}
+}
+
+// parseAbbreviation reads 'datum and its friends as (quote datum).
+func (p *parser) parseAbbreviation(keyword string) (scheme.Object, error) {
+	datum, err := p.parseDatum()
+	if err != nil {
+		return nil, err
+	}
+	return scheme.NewList(p.symbols.Intern(keyword), datum), nil
+}
+
+// parseList reads elements of a list after '('.
+func (p *parser) parseList() (scheme.Object, error) {
+	var elems []scheme.Object
+	var tail scheme.Object = scheme.EmptyList
+
+	for {
+		tk, err := p.nextInDatum()
+		if err != nil {
+			return nil, err
+		}
+		switch tk.TokenType {
+		case token.RPAREN:
+			return buildList(elems, tail), nil
+		case token.DOT:
+			if len(elems) == 0 {
+				return nil, errors.New("fail to parse: no datum before '.'")
+			}
+			if tail, err = p.parseDatum(); err != nil {
+				return nil, err
+			}
+			if tk, err = p.nextInDatum(); err != nil {
+				return nil, err
+			}
+			if tk.TokenType != token.RPAREN {
+				return nil, errors.New("fail to parse: more than one datum after '.'")
+			}
+			return buildList(elems, tail), nil
+		default:
+			elem, err := p.parse(tk)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+	}
+}
+
+// parseBytevector reads the bytes of #u8(byte ...).
+func (p *parser) parseBytevector() (scheme.Object, error) {
+	tk, err := p.nextInDatum()
+	if err != nil {
+		return nil, err
+	}
+	switch tk.TokenType {
+	case token.EMPTY_LIST:
+		return scheme.NewBytevector([]byte{}), nil
+	case token.LPAREN:
+	default:
+		return nil, errors.New("fail to parse: no list after #u8")
+	}
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	elems, _ := scheme.ListToSlice(list)
+	b := make([]byte, len(elems))
+	for i, elem := range elems {
+		n, ok := elem.(*scheme.Number)
+		if !ok || !isByte(n) {
+			return nil, fmt.Errorf("fail to parse: not a byte in bytevector: %s", elem)
+		}
+		b[i] = byte(n.Value().(int64))
+	}
+	return scheme.NewBytevector(b), nil
+}
+
+// parseVector reads the elements of #(datum ...).
+func (p *parser) parseVector() (scheme.Object, error) {
+	tk, err := p.nextInDatum()
+	if err != nil {
+		return nil, err
+	}
+	switch tk.TokenType {
+	case token.EMPTY_LIST:
+		return scheme.NewVector([]scheme.Object{}), nil
+	case token.LPAREN:
+	default:
+		return nil, errors.New("fail to parse: no list after #")
+	}
+	var elems []scheme.Object
+	for {
+		tk, err := p.nextInDatum()
+		if err != nil {
+			return nil, err
+		}
+		switch tk.TokenType {
+		case token.RPAREN:
+			return scheme.NewVector(elems), nil
+		case token.DOT:
+			return nil, errors.New("fail to parse: '.' in vector")
+		}
+		elem, err := p.parse(tk)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+	}
+}
+
+// nextInDatum is like next, but the end of the input is errIncomplete,
+// since a datum is being read.
+func (p *parser) nextInDatum() (*token.Token, error) {
+	tk, ok, err := p.next()
+	if err == nil && !ok {
+		err = errIncomplete
+	}
+	return tk, err
+}
+
+// parseDatum reads the next datum.
+func (p *parser) parseDatum() (scheme.Object, error) {
+	tk, err := p.nextInDatum()
+	if err != nil {
+		return nil, err
+	}
+	return p.parse(tk)
+}
+
+func buildList(elems []scheme.Object, tail scheme.Object) scheme.Object {
+	list := tail
+	for i := len(elems) - 1; i >= 0; i-- {
+		list = scheme.NewPair(elems[i], list)
+	}
+	return list
+}
+
+// Reader reads data from a textual input port one by one, as `read`
+// does.  It reads the port only up to the end of each datum, so that
+// the rest can be read by other procedures.
+type Reader struct {
+	port    *scheme.Port
+	symbols *scheme.SymbolTable
+}
+
+// NewReader creates a reader of a textual input port.  Symbols in the
+// data are interned by the interpreter, so that they are eq? to the
+// ones in its code.
+func (interp *Interpreter) NewReader(port *scheme.Port) *Reader {
+	return &Reader{port: port, symbols: interp.symbols}
+}
+
+// Read returns the next datum.  It returns io.EOF at the end of the
+// input, and a *scheme.ErrorObject which satisfies `read-error?` when
+// the input is malformed.  The directive #!fold-case affects the
+// following data read from the same port.
+func (r *Reader) Read() (scheme.Object, error) {
+	for {
+		text, err := scanDatum(r.port)
+		if err != nil {
+			return nil, err
+		}
+		l, err := lexer.Analyze(text)
+		if err != nil {
+			return nil, scheme.NewReadError(fmt.Errorf("fail to analyze lexically: %w", err))
+		}
+		p := &parser{l: l, symbols: r.symbols, foldCase: r.port.FoldCase()}
+		tk, ok, err := p.next()
+		r.port.SetFoldCase(p.foldCase)
+		if err != nil {
+			return nil, scheme.NewReadError(err)
+		}
+		if !ok {
+			continue // only a directive
+		}
+		datum, err := p.parse(tk)
+		if err != nil {
+			return nil, scheme.NewReadError(err)
+		}
+		return datum, nil
+	}
+}
+
+// scanDatum reads the text of the next datum from a port, and leaves
+// the port just after it.  Comments before the datum are skipped,
+// including datum comments.  It returns io.EOF when nothing but
+// whitespaces and comments remains.
+func scanDatum(port *scheme.Port) (string, error) {
+	var sb strings.Builder
+	depth := 0
+	// the number of datum comments at the top level waiting for their
+	// data, and where the first of them starts
+	comments, commentStart := 0, 0
+	for {
+		c, err := port.ReadChar()
+		if err == io.EOF && sb.Len() > 0 {
+			return "", scheme.NewReadError(errIncomplete)
+		}
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case unicode.IsSpace(c):
+			if sb.Len() > 0 {
+				sb.WriteRune(c)
+			}
+			continue
+		case c == ';':
+			if _, err := port.ReadLine(); err != nil && err != io.EOF {
+				return "", err
+			}
+			if sb.Len() > 0 {
+				sb.WriteRune('\n')
+			}
+			continue
+		case c == '(':
+			depth++
+			sb.WriteRune(c)
+			continue
+		case c == ')':
+			if depth == 0 {
+				return "", scheme.NewReadError(errors.New("unexpected ')'"))
+			}
+			depth--
+			sb.WriteRune(c)
+		case c == '"':
+			sb.WriteRune(c)
+			if err := scanQuoted(port, &sb, c); err != nil {
+				return "", err
+			}
+		case c == '\'' || c == '`':
+			sb.WriteRune(c)
+			continue
+		case c == ',':
+			sb.WriteRune(c)
+			if next, err := port.PeekChar(); err == nil && next == '@' {
+				sb.WriteRune(next)
+				_, _ = port.ReadChar()
+			}
+			continue
+		default:
+			atom, err := scanAtom(port, c)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(atom)
+			if next, err := port.PeekChar(); atom == "#" && err == nil && next == ';' {
+				_, _ = port.ReadChar()
+				sb.WriteRune(next)
+				if depth == 0 {
+					if comments == 0 {
+						commentStart = sb.Len() - 2
+					}
+					comments++
+				}
+				continue
+			}
+			if atom == "#u8" || atom == "#" || isLabelPrefix(atom) {
+				continue // followed by a list or a datum
+			}
+		}
+		if depth == 0 {
+			if comments == 0 {
+				return sb.String(), nil
+			}
+			// The datum of a datum comment ends, which is dropped if
+			// nothing precedes the comment.
+			comments--
+			if comments == 0 && commentStart == 0 {
+				sb.Reset()
+			}
+		}
+	}
+}
+
+// scanAtom reads a symbol, a number or a literal starting with '#'
+// until a delimiter, which is left in the port.
+func scanAtom(port *scheme.Port, first rune) (string, error) {
+	var sb strings.Builder
+	sb.WriteRune(first)
+	if next, err := port.PeekChar(); first == '#' && err == nil && next == '\\' {
+		// The rune after `#\` belongs to the literal even if it is a
+		// delimiter.
+		_, _ = port.ReadChar()
+		c, err := port.ReadChar()
+		if err == io.EOF {
+			return "", scheme.NewReadError(errIncomplete)
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune('\\')
+		sb.WriteRune(c)
+	}
+	if first == '|' {
+		if err := scanQuoted(port, &sb, '|'); err != nil {
+			return "", err
+		}
+	}
+	for {
+		c, err := port.PeekChar()
+		if err == io.EOF || (err == nil && isDelimiter(c)) {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(c)
+		_, _ = port.ReadChar()
+		if c == '|' {
+			if err := scanQuoted(port, &sb, '|'); err != nil {
+				return "", err
+			}
+		}
+		if c == '=' && isLabelPrefix(sb.String()) {
+			// a datum label, and the datum after it, e.g. #(...),
+			// is not a part of the atom
+			return sb.String(), nil
+		}
+	}
+}
+
+// scanQuoted reads a string literal or a symbol name enclosed by
+// vertical bars after the opening quote, up to the closing one.
+func scanQuoted(port *scheme.Port, sb *strings.Builder, quote rune) error {
+	escaped := false
+	for {
+		c, err := port.ReadChar()
+		if err == io.EOF {
+			return scheme.NewReadError(errIncomplete)
+		}
+		if err != nil {
+			return err
+		}
+		sb.WriteRune(c)
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == quote:
+			return nil
+		}
+	}
+}
+
+// isLabelPrefix reports whether an atom is a datum label #n=.
+func isLabelPrefix(atom string) bool {
+	digits, ok := strings.CutSuffix(strings.TrimPrefix(atom, "#"), "=")
+	return ok && len(atom) > 2 && atom[0] == '#' && strings.Trim(digits, "0123456789") == ""
+}
+
+func isDelimiter(c rune) bool {
+	return unicode.IsSpace(c) || strings.ContainsRune("()\";'`,", c)
+}
@@ -0,0 +1,138 @@
+// gopische/reader_test.go
+
+package gopische
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		id       int
+		input    string
+		testcase string
+		expected string
+	}{
+		{1, "(a b . c)", "(read)", "(a b . c)"},
+		{2, `42 "s" #\( foo`, "(list (read) (read) (read) (read))", `(42 "s" #\( foo)`},
+		{3, "; comment\n'x ,@y", "(list (read) (read))", "((quote x) (unquote-splicing y))"},
+		{4, "#u8(1 2)", "(read)", "#u8(1 2)"},
+		{5, "abc def", "(read) (read-char)", `#\space`},
+		{6, "(x)\nnext line", "(read) (read-line) (read-line)", `"next line"`},
+		{7, "  ; nothing\n", "(eof-object? (read))", "#t"},
+		{8, "#!fold-case ABC (Foo) #!no-fold-case Bar", "(list (read) (read) (read))", "(abc (foo) Bar)"},
+		{9, "#!fold-case", "(eof-object? (read))", "#t"},
+		{10, "sym", "(eq? 'sym (read))", "#t"},
+		{11, "", `(read (open-input-string "(1 2)"))`, "(1 2)"},
+		{12, "", "#!fold-case (DEFINE X 1) x", "1"},
+		{13, "#(1 (a) #u8(2)) #()", "(list (read) (read))", "(#(1 (a) #u8(2)) #())"},
+		{14, "#;(skipped) a #; #;b c d '#;e f (1 #;2) #;g", "(list (read) (read) (read) (read) (eof-object? (read)))", "(a d (quote f) (1) #t)"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithStdin(strings.NewReader(tc.input)))
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestDatumLabel(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(define x '#0=(a b . #0#)) (eq? x (cddr x))", "#t"},
+		{2, "(define x '(#0=(1 2) #0#)) (eq? (car x) (cadr x))", "#t"},
+		{3, "(define p (open-output-string)) (define x (list 1 2)) (set-cdr! (cdr x) x) (write x p) (get-output-string p)", `"#0=(1 2 . #0#)"`},
+		{4, `(define p (open-output-string)) (define x (list 'a "b" (string->symbol "c d"))) (set-cdr! (cddr x) x) (write x p) (define y (read (open-input-string (get-output-string p)))) (list (car y) (cadr y) (list-ref y 2) (eq? y (list-tail y 3)))`, `(a "b" |c d| #t)`},
+		{5, `(define p (open-output-string)) (define x (list 1)) (write-shared (list x x) p) (get-output-string p)`, `"(#0=(1) #0#)"`},
+		{6, `(define p (open-output-string)) (display (list "a" #\b 'c) p) (get-output-string p)`, `"(a b c)"`},
+		{7, "(define v '#0=#(a #0#)) (eq? v (vector-ref v 1))", "#t"},
+		{8, `(define x '#0=(#1=#(1 #0#) #1#)) (list (eq? x (vector-ref (car x) 1)) (eq? (car x) (cadr x)))`, "(#t #t)"},
+		{9, `(define p (open-output-string)) (define v (vector 1 2)) (vector-set! v 1 v) (write v p) (get-output-string p)`, `"#0=#(1 #0#)"`},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithStdout(io.Discard))
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+
+	for i, src := range []string{"'#0#", "'(#0= #0#)", "'(#1=a #2#)"} {
+		if _, err := New().Eval(context.Background(), src); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", 100+i, src)
+		}
+	}
+}
+
+func TestReadError(t *testing.T) {
+	tests := []struct {
+		id    int
+		input string
+	}{
+		{1, "(a b"},
+		{2, ")"},
+		{3, `"unterminated`},
+		{4, "#u8(300)"},
+		{5, "(a . b c)"},
+		{6, "'"},
+		{7, "#(1 . 2)"},
+		{8, "#(1 2"},
+		{9, "(a #;)"},
+		{10, "#;"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithStdin(strings.NewReader(tc.input)))
+		value, err := interp.Eval(context.Background(), "(guard (e ((read-error? e) 'read-error)) (read))")
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to read %q: %s", tc.id, tc.input, err)
+		}
+		if value.String() != "read-error" {
+			t.Fatalf("tests[%d] - no read error for %q, got=%s", tc.id, tc.input, value)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	interp := New()
+	port := scheme.NewStringInputPort("(define x 1) #!fold-case HELLO")
+	r := interp.NewReader(port)
+
+	datum, err := r.Read()
+	if err != nil || datum.String() != "(define x 1)" {
+		t.Fatalf("wrong datum, expected=(define x 1), got=%v, err=%v", datum, err)
+	}
+	if _, err := interp.EvalObject(context.Background(), datum); err != nil {
+		t.Fatalf("fail to evaluate a datum read: %s", err)
+	}
+	if datum, _ := r.Read(); datum.String() != "hello" {
+		t.Fatalf("case not folded, got=%s", datum)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("no EOF at the end, got=%v", err)
+	}
+
+	_, err = interp.NewReader(scheme.NewStringInputPort("(1 2")).Read()
+	var e *scheme.ErrorObject
+	if !errors.As(err, &e) || !e.IsReadError() {
+		t.Fatalf("not a read error: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+// gopische/record_test.go
+
+package gopische
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+func TestDefineRecordType(t *testing.T) {
+	point := `(define-record-type <point> (make-point x y) point?
+                (x point-x set-point-x!) (y point-y))`
+
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(make-point 1 2)", "#<point x: 1 y: 2>"},
+		{2, "(point? (make-point 1 2))", "#t"},
+		{3, "(point? '(1 2))", "#f"},
+		{4, "(point-y (make-point 1 2))", "2"},
+		{5, "(let ((p (make-point 1 2))) (set-point-x! p 3) (point-x p))", "3"},
+		{6, "<point>", "#<record-type point>"},
+		{7, "(record? (make-point 1 2))", "#t"},
+		{8, "(define (f) (define-record-type node (make-node v) node? (v node-v)) (node-v (make-node 'a))) (f)", "a"},
+		{9, "(define-record-type cell make-cell cell? (v cell-v) (w cell-w)) (make-cell 1 2)", "#<cell v: 1 w: 2>"},
+		{10, "(define-record-type leaf (make-leaf) leaf? (v leaf-v set-leaf-v!)) (let ((l (make-leaf))) (set-leaf-v! l 1) l)", "#<leaf v: 1>"},
+		{11, "make-point", "#<procedure make-point>"},
+		{12, "(equal? (make-point 1 2) (make-point 1 2))", "#f"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), point); err != nil {
+			t.Fatalf("tests[%d] - fail to define a record type: %s", tc.id, err)
+		}
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestDefineRecordTypeError(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(define-record-type)"},
+		{2, "(define-record-type p (make-p x) p? (x))"},
+		{3, "(define-record-type p (make-p z) p? (x p-x))"},
+		{4, "(define-record-type p (make-p x) p? (x p-x)) (p-x 1)"},
+		{5, "(define-record-type p (make-p x) p? (x p-x)) (make-p)"},
+		{6, "(define-record-type p (make-p x) p? (x p-x)) (define-record-type q (make-q x) q? (x q-x)) (p-x (make-q 1))"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
+
+type account struct {
+	Owner   string
+	Balance int64
+}
+
+func TestGoRecordType(t *testing.T) {
+	interp := New()
+	rt, err := interp.DefineRecordType("account", account{})
+	if err != nil {
+		t.Fatalf("fail to define a record type: %s", err)
+	}
+
+	acc := &account{Owner: "alice", Balance: 100}
+	rec, err := scheme.NewGoRecord(rt, acc)
+	if err != nil {
+		t.Fatalf("fail to wrap a value: %s", err)
+	}
+	interp.Define("acc", rec)
+
+	src := `(set-account-balance! acc (+ (account-balance acc) 50))
+            (list (account? acc) (account-owner acc) (make-account "bob" 1))`
+	value, err := interp.Eval(context.Background(), src)
+	if err != nil {
+		t.Fatalf("fail to evaluate: %s", err)
+	}
+	expected := `(#t "alice" #<account owner: "bob" balance: 1>)`
+	if value.String() != expected {
+		t.Fatalf("wrong value, expected=%s, got=%s", expected, value)
+	}
+	if acc.Balance != 150 {
+		t.Fatalf("Scheme code must modify the Go value, got=%d", acc.Balance)
+	}
+
+	value, _ = interp.Eval(context.Background(), `(make-account "carol" 7)`)
+	if got := value.(*scheme.Record).GoValue().(*account); got.Owner != "carol" || got.Balance != 7 {
+		t.Fatalf("wrong Go value: %v", got)
+	}
+
+	if _, err := interp.Eval(context.Background(), `(set-account-balance! acc "many")`); err == nil {
+		t.Fatalf("no error for a wrong type of a field")
+	}
+}
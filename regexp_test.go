@@ -0,0 +1,78 @@
+// gopische/regexp_test.go
+
+package gopische
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegexp(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		// compiling and matching
+		{1, `(list (regexp? (regexp "a+")) (regexp? "a+") (regexp "a+"))`, `(#t #f #<regexp "a+">)`},
+		{2, `(list (regexp-matches? "a|ab" "ab") (regexp-matches? "a" "ab") (regexp-matches? "b+" "abb" 1))`, "(#t #f #t)"},
+		{3, `(regexp-match->list (regexp-match "(\\w+)@(\\w+)" "user@host"))`, `("user@host" "user" "host")`},
+		{4, `(list (regexp-matches "x" "y") (regexp-search "x" "y"))`, "(#f #f)"},
+		{5, `(let ((m (regexp-search "[0-9]+" "日本語 2024年"))) (list (regexp-match-submatch m 0) (regexp-match-submatch-start m 0) (regexp-match-submatch-end m 0)))`, `("2024" 4 8)`},
+		{6, `(regexp-match-submatch (regexp-search "[0-9]+" "12 34" 2) 0)`, `"34"`},
+		{7, `(let ((m (regexp-search "(a)|(b)" "b"))) (list (regexp-match-count m) (regexp-match-submatch m 1) (regexp-match-submatch-start m 1) (regexp-match->list m)))`, `(2 #f #f ("b" #f "b"))`},
+		{8, `(list (regexp-match? (regexp-search "a" "a")) (regexp-match? "a"))`, "(#t #f)"},
+		// named submatches
+		{10, `(regexp-match->alist (regexp-search "(?P<year>\\d{4})-(?P<month>\\d{2})(-(?P<day>\\d{2}))?" "on 2024-05"))`, `((year . "2024") (month . "05") (day . #f))`},
+		{11, `(let ((m (regexp-search "(?P<word>\\pL+)" "  héllo"))) (list (regexp-match-submatch m 'word) (regexp-match-submatch m "word") (regexp-match-submatch-start m 'word)))`, `("héllo" "héllo" 2)`},
+		// replacing
+		{20, `(list (regexp-replace "o" "foo boo" "0") (regexp-replace-all "o" "foo boo" "0"))`, `("f0o boo" "f00 b00")`},
+		{21, `(regexp-replace-all "(\\w+)=(\\w+)" "a=1 b=2" "$2=$1")`, `"1=a 2=b"`},
+		{22, `(regexp-replace-all "(?P<n>\\d+)" "x1y22" "<${n}>")`, `"x<1>y<22>"`},
+		{23, `(regexp-replace-all "\\d+" "a1b22c333" (lambda (m) (number->string (string-length (regexp-match-submatch m 0)))))`, `"a1b2c3"`},
+		{24, `(regexp-replace-all "o" "oooo" "0" 1 3)`, `"o00o"`},
+		{25, `(regexp-replace-all "x*" "ab" "-")`, `"-a-b-"`},
+		// splitting and extracting
+		{30, `(regexp-split "\\s+" " fee fi  fo\tfum\n")`, `("" "fee" "fi" "fo" "fum" "")`},
+		{31, `(regexp-split "," "a,b,c" 2)`, `("b" "c")`},
+		{32, `(regexp-extract "\\d+" "1 kilo 23 grams 456")`, `("1" "23" "456")`},
+		// libraries
+		{40, `(import (prefix (gopische regexp) re:)) (re:regexp-matches? "\\d+" "42")`, "#t"},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - engine %d: fail to evaluate %s: %s", tc.id, engine, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - engine %d: wrong value, expected=%s, got=%s", tc.id, engine, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestRegexpError(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, `(regexp "(a")`},
+		{2, `(regexp 1)`},
+		{3, `(regexp-search "a" "abc" 4)`},
+		{4, `(regexp-match-submatch (regexp-search "a" "a") 1)`},
+		{5, `(regexp-match-submatch (regexp-search "a" "a") 'name)`},
+		{6, `(regexp-replace "a" "a" (lambda (m) 1))`},
+		{7, `(regexp-replace "a" "a" 'b)`},
+		{8, `(regexp-match-count "a")`},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
@@ -1,99 +1,150 @@
 package gopische
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"strings"
 
-	"github.com/mnbi/gopische/lexer"
 	"github.com/mnbi/gopische/scheme"
-	"github.com/mnbi/gopische/token"
 )
 
-func writeString(writer *bufio.Writer, str string) {
-	_, _ = writer.WriteString(str)
-	writer.Flush()
+// defaultPrettyWidth is the width of `pretty-print` unless the REPL
+// pretty-prints results.
+const defaultPrettyWidth = 79
+
+// WithPrettyPrint makes the REPL pretty-print results so that they
+// fit in width columns.  The width is also used by `pretty-print`.
+func WithPrettyPrint(width int) Option {
+	return func(interp *Interpreter) {
+		interp.prettyPrint = width
+	}
+}
+
+// prettyWidth returns the width which `pretty-print` uses.
+func (interp *Interpreter) prettyWidth() int {
+	if interp.prettyPrint > 0 {
+		return interp.prettyPrint
+	}
+	return defaultPrettyWidth
+}
+
+func writeString(port *scheme.Port, str string) {
+	_ = port.WriteString(str)
+	_ = port.Flush()
 }
 
-func welcome(writer *bufio.Writer) {
+func welcome(port *scheme.Port) {
 	msg := fmt.Sprintf("Welcome to %s - %s (%s)\n", name, version, revision)
-	writeString(writer, msg)
+	writeString(port, msg)
 }
 
-func prompt(writer *bufio.Writer) {
+func prompt(port *scheme.Port) {
 	header := fmt.Sprintf("%s > ", name)
-	writeString(writer, header)
+	writeString(port, header)
 }
 
-func farewell(writer *bufio.Writer) {
+func farewell(port *scheme.Port) {
 	msg := fmt.Sprintf("\nBye!\n")
-	writeString(writer, msg)
+	writeString(port, msg)
 }
 
+// Repl runs a read-eval-print loop on a new interpreter which uses
+// the standard input and output.
 func Repl() int {
-	scanner := bufio.NewScanner(os.Stdin)
-	writer := bufio.NewWriter(os.Stdout)
+	return New().Repl()
+}
+
+// Repl runs a read-eval-print loop on the interpreter.  An expression
+// may span several lines.  The loop reads from the current input port
+// and prints to the current output port, so that expressions can read
+// the lines following them, e.g. by `read-line`.
+func (interp *Interpreter) Repl() int {
+	return interp.repl(context.Background(), currentPort(interp.inputPort), currentPort(interp.outputPort), func(fn func()) { fn() })
+}
 
-	welcome(writer)
+// repl runs a read-eval-print loop which reads from in and prints to
+// out.  Evaluations and commands run inside guard, and evaluations are
+// interrupted when ctx is done.
+func (interp *Interpreter) repl(ctx context.Context, in *scheme.Port, out *scheme.Port, guard func(fn func())) int {
+	welcome(out)
 
-	var sexp scheme.Object
-	var err error
+	var input string
 
 	for {
-		prompt(writer)
+		if input == "" {
+			prompt(out)
+		}
 
-		if !scanner.Scan() {
+		line, err := in.ReadLine()
+		if err != nil {
 			break
 		}
-		firstLine := scanner.Text()
-		if sexp, err = read(firstLine); err != nil {
-			log.Print(err)
+		if input == "" && strings.HasPrefix(line, ",") {
+			guard(func() { interp.command(out, line) })
+			continue
+		}
+		input += line + "\n"
+		data, err := read(input, "", interp.symbols)
+		if err == errIncomplete {
+			continue
+		}
+		input = ""
+		if err != nil {
+			printError(out, err)
 			continue
 		}
-		print(writer, eval(sexp))
+		for _, sexp := range data {
+			var value scheme.Object
+			guard(func() { value, err = interp.EvalObject(ctx, sexp) })
+			var exit *ExitError
+			if errors.As(err, &exit) {
+				return exit.Code
+			}
+			if err != nil {
+				printError(out, err)
+				break
+			}
+			interp.print(out, value)
+		}
 	}
 
-	farewell(writer)
+	farewell(out)
 
 	return 0
 }
 
-func read(input string) (sexp scheme.Object, err error) {
-	l := lexer.NewLexer(input)
-	if l == nil {
-		emsg := fmt.Sprintf("fail to analyze lexically: \"%s\"", input)
-		return scheme.EmptyList, errors.New(emsg)
+// command runs a REPL command, which starts with a comma.
+//
+//	,disasm <expr>	show the bytecode of expr, or of a procedure
+func (interp *Interpreter) command(port *scheme.Port, line string) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line[1:]), " ")
+	switch name {
+	case "disasm":
+		listing, err := interp.Disassemble(arg)
+		if err != nil {
+			printError(port, err)
+			return
+		}
+		writeString(port, listing)
+	default:
+		printError(port, fmt.Errorf("unknown command: ,%s", name))
 	}
-	sexp, err = parse(l)
-	return
-}
-
-func eval(sexp scheme.Object) scheme.Object {
-	return sexp
-}
-
-func print(writer *bufio.Writer, value scheme.Object) {
-	answerLine := fmt.Sprintf("%s\n", value.String())
-	writeString(writer, answerLine)
 }
 
-func parse(l *lexer.Lexer) (sexp scheme.Object, err error) {
-	for tk, ok := l.NextToken(); ok; tk, ok = l.NextToken() {
-		switch tk.TokenType {
-		case token.NUMBER:
-			sexp = tk.Value
-		case token.STRING:
-			sexp = tk.Value
-		case token.EMPTY_LIST:
-			sexp = tk.Value
-		case token.BOOLEAN:
-			sexp = tk.Value
-		default:
-			emsg := fmt.Sprintf("fail to parse: %s", tk)
-			err = errors.New(emsg)
+func (interp *Interpreter) print(port *scheme.Port, value scheme.Object) {
+	if value == scheme.Unspecified {
+		return
+	}
+	for _, v := range scheme.ValuesToSlice(value) {
+		if interp.prettyPrint > 0 {
+			writeString(port, scheme.PrettyPrint(v, interp.prettyPrint)+"\n")
+		} else {
+			writeString(port, scheme.Write(v)+"\n")
 		}
 	}
-	return
+}
+
+func printError(port *scheme.Port, err error) {
+	writeString(port, fmt.Sprintf("Error: %s\n", err))
 }
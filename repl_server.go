@@ -0,0 +1,236 @@
+package gopische
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// REPLServer serves REPL sessions over network connections, so that a
+// running interpreter can be inspected.  Each connection has its own
+// session with its own ports, while all of them share the global
+// environment of the interpreter.  Evaluations of the sessions run one
+// at a time, but one waiting for the input of its session lets the
+// others run.  An evaluation is interrupted when its connection is
+// closed.  A host which evaluates on the interpreter while serving
+// should do so by Do.
+type REPLServer struct {
+	Interp *Interpreter
+
+	// Token, if not empty, must be sent as the first line of a
+	// connection.
+	Token string
+
+	// IdleTimeout, if positive, closes a connection which sends
+	// nothing for the duration.
+	IdleTimeout time.Duration
+
+	// evaluations of the sessions
+	mu sync.Mutex
+}
+
+// ServeREPL serves REPL sessions on the connections accepted by l
+// until l is closed.
+func ServeREPL(l net.Listener, interp *Interpreter) error {
+	return (&REPLServer{Interp: interp}).Serve(l)
+}
+
+// Serve accepts connections on l and serves a session on each of them
+// until l is closed.  It returns nil when l is closed.
+func (s *REPLServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go s.session(conn)
+	}
+}
+
+// Do calls fn while no session evaluates.
+func (s *REPLServer) Do(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// session runs a REPL on a connection.  Its evaluations are
+// interrupted when the connection is closed.
+func (s *REPLServer) session(conn net.Conn) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &replConn{server: s, conn: conn, chunks: make(chan []byte, 16)}
+	go c.receive(ctx, cancel)
+	r := bufio.NewReader(c)
+	if s.Token != "" && !s.authenticate(conn, r) {
+		return
+	}
+
+	c.in = scheme.NewInputPort("repl", r, false)
+	c.out = scheme.NewOutputPort("repl", conn, false)
+	s.Interp.repl(ctx, c.in, c.out, c.guard)
+}
+
+// authenticate reads the token from a connection.
+func (s *REPLServer) authenticate(conn net.Conn, r *bufio.Reader) bool {
+	if _, err := conn.Write([]byte("Token: ")); err != nil {
+		return false
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	token := strings.TrimRight(line, "\r\n")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		_, _ = conn.Write([]byte("Error: authentication failed\n"))
+		return false
+	}
+	return true
+}
+
+// replConn is the input of a session, which is received from the
+// connection in the background so that a closed connection is noticed
+// even while the session evaluates.
+type replConn struct {
+	server *REPLServer
+	conn   net.Conn
+	in     *scheme.Port
+	out    *scheme.Port
+
+	// input from the connection, closed after err is set
+	chunks chan []byte
+	err    error
+	rest   []byte
+
+	// whether the session holds the lock of the server, and the
+	// function which restores the ports
+	held    bool
+	restore func()
+
+	// the time since when the session waits for input, zero while it
+	// does not
+	mu        sync.Mutex
+	waitSince time.Time
+}
+
+// guard calls fn while no other session evaluates, with the ports of
+// the session current.
+func (c *replConn) guard(fn func()) {
+	c.lock()
+	defer c.unlock()
+	fn()
+}
+
+func (c *replConn) lock() {
+	c.server.mu.Lock()
+	c.restore = c.server.Interp.UsePorts(c.in, c.out, c.out)
+	c.held = true
+}
+
+func (c *replConn) unlock() {
+	c.held = false
+	c.restore()
+	c.server.mu.Unlock()
+}
+
+// Read reads the input of the session.  While it waits for input, an
+// evaluation of the session, e.g. of `read-line`, gives up the lock to
+// the other sessions.
+func (c *replConn) Read(p []byte) (int, error) {
+	if len(c.rest) == 0 {
+		held := c.held
+		if held {
+			c.unlock()
+		}
+		c.setWaiting(true)
+		chunk, ok := <-c.chunks
+		c.setWaiting(false)
+		if held {
+			c.lock()
+		}
+		if !ok {
+			return 0, c.err
+		}
+		c.rest = chunk
+	}
+	n := copy(p, c.rest)
+	c.rest = c.rest[n:]
+	return n, nil
+}
+
+func (c *replConn) setWaiting(waiting bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if waiting {
+		c.waitSince = time.Now()
+	} else {
+		c.waitSince = time.Time{}
+	}
+}
+
+// receive reads from the connection until it fails, and then calls
+// cancel.  The idle timeout counts only while the session waits for
+// input.
+func (c *replConn) receive(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	defer close(c.chunks)
+	for {
+		if err := c.setDeadline(); err != nil {
+			c.err = err
+			return
+		}
+		buf := make([]byte, 4096)
+		n, err := c.conn.Read(buf)
+		if n > 0 {
+			select {
+			case c.chunks <- buf[:n]:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) && !c.idle() {
+			continue
+		}
+		if err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// setDeadline sets the read deadline of the connection to when the
+// session becomes idle.
+func (c *replConn) setDeadline() error {
+	timeout := c.server.IdleTimeout
+	if timeout <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	since := c.waitSince
+	c.mu.Unlock()
+	if since.IsZero() {
+		since = time.Now()
+	}
+	return c.conn.SetReadDeadline(since.Add(timeout))
+}
+
+// idle reports whether the session has waited for input longer than
+// the idle timeout.
+func (c *replConn) idle() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.waitSince.IsZero() && time.Since(c.waitSince) >= c.server.IdleTimeout
+}
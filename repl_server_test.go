@@ -0,0 +1,196 @@
+// gopische/repl_server_test.go
+
+package gopische
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replClient talks to a REPL session.
+type replClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialREPL(t *testing.T, l net.Listener) *replClient {
+	t.Helper()
+	conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &replClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// until reads the output up to a string, which is left out.
+func (c *replClient) until(s string) string {
+	c.t.Helper()
+	var sb strings.Builder
+	for !strings.HasSuffix(sb.String(), s) {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			c.t.Fatalf("%s after %q", err, sb.String())
+		}
+		sb.WriteByte(b)
+	}
+	return strings.TrimSuffix(sb.String(), s)
+}
+
+// eval sends a line and returns the output up to the next prompt.
+func (c *replClient) eval(line string) string {
+	c.t.Helper()
+	if _, err := io.WriteString(c.conn, line+"\n"); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.until(name + " > ")
+}
+
+func serveREPL(t *testing.T, network string, address string, server *REPLServer) net.Listener {
+	t.Helper()
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+	t.Cleanup(func() {
+		l.Close()
+		if err := <-done; err != nil {
+			t.Errorf("fail to serve: %s", err)
+		}
+	})
+	return l
+}
+
+func TestServeREPL(t *testing.T) {
+	var hostOut strings.Builder
+	interp := New(WithStdout(&hostOut))
+	server := &REPLServer{Interp: interp}
+	for _, l := range []net.Listener{
+		serveREPL(t, "tcp", "127.0.0.1:0", server),
+		serveREPL(t, "unix", filepath.Join(t.TempDir(), "repl.sock"), server),
+	} {
+		a, b := dialREPL(t, l), dialREPL(t, l)
+		a.until(name + " > ")
+		b.until(name + " > ")
+
+		tests := []struct {
+			id       int
+			client   *replClient
+			line     string
+			expected string
+		}{
+			{1, a, "(define x 42)", ""},
+			{2, b, "x", "42\n"},
+			{3, a, "(display \"to a\")", "to a"},
+			{4, b, "(write 'to-b (current-error-port))", "to-b"},
+			{5, a, "(define line (read-line))\ninput of a", ""},
+			{6, b, "line", "\"input of a\"\n"},
+			{7, b, "(car '())", "Error: car: wrong type argument, expected pair, got ()\n"},
+			{8, a, "(+ 1\n2)", "3\n"},
+		}
+		for _, tc := range tests {
+			if got := tc.client.eval(tc.line); got != tc.expected {
+				t.Errorf("tests[%d] - wrong output, expected=%q, got=%q", tc.id, tc.expected, got)
+			}
+		}
+
+		// (exit) ends only the session.
+		if _, err := io.WriteString(a.conn, "(exit)\n"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(a.r); err != nil {
+			t.Errorf("session not closed: %s", err)
+		}
+		if got := b.eval("(* x 2)"); got != "84\n" {
+			t.Errorf("wrong output after exit, got=%q", got)
+		}
+	}
+	if hostOut.Len() > 0 {
+		t.Errorf("sessions wrote to the host: %q", hostOut.String())
+	}
+}
+
+func TestServeREPLToken(t *testing.T) {
+	l := serveREPL(t, "tcp", "127.0.0.1:0", &REPLServer{Interp: New(), Token: "secret"})
+
+	tests := []struct {
+		id       int
+		token    string
+		expected string
+	}{
+		{1, "wrong", "Error: authentication failed\n"},
+		{2, "", "Error: authentication failed\n"},
+		{3, "secret", "Welcome"},
+	}
+	for _, tc := range tests {
+		c := dialREPL(t, l)
+		c.until("Token: ")
+		if _, err := io.WriteString(c.conn, tc.token+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := c.r.ReadString('\n')
+		if !strings.HasPrefix(got, tc.expected) {
+			t.Errorf("tests[%d] - wrong response, expected=%q, got=%q", tc.id, tc.expected, got)
+		}
+	}
+}
+
+func TestServeREPLIdleTimeout(t *testing.T) {
+	l := serveREPL(t, "tcp", "127.0.0.1:0", &REPLServer{Interp: New(), IdleTimeout: 100 * time.Millisecond})
+	c := dialREPL(t, l)
+	c.until(name + " > ")
+	if got := c.eval("(+ 1 2)"); got != "3\n" {
+		t.Errorf("wrong output, got=%q", got)
+	}
+	start := time.Now()
+	rest, err := io.ReadAll(c.r)
+	if err != nil {
+		t.Fatalf("session not closed: %s", err)
+	}
+	if !strings.Contains(string(rest), "Bye!") {
+		t.Errorf("no farewell: %q", rest)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("closed after %s", elapsed)
+	}
+}
+
+func TestServeREPLWaitAndDisconnect(t *testing.T) {
+	l := serveREPL(t, "tcp", "127.0.0.1:0", &REPLServer{Interp: New()})
+	a, b := dialREPL(t, l), dialREPL(t, l)
+	a.until(name + " > ")
+	b.until(name + " > ")
+
+	// A session waiting for its input does not block the others.
+	if _, err := io.WriteString(a.conn, "(define line (read-line))\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.eval("(+ 1 2)"); got != "3\n" {
+		t.Errorf("wrong output while a waits, got=%q", got)
+	}
+	if got := a.eval("input of a"); got != "" {
+		t.Errorf("wrong output of a, got=%q", got)
+	}
+	if got := b.eval("line"); got != "\"input of a\"\n" {
+		t.Errorf("wrong line, got=%q", got)
+	}
+
+	// Closing a connection interrupts its evaluation.
+	if _, err := io.WriteString(a.conn, "(let loop () (loop))\n"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	a.conn.Close()
+	if got := b.eval("(* 2 3)"); got != "6\n" {
+		t.Errorf("wrong output after a closed, got=%q", got)
+	}
+}
@@ -0,0 +1,142 @@
+package gopische
+
+import (
+	"fmt"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// Sandbox builds the global environment of an interpreter from the
+// builtin libraries, such as "(scheme base)" or "(scheme file)".
+// Only procedures of allowed libraries are visible, and Scheme code
+// cannot get the others even through `environment` and `eval`.
+//
+// A library may be allowed read-only.  Then procedures which modify
+// the world outside the interpreter, e.g. delete-file or exit, are
+// left out.
+type Sandbox struct {
+	allowed  map[string]bool
+	readOnly map[string]bool
+	denied   map[string]bool
+}
+
+// WithSandbox restricts the builtin procedures of an interpreter.
+// Without it, an interpreter can see all builtin libraries.
+func WithSandbox(s *Sandbox) Option {
+	return func(interp *Interpreter) {
+		interp.sandbox = s
+	}
+}
+
+// Libraries returns the names of the builtin libraries.
+func Libraries() []string {
+	names := make([]string, len(builtinLibraries))
+	for i, lib := range builtinLibraries {
+		names[i] = lib.name
+	}
+	return names
+}
+
+// NewSandbox creates a sandbox which allows the given libraries.
+func NewSandbox(libs ...string) (*Sandbox, error) {
+	s := &Sandbox{
+		allowed:  make(map[string]bool),
+		readOnly: make(map[string]bool),
+		denied:   make(map[string]bool),
+	}
+	for _, lib := range libs {
+		if err := s.Allow(lib); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Allow makes all procedures of a library visible.
+func (s *Sandbox) Allow(lib string) error {
+	if findLibrary(lib) == nil {
+		return fmt.Errorf("unknown library: %s", lib)
+	}
+	s.allowed[lib] = true
+	delete(s.readOnly, lib)
+	return nil
+}
+
+// AllowReadOnly makes procedures of a library visible, except ones
+// which modify the world outside the interpreter.
+func (s *Sandbox) AllowReadOnly(lib string) error {
+	if findLibrary(lib) == nil {
+		return fmt.Errorf("unknown library: %s", lib)
+	}
+	s.allowed[lib] = true
+	s.readOnly[lib] = true
+	return nil
+}
+
+// Deny hides a library, or a single procedure in any library.
+func (s *Sandbox) Deny(name string) error {
+	if findLibrary(name) != nil {
+		delete(s.allowed, name)
+		delete(s.readOnly, name)
+		return nil
+	}
+	if findBuiltin(name) == nil {
+		return fmt.Errorf("unknown library or procedure: %s", name)
+	}
+	s.denied[name] = true
+	return nil
+}
+
+// allows tells whether a library is visible.  A nil sandbox allows
+// everything.
+func (s *Sandbox) allows(lib *builtinLibrary) bool {
+	return s == nil || s.allowed[lib.name]
+}
+
+// exports returns the visible builtins of a library.
+func (s *Sandbox) exports(lib *builtinLibrary) []builtin {
+	var result []builtin
+	for _, b := range lib.all(s == nil || !s.readOnly[lib.name]) {
+		if s == nil || !s.denied[b.name] {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+func findLibrary(name string) *builtinLibrary {
+	for i := range builtinLibraries {
+		if builtinLibraries[i].name == name {
+			return &builtinLibraries[i]
+		}
+	}
+	return nil
+}
+
+func findBuiltin(name string) *builtin {
+	for _, lib := range builtinLibraries {
+		for _, b := range lib.all(true) {
+			if b.name == name {
+				return &b
+			}
+		}
+	}
+	return nil
+}
+
+// importLibrary binds the visible procedures of an allowed library
+// in env.
+func (interp *Interpreter) importLibrary(env *environment, lib *builtinLibrary) {
+	for _, b := range interp.sandbox.exports(lib) {
+		env.define(b.name, interp.prims[b.name])
+	}
+}
+
+// interactionEnvironment returns the global environment as a Scheme
+// object.
+func (interp *Interpreter) interactionEnvironment() *scheme.Environment {
+	if interp.interaction == nil {
+		interp.interaction = scheme.NewEnvironment(interp.global)
+	}
+	return interp.interaction
+}
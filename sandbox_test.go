@@ -0,0 +1,178 @@
+// gopische/sandbox_test.go
+
+package gopische
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSandbox(t *testing.T) {
+	sandbox, err := NewSandbox("(scheme base)", "(scheme eval)")
+	if err != nil {
+		t.Fatalf("fail to create a sandbox: %s", err)
+	}
+	if err := sandbox.AllowReadOnly("(scheme file)"); err != nil {
+		t.Fatalf("fail to allow a library: %s", err)
+	}
+	if err := sandbox.Deny("error"); err != nil {
+		t.Fatalf("fail to deny a procedure: %s", err)
+	}
+
+	tests := []struct {
+		id       int
+		testcase string
+		ok       bool
+	}{
+		{1, "(+ 1 2)", true},
+		{2, "(file-exists? \"/\")", true},
+		{3, "(delete-file \"/nonexistent\")", false},
+		{4, "(exit)", false},
+		{5, "(load \"/nonexistent\")", false},
+		{6, "(display 1)", false},
+		{7, "(error \"boom\")", false},
+		{8, "(eval '(+ 1 2) (environment '(scheme base)))", true},
+		{9, "(environment '(scheme process-context))", false},
+		{10, "(eval '(delete-file \"/nonexistent\") (environment '(scheme file)))", false},
+		{11, "(eval '(error \"boom\") (environment '(scheme base)))", false},
+		{12, "(interaction-environment)", false},
+		{13, "`(1 ,@(list 2 3))", true},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithSandbox(sandbox))
+		_, err := interp.Eval(context.Background(), tc.testcase)
+		if tc.ok && err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if !tc.ok && err == nil {
+			t.Fatalf("tests[%d] - %s must not be available", tc.id, tc.testcase)
+		}
+	}
+}
+
+func TestSandboxUnknownName(t *testing.T) {
+	if _, err := NewSandbox("(scheme nonexistent)"); err == nil {
+		t.Fatalf("no error for an unknown library")
+	}
+	sandbox, _ := NewSandbox()
+	if err := sandbox.Deny("nonexistent"); err == nil {
+		t.Fatalf("no error for an unknown procedure")
+	}
+	if err := sandbox.Deny("(scheme base)"); err != nil {
+		t.Fatalf("fail to deny a library: %s", err)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(eval '(* 2 3) (environment '(scheme base)))", "6"},
+		{2, "(eval '(exact->inexact 1) (environment '(scheme base) '(scheme inexact)))", "1.0"},
+		{3, "(define x 10) (eval 'x (interaction-environment))", "10"},
+		{4, "(eval '(define y 1) (interaction-environment)) y", "1"},
+		{5, "(eval '(let ((a 1)) (+ a 1)) (environment '(scheme base)))", "2"},
+		{6, "(environment '(scheme base))", "#<environment>"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+
+	interp := New()
+	if _, err := interp.Eval(context.Background(), "(eval 'x (environment '(scheme base)))"); err == nil {
+		t.Fatalf("global variables must not be visible in a new environment")
+	}
+	if _, err := interp.Eval(context.Background(), "(environment '(scheme nonexistent))"); err == nil {
+		t.Fatalf("no error for an unknown library")
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected int
+	}{
+		{1, "(exit)", 0},
+		{2, "(exit #t)", 0},
+		{3, "(exit #f)", 1},
+		{4, "(exit 3)", 3},
+		{5, "(emergency-exit 4)", 4},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		_, err := interp.Eval(context.Background(), tc.testcase)
+		var exit *ExitError
+		if !errors.As(err, &exit) {
+			t.Fatalf("tests[%d] - expected an exit error, got %v", tc.id, err)
+		}
+		if exit.Code != tc.expected {
+			t.Fatalf("tests[%d] - wrong exit code, expected=%d, got=%d", tc.id, tc.expected, exit.Code)
+		}
+	}
+
+	// exit runs the after thunks, but emergency-exit does not.
+	winds := []struct {
+		id       int
+		exit     string
+		expected string
+	}{
+		{1, "(exit 2)", "(outer inner)"},
+		{2, "(emergency-exit 2)", "()"},
+	}
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range winds {
+			interp := New(WithEngine(engine))
+			src := `(define ran '())
+                    (define (after name) (lambda () (set! ran (cons name ran))))
+                    (dynamic-wind (lambda () #f)
+                                  (lambda () (dynamic-wind (lambda () #f) (lambda () ` + tc.exit + `) (after 'inner)))
+                                  (after 'outer))`
+			if _, err := interp.Eval(context.Background(), src); err == nil {
+				t.Fatalf("winds[%d] - engine %d: no exit", tc.id, engine)
+			}
+			value, err := interp.Eval(context.Background(), "ran")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("winds[%d] - engine %d: wrong after thunks run, expected=%s, got=%s", tc.id, engine, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestFileProcedures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(path, []byte("hoge"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	interp := New(WithArgs([]string{"gopische", "test.scm"}))
+	src := `(list (file-exists? "` + path + `")
+                  (begin (delete-file "` + path + `") (file-exists? "` + path + `"))
+                  (command-line))`
+	value, err := interp.Eval(context.Background(), src)
+	if err != nil {
+		t.Fatalf("fail to evaluate: %s", err)
+	}
+	expected := `(#t #f ("gopische" "test.scm"))`
+	if value.String() != expected {
+		t.Fatalf("wrong value, expected=%s, got=%s", expected, value)
+	}
+}
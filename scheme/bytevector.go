@@ -0,0 +1,53 @@
+// gopische/scheme/bytevector.go
+
+package scheme
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bytevector object, which holds a sequence of bytes.
+type Bytevector struct {
+	value []byte
+}
+
+// NewBytevector returns a bytevector holding b, which is not copied.
+func NewBytevector(b []byte) *Bytevector {
+	return &Bytevector{value: b}
+}
+
+func (sobj *Bytevector) Tag() Tag {
+	return Tag(BYTEVECTOR)
+}
+
+func (sobj *Bytevector) SubClass() SubClass {
+	return 0
+}
+
+func (sobj *Bytevector) Value() any {
+	return sobj.value
+}
+
+func (sobj *Bytevector) IsClass(bits Class) bool {
+	return bits == bitsBytevector()
+}
+
+func (sobj *Bytevector) String() string {
+	var sb strings.Builder
+	sb.WriteString("#u8(")
+	for i, b := range sobj.value {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		fmt.Fprintf(&sb, "%d", b)
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// Bytes returns the bytes held by the bytevector.  Modifying them
+// modifies the bytevector.
+func (sobj *Bytevector) Bytes() []byte {
+	return sobj.value
+}
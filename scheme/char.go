@@ -0,0 +1,90 @@
+// gopische/scheme/char.go
+
+package scheme
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Char object, which holds a Unicode code point.
+type Char struct {
+	value rune
+}
+
+// charNames are the names of characters in `#\name` notation.
+var charNames = map[string]rune{
+	"alarm":     '\a',
+	"backspace": '\b',
+	"delete":    0x7f,
+	"escape":    0x1b,
+	"newline":   '\n',
+	"null":      0,
+	"return":    '\r',
+	"space":     ' ',
+	"tab":       '\t',
+}
+
+// NewChar returns a character object of r.
+func NewChar(r rune) *Char {
+	return &Char{value: r}
+}
+
+// ParseChar parses a character literal, such as `#\a`, `#\space` or
+// `#\x3bb`.
+func ParseChar(lit string) (*Char, error) {
+	name, ok := strings.CutPrefix(lit, `#\`)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("illegal character literal, %s", lit)
+	}
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) {
+		return NewChar(r), nil
+	}
+	if r, ok := charNames[name]; ok {
+		return NewChar(r), nil
+	}
+	if hex, ok := strings.CutPrefix(name, "x"); ok {
+		if n, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(n)) {
+			return NewChar(rune(n)), nil
+		}
+	}
+	return nil, fmt.Errorf("illegal character literal, %s", lit)
+}
+
+func (sobj *Char) Tag() Tag {
+	return Tag(CHARACTER)
+}
+
+func (sobj *Char) SubClass() SubClass {
+	return 0
+}
+
+func (sobj *Char) Value() any {
+	return sobj.value
+}
+
+func (sobj *Char) IsClass(bits Class) bool {
+	return bits == bitsCharacter()
+}
+
+// String returns the external representation, which is read back as
+// the same character.
+func (sobj *Char) String() string {
+	for name, r := range charNames {
+		if r == sobj.value {
+			return `#\` + name
+		}
+	}
+	if !unicode.IsGraphic(sobj.value) {
+		return fmt.Sprintf(`#\x%x`, sobj.value)
+	}
+	return `#\` + string(sobj.value)
+}
+
+// Rune returns the code point of the character.
+func (sobj *Char) Rune() rune {
+	return sobj.value
+}
@@ -0,0 +1,38 @@
+// gopische/scheme/environment.go
+
+package scheme
+
+// Environment object, which is a first-class environment given to
+// `eval`.  Like a procedure, its body is opaque to this package.
+type Environment struct {
+	impl any
+}
+
+func NewEnvironment(impl any) *Environment {
+	return &Environment{impl: impl}
+}
+
+func (sobj *Environment) Tag() Tag {
+	return Tag(ENVIRONMENT)
+}
+
+func (sobj *Environment) SubClass() SubClass {
+	return 0
+}
+
+func (sobj *Environment) Value() any {
+	return sobj.impl
+}
+
+func (sobj *Environment) IsClass(bits Class) bool {
+	return bits == bitsEnvironment()
+}
+
+func (sobj *Environment) String() string {
+	return "#<environment>"
+}
+
+// Impl returns the body of the environment given to NewEnvironment.
+func (sobj *Environment) Impl() any {
+	return sobj.impl
+}
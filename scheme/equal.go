@@ -0,0 +1,148 @@
+// gopische/scheme/equal.go
+
+package scheme
+
+import (
+	"bytes"
+	"math/big"
+)
+
+// Eq implements `eq?`.  Symbols with the same name are the same
+// object even if they are not interned by the same table, and so are
+// characters with the same code point.
+func Eq(a Object, b Object) bool {
+	if a == b {
+		return true
+	}
+	switch av := a.(type) {
+	case *Symbol:
+		if bv, ok := b.(*Symbol); ok {
+			return av.value == bv.value
+		}
+	case *Boolean:
+		if bv, ok := b.(*Boolean); ok {
+			return av.value == bv.value
+		}
+	case *Char:
+		if bv, ok := b.(*Char); ok {
+			return av.value == bv.value
+		}
+	}
+	return false
+}
+
+// Eqv implements `eqv?`.  Numbers are compared by their exactness
+// and values.
+func Eqv(a Object, b Object) bool {
+	if Eq(a, b) {
+		return true
+	}
+	an, ok := a.(*Number)
+	if !ok {
+		return false
+	}
+	bn, ok := b.(*Number)
+	if !ok {
+		return false
+	}
+	if ar, ok := an.value.(*big.Rat); ok {
+		br, ok := bn.value.(*big.Rat)
+		return ok && ar.Cmp(br) == 0
+	}
+	return an.tag == bn.tag && an.value == bn.value
+}
+
+// equalFastSteps is the number of pairs and vectors which Equal
+// compares before it begins to track the ones compared already.
+const equalFastSteps = 1000
+
+// Equal implements `equal?`.  It compares pairs, vectors, strings and
+// bytevectors by their contents.  It terminates even on circular data,
+// since pairs and vectors compared once are regarded as equal when
+// they meet again, and it does not consume the Go stack for nested
+// data.
+func Equal(a Object, b Object) bool {
+	var seen equivalences
+	steps := 0
+	stack := []Object{a, b}
+	for len(stack) > 0 {
+		a, b := stack[len(stack)-2], stack[len(stack)-1]
+		stack = stack[:len(stack)-2]
+		if Eqv(a, b) {
+			continue
+		}
+		switch av := a.(type) {
+		case *String:
+			bv, ok := b.(*String)
+			if !ok || av.value != bv.value {
+				return false
+			}
+			continue
+		case *Bytevector:
+			bv, ok := b.(*Bytevector)
+			if !ok || !bytes.Equal(av.value, bv.value) {
+				return false
+			}
+			continue
+		case *Vector:
+			bv, ok := b.(*Vector)
+			if !ok || len(av.value) != len(bv.value) {
+				return false
+			}
+		case *Pair:
+			if _, ok := b.(*Pair); !ok {
+				return false
+			}
+		default:
+			return false
+		}
+		if steps++; steps > equalFastSteps && seen.union(a, b) {
+			continue
+		}
+		switch av := a.(type) {
+		case *Vector:
+			bv := b.(*Vector)
+			for i := len(av.value) - 1; i >= 0; i-- {
+				stack = append(stack, av.value[i], bv.value[i])
+			}
+		case *Pair:
+			bv := b.(*Pair)
+			stack = append(stack, av.cdr, bv.cdr, av.car, bv.car)
+		}
+	}
+	return true
+}
+
+// equivalences is a union-find of the objects regarded as equal.
+type equivalences map[Object]Object
+
+func (e *equivalences) find(obj Object) Object {
+	root := obj
+	for {
+		parent, ok := (*e)[root]
+		if !ok {
+			break
+		}
+		root = parent
+	}
+	for obj != root {
+		next := (*e)[obj]
+		(*e)[obj] = root
+		obj = next
+	}
+	return root
+}
+
+// union merges the classes of a and b, and reports whether they were
+// in the same class already.
+func (e *equivalences) union(a Object, b Object) bool {
+	if *e == nil {
+		*e = make(equivalences)
+	}
+	ra, rb := e.find(a), e.find(b)
+	if ra == rb {
+		return true
+	}
+	(*e)[ra] = rb
+	return false
+}
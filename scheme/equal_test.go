@@ -0,0 +1,67 @@
+// gopische/scheme/equal_test.go
+
+package scheme
+
+import (
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	list := func(elems ...Object) Object { return NewList(elems...) }
+	// cdrCycle returns (elems ... elems ...), which is circular.
+	cdrCycle := func(elems ...Object) Object {
+		first := NewPair(elems[0], EmptyList)
+		last := first
+		for _, elem := range elems[1:] {
+			pair := NewPair(elem, EmptyList)
+			last.SetCdr(pair)
+			last = pair
+		}
+		last.SetCdr(first)
+		return first
+	}
+	// carCycle returns #0=(elem . #0#) with the pair in its car.
+	carCycle := func(elem Object) Object {
+		pair := NewPair(EmptyList, elem)
+		pair.SetCar(pair)
+		return pair
+	}
+	vectorCycle := func(elem Object) Object {
+		v := NewVector([]Object{elem, nil})
+		v.Elements()[1] = v
+		return v
+	}
+	deep := func(depth int) Object {
+		var obj Object = EmptyList
+		for range depth {
+			obj = NewPair(obj, EmptyList)
+		}
+		return obj
+	}
+
+	tests := []struct {
+		id       int
+		a        Object
+		b        Object
+		expected bool
+	}{
+		{1, list(NewInteger(1), NewString("x")), list(NewInteger(1), NewString("x")), true},
+		{2, list(NewInteger(1)), list(NewInteger(1), NewInteger(2)), false},
+		{3, NewVector([]Object{NewString("a")}), NewVector([]Object{NewString("a")}), true},
+		{4, NewBytevector([]byte{1}), NewString("\x01"), false},
+		{5, cdrCycle(NewInteger(1), NewInteger(2)), cdrCycle(NewInteger(1), NewInteger(2)), true},
+		{6, cdrCycle(NewInteger(1), NewInteger(2)), cdrCycle(NewInteger(1), NewInteger(2), NewInteger(1), NewInteger(2)), true},
+		{7, cdrCycle(NewInteger(1), NewInteger(2)), cdrCycle(NewInteger(1), NewInteger(3)), false},
+		{8, carCycle(NewInteger(1)), carCycle(NewInteger(1)), true},
+		{9, carCycle(NewInteger(1)), carCycle(NewInteger(2)), false},
+		{10, vectorCycle(NewString("a")), vectorCycle(NewString("a")), true},
+		{11, vectorCycle(NewString("a")), vectorCycle(NewString("b")), false},
+		{12, deep(1000000), deep(1000000), true},
+	}
+
+	for _, tc := range tests {
+		if got := Equal(tc.a, tc.b); got != tc.expected {
+			t.Fatalf("tests[%d] - wrong result, expected=%t, got=%t", tc.id, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// gopische/scheme/error.go
+
+package scheme
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrorObject is a condition raised by `error`, or by a procedure
+// which fails, e.g. to open a file.  It is also a Go error, so that
+// an embedder can tell the kind of an error by errors.As, and the Go
+// error which causes it by errors.Is.
+type ErrorObject struct {
+	tag       Tag // ERROR_OBJECT, FILE_ERROR or READ_ERROR
+	message   string
+	irritants []Object
+	err       error // the cause, nil if raised by Scheme code
+}
+
+// NewErrorObject returns an error object with a message and irritants,
+// as `error` creates.
+func NewErrorObject(message string, irritants ...Object) *ErrorObject {
+	return &ErrorObject{tag: ERROR_OBJECT, message: message, irritants: irritants}
+}
+
+// NewFileError returns an error object satisfying `file-error?`,
+// which is caused by err.  The path of a *fs.PathError becomes the
+// irritant.
+func NewFileError(err error) *ErrorObject {
+	e := &ErrorObject{tag: FILE_ERROR, message: err.Error(), err: err}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		e.message = pathErr.Op + ": " + pathErr.Err.Error()
+		e.irritants = []Object{NewString(pathErr.Path)}
+	}
+	return e
+}
+
+// NewReadError returns an error object satisfying `read-error?`,
+// which is caused by err.
+func NewReadError(err error) *ErrorObject {
+	return &ErrorObject{tag: READ_ERROR, message: err.Error(), err: err}
+}
+
+// WrapError returns an error object caused by a Go error.  An error
+// object in the chain of err is returned as it is.
+func WrapError(err error) *ErrorObject {
+	var e *ErrorObject
+	if errors.As(err, &e) {
+		return e
+	}
+	return &ErrorObject{tag: ERROR_OBJECT, message: err.Error(), err: err}
+}
+
+func (sobj *ErrorObject) Tag() Tag {
+	return Tag(CONDITION)
+}
+
+func (sobj *ErrorObject) SubClass() SubClass {
+	return sobj.tag.subClass()
+}
+
+func (sobj *ErrorObject) Value() any {
+	return sobj.message
+}
+
+func (sobj *ErrorObject) IsClass(bits Class) bool {
+	return bits == bitsCondition()
+}
+
+func (sobj *ErrorObject) String() string {
+	return Write(sobj)
+}
+
+// Error returns the message followed by the irritants, which are
+// written with datum labels if they contain cycles.
+func (sobj *ErrorObject) Error() string {
+	p := &printer{labels: findLabels(sobj, false)}
+	p.errorText(sobj)
+	return p.sb.String()
+}
+
+func (sobj *ErrorObject) Unwrap() error {
+	return sobj.err
+}
+
+func (sobj *ErrorObject) Message() string {
+	return sobj.message
+}
+
+func (sobj *ErrorObject) Irritants() []Object {
+	return sobj.irritants
+}
+
+func (sobj *ErrorObject) IsFileError() bool {
+	return sobj.tag == FILE_ERROR
+}
+
+func (sobj *ErrorObject) IsReadError() bool {
+	return sobj.tag == READ_ERROR
+}
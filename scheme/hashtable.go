@@ -0,0 +1,410 @@
+// gopische/scheme/hashtable.go
+
+package scheme
+
+import (
+	"errors"
+	"hash/maphash"
+	"math/big"
+	"weak"
+)
+
+// Hasher defines the equivalence of the keys of a hash table, and a
+// hash function consistent with it, i.e. equivalent keys have the same
+// hash.
+type Hasher interface {
+	Hash(key Object) (uint64, error)
+	Equal(a Object, b Object) (bool, error)
+}
+
+// hashSeed is the seed of hashes, which are stable while the process
+// runs.
+var hashSeed = maphash.MakeSeed()
+
+type builtinHasher struct {
+	hash  func(Object) uint64
+	equal func(a Object, b Object) bool
+}
+
+func (h *builtinHasher) Hash(key Object) (uint64, error) {
+	return h.hash(key), nil
+}
+
+func (h *builtinHasher) Equal(a Object, b Object) (bool, error) {
+	return h.equal(a, b), nil
+}
+
+// Hashers of `eq?`, `eqv?`, `equal?` and `string=?`.  StringHasher
+// expects keys to be strings.
+var (
+	EqHasher     Hasher = &builtinHasher{hash: EqHash, equal: Eq}
+	EqvHasher    Hasher = &builtinHasher{hash: EqvHash, equal: Eqv}
+	EqualHasher  Hasher = &builtinHasher{hash: EqualHash, equal: Equal}
+	StringHasher Hasher = &builtinHasher{hash: EqualHash, equal: Equal}
+)
+
+// EqHash returns a hash consistent with Eq.
+func EqHash(obj Object) uint64 {
+	switch v := obj.(type) {
+	case *Symbol:
+		return maphash.String(hashSeed, v.value)
+	case *Boolean:
+		return maphash.Comparable(hashSeed, v.value)
+	case *Char:
+		return maphash.Comparable(hashSeed, v.value)
+	}
+	return maphash.Comparable(hashSeed, obj)
+}
+
+// EqvHash returns a hash consistent with Eqv.
+func EqvHash(obj Object) uint64 {
+	if n, ok := obj.(*Number); ok {
+		if r, ok := n.value.(*big.Rat); ok {
+			return maphash.String(hashSeed, r.RatString())
+		}
+		return maphash.Comparable(hashSeed, n.value)
+	}
+	return EqHash(obj)
+}
+
+// equalHashBudget is the number of objects in a key which EqualHash
+// looks at, so that hashing a long list is cheap.
+const equalHashBudget = 64
+
+// EqualHash returns a hash consistent with Equal.
+func EqualHash(obj Object) uint64 {
+	budget := equalHashBudget
+	return equalHash(obj, &budget)
+}
+
+func equalHash(obj Object, budget *int) uint64 {
+	*budget--
+	if *budget < 0 {
+		return 0
+	}
+	switch v := obj.(type) {
+	case *String:
+		return maphash.String(hashSeed, v.value)
+	case *Bytevector:
+		return maphash.Bytes(hashSeed, v.value)
+	case *Pair:
+		car := equalHash(v.car, budget)
+		return (car^0x9e3779b97f4a7c15)*0x100000001b3 + equalHash(v.cdr, budget)
+	case *Vector:
+		h := uint64(len(v.value))
+		for _, elem := range v.value {
+			if *budget <= 0 {
+				break
+			}
+			h = (h^0x9e3779b97f4a7c15)*0x100000001b3 + equalHash(elem, budget)
+		}
+		return h
+	}
+	return EqvHash(obj)
+}
+
+// errImmutable is returned when an immutable hash table is modified.
+var errImmutable = errors.New("immutable hash table")
+
+// HashTable object, which maps keys to values.  The keys are compared
+// by a Hasher.  A weak hash table does not keep its keys alive, and
+// forgets the entries whose keys are collected.
+type HashTable struct {
+	hasher  Hasher
+	weak    bool
+	mutable bool
+
+	buckets map[uint64][]*hashEntry
+	entries []*hashEntry // in the order of insertion, with removed ones
+	size    int
+}
+
+type hashEntry struct {
+	hash    uint64
+	strong  Object  // the key, nil if held weakly
+	weak    weakRef // the key, nil if held strongly
+	value   Object
+	removed bool
+}
+
+// key returns the key of an entry, or nil if it has been collected.
+func (e *hashEntry) key() Object {
+	if e.weak != nil {
+		return e.weak.get()
+	}
+	return e.strong
+}
+
+// weakRef refers to an object without keeping it alive.
+type weakRef interface {
+	get() Object
+}
+
+type weakPointer[T any] struct {
+	p weak.Pointer[T]
+}
+
+func (w weakPointer[T]) get() Object {
+	if p := w.p.Value(); p != nil {
+		return any(p).(Object)
+	}
+	return nil
+}
+
+func newWeakPointer[T any](p *T) weakRef {
+	return weakPointer[T]{p: weak.Make(p)}
+}
+
+// makeWeakRef returns a weak reference to an object which is
+// allocated by itself.  Others, e.g. symbols and numbers, are held
+// strongly, since they can be made again.
+func makeWeakRef(obj Object) weakRef {
+	switch v := obj.(type) {
+	case *Pair:
+		return newWeakPointer(v)
+	case *String:
+		return newWeakPointer(v)
+	case *Bytevector:
+		return newWeakPointer(v)
+	case *Vector:
+		return newWeakPointer(v)
+	case *Procedure:
+		return newWeakPointer(v)
+	case *Record:
+		return newWeakPointer(v)
+	case *RecordType:
+		return newWeakPointer(v)
+	case *Port:
+		return newWeakPointer(v)
+	case *Environment:
+		return newWeakPointer(v)
+	case *ErrorObject:
+		return newWeakPointer(v)
+	case *HashTable:
+		return newWeakPointer(v)
+	case *Regexp:
+		return newWeakPointer(v)
+	case *RegexpMatch:
+		return newWeakPointer(v)
+	}
+	return nil
+}
+
+// NewHashTable creates an empty mutable hash table.
+func NewHashTable(hasher Hasher, weak bool) *HashTable {
+	return &HashTable{
+		hasher:  hasher,
+		weak:    weak,
+		mutable: true,
+		buckets: make(map[uint64][]*hashEntry),
+	}
+}
+
+func (sobj *HashTable) Tag() Tag {
+	return Tag(HASH_TABLE)
+}
+
+func (sobj *HashTable) SubClass() SubClass {
+	return 0
+}
+
+func (sobj *HashTable) Value() any {
+	return sobj
+}
+
+func (sobj *HashTable) IsClass(bits Class) bool {
+	return bits == bitsHashTable()
+}
+
+func (sobj *HashTable) String() string {
+	return "#<hash-table>"
+}
+
+// Hasher returns the hasher of the keys.
+func (sobj *HashTable) Hasher() Hasher {
+	return sobj.hasher
+}
+
+// IsWeak tells whether the hash table holds its keys weakly.
+func (sobj *HashTable) IsWeak() bool {
+	return sobj.weak
+}
+
+// IsMutable tells whether the hash table can be modified.
+func (sobj *HashTable) IsMutable() bool {
+	return sobj.mutable
+}
+
+// find returns the entry of a key, or nil, with the hash of the key.
+// It drops the entries of collected keys in the bucket.
+func (sobj *HashTable) find(key Object) (*hashEntry, uint64, error) {
+	hash, err := sobj.hasher.Hash(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	bucket := sobj.buckets[hash]
+	for i := 0; i < len(bucket); i++ {
+		e := bucket[i]
+		k := e.key()
+		if k == nil {
+			sobj.remove(e)
+			bucket = sobj.buckets[hash]
+			i--
+			continue
+		}
+		same, err := sobj.hasher.Equal(k, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		if same {
+			return e, hash, nil
+		}
+	}
+	return nil, hash, nil
+}
+
+// remove drops an entry.
+func (sobj *HashTable) remove(e *hashEntry) {
+	bucket := sobj.buckets[e.hash]
+	for i, b := range bucket {
+		if b == e {
+			bucket = append(bucket[:i:i], bucket[i+1:]...)
+			break
+		}
+	}
+	if len(bucket) == 0 {
+		delete(sobj.buckets, e.hash)
+	} else {
+		sobj.buckets[e.hash] = bucket
+	}
+	e.removed = true
+	sobj.size--
+	// The removed entries are swept when they are the majority.
+	if removed := len(sobj.entries) - sobj.size; removed > 16 && removed > sobj.size {
+		sobj.entries = sobj.live()
+	}
+}
+
+// live returns the entries not removed.
+func (sobj *HashTable) live() []*hashEntry {
+	entries := make([]*hashEntry, 0, sobj.size)
+	for _, e := range sobj.entries {
+		if !e.removed {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// prune drops the entries whose keys are collected.
+func (sobj *HashTable) prune() {
+	if !sobj.weak {
+		return
+	}
+	for _, e := range sobj.entries {
+		if !e.removed && e.key() == nil {
+			sobj.remove(e)
+		}
+	}
+}
+
+// Ref returns the value of a key, and whether the key is found.
+func (sobj *HashTable) Ref(key Object) (Object, bool, error) {
+	e, _, err := sobj.find(key)
+	if err != nil || e == nil {
+		return nil, false, err
+	}
+	return e.value, true, nil
+}
+
+// Set associates a value with a key.  It tells whether a new entry is
+// added.
+func (sobj *HashTable) Set(key Object, value Object) (bool, error) {
+	if !sobj.mutable {
+		return false, errImmutable
+	}
+	e, hash, err := sobj.find(key)
+	if err != nil {
+		return false, err
+	}
+	if e != nil {
+		e.value = value
+		return false, nil
+	}
+	e = &hashEntry{hash: hash, value: value}
+	if sobj.weak {
+		e.weak = makeWeakRef(key)
+	}
+	if e.weak == nil {
+		e.strong = key
+	}
+	sobj.buckets[hash] = append(sobj.buckets[hash], e)
+	sobj.entries = append(sobj.entries, e)
+	sobj.size++
+	return true, nil
+}
+
+// Delete removes the entry of a key, and tells whether it was there.
+func (sobj *HashTable) Delete(key Object) (bool, error) {
+	if !sobj.mutable {
+		return false, errImmutable
+	}
+	e, _, err := sobj.find(key)
+	if err != nil || e == nil {
+		return false, err
+	}
+	sobj.remove(e)
+	return true, nil
+}
+
+// Clear removes all entries.
+func (sobj *HashTable) Clear() error {
+	if !sobj.mutable {
+		return errImmutable
+	}
+	for _, e := range sobj.entries {
+		e.removed = true
+	}
+	sobj.buckets = make(map[uint64][]*hashEntry)
+	sobj.entries = nil
+	sobj.size = 0
+	return nil
+}
+
+// Len returns the number of entries.
+func (sobj *HashTable) Len() int {
+	sobj.prune()
+	return sobj.size
+}
+
+// Entries returns the keys and the values of the entries in the order
+// of insertion.  Modifying the hash table does not affect them.
+func (sobj *HashTable) Entries() ([]Object, []Object) {
+	sobj.prune()
+	keys := make([]Object, 0, sobj.size)
+	values := make([]Object, 0, sobj.size)
+	for _, e := range sobj.entries {
+		if e.removed {
+			continue
+		}
+		// A key may be collected after pruning.
+		if k := e.key(); k != nil {
+			keys = append(keys, k)
+			values = append(values, e.value)
+		}
+	}
+	return keys, values
+}
+
+// Copy returns a hash table with the same entries, which is mutable
+// only if mutable is true.
+func (sobj *HashTable) Copy(mutable bool) *HashTable {
+	table := NewHashTable(sobj.hasher, sobj.weak)
+	keys, values := sobj.Entries()
+	for i, key := range keys {
+		// The keys are already unique.
+		_, _ = table.Set(key, values[i])
+	}
+	table.mutable = mutable
+	return table
+}
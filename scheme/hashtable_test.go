@@ -0,0 +1,108 @@
+// gopische/scheme/hashtable_test.go
+
+package scheme
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestHashTable(t *testing.T) {
+	list := func(elems ...Object) Object { return NewList(elems...) }
+	tests := []struct {
+		id     int
+		hasher Hasher
+		key    Object
+		same   Object // a key equivalent to key, but not eq
+		other  Object // a key not equivalent to key
+	}{
+		{1, EqHasher, NewSymbol("a"), NewSymbol("a"), NewSymbol("b")},
+		{2, EqHasher, NewChar('a'), NewChar('a'), NewChar('b')},
+		{3, EqvHasher, NewInteger(1), NewInteger(1), NewFloat(1)},
+		{4, EqvHasher, NewFloat(-0.0), NewFloat(0.0), NewInteger(0)},
+		{5, EqualHasher, NewString("abc"), NewString("abc"), NewString("abd")},
+		{6, EqualHasher, list(NewInteger(1), NewString("x")), list(NewInteger(1), NewString("x")), list(NewInteger(1))},
+		{7, EqualHasher, NewBytevector([]byte{1, 2}), NewBytevector([]byte{1, 2}), NewBytevector([]byte{2, 1})},
+		{8, StringHasher, NewString("日本"), NewString("日本"), NewString("日")},
+	}
+
+	for _, tc := range tests {
+		table := NewHashTable(tc.hasher, false)
+		if added, err := table.Set(tc.key, NewInteger(1)); err != nil || !added {
+			t.Fatalf("tests[%d] - fail to add: %v", tc.id, err)
+		}
+		if added, err := table.Set(tc.same, NewInteger(2)); err != nil || added {
+			t.Fatalf("tests[%d] - fail to replace: %v", tc.id, err)
+		}
+		if table.Len() != 1 {
+			t.Fatalf("tests[%d] - wrong size, expected=1, got=%d", tc.id, table.Len())
+		}
+		if value, ok, _ := table.Ref(tc.key); !ok || !Eqv(value, NewInteger(2)) {
+			t.Fatalf("tests[%d] - wrong value, expected=2, got=%v", tc.id, value)
+		}
+		if _, ok, _ := table.Ref(tc.other); ok {
+			t.Fatalf("tests[%d] - found %s", tc.id, tc.other)
+		}
+		if found, _ := table.Delete(tc.same); !found || table.Len() != 0 {
+			t.Fatalf("tests[%d] - fail to delete", tc.id)
+		}
+	}
+}
+
+func TestHashTableEntries(t *testing.T) {
+	table := NewHashTable(EqvHasher, false)
+	for i := range 100 {
+		_, _ = table.Set(NewInteger(int64(i)), NewInteger(int64(i*i)))
+	}
+	for i := 0; i < 100; i += 2 {
+		_, _ = table.Delete(NewInteger(int64(i)))
+	}
+	_, _ = table.Set(NewInteger(0), NewInteger(0))
+
+	keys, values := table.Entries()
+	if len(keys) != 51 {
+		t.Fatalf("wrong number of entries, expected=51, got=%d", len(keys))
+	}
+	for i, key := range keys[:50] {
+		n := int64(2*i + 1)
+		if !Eqv(key, NewInteger(n)) || !Eqv(values[i], NewInteger(n*n)) {
+			t.Fatalf("entries[%d] - wrong entry, expected=%d, got=%s", i, n, key)
+		}
+	}
+	if !Eqv(keys[50], NewInteger(0)) {
+		t.Fatalf("wrong last key, expected=0, got=%s", keys[50])
+	}
+
+	immutable := table.Copy(false)
+	if immutable.Len() != 51 || immutable.IsMutable() {
+		t.Fatalf("wrong copy")
+	}
+	if _, err := immutable.Set(NewInteger(0), NewInteger(1)); err == nil {
+		t.Fatalf("immutable hash table modified")
+	}
+	if err := table.Clear(); err != nil || table.Len() != 0 {
+		t.Fatalf("fail to clear")
+	}
+}
+
+func TestWeakHashTable(t *testing.T) {
+	table := NewHashTable(EqHasher, true)
+	kept := NewString("kept")
+	_, _ = table.Set(kept, NewInteger(1))
+	_, _ = table.Set(NewSymbol("symbol"), NewInteger(2))
+	for range 10 {
+		_, _ = table.Set(NewString("dropped"), NewInteger(3))
+	}
+	runtime.GC()
+
+	if table.Len() != 2 {
+		t.Fatalf("wrong size, expected=2, got=%d", table.Len())
+	}
+	if value, ok, _ := table.Ref(kept); !ok || !Eqv(value, NewInteger(1)) {
+		t.Fatalf("wrong value of a kept key, got=%v", value)
+	}
+	if _, ok, _ := table.Ref(NewSymbol("symbol")); !ok {
+		t.Fatalf("symbol collected")
+	}
+	runtime.KeepAlive(kept)
+}
@@ -0,0 +1,53 @@
+// gopische/scheme/list.go
+
+package scheme
+
+// ListToSlice converts a proper list into a slice of its elements.
+// It returns false when obj is not a proper list, including when it is
+// a circular list.
+func ListToSlice(obj Object) ([]Object, bool) {
+	var elems []Object
+	slow := obj
+	for obj != EmptyList {
+		pair, ok := obj.(*Pair)
+		if !ok {
+			return elems, false
+		}
+		elems = append(elems, pair.car)
+		obj = pair.cdr
+		if len(elems)%2 == 0 {
+			slow = slow.(*Pair).cdr
+			if slow == obj {
+				return elems, false
+			}
+		}
+	}
+	return elems, true
+}
+
+// IsList reports whether obj is a proper list.  It terminates even
+// if obj is a circular list.
+func IsList(obj Object) bool {
+	slow, fast := obj, obj
+	for {
+		if fast == EmptyList {
+			return true
+		}
+		pair, ok := fast.(*Pair)
+		if !ok {
+			return false
+		}
+		fast = pair.cdr
+		if fast == EmptyList {
+			return true
+		}
+		if pair, ok = fast.(*Pair); !ok {
+			return false
+		}
+		fast = pair.cdr
+		slow = slow.(*Pair).cdr
+		if fast == slow {
+			return false
+		}
+	}
+}
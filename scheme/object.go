@@ -8,6 +8,11 @@ package scheme
 import (
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // Object provides a generalized interface to handle a Scheme data
@@ -17,14 +22,16 @@ import (
 // - boolean
 // - string
 // - symbol
-// - character (not implemented yet in this version)
+// - character
 // - number
 //
 // Compound data objects:
 // - list
 // - procedure
-// - vector (not implemented yet in this version)
-// - port (not implemented yet in this version)
+// - record
+// - vector
+// - bytevector
+// - port
 type Object interface {
 	// Returns a tag of a Scheme data object.
 	Tag() Tag
@@ -76,6 +83,12 @@ type Boolean struct {
 	value bool
 }
 
+// Booleans are immutable, so #t and #f are singletons.
+var (
+	True  = &Boolean{value: true}
+	False = &Boolean{value: false}
+)
+
 func (sobj *Boolean) Tag() Tag {
 	return Tag(BOOLEAN)
 }
@@ -121,8 +134,10 @@ func (sobj *String) IsClass(bits Class) bool {
 	return bits == bitsString()
 }
 
+// String returns a string literal, escaping quotation marks and
+// control characters as `write` does.
 func (sobj *String) String() string {
-	return fmt.Sprintf("\"%s\"", sobj.value)
+	return quoteString(sobj.value)
 }
 
 // Symbol object
@@ -150,6 +165,55 @@ func (sobj *Symbol) String() string {
 	return sobj.value
 }
 
+func (sobj *Symbol) Name() string {
+	return sobj.value
+}
+
+// Special object, such as the unspecified value.  It has no printed
+// representation in the source code.
+type Special struct {
+	tag Tag
+}
+
+// Unspecified is returned by expressions whose values are unspecified
+// in R7RS, such as `set!`.
+var Unspecified = &Special{tag: UNSPECIFIED}
+
+// Undefined is the value of a variable which is bound but not yet
+// initialized (e.g. in `letrec`).
+var Undefined = &Special{tag: UNDEFINED}
+
+// EOF is returned by input procedures at the end of the input.
+var EOF = &Special{tag: EOF_OBJECT}
+
+func (sobj *Special) Tag() Tag {
+	return Tag(SPECIAL)
+}
+
+func (sobj *Special) SubClass() SubClass {
+	return sobj.tag.subClass()
+}
+
+func (sobj *Special) Value() any {
+	return nil
+}
+
+func (sobj *Special) IsClass(bits Class) bool {
+	return bits == bitsSpecial()
+}
+
+func (sobj *Special) String() string {
+	switch sobj.tag {
+	case UNSPECIFIED:
+		return "#<unspecified>"
+	case UNDEFINED:
+		return "#<undefined>"
+	case EOF_OBJECT:
+		return "#<eof>"
+	}
+	return "#<special>"
+}
+
 // Number object
 type Number struct {
 	tag   Tag
@@ -179,14 +243,90 @@ func (sobj *Number) String() (str string) {
 		str = fmt.Sprintf("%d", iv)
 	case float64:
 		fv := sobj.value.(float64)
-		str = fmt.Sprintf("%g", fv)
+		str = formatFloat(fv)
 	case complex128:
 		cv := sobj.value.(complex128)
 		str = fmt.Sprintf("%g", cv)
+	case *big.Rat:
+		str = sobj.value.(*big.Rat).RatString()
 	}
 	return
 }
 
+// Pair object
+type Pair struct {
+	car Object
+	cdr Object
+	loc *Location
+}
+
+func (sobj *Pair) Tag() Tag {
+	return Tag(LIST)
+}
+
+func (sobj *Pair) SubClass() SubClass {
+	return 0
+}
+
+func (sobj *Pair) Value() any {
+	return [2]Object{sobj.car, sobj.cdr}
+}
+
+func (sobj *Pair) IsClass(bits Class) bool {
+	return bits == bitsList()
+}
+
+func (sobj *Pair) Car() Object {
+	return sobj.car
+}
+
+func (sobj *Pair) Cdr() Object {
+	return sobj.cdr
+}
+
+func (sobj *Pair) SetCar(obj Object) {
+	sobj.car = obj
+}
+
+func (sobj *Pair) SetCdr(obj Object) {
+	sobj.cdr = obj
+}
+
+// Location returns where the pair is read from, or nil when it is
+// unknown.
+func (sobj *Pair) Location() *Location {
+	return sobj.loc
+}
+
+// SetLocation records where the pair is read from.
+func (sobj *Pair) SetLocation(loc *Location) {
+	sobj.loc = loc
+}
+
+// String returns the representation of a list as `write` prints,
+// which has datum labels if the list is cyclic.
+func (sobj *Pair) String() string {
+	return Write(sobj)
+}
+
+// formatFloat formats an inexact real number, so that it can be read
+// back as an inexact number.
+func formatFloat(fv float64) string {
+	switch {
+	case math.IsInf(fv, 1):
+		return "+inf.0"
+	case math.IsInf(fv, -1):
+		return "-inf.0"
+	case math.IsNaN(fv):
+		return "+nan.0"
+	}
+	str := strconv.FormatFloat(fv, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".e") {
+		str += ".0"
+	}
+	return str
+}
+
 // factory
 func NewSchemeObject(tag Tag, value any) (Object, error) {
 	var sobj Object
@@ -213,6 +353,10 @@ func NewSchemeObject(tag Tag, value any) (Object, error) {
 		if sobj, ok = newNumber(value); !ok {
 			emsg = fmt.Sprintf("illegal number value, %v", value)
 		}
+	case LIST:
+		if sobj, ok = newList(value); !ok {
+			emsg = fmt.Sprintf("illegal list value, %v", value)
+		}
 	default:
 		ok = false
 		emsg = fmt.Sprintf("illegal tag as Sobj, %s", tag)
@@ -232,7 +376,7 @@ func newNil(v any) (Object, bool) {
 func newBoolean(v any) (sobj Object, ok bool) {
 	var bv bool
 	if bv, ok = v.(bool); ok {
-		sobj = &Boolean{value: bv}
+		sobj = NewBoolean(bv)
 	}
 	return
 }
@@ -302,11 +446,73 @@ func newNumber(v any) (sobj Object, ok bool) {
 	return
 }
 
+func newList(v any) (sobj Object, ok bool) {
+	var elems []Object
+	if elems, ok = v.([]Object); ok {
+		sobj = NewList(elems...)
+	}
+	return
+}
+
+// NewBoolean returns #t or #f.
+func NewBoolean(v bool) *Boolean {
+	if v {
+		return True
+	}
+	return False
+}
+
+// NewString returns a string object holding v as is.  Unlike the
+// factory, it does not process escape sequences.
+func NewString(v string) *String {
+	return &String{value: v}
+}
+
+// NewSymbol returns a symbol which is not interned.  Use SymbolTable
+// to get a unique symbol for a name.
+func NewSymbol(name string) *Symbol {
+	return &Symbol{value: name}
+}
+
+func NewInteger(v int64) *Number {
+	return &Number{tag: INT, value: v}
+}
+
+func NewFloat(v float64) *Number {
+	return &Number{tag: FLOAT, value: v}
+}
+
+func NewComplex(v complex128) *Number {
+	return &Number{tag: COMPLEX, value: v}
+}
+
+func NewPair(car Object, cdr Object) *Pair {
+	return &Pair{car: car, cdr: cdr}
+}
+
+// NewList returns a proper list which consists of elems.
+func NewList(elems ...Object) Object {
+	var list Object = EmptyList
+	for i := len(elems) - 1; i >= 0; i-- {
+		list = NewPair(elems[i], list)
+	}
+	return list
+}
+
+// IsTrue reports whether obj counts as true in a conditional
+// expression.  Only #f is false in Scheme.
+func IsTrue(obj Object) bool {
+	if b, ok := obj.(*Boolean); ok {
+		return b.value
+	}
+	return true
+}
+
 func unescapeGoStr(raw string) (string, bool) {
 	length := len(raw)
 
 	if length < 1 {
-		return "", false
+		return "", true
 	}
 
 	result := make([]byte, 0, length)
@@ -315,16 +521,37 @@ func unescapeGoStr(raw string) (string, bool) {
 	for i := 0; i < length; i++ {
 		ch = raw[i]
 		if ch == 0x5c { // '\'
-			if i < length-1 {
-				switch raw[i+1] {
-				case 0x22: // '"'
-					i++
-				default:
-					// nothing to do
+			if i >= length-1 {
+				return "", false
+			}
+			i++
+			switch raw[i] {
+			case 'a':
+				ch = 0x07
+			case 'b':
+				ch = 0x08
+			case 't':
+				ch = 0x09
+			case 'n':
+				ch = 0x0a
+			case 'r':
+				ch = 0x0d
+			case 'x':
+				// \x<hex digits>; represents a code point
+				end := strings.IndexByte(raw[i:], ';')
+				if end < 0 {
+					return "", false
 				}
+				cp, err := strconv.ParseUint(raw[i+1:i+end], 16, 32)
+				if err != nil {
+					return "", false
+				}
+				result = utf8.AppendRune(result, rune(cp))
+				i += end
+				continue
+			default:
+				// '"', '\\', '|' and others stand for themselves
 				ch = raw[i]
-			} else {
-				return "", false
 			}
 		}
 		result = append(result, ch)
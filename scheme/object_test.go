@@ -89,6 +89,9 @@ func TestStringer(t *testing.T) {
 		{312, obj{NUMBER, 3.14}, "3.14"},
 		{313, obj{NUMBER, -1.41}, "-1.41"},
 		{314, obj{NUMBER, +1.41}, "1.41"},
+		{315, obj{NUMBER, 2.0}, "2.0"},
+		{316, obj{LIST, []Object{}}, "()"},
+		{317, obj{LIST, []Object{True, NewInteger(1)}}, "(#t 1)"},
 		{320, obj{NUMBER, 0 + 0i}, "(0+0i)"},
 		{321, obj{NUMBER, 1 + 0i}, "(1+0i)"},
 		{322, obj{NUMBER, 0.0 + 1i}, "(0+1i)"},
@@ -0,0 +1,365 @@
+// gopische/scheme/port.go
+
+package scheme
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Port object, which reads from an io.Reader or writes to an
+// io.Writer.  A textual port reads and writes characters encoded in
+// UTF-8, and a binary port reads and writes bytes.
+//
+// Reading is buffered, while writing goes to the writer directly.
+// Flush flushes the writer when it has a Flush method, e.g. a
+// bufio.Writer.
+type Port struct {
+	tag     Tag // TEXTUAL_PORT or BINARY_PORT
+	name    string
+	source  io.Reader
+	reader  *bufio.Reader
+	writer  io.Writer
+	buffer  *bytes.Buffer // output of a string or bytevector port
+	onClose func() error
+	closed  bool
+
+	// whether `read` folds the case of symbols, see #!fold-case
+	foldCase bool
+}
+
+// ErrPortClosed is returned when a closed port is read or written.
+var ErrPortClosed = errors.New("port is closed")
+
+// NewInputPort creates an input port reading from r.  The name is
+// used only to print the port.
+func NewInputPort(name string, r io.Reader, binary bool) *Port {
+	return &Port{tag: portTag(binary), name: name, source: r, reader: bufio.NewReader(r)}
+}
+
+// NewOutputPort creates an output port writing to w.
+func NewOutputPort(name string, w io.Writer, binary bool) *Port {
+	return &Port{tag: portTag(binary), name: name, writer: w}
+}
+
+// NewStringInputPort creates a textual port reading a string.
+func NewStringInputPort(s string) *Port {
+	return NewInputPort("string", strings.NewReader(s), false)
+}
+
+// NewBytevectorInputPort creates a binary port reading bytes.
+func NewBytevectorInputPort(b []byte) *Port {
+	return NewInputPort("bytevector", bytes.NewReader(b), true)
+}
+
+// NewStringOutputPort creates a textual port which accumulates the
+// output in memory.  Output returns the output so far.
+func NewStringOutputPort() *Port {
+	buf := new(bytes.Buffer)
+	return &Port{tag: TEXTUAL_PORT, name: "string", writer: buf, buffer: buf}
+}
+
+// NewBytevectorOutputPort creates a binary port which accumulates the
+// output in memory.
+func NewBytevectorOutputPort() *Port {
+	buf := new(bytes.Buffer)
+	return &Port{tag: BINARY_PORT, name: "bytevector", writer: buf, buffer: buf}
+}
+
+func portTag(binary bool) Tag {
+	if binary {
+		return BINARY_PORT
+	}
+	return TEXTUAL_PORT
+}
+
+// OnClose sets a function which is called when the port is closed,
+// e.g. to close the file which the port reads.  Closing a port does
+// not close its reader or writer otherwise.
+func (sobj *Port) OnClose(fn func() error) {
+	sobj.onClose = fn
+}
+
+// FoldCase reports whether data read from the port have the names of
+// symbols folded into lower case, which #!fold-case switches on.
+func (sobj *Port) FoldCase() bool {
+	return sobj.foldCase
+}
+
+func (sobj *Port) SetFoldCase(fold bool) {
+	sobj.foldCase = fold
+}
+
+func (sobj *Port) Tag() Tag {
+	return Tag(PORT)
+}
+
+func (sobj *Port) SubClass() SubClass {
+	return sobj.tag.subClass()
+}
+
+func (sobj *Port) Value() any {
+	return sobj
+}
+
+func (sobj *Port) IsClass(bits Class) bool {
+	return bits == bitsPort()
+}
+
+func (sobj *Port) String() string {
+	kind := "textual"
+	if sobj.IsBinary() {
+		kind = "binary"
+	}
+	if sobj.IsInput() {
+		kind += "-input-port"
+	} else {
+		kind += "-output-port"
+	}
+	if sobj.name == "" {
+		return fmt.Sprintf("#<%s>", kind)
+	}
+	return fmt.Sprintf("#<%s %s>", kind, sobj.name)
+}
+
+func (sobj *Port) Name() string {
+	return sobj.name
+}
+
+func (sobj *Port) IsInput() bool {
+	return sobj.reader != nil
+}
+
+func (sobj *Port) IsOutput() bool {
+	return sobj.writer != nil
+}
+
+func (sobj *Port) IsTextual() bool {
+	return sobj.tag == TEXTUAL_PORT
+}
+
+func (sobj *Port) IsBinary() bool {
+	return sobj.tag == BINARY_PORT
+}
+
+// IsOpen reports whether the port is not closed yet.
+func (sobj *Port) IsOpen() bool {
+	return !sobj.closed
+}
+
+// Reader returns the buffered reader of an input port, so that other
+// readers can share its buffer.
+func (sobj *Port) Reader() *bufio.Reader {
+	return sobj.reader
+}
+
+// Output returns a copy of the output accumulated by a port made by
+// NewStringOutputPort or NewBytevectorOutputPort.  It reports false
+// for other ports.
+func (sobj *Port) Output() ([]byte, bool) {
+	if sobj.buffer == nil {
+		return nil, false
+	}
+	return bytes.Clone(sobj.buffer.Bytes()), true
+}
+
+// Writer returns the writer of an output port.
+func (sobj *Port) Writer() io.Writer {
+	return sobj.writer
+}
+
+func (sobj *Port) readable() error {
+	if sobj.closed {
+		return ErrPortClosed
+	}
+	if !sobj.IsInput() {
+		return errors.New("not an input port")
+	}
+	return nil
+}
+
+func (sobj *Port) writable() error {
+	if sobj.closed {
+		return ErrPortClosed
+	}
+	if !sobj.IsOutput() {
+		return errors.New("not an output port")
+	}
+	return nil
+}
+
+// ReadChar reads a character.  It returns io.EOF at the end of the
+// input.
+func (sobj *Port) ReadChar() (rune, error) {
+	if err := sobj.readable(); err != nil {
+		return 0, err
+	}
+	r, _, err := sobj.reader.ReadRune()
+	return r, err
+}
+
+// PeekChar returns the next character without reading it.
+func (sobj *Port) PeekChar() (rune, error) {
+	r, err := sobj.ReadChar()
+	if err != nil {
+		return 0, err
+	}
+	return r, sobj.reader.UnreadRune()
+}
+
+// ReadLine reads characters up to the end of a line, which is a
+// linefeed, a carriage return followed by a linefeed, or the end of
+// the input.  The line ending is not included.
+func (sobj *Port) ReadLine() (string, error) {
+	if err := sobj.readable(); err != nil {
+		return "", err
+	}
+	line, err := sobj.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// ReadString reads at most k characters.  It returns io.EOF when no
+// character is available before the end of the input.
+func (sobj *Port) ReadString(k int) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < k; i++ {
+		r, err := sobj.ReadChar()
+		if err == io.EOF && i > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), nil
+}
+
+// ReadByte reads a byte.  It returns io.EOF at the end of the input.
+func (sobj *Port) ReadByte() (byte, error) {
+	if err := sobj.readable(); err != nil {
+		return 0, err
+	}
+	return sobj.reader.ReadByte()
+}
+
+// ReadBytes reads at most k bytes.  It returns io.EOF when no byte is
+// available before the end of the input.
+func (sobj *Port) ReadBytes(k int) ([]byte, error) {
+	if err := sobj.readable(); err != nil {
+		return nil, err
+	}
+	b := make([]byte, k)
+	n, err := io.ReadFull(sobj.reader, b)
+	if n > 0 {
+		return b[:n], nil
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return nil, err
+}
+
+// PeekByte returns the next byte without reading it.
+func (sobj *Port) PeekByte() (byte, error) {
+	if err := sobj.readable(); err != nil {
+		return 0, err
+	}
+	b, err := sobj.reader.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// Ready reports whether the next read does not block.  Data already
+// buffered, data in memory and regular files never block.
+func (sobj *Port) Ready() (bool, error) {
+	if err := sobj.readable(); err != nil {
+		return false, err
+	}
+	if sobj.reader.Buffered() > 0 {
+		return true, nil
+	}
+	switch r := sobj.source.(type) {
+	case interface{ Len() int }:
+		return true, nil
+	case *os.File:
+		if fi, err := r.Stat(); err == nil && fi.Mode().IsRegular() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// WriteString writes a string.
+func (sobj *Port) WriteString(s string) error {
+	if err := sobj.writable(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(sobj.writer, s)
+	return err
+}
+
+// WriteChar writes a character.
+func (sobj *Port) WriteChar(r rune) error {
+	return sobj.WriteString(string(r))
+}
+
+// WriteByte writes a byte.
+func (sobj *Port) WriteByte(b byte) error {
+	if err := sobj.writable(); err != nil {
+		return err
+	}
+	_, err := sobj.writer.Write([]byte{b})
+	return err
+}
+
+// WriteBytes writes bytes.
+func (sobj *Port) WriteBytes(b []byte) error {
+	if err := sobj.writable(); err != nil {
+		return err
+	}
+	_, err := sobj.writer.Write(b)
+	return err
+}
+
+// Flush flushes the writer of an output port if it buffers output.
+func (sobj *Port) Flush() error {
+	if err := sobj.writable(); err != nil {
+		return err
+	}
+	if f, ok := sobj.writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close closes the port.  An output port is flushed before closed.
+// Closing a closed port has no effect.
+func (sobj *Port) Close() error {
+	if sobj.closed {
+		return nil
+	}
+	var err error
+	if sobj.IsOutput() {
+		err = sobj.Flush()
+	}
+	sobj.closed = true
+	if sobj.onClose != nil {
+		err = errors.Join(err, sobj.onClose())
+	}
+	return err
+}
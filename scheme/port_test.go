@@ -0,0 +1,126 @@
+// gopische/scheme/port_test.go
+
+package scheme
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseChar(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected rune
+		str      string
+	}{
+		{1, `#\a`, 'a', `#\a`},
+		{2, `#\space`, ' ', `#\space`},
+		{3, `#\ `, ' ', `#\space`},
+		{4, `#\newline`, '\n', `#\newline`},
+		{5, `#\x41`, 'A', `#\A`},
+		{6, `#\x3bb`, 'λ', `#\λ`},
+		{7, `#\λ`, 'λ', `#\λ`},
+		{8, `#\x`, 'x', `#\x`},
+		{9, `#\(`, '(', `#\(`},
+		{10, `#\x7`, '\a', `#\alarm`},
+		{11, `#\x200b`, 0x200b, `#\x200b`},
+	}
+
+	for _, tc := range tests {
+		c, err := ParseChar(tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to parse %s: %s", tc.id, tc.testcase, err)
+		}
+		if c.Rune() != tc.expected {
+			t.Fatalf("tests[%d] - wrong character, expected=%q, got=%q", tc.id, tc.expected, c.Rune())
+		}
+		if c.String() != tc.str {
+			t.Fatalf("tests[%d] - wrong representation, expected=%s, got=%s", tc.id, tc.str, c)
+		}
+	}
+
+	for i, lit := range []string{`#\`, `#\nosuchname`, `#\xd800`, `a`} {
+		if _, err := ParseChar(lit); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", 100+i, lit)
+		}
+	}
+}
+
+func TestPortRead(t *testing.T) {
+	port := NewInputPort("test", strings.NewReader("ab\ncd"), false)
+	if r, _ := port.PeekChar(); r != 'a' {
+		t.Fatalf("wrong peeked character, expected='a', got=%q", r)
+	}
+	if line, _ := port.ReadLine(); line != "ab" {
+		t.Fatalf("wrong line, expected=\"ab\", got=%q", line)
+	}
+	if s, _ := port.ReadString(5); s != "cd" {
+		t.Fatalf("wrong string, expected=\"cd\", got=%q", s)
+	}
+	if _, err := port.ReadChar(); err != io.EOF {
+		t.Fatalf("no EOF at the end, got=%v", err)
+	}
+	if err := port.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := port.ReadChar(); err != ErrPortClosed {
+		t.Fatalf("read a closed port, got=%v", err)
+	}
+}
+
+func TestPortWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	port := NewOutputPort("test", w, true)
+	closed := false
+	port.OnClose(func() error {
+		closed = true
+		return nil
+	})
+
+	if err := port.WriteByte('x'); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("written before flushed: %q", buf.String())
+	}
+	if err := port.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "x" || !closed {
+		t.Fatalf("not flushed or closed, output=%q, closed=%v", buf.String(), closed)
+	}
+	if err := port.WriteByte('y'); err != ErrPortClosed {
+		t.Fatalf("wrote to a closed port, got=%v", err)
+	}
+	if port.String() != "#<binary-output-port test>" {
+		t.Fatalf("wrong representation: %s", port)
+	}
+}
+
+func TestMemoryPort(t *testing.T) {
+	in := NewBytevectorInputPort([]byte{1, 2, 3})
+	if b, _ := in.ReadBytes(2); !bytes.Equal(b, []byte{1, 2}) {
+		t.Fatalf("wrong bytes, expected=[1 2], got=%v", b)
+	}
+	if ready, _ := in.Ready(); !ready {
+		t.Fatalf("a bytevector port is not ready")
+	}
+
+	out := NewStringOutputPort()
+	_ = out.WriteString("ab")
+	_ = out.WriteChar('λ')
+	if b, ok := out.Output(); !ok || string(b) != "abλ" {
+		t.Fatalf("wrong output, expected=\"abλ\", got=%q", b)
+	}
+	if _, ok := in.Output(); ok {
+		t.Fatalf("an input port has output")
+	}
+	if s := NewBytevector([]byte{0, 255}).String(); s != "#u8(0 255)" {
+		t.Fatalf("wrong representation, expected=#u8(0 255), got=%s", s)
+	}
+}
@@ -0,0 +1,130 @@
+// gopische/scheme/pretty.go
+
+package scheme
+
+import (
+	"maps"
+	"strings"
+	"unicode/utf8"
+)
+
+// prettyIndents lists the special forms which the pretty printer
+// indents by two columns.  The number is how many arguments stay on
+// the first line with the keyword, e.g. the variables of `let`.
+var prettyIndents = map[string]int{
+	"begin":              0,
+	"case":               1,
+	"define":             1,
+	"define-library":     1,
+	"define-record-type": 2,
+	"define-syntax":      1,
+	"do":                 2,
+	"guard":              1,
+	"lambda":             1,
+	"let":                1,
+	"let*":               1,
+	"let*-values":        1,
+	"let-values":         1,
+	"letrec":             1,
+	"letrec*":            1,
+	"parameterize":       1,
+	"syntax-rules":       1,
+	"unless":             1,
+	"when":               1,
+}
+
+// BodyIndent returns the number of arguments of a special form which
+// stay on the first line with the keyword, and whether keyword is the
+// one of the special forms whose bodies are indented by two columns.
+func BodyIndent(keyword string) (int, bool) {
+	n, ok := prettyIndents[keyword]
+	return n, ok
+}
+
+// prettyPrinter breaks the lines of a printer.
+type prettyPrinter struct {
+	printer
+	width int
+}
+
+// PrettyPrint returns the representation of obj as Write does, with
+// lines broken to fit in width columns where possible.  A list which
+// does not fit in a line is broken after the keyword of a special
+// form and its first arguments, and the rest is indented by two
+// columns, e.g. the body of `define`.  The arguments of a call are
+// aligned under the first one.
+func PrettyPrint(obj Object, width int) string {
+	p := &prettyPrinter{printer: printer{labels: findLabels(obj, false)}, width: width}
+	p.pretty(obj)
+	return p.sb.String()
+}
+
+func (p *prettyPrinter) pretty(obj Object) {
+	pair, ok := obj.(*Pair)
+	if !ok || p.fits(obj) {
+		p.print(obj)
+		return
+	}
+	if p.label(pair) {
+		return
+	}
+	open := p.column()
+	elems, tail := p.elements(pair)
+
+	// The elements before start are printed in the first line, and
+	// the others are in their own lines indented to indent.
+	indent, start := open+1, 1
+	if sym, ok := elems[0].(*Symbol); ok {
+		if n, special := prettyIndents[sym.value]; special {
+			if sym.value == "let" && len(elems) > 1 {
+				if _, named := elems[1].(*Symbol); named {
+					n++
+				}
+			}
+			indent, start = open+2, 1+n
+		} else if col := open + 2 + utf8.RuneCountInString(quoteSymbol(sym.value)); col <= p.width/2 {
+			indent, start = col, 2
+		}
+	}
+
+	p.sb.WriteString("(")
+	for i, elem := range elems {
+		switch {
+		case i == 0:
+		case i < start:
+			p.sb.WriteString(" ")
+		default:
+			p.newline(indent)
+		}
+		p.pretty(elem)
+	}
+	if tail != EmptyList {
+		p.sb.WriteString(" . ")
+		p.pretty(tail)
+	}
+	p.sb.WriteString(")")
+}
+
+// fits reports whether obj can be printed in the rest of the line.
+func (p *prettyPrinter) fits(obj Object) bool {
+	room := p.width - p.column()
+	if room <= 0 {
+		return false
+	}
+	// A rune takes 4 bytes at most, so the output is longer than room
+	// if it is cut at the limit.
+	m := &printer{labels: maps.Clone(p.labels), next: p.next, limit: 4 * room}
+	m.print(obj)
+	return utf8.RuneCountInString(m.sb.String()) <= room
+}
+
+// column returns the column where the next rune is printed.
+func (p *prettyPrinter) column() int {
+	s := p.sb.String()
+	return utf8.RuneCountInString(s[strings.LastIndexByte(s, '\n')+1:])
+}
+
+func (p *prettyPrinter) newline(indent int) {
+	p.sb.WriteString("\n")
+	p.sb.WriteString(strings.Repeat(" ", indent))
+}
@@ -0,0 +1,45 @@
+// gopische/scheme/pretty_test.go
+
+package scheme
+
+import (
+	"testing"
+)
+
+func TestPrettyPrint(t *testing.T) {
+	sym := NewSymbol
+	fib := NewList(sym("define"), NewList(sym("fib"), sym("n")),
+		NewList(sym("if"), NewList(sym("<"), sym("n"), NewInteger(2)),
+			sym("n"),
+			NewList(sym("+"), NewList(sym("fib"), NewList(sym("-"), sym("n"), NewInteger(1))),
+				NewList(sym("fib"), NewList(sym("-"), sym("n"), NewInteger(2))))))
+	let := NewList(sym("let"), sym("loop"), NewList(NewList(sym("i"), NewInteger(0))),
+		NewList(sym("when"), NewList(sym("<"), sym("i"), NewInteger(10)),
+			NewList(sym("display"), sym("i")),
+			NewList(sym("loop"), NewList(sym("+"), sym("i"), NewInteger(1)))))
+	data := NewList(NewList(NewInteger(1), NewString("one")), NewList(NewInteger(2), NewString("two")))
+	cyclic := NewPair(NewSymbol("element"), EmptyList)
+	cyclic.SetCdr(cyclic)
+
+	tests := []struct {
+		id       int
+		obj      Object
+		width    int
+		expected string
+	}{
+		{1, fib, 80, "(define (fib n) (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2)))))"},
+		{2, fib, 40, "(define (fib n)\n  (if (< n 2)\n      n\n      (+ (fib (- n 1)) (fib (- n 2)))))"},
+		{3, fib, 30, "(define (fib n)\n  (if (< n 2)\n      n\n      (+ (fib (- n 1))\n         (fib (- n 2)))))"},
+		{4, let, 30, "(let loop ((i 0))\n  (when (< i 10)\n    (display i)\n    (loop (+ i 1))))"},
+		{5, data, 10, "((1 \"one\")\n (2 \"two\"))"},
+		{6, NewString("a long string"), 5, `"a long string"`},
+		{7, NewList(cyclic, cyclic), 10, "(#0=(element . #0#)\n #0#)"},
+		{8, NewPair(NewInteger(1), NewInteger(2)), 3, "(1 . 2)"},
+	}
+
+	for _, tc := range tests {
+		if got := PrettyPrint(tc.obj, tc.width); got != tc.expected {
+			t.Fatalf("tests[%d] - wrong output, expected=\n%s\ngot=\n%s", tc.id, tc.expected, got)
+		}
+	}
+}
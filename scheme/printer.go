@@ -0,0 +1,380 @@
+// gopische/scheme/printer.go
+
+package scheme
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// labelMode tells a printer which pairs and vectors get datum labels.
+type labelMode int
+
+const (
+	labelNone   labelMode = iota // no labels, which fails on cycles
+	labelCycles                  // pairs and vectors which are part of cycles
+	labelShared                  // pairs and vectors which appear more than once
+)
+
+// printer produces the external representation of an object.
+type printer struct {
+	sb      strings.Builder
+	display bool // print strings and characters as they are
+
+	// labels holds the pairs and the vectors which need labels.  One
+	// is numbered when it is printed at first, and -1 until then.
+	labels map[Object]int
+	next   int
+
+	// the number of bytes to stop printing after, 0 for no limit
+	limit int
+
+	// open holds the pairs and the vectors being printed when no
+	// labels are used.  Meeting one of them again is a cycle, which
+	// is reported in err.
+	open map[Object]bool
+	err  error
+}
+
+// ErrCycle is returned by WriteSimple for a cyclic object, which has
+// no external representation without datum labels.
+var ErrCycle = errors.New("cannot write a cyclic object without datum labels")
+
+// Write returns the external representation of obj as `write` does.
+// Strings and symbols are escaped so that they can be read back, and
+// cycles are printed with datum labels such as #0=(a . #0#).
+func Write(obj Object) string {
+	return printObject(obj, false, labelCycles)
+}
+
+// WriteShared is like Write, but labels every pair and vector which
+// appears more than once, as `write-shared` does.
+func WriteShared(obj Object) string {
+	return printObject(obj, false, labelShared)
+}
+
+// WriteSimple is like Write, but it uses no datum labels, as
+// `write-simple` does.  It returns ErrCycle for a cyclic object.
+func WriteSimple(obj Object) (string, error) {
+	p := &printer{open: make(map[Object]bool)}
+	p.print(obj)
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.sb.String(), nil
+}
+
+// Display returns the representation of obj as `display` does.
+// Strings and characters are printed as they are, and symbols are
+// not escaped.
+func Display(obj Object) string {
+	return printObject(obj, true, labelCycles)
+}
+
+func printObject(obj Object, display bool, mode labelMode) string {
+	p := &printer{display: display}
+	if mode != labelNone {
+		p.labels = findLabels(obj, mode == labelShared)
+	}
+	p.print(obj)
+	return p.sb.String()
+}
+
+// findLabels returns the pairs and the vectors in obj which need
+// labels.  The cdrs of a list are followed in a loop, so that a long
+// list does not consume the Go stack.
+func findLabels(obj Object, shared bool) map[Object]int {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[Object]int)
+	labels := make(map[Object]int)
+
+	var scan func(obj Object)
+	scan = func(obj Object) {
+		var chain []*Pair
+		for {
+			if e, ok := obj.(*ErrorObject); ok {
+				for _, irritant := range e.irritants {
+					scan(irritant)
+				}
+				break
+			}
+			if v, ok := obj.(*Vector); ok {
+				if s := state[v]; s != 0 {
+					if s == visiting || shared {
+						labels[v] = -1
+					}
+					break
+				}
+				state[v] = visiting
+				for _, elem := range v.value {
+					scan(elem)
+				}
+				state[v] = visited
+				break
+			}
+			pair, ok := obj.(*Pair)
+			if !ok {
+				break
+			}
+			if s := state[pair]; s != 0 {
+				if s == visiting || shared {
+					labels[pair] = -1
+				}
+				break
+			}
+			state[pair] = visiting
+			chain = append(chain, pair)
+			scan(pair.car)
+			obj = pair.cdr
+		}
+		for _, pair := range chain {
+			state[pair] = visited
+		}
+	}
+	scan(obj)
+	return labels
+}
+
+func (p *printer) print(obj Object) {
+	if p.err != nil || p.limit > 0 && p.sb.Len() > p.limit {
+		return
+	}
+	switch v := obj.(type) {
+	case *Pair:
+		p.printPair(v)
+	case *Vector:
+		p.printVector(v)
+	case *String:
+		if p.display {
+			p.sb.WriteString(v.value)
+		} else {
+			p.sb.WriteString(quoteString(v.value))
+		}
+	case *Symbol:
+		if p.display {
+			p.sb.WriteString(v.value)
+		} else {
+			p.sb.WriteString(quoteSymbol(v.value))
+		}
+	case *Char:
+		if p.display {
+			p.sb.WriteRune(v.value)
+		} else {
+			p.sb.WriteString(v.String())
+		}
+	case *ErrorObject:
+		p.printError(v)
+	default:
+		p.sb.WriteString(obj.String())
+	}
+}
+
+// printPair prints a list, which starts with a label if it needs.
+func (p *printer) printPair(pair *Pair) {
+	if p.label(pair) || !p.enter(pair) {
+		return
+	}
+	elems, tail := p.elements(pair)
+	if p.err != nil {
+		return
+	}
+	p.sb.WriteString("(")
+	for i, elem := range elems {
+		if i > 0 {
+			p.sb.WriteString(" ")
+		}
+		p.print(elem)
+	}
+	if tail != EmptyList {
+		p.sb.WriteString(" . ")
+		p.print(tail)
+	}
+	p.sb.WriteString(")")
+	if p.open != nil {
+		for rest := Object(pair); rest != tail; rest = rest.(*Pair).cdr {
+			delete(p.open, rest)
+		}
+	}
+}
+
+// printVector prints a vector, which starts with a label if it needs.
+func (p *printer) printVector(v *Vector) {
+	if p.label(v) || !p.enter(v) {
+		return
+	}
+	defer delete(p.open, v)
+	p.sb.WriteString("#(")
+	for i, elem := range v.value {
+		if i > 0 {
+			p.sb.WriteString(" ")
+		}
+		p.print(elem)
+	}
+	p.sb.WriteString(")")
+}
+
+// printError prints an error object, whose message and irritants are
+// in a string as Error returns.  They are printed with the labels of
+// p, so that an irritant which contains the error object ends.
+func (p *printer) printError(e *ErrorObject) {
+	text := &printer{labels: p.labels, next: p.next, limit: p.limit, open: p.open}
+	text.errorText(e)
+	p.next, p.err = text.next, text.err
+	p.sb.WriteString("#<" + e.tag.String() + " " + quoteString(text.sb.String()) + ">")
+}
+
+// errorText prints the message of an error object followed by the
+// irritants.
+func (p *printer) errorText(e *ErrorObject) {
+	p.sb.WriteString(e.message)
+	for _, irritant := range e.irritants {
+		p.sb.WriteString(" ")
+		p.print(irritant)
+	}
+}
+
+// elements returns the elements of a list and its tail.  A pair with
+// a label ends the elements, so that it is printed after a dot.
+func (p *printer) elements(pair *Pair) ([]Object, Object) {
+	elems := []Object{pair.car}
+	rest := pair.cdr
+	for {
+		next, ok := rest.(*Pair)
+		if !ok {
+			break
+		}
+		if _, labeled := p.labels[next]; labeled {
+			break
+		}
+		if !p.enter(next) {
+			break
+		}
+		elems = append(elems, next.car)
+		rest = next.cdr
+	}
+	return elems, rest
+}
+
+// enter marks a pair or a vector as being printed when no labels are
+// used.  It returns false and sets p.err if obj is already, which
+// means a cycle.
+func (p *printer) enter(obj Object) bool {
+	if p.open == nil {
+		return true
+	}
+	if p.open[obj] {
+		p.err = ErrCycle
+		return false
+	}
+	p.open[obj] = true
+	return true
+}
+
+// label prints the label of a pair or a vector.  It returns true if
+// obj has been printed, and only its reference #n# is printed.
+func (p *printer) label(obj Object) bool {
+	n, ok := p.labels[obj]
+	if !ok {
+		return false
+	}
+	if n >= 0 {
+		fmt.Fprintf(&p.sb, "#%d#", n)
+		return true
+	}
+	n, p.next = p.next, p.next+1
+	p.labels[obj] = n
+	fmt.Fprintf(&p.sb, "#%d=", n)
+	return false
+}
+
+// quoteString returns a string literal which reads back as s.
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		default:
+			writeEscaped(&sb, r)
+		}
+	}
+	sb.WriteString(`"`)
+	return sb.String()
+}
+
+// quoteSymbol returns the name of a symbol, which is enclosed by
+// vertical bars if it does not read back as the symbol otherwise.
+func quoteSymbol(name string) string {
+	if !needsBars(name) {
+		return name
+	}
+	var sb strings.Builder
+	sb.WriteString("|")
+	for _, r := range name {
+		switch r {
+		case '|':
+			sb.WriteString(`\|`)
+		case '\\':
+			sb.WriteString(`\\`)
+		default:
+			writeEscaped(&sb, r)
+		}
+	}
+	sb.WriteString("|")
+	return sb.String()
+}
+
+// writeEscaped writes a rune in a string or a symbol enclosed by
+// vertical bars, escaping control characters.
+func writeEscaped(sb *strings.Builder, r rune) {
+	switch r {
+	case '\n':
+		sb.WriteString(`\n`)
+	case '\t':
+		sb.WriteString(`\t`)
+	case '\r':
+		sb.WriteString(`\r`)
+	case '\a':
+		sb.WriteString(`\a`)
+	case '\b':
+		sb.WriteString(`\b`)
+	default:
+		if unicode.IsGraphic(r) {
+			sb.WriteRune(r)
+		} else {
+			fmt.Fprintf(sb, `\x%x;`, r)
+		}
+	}
+}
+
+// needsBars reports whether the name of a symbol is read as something
+// else, or is not read as a single symbol, without vertical bars.
+func needsBars(name string) bool {
+	runes := []rune(name)
+	if len(runes) == 0 || name == "." || runes[0] == '#' {
+		return true
+	}
+	for _, r := range runes {
+		if !unicode.IsGraphic(r) || unicode.IsSpace(r) || strings.ContainsRune("()\";'`,|\\", r) {
+			return true
+		}
+	}
+	isDigit := func(i int) bool {
+		return i < len(runes) && '0' <= runes[i] && runes[i] <= '9'
+	}
+	switch runes[0] {
+	case '+', '-':
+		return isDigit(1) || (len(runes) > 1 && runes[1] == '.')
+	case '.':
+		return isDigit(1)
+	}
+	return isDigit(0)
+}
@@ -0,0 +1,71 @@
+// gopische/scheme/printer_test.go
+
+package scheme
+
+import (
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	shared := NewList(NewInteger(1), NewInteger(2))
+	cyclic := NewPair(NewSymbol("a"), EmptyList)
+	cyclic.SetCdr(cyclic)
+	selfCar := NewPair(EmptyList, EmptyList)
+	selfCar.SetCar(selfCar)
+	irritant := NewPair(NewInteger(1), EmptyList)
+	errorCycle := NewErrorObject("m", irritant)
+	irritant.SetCar(errorCycle)
+	selfVector := NewVector([]Object{NewSymbol("a"), EmptyList})
+	selfVector.Elements()[1] = selfVector
+	sharedVector := NewVector([]Object{NewString("v")})
+
+	tests := []struct {
+		id      int
+		obj     Object
+		write   string
+		display string
+		shared  string
+	}{
+		{1, NewString("a\"b\\c\n"), `"a\"b\\c\n"`, "a\"b\\c\n", `"a\"b\\c\n"`},
+		{2, NewString("\x01"), `"\x1;"`, "\x01", `"\x1;"`},
+		{3, NewSymbol("abc"), "abc", "abc", "abc"},
+		{4, NewSymbol("a b"), "|a b|", "a b", "|a b|"},
+		{5, NewSymbol(""), "||", "", "||"},
+		{6, NewSymbol("1+"), "|1+|", "1+", "|1+|"},
+		{7, NewSymbol("x|y"), `|x\|y|`, "x|y", `|x\|y|`},
+		{8, NewSymbol("+"), "+", "+", "+"},
+		{9, NewSymbol("-1"), "|-1|", "-1", "|-1|"},
+		{10, NewChar('a'), `#\a`, "a", `#\a`},
+		{11, NewList(NewString("s"), NewChar(' ')), `("s" #\space)`, "(s  )", `("s" #\space)`},
+		{12, NewList(shared, shared), "((1 2) (1 2))", "((1 2) (1 2))", "(#0=(1 2) #0#)"},
+		{13, cyclic, "#0=(a . #0#)", "#0=(a . #0#)", "#0=(a . #0#)"},
+		{14, selfCar, "#0=(#0#)", "#0=(#0#)", "#0=(#0#)"},
+		{15, NewPair(NewInteger(0), shared), "(0 1 2)", "(0 1 2)", "(0 1 2)"},
+		{16, NewList(cyclic, cyclic), "(#0=(a . #0#) #0#)", "(#0=(a . #0#) #0#)", "(#0=(a . #0#) #0#)"},
+		{17, errorCycle, `#<error "m #0=(#<error \"m #0#\">)">`, `#<error "m #0=(#<error \"m #0#\">)">`, `#<error "m #0=(#<error \"m #0#\">)">`},
+		{18, selfVector, "#0=#(a #0#)", "#0=#(a #0#)", "#0=#(a #0#)"},
+		{19, NewList(sharedVector, sharedVector), `(#("v") #("v"))`, "(#(v) #(v))", `(#0=#("v") #0#)`},
+		{20, NewVector([]Object{}), "#()", "#()", "#()"},
+	}
+
+	for _, tc := range tests {
+		if got := Write(tc.obj); got != tc.write {
+			t.Fatalf("tests[%d] - wrong write, expected=%s, got=%s", tc.id, tc.write, got)
+		}
+		if got := Display(tc.obj); got != tc.display {
+			t.Fatalf("tests[%d] - wrong display, expected=%q, got=%q", tc.id, tc.display, got)
+		}
+		if got := WriteShared(tc.obj); got != tc.shared {
+			t.Fatalf("tests[%d] - wrong write-shared, expected=%s, got=%s", tc.id, tc.shared, got)
+		}
+	}
+
+	if got, err := WriteSimple(NewList(shared, shared)); err != nil || got != "((1 2) (1 2))" {
+		t.Fatalf("wrong write-simple, expected=((1 2) (1 2)), got=%s, %v", got, err)
+	}
+	for i, obj := range []Object{cyclic, selfCar, errorCycle, selfVector, NewList(NewInteger(0), cyclic)} {
+		if _, err := WriteSimple(obj); err != ErrCycle {
+			t.Fatalf("cyclic[%d] - wrong write-simple error, expected=%v, got=%v", i, ErrCycle, err)
+		}
+	}
+}
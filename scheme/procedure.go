@@ -0,0 +1,121 @@
+// gopische/scheme/procedure.go
+
+package scheme
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Arity describes the numbers of arguments which a procedure
+// accepts.
+type Arity struct {
+	Required int
+	Optional int
+	Rest     bool
+}
+
+// Accepts reports whether a procedure of the arity can be called with
+// n arguments.
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Required && (a.Rest || n <= a.Required+a.Optional)
+}
+
+// Location is a position in a source file.
+type Location struct {
+	File string
+	Line int
+}
+
+func (loc *Location) String() string {
+	return fmt.Sprintf("%s:%d", loc.File, loc.Line)
+}
+
+// Procedure object, which is either a primitive implemented in Go or
+// a closure created by a lambda expression.  The body of a procedure
+// is opaque to this package; it is created and applied by an
+// evaluator.
+type Procedure struct {
+	tag   Tag
+	name  string
+	arity Arity
+	loc   *Location
+	impl  any
+}
+
+// NewPrimitive creates a procedure implemented in Go.
+func NewPrimitive(name string, arity Arity, impl any) *Procedure {
+	return &Procedure{tag: PRIMITIVE, name: name, arity: arity, impl: impl}
+}
+
+// NewClosure creates an anonymous procedure from a lambda expression.
+// The location is nil when it is unknown.
+func NewClosure(arity Arity, loc *Location, impl any) *Procedure {
+	return &Procedure{tag: CLOSURE, arity: arity, loc: loc, impl: impl}
+}
+
+func (sobj *Procedure) Tag() Tag {
+	return Tag(PROCEDURE)
+}
+
+func (sobj *Procedure) SubClass() SubClass {
+	return sobj.tag.subClass()
+}
+
+func (sobj *Procedure) Value() any {
+	return sobj.impl
+}
+
+func (sobj *Procedure) IsClass(bits Class) bool {
+	return bits == bitsProcedure()
+}
+
+func (sobj *Procedure) String() string {
+	var sb strings.Builder
+	sb.WriteString("#<procedure")
+	if sobj.name != "" {
+		sb.WriteString(" ")
+		sb.WriteString(sobj.name)
+	}
+	if sobj.loc != nil {
+		sb.WriteString(" ")
+		sb.WriteString(sobj.loc.String())
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// Name returns the name of the procedure.  An anonymous procedure
+// has the empty name.
+func (sobj *Procedure) Name() string {
+	return sobj.name
+}
+
+// SetName gives a name to an anonymous procedure.  It is used when
+// a lambda expression is bound by `define`.
+func (sobj *Procedure) SetName(name string) {
+	if sobj.name == "" {
+		sobj.name = name
+	}
+}
+
+// IsPrimitive reports whether the procedure is implemented in Go.
+func (sobj *Procedure) IsPrimitive() bool {
+	return sobj.tag == PRIMITIVE
+}
+
+// Arity returns the numbers of arguments the procedure accepts.
+func (sobj *Procedure) Arity() Arity {
+	return sobj.arity
+}
+
+// Location returns where the procedure is defined, or nil when it is
+// unknown, e.g. for primitives.
+func (sobj *Procedure) Location() *Location {
+	return sobj.loc
+}
+
+// Impl returns the body of the procedure given to the constructor.
+func (sobj *Procedure) Impl() any {
+	return sobj.impl
+}
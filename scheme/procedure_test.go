@@ -0,0 +1,59 @@
+// gopische/scheme/procedure_test.go
+
+package scheme
+
+import (
+	"testing"
+)
+
+func TestProcedureString(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase *Procedure
+		expected string
+	}{
+		{1, NewPrimitive("car", Arity{Required: 1}, nil), "#<procedure car>"},
+		{2, NewClosure(Arity{}, nil, nil), "#<procedure>"},
+		{3, NewClosure(Arity{}, &Location{File: "a.scm", Line: 3}, nil), "#<procedure a.scm:3>"},
+	}
+
+	for _, tc := range tests {
+		str := tc.testcase.String()
+		if str != tc.expected {
+			t.Fatalf("tests[%d] - wrong string, expected=%q, got=%q", tc.id, tc.expected, str)
+		}
+	}
+
+	proc := NewClosure(Arity{}, &Location{File: "a.scm", Line: 3}, nil)
+	proc.SetName("f")
+	proc.SetName("g")
+	if proc.String() != "#<procedure f a.scm:3>" {
+		t.Fatalf("wrong string of a named closure: %s", proc)
+	}
+	if proc.SubClass() != SubClass(CLOSURE&subClassMask) || proc.IsPrimitive() {
+		t.Fatalf("wrong subclass of a closure: %d", proc.SubClass())
+	}
+}
+
+func TestArityAccepts(t *testing.T) {
+	tests := []struct {
+		id       int
+		arity    Arity
+		n        int
+		expected bool
+	}{
+		{1, Arity{Required: 1}, 1, true},
+		{2, Arity{Required: 1}, 0, false},
+		{3, Arity{Required: 1}, 2, false},
+		{4, Arity{Required: 1, Optional: 1}, 2, true},
+		{5, Arity{Required: 1, Optional: 1}, 3, false},
+		{6, Arity{Required: 1, Rest: true}, 10, true},
+		{7, Arity{Required: 1, Rest: true}, 0, false},
+	}
+
+	for _, tc := range tests {
+		if tc.arity.Accepts(tc.n) != tc.expected {
+			t.Fatalf("tests[%d] - wrong result of Accepts(%d), expected=%t", tc.id, tc.n, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// gopische/scheme/rational.go
+
+package scheme
+
+import (
+	"math/big"
+	"strings"
+)
+
+// NewExact returns an exact number of r, which is an integer if r is
+// integral.  It reports false if r is an integer which does not fit in
+// 64 bits.  r must not be modified after that.
+func NewExact(r *big.Rat) (*Number, bool) {
+	if !r.IsInt() {
+		return &Number{tag: RATIONAL, value: r}, true
+	}
+	if !r.Num().IsInt64() {
+		return nil, false
+	}
+	return NewInteger(r.Num().Int64()), true
+}
+
+// ParseRational parses a ratio n/d of integers in radix, e.g. "-1/3".
+// The denominator has no sign, and must not be zero.
+func ParseRational(s string, radix int) (*big.Rat, bool) {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok || den == "" || strings.ContainsAny(den, "+-") {
+		return nil, false
+	}
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(num, "+"), radix)
+	if !ok || strings.HasPrefix(num, "+-") {
+		return nil, false
+	}
+	d, ok := new(big.Int).SetString(den, radix)
+	if !ok || d.Sign() == 0 {
+		return nil, false
+	}
+	return new(big.Rat).SetFrac(n, d), true
+}
@@ -0,0 +1,320 @@
+// gopische/scheme/record.go
+
+package scheme
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// RecordType object, which is created by `define-record-type`.  A
+// record type may be backed by a Go struct type.  Then its instances
+// wrap pointers to values of the struct, and its fields are the
+// exported fields of the struct.
+type RecordType struct {
+	name   string
+	fields []string
+	goType reflect.Type // nil for a record type defined in Scheme
+	goPath [][]int      // indices of the struct fields for reflect
+}
+
+// NewRecordType creates a record type with the names of fields.
+func NewRecordType(name string, fields []string) *RecordType {
+	return &RecordType{name: name, fields: fields}
+}
+
+// NewGoRecordType creates a record type backed by a Go struct type.
+// goType must be a struct type or a pointer to it.  The name of a
+// field is given by the `scheme` tag of the struct field, or made
+// from the Go name, e.g. "first-name" for FirstName.  A field tagged
+// with `scheme:"-"` is hidden.
+func NewGoRecordType(name string, goType reflect.Type) (*RecordType, error) {
+	if goType != nil && goType.Kind() == reflect.Pointer {
+		goType = goType.Elem()
+	}
+	if goType == nil || goType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("not a struct type: %s", goType)
+	}
+	rt := &RecordType{name: name, goType: goType}
+	for _, f := range reflect.VisibleFields(goType) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("scheme")
+		if tag == "-" {
+			continue
+		}
+		if !convertible(f.Type) {
+			return nil, fmt.Errorf("unsupported type of field %s: %s", f.Name, f.Type)
+		}
+		if tag == "" {
+			tag = fieldName(f.Name)
+		}
+		rt.fields = append(rt.fields, tag)
+		rt.goPath = append(rt.goPath, f.Index)
+	}
+	return rt, nil
+}
+
+// fieldName converts a Go name into a Scheme one, e.g. FirstName into
+// first-name.
+func fieldName(name string) string {
+	var sb strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				sb.WriteRune('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func (sobj *RecordType) Tag() Tag {
+	return Tag(RECORD)
+}
+
+func (sobj *RecordType) SubClass() SubClass {
+	return SubClass(RECORD_TYPE & subClassMask)
+}
+
+func (sobj *RecordType) Value() any {
+	return sobj.name
+}
+
+func (sobj *RecordType) IsClass(bits Class) bool {
+	return bits == bitsRecord()
+}
+
+func (sobj *RecordType) String() string {
+	return fmt.Sprintf("#<record-type %s>", sobj.name)
+}
+
+// Name returns the name of the record type.
+func (sobj *RecordType) Name() string {
+	return sobj.name
+}
+
+// Fields returns the names of the fields.
+func (sobj *RecordType) Fields() []string {
+	return sobj.fields
+}
+
+// FieldIndex returns the index of a field, or -1 when the record type
+// has no such field.
+func (sobj *RecordType) FieldIndex(name string) int {
+	for i, field := range sobj.fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// GoType returns the Go struct type which backs the record type, or
+// nil.
+func (sobj *RecordType) GoType() reflect.Type {
+	return sobj.goType
+}
+
+// Record object, which is an instance of a record type.
+type Record struct {
+	rtype   *RecordType
+	fields  []Object
+	goValue reflect.Value // a pointer to a struct for a Go record type
+}
+
+// NewRecord creates an instance of a record type.  Its fields are
+// unspecified, or zero values of the struct for a Go record type.
+func NewRecord(rtype *RecordType) *Record {
+	if rtype.goType == nil {
+		fields := make([]Object, len(rtype.fields))
+		for i := range fields {
+			fields[i] = Unspecified
+		}
+		return &Record{rtype: rtype, fields: fields}
+	}
+	return &Record{rtype: rtype, goValue: reflect.New(rtype.goType)}
+}
+
+// NewGoRecord wraps a pointer to a Go struct as an instance of a Go
+// record type.  The record shares the struct with the caller.
+func NewGoRecord(rtype *RecordType, ptr any) (*Record, error) {
+	v := reflect.ValueOf(ptr)
+	if rtype.goType == nil || !v.IsValid() || v.Type() != reflect.PointerTo(rtype.goType) || v.IsNil() {
+		return nil, fmt.Errorf("%s: not a pointer to %v", rtype.name, rtype.goType)
+	}
+	return &Record{rtype: rtype, goValue: v}, nil
+}
+
+func (sobj *Record) Tag() Tag {
+	return Tag(RECORD)
+}
+
+func (sobj *Record) SubClass() SubClass {
+	return SubClass(RECORD_INSTANCE & subClassMask)
+}
+
+func (sobj *Record) Value() any {
+	if sobj.rtype.goType == nil {
+		return sobj.fields
+	}
+	return sobj.GoValue()
+}
+
+func (sobj *Record) IsClass(bits Class) bool {
+	return bits == bitsRecord()
+}
+
+func (sobj *Record) String() string {
+	var sb strings.Builder
+	sb.WriteString("#<")
+	sb.WriteString(sobj.rtype.name)
+	for i, name := range sobj.rtype.fields {
+		value, err := sobj.Field(i)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&sb, " %s: %s", name, value)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// Type returns the record type of the record.
+func (sobj *Record) Type() *RecordType {
+	return sobj.rtype
+}
+
+// GoValue returns the pointer to the Go struct wrapped by the record,
+// or nil for a record defined in Scheme.
+func (sobj *Record) GoValue() any {
+	if !sobj.goValue.IsValid() {
+		return nil
+	}
+	return sobj.goValue.Interface()
+}
+
+// Field returns the value of the i-th field.
+func (sobj *Record) Field(i int) (Object, error) {
+	if sobj.rtype.goType == nil {
+		return sobj.fields[i], nil
+	}
+	return fromGo(sobj.goValue.Elem().FieldByIndex(sobj.rtype.goPath[i]))
+}
+
+// SetField modifies the value of the i-th field.  For a Go record,
+// it fails when the value cannot be converted to the type of the
+// struct field.
+func (sobj *Record) SetField(i int, value Object) error {
+	if sobj.rtype.goType == nil {
+		sobj.fields[i] = value
+		return nil
+	}
+	field := sobj.goValue.Elem().FieldByIndex(sobj.rtype.goPath[i])
+	v, err := toGo(value, field.Type())
+	if err != nil {
+		return fmt.Errorf("%s: field %s: %w", sobj.rtype.name, sobj.rtype.fields[i], err)
+	}
+	field.Set(v)
+	return nil
+}
+
+var objectType = reflect.TypeOf((*Object)(nil)).Elem()
+
+// convertible reports whether values of a Go type can be converted
+// from and to Scheme objects.
+func convertible(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Interface:
+		return objectType.Implements(t)
+	}
+	return t.Implements(objectType)
+}
+
+var errConversion = errors.New("cannot convert")
+
+func fromGo(v reflect.Value) (Object, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return NewBoolean(v.Bool()), nil
+	case reflect.String:
+		return NewString(v.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return NewInteger(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return NewFloat(v.Float()), nil
+	}
+	if (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) && v.IsNil() {
+		return Unspecified, nil
+	}
+	if obj, ok := v.Interface().(Object); ok {
+		return obj, nil
+	}
+	return nil, fmt.Errorf("%w %s to Scheme", errConversion, v.Type())
+}
+
+func toGo(obj Object, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, ok := obj.(*Boolean); ok {
+			v.SetBool(b.value)
+			return v, nil
+		}
+	case reflect.String:
+		if s, ok := obj.(*String); ok {
+			v.SetString(s.value)
+			return v, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := obj.(*Number); ok {
+			if iv, ok := n.value.(int64); ok && !v.OverflowInt(iv) {
+				v.SetInt(iv)
+				return v, nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		if n, ok := obj.(*Number); ok {
+			if iv, ok := n.value.(int64); ok && iv >= 0 && !v.OverflowUint(uint64(iv)) {
+				v.SetUint(uint64(iv))
+				return v, nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := obj.(*Number); ok {
+			switch nv := n.value.(type) {
+			case int64:
+				v.SetFloat(float64(nv))
+				return v, nil
+			case float64:
+				v.SetFloat(nv)
+				return v, nil
+			case *big.Rat:
+				f, _ := nv.Float64()
+				v.SetFloat(f)
+				return v, nil
+			}
+		}
+	default:
+		if reflect.TypeOf(obj).AssignableTo(t) {
+			v.Set(reflect.ValueOf(obj))
+			return v, nil
+		}
+	}
+	return v, fmt.Errorf("%w %s to %s", errConversion, obj, t)
+}
@@ -0,0 +1,92 @@
+// gopische/scheme/record_test.go
+
+package scheme
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordString(t *testing.T) {
+	rt := NewRecordType("point", []string{"x", "y"})
+	rec := NewRecord(rt)
+	if err := rec.SetField(0, NewInteger(1)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.String() != "#<point x: 1 y: #<unspecified>>" {
+		t.Fatalf("wrong string: %s", rec)
+	}
+	if rt.String() != "#<record-type point>" {
+		t.Fatalf("wrong string: %s", rt)
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "X", "x"},
+		{2, "FirstName", "first-name"},
+		{3, "ID", "id"},
+		{4, "HTTPServer", "http-server"},
+		{5, "UserID", "user-id"},
+	}
+
+	for _, tc := range tests {
+		if name := fieldName(tc.testcase); name != tc.expected {
+			t.Fatalf("tests[%d] - wrong name, expected=%s, got=%s", tc.id, tc.expected, name)
+		}
+	}
+}
+
+func TestGoRecord(t *testing.T) {
+	type user struct {
+		Name   string
+		Age    int32
+		Score  float64
+		Admin  bool
+		Extra  Object
+		Secret string `scheme:"-"`
+		Nick   string `scheme:"nickname"`
+		hidden int
+	}
+
+	rt, err := NewGoRecordType("user", reflect.TypeOf(&user{}))
+	if err != nil {
+		t.Fatalf("fail to create a record type: %s", err)
+	}
+	expected := []string{"name", "age", "score", "admin", "extra", "nickname"}
+	if !reflect.DeepEqual(rt.Fields(), expected) {
+		t.Fatalf("wrong fields, expected=%v, got=%v", expected, rt.Fields())
+	}
+
+	u := &user{Name: "alice", Age: 20}
+	rec, err := NewGoRecord(rt, u)
+	if err != nil {
+		t.Fatalf("fail to wrap a value: %s", err)
+	}
+	if err := rec.SetField(2, NewInteger(3)); err != nil {
+		t.Fatalf("fail to set a field: %s", err)
+	}
+	if u.Score != 3.0 {
+		t.Fatalf("the record must share the struct")
+	}
+	if err := rec.SetField(1, NewInteger(1<<40)); err == nil {
+		t.Fatalf("no error for an overflow")
+	}
+	if err := rec.SetField(0, NewInteger(1)); err == nil {
+		t.Fatalf("no error for a wrong type")
+	}
+	if rec.String() != `#<user name: "alice" age: 20 score: 3.0 admin: #f extra: #<unspecified> nickname: "">` {
+		t.Fatalf("wrong string: %s", rec)
+	}
+
+	if _, err := NewGoRecord(rt, user{}); err == nil {
+		t.Fatalf("no error for a non-pointer")
+	}
+	if _, err := NewGoRecordType("chan", reflect.TypeOf(struct{ C chan int }{})); err == nil {
+		t.Fatalf("no error for an unsupported field")
+	}
+}
@@ -0,0 +1,165 @@
+// gopische/scheme/regexp.go
+
+package scheme
+
+import (
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Regexp object, which is a compiled regular expression of the RE2
+// syntax of Go's regexp package.
+type Regexp struct {
+	re   *regexp.Regexp
+	full *regexp.Regexp // re anchored at both ends
+}
+
+// NewRegexp compiles a pattern into a regexp object.
+func NewRegexp(pattern string) (*Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	full, err := regexp.Compile(`\A(?:` + pattern + `)\z`)
+	if err != nil {
+		return nil, err
+	}
+	return &Regexp{re: re, full: full}, nil
+}
+
+func (sobj *Regexp) Tag() Tag {
+	return Tag(REGEXP)
+}
+
+func (sobj *Regexp) SubClass() SubClass {
+	return SubClass(REGEXP_PATTERN & subClassMask)
+}
+
+func (sobj *Regexp) Value() any {
+	return sobj.re
+}
+
+func (sobj *Regexp) IsClass(bits Class) bool {
+	return bits == bitsRegexp()
+}
+
+func (sobj *Regexp) String() string {
+	return "#<regexp " + strconv.Quote(sobj.re.String()) + ">"
+}
+
+// Regexp returns the compiled regular expression.
+func (sobj *Regexp) Regexp() *regexp.Regexp {
+	return sobj.re
+}
+
+// Search returns the leftmost match in s[from:to], or nil.  from and
+// to are byte offsets.
+func (sobj *Regexp) Search(s string, from int, to int) *RegexpMatch {
+	return newRegexpMatch(sobj, sobj.re, s, from, to)
+}
+
+// Match returns the match of the whole s[from:to], or nil.  from and
+// to are byte offsets.
+func (sobj *Regexp) Match(s string, from int, to int) *RegexpMatch {
+	return newRegexpMatch(sobj, sobj.full, s, from, to)
+}
+
+// SearchAll returns the successive non-overlapping matches in
+// s[from:to].  from and to are byte offsets.
+func (sobj *Regexp) SearchAll(s string, from int, to int) []*RegexpMatch {
+	var matches []*RegexpMatch
+	for _, index := range sobj.re.FindAllStringSubmatchIndex(s[from:to], -1) {
+		matches = append(matches, makeRegexpMatch(sobj, s, from, index))
+	}
+	return matches
+}
+
+// RegexpMatch object, which holds the submatches of a match of a
+// regexp.  The whole match is the submatch 0.
+type RegexpMatch struct {
+	regexp *Regexp
+	s      string
+	index  []int // byte offsets of the submatches in s, -1 if unmatched
+}
+
+func newRegexpMatch(r *Regexp, re *regexp.Regexp, s string, from int, to int) *RegexpMatch {
+	index := re.FindStringSubmatchIndex(s[from:to])
+	if index == nil {
+		return nil
+	}
+	return makeRegexpMatch(r, s, from, index)
+}
+
+// makeRegexpMatch makes a match from the offsets in s[from:].
+func makeRegexpMatch(r *Regexp, s string, from int, index []int) *RegexpMatch {
+	for i := range index {
+		if index[i] >= 0 {
+			index[i] += from
+		}
+	}
+	return &RegexpMatch{regexp: r, s: s, index: index}
+}
+
+func (sobj *RegexpMatch) Tag() Tag {
+	return Tag(REGEXP)
+}
+
+func (sobj *RegexpMatch) SubClass() SubClass {
+	return SubClass(REGEXP_MATCH & subClassMask)
+}
+
+func (sobj *RegexpMatch) Value() any {
+	return sobj
+}
+
+func (sobj *RegexpMatch) IsClass(bits Class) bool {
+	return bits == bitsRegexp()
+}
+
+func (sobj *RegexpMatch) String() string {
+	s, _ := sobj.Submatch(0)
+	return "#<regexp-match " + strconv.Quote(s) + ">"
+}
+
+// Regexp returns the regexp which made the match.
+func (sobj *RegexpMatch) Regexp() *Regexp {
+	return sobj.regexp
+}
+
+// Len returns the number of the submatches, including the whole
+// match.
+func (sobj *RegexpMatch) Len() int {
+	return len(sobj.index) / 2
+}
+
+// Submatch returns the i-th submatch, and whether it matched.
+func (sobj *RegexpMatch) Submatch(i int) (string, bool) {
+	start, end := sobj.index[2*i], sobj.index[2*i+1]
+	if start < 0 {
+		return "", false
+	}
+	return sobj.s[start:end], true
+}
+
+// Span returns the start and the end of the i-th submatch counted in
+// characters, and whether it matched.
+func (sobj *RegexpMatch) Span(i int) (int, int, bool) {
+	start, end := sobj.index[2*i], sobj.index[2*i+1]
+	if start < 0 {
+		return 0, 0, false
+	}
+	cs := utf8.RuneCountInString(sobj.s[:start])
+	return cs, cs + utf8.RuneCountInString(sobj.s[start:end]), true
+}
+
+// Offsets returns the byte offsets of the whole match.
+func (sobj *RegexpMatch) Offsets() (int, int) {
+	return sobj.index[0], sobj.index[1]
+}
+
+// Expand returns a template with $1, ${name} and so on replaced by
+// the submatches, as regexp.Regexp.ExpandString does.
+func (sobj *RegexpMatch) Expand(template string) string {
+	return string(sobj.regexp.re.ExpandString(nil, template, sobj.s, sobj.index))
+}
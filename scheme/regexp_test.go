@@ -0,0 +1,64 @@
+// gopische/scheme/regexp_test.go
+
+package scheme
+
+import (
+	"testing"
+)
+
+func TestRegexp(t *testing.T) {
+	tests := []struct {
+		id       int
+		pattern  string
+		s        string
+		full     bool
+		expected []string // submatches, "-" if unmatched
+		span     [2]int   // of the whole match in characters
+	}{
+		{1, `b+`, "abbc", false, []string{"bb"}, [2]int{1, 3}},
+		{2, `(\d+)-(x)?`, "日本 12-", false, []string{"12-", "12", "-"}, [2]int{3, 6}},
+		{3, `a|ab`, "ab", true, []string{"ab"}, [2]int{0, 2}},
+		{4, `(?i)ABC`, "abc", true, []string{"abc"}, [2]int{0, 3}},
+	}
+
+	for _, tc := range tests {
+		re, err := NewRegexp(tc.pattern)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to compile: %s", tc.id, err)
+		}
+		var m *RegexpMatch
+		if tc.full {
+			m = re.Match(tc.s, 0, len(tc.s))
+		} else {
+			m = re.Search(tc.s, 0, len(tc.s))
+		}
+		if m == nil {
+			t.Fatalf("tests[%d] - no match", tc.id)
+		}
+		if m.Len() != len(tc.expected) {
+			t.Fatalf("tests[%d] - wrong number of submatches, expected=%d, got=%d", tc.id, len(tc.expected), m.Len())
+		}
+		for i, expected := range tc.expected {
+			s, ok := m.Submatch(i)
+			if !ok {
+				s = "-"
+			}
+			if s != expected {
+				t.Fatalf("tests[%d] - wrong submatch %d, expected=%q, got=%q", tc.id, i, expected, s)
+			}
+		}
+		if start, end, _ := m.Span(0); start != tc.span[0] || end != tc.span[1] {
+			t.Fatalf("tests[%d] - wrong span, expected=%v, got=[%d %d]", tc.id, tc.span, start, end)
+		}
+	}
+}
+
+func TestRegexpError(t *testing.T) {
+	if _, err := NewRegexp(`(a`); err == nil {
+		t.Fatalf("no error for a bad pattern")
+	}
+	re, _ := NewRegexp(`a`)
+	if m := re.Match("ab", 0, 2); m != nil {
+		t.Fatalf("matched a part of a string")
+	}
+}
@@ -0,0 +1,47 @@
+// gopische/scheme/symtab.go
+
+package scheme
+
+import (
+	"sync"
+)
+
+// SymbolTable interns symbols, so that the same name always yields
+// the same symbol object.  It is safe for concurrent use.
+type SymbolTable struct {
+	mu      sync.Mutex
+	symbols map[string]*Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{symbols: make(map[string]*Symbol)}
+}
+
+// Intern returns the unique symbol for name.
+func (st *SymbolTable) Intern(name string) *Symbol {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if sym, ok := st.symbols[name]; ok {
+		return sym
+	}
+	sym := NewSymbol(name)
+	st.symbols[name] = sym
+	return sym
+}
+
+// Len returns the number of interned symbols.
+func (st *SymbolTable) Len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.symbols)
+}
+
+// Lookup returns the symbol interned for name, if any.
+func (st *SymbolTable) Lookup(name string) (*Symbol, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sym, ok := st.symbols[name]
+	return sym, ok
+}
@@ -25,19 +25,54 @@ const (
 	STRING    = 0x0020 // 0b 0000 0000 0010 0000
 	SYMBOL    = 0x0030 // 0b 0000 0000 0011 0000
 	CHARACTER = 0x0040 // 0b 0000 0000 0100 0000
-	// gap(0x50 - 0x6f) - reserved for the future
-	NUMBER = 0x0070 // 0b 0000 0000 0111 0000
-	// 0b 1000 0000 - not used
-	LIST = 0x0090 // 0b 0000 0000 1001 0000
+	SPECIAL   = 0x0050 // 0b 0000 0000 0101 0000
+	CONDITION = 0x0060 // 0b 0000 0000 0110 0000
+	NUMBER    = 0x0070 // 0b 0000 0000 0111 0000
+	// compound data object
+	REGEXP      = 0x0080 // 0b 0000 0000 1000 0000
+	LIST        = 0x0090 // 0b 0000 0000 1001 0000
+	PROCEDURE   = 0x00a0 // 0b 0000 0000 1010 0000
+	RECORD      = 0x00b0 // 0b 0000 0000 1011 0000
+	PORT        = 0x00c0 // 0b 0000 0000 1100 0000
+	BYTEVECTOR  = 0x00d0 // 0b 0000 0000 1101 0000
+	ENVIRONMENT = 0x00e0 // 0b 0000 0000 1110 0000
+	HASH_TABLE  = 0x00f0 // 0b 0000 0000 1111 0000
+	// special class (SPECIAL)
+	// - objects which have no printed representation in the
+	//   source code
+	UNSPECIFIED     = 0x0051
+	UNDEFINED       = 0x0052
+	MULTIPLE_VALUES = 0x0053
+	EOF_OBJECT      = 0x0054
+	// condition class
+	ERROR_OBJECT = 0x0061
+	FILE_ERROR   = 0x0062
+	READ_ERROR   = 0x0063
+	// procedure class
+	PRIMITIVE = 0x00a1
+	CLOSURE   = 0x00a2
+	// record class
+	RECORD_TYPE     = 0x00b1
+	RECORD_INSTANCE = 0x00b2
+	// port class
+	TEXTUAL_PORT = 0x00c1
+	BINARY_PORT  = 0x00c2
+	// regexp class
+	REGEXP_PATTERN = 0x0081
+	REGEXP_MATCH   = 0x0082
+	// list class
+	VECTOR = 0x0091
 	// number class (NumClass)
 	// - 0b 0000 0000 0111 0000 - (not used)
-	// - 0b 0000 0000 0111 0xxx - represents with go primitive types
+	// - 0b 0000 0000 0111 0xxx - represents with go primitive types, or
+	//   with math/big for rationals
 	// - 0b 0000 0000 0111 1000 - (not used)
 	// - 0b 0000 0000 0111 1xxx - arbitrary-precision integer
-	INT     = 0x0071
-	FLOAT   = 0x0072
-	COMPLEX = 0x0073
-	BIGINT  = 0x0079 // resereved for future
+	INT      = 0x0071
+	FLOAT    = 0x0072
+	COMPLEX  = 0x0073
+	RATIONAL = 0x0074 // exact non-integral rational number
+	BIGINT   = 0x0079 // resereved for future
 )
 
 func bitsNil() Class {
@@ -56,14 +91,54 @@ func bitsSymbol() Class {
 	return Class(SYMBOL >> 4)
 }
 
+func bitsCharacter() Class {
+	return Class(CHARACTER >> 4)
+}
+
+func bitsSpecial() Class {
+	return Class(SPECIAL >> 4)
+}
+
+func bitsCondition() Class {
+	return Class(CONDITION >> 4)
+}
+
 func bitsNumber() Class {
 	return Class(NUMBER >> 4)
 }
 
+func bitsRegexp() Class {
+	return Class(REGEXP >> 4)
+}
+
 func bitsList() Class {
 	return Class(LIST >> 4)
 }
 
+func bitsProcedure() Class {
+	return Class(PROCEDURE >> 4)
+}
+
+func bitsRecord() Class {
+	return Class(RECORD >> 4)
+}
+
+func bitsPort() Class {
+	return Class(PORT >> 4)
+}
+
+func bitsBytevector() Class {
+	return Class(BYTEVECTOR >> 4)
+}
+
+func bitsEnvironment() Class {
+	return Class(ENVIRONMENT >> 4)
+}
+
+func bitsHashTable() Class {
+	return Class(HASH_TABLE >> 4)
+}
+
 func bitsInt() SubClass {
 	return SubClass(INT & subClassMask)
 }
@@ -110,8 +185,58 @@ func (tag Tag) String() string {
 		name = "symbol"
 	case CHARACTER:
 		name = "character"
+	case SPECIAL:
+		name = "special"
+	case UNSPECIFIED:
+		name = "special(unspecified)"
+	case UNDEFINED:
+		name = "special(undefined)"
+	case MULTIPLE_VALUES:
+		name = "special(values)"
+	case EOF_OBJECT:
+		name = "special(eof)"
+	case CONDITION:
+		name = "condition"
+	case ERROR_OBJECT:
+		name = "error"
+	case FILE_ERROR:
+		name = "file-error"
+	case READ_ERROR:
+		name = "read-error"
+	case REGEXP:
+		name = "regexp"
+	case REGEXP_PATTERN:
+		name = "regexp(pattern)"
+	case REGEXP_MATCH:
+		name = "regexp(match)"
 	case LIST:
 		name = "list"
+	case VECTOR:
+		name = "list(vector)"
+	case PROCEDURE:
+		name = "procedure"
+	case PRIMITIVE:
+		name = "procedure(primitive)"
+	case CLOSURE:
+		name = "procedure(closure)"
+	case RECORD:
+		name = "record"
+	case RECORD_TYPE:
+		name = "record(type)"
+	case RECORD_INSTANCE:
+		name = "record(instance)"
+	case PORT:
+		name = "port"
+	case TEXTUAL_PORT:
+		name = "port(textual)"
+	case BINARY_PORT:
+		name = "port(binary)"
+	case BYTEVECTOR:
+		name = "bytevector"
+	case ENVIRONMENT:
+		name = "environment"
+	case HASH_TABLE:
+		name = "hash-table"
 	case NUMBER:
 		name = "number"
 	case INT:
@@ -120,6 +245,8 @@ func (tag Tag) String() string {
 		name = "number(float)"
 	case COMPLEX:
 		name = "number(complex)"
+	case RATIONAL:
+		name = "number(rational)"
 	case BIGINT:
 		name = "number(bigint)"
 	default:
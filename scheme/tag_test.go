@@ -17,11 +17,37 @@ func TestTagString(t *testing.T) {
 		{0x02, STRING, "string"},
 		{0x03, SYMBOL, "symbol"},
 		{0x04, CHARACTER, "character"},
+		{0x05, SPECIAL, "special"},
+		{0x51, UNSPECIFIED, "special(unspecified)"},
+		{0x52, UNDEFINED, "special(undefined)"},
+		{0x53, MULTIPLE_VALUES, "special(values)"},
+		{0x54, EOF_OBJECT, "special(eof)"},
+		{0x60, CONDITION, "condition"},
+		{0x61, ERROR_OBJECT, "error"},
+		{0x62, FILE_ERROR, "file-error"},
+		{0x63, READ_ERROR, "read-error"},
 		{0x70, NUMBER, "number"},
 		{0x71, INT, "number(int)"},
 		{0x72, FLOAT, "number(float)"},
 		{0x73, COMPLEX, "number(complex)"},
+		{0x74, RATIONAL, "number(rational)"},
+		{0x80, REGEXP, "regexp"},
+		{0x84, REGEXP_PATTERN, "regexp(pattern)"},
+		{0x85, REGEXP_MATCH, "regexp(match)"},
 		{0x81, LIST, "list"},
+		{0x91, VECTOR, "list(vector)"},
+		{0x82, PROCEDURE, "procedure"},
+		{0xa1, PRIMITIVE, "procedure(primitive)"},
+		{0xa2, CLOSURE, "procedure(closure)"},
+		{0xb0, RECORD, "record"},
+		{0xb1, RECORD_TYPE, "record(type)"},
+		{0xb2, RECORD_INSTANCE, "record(instance)"},
+		{0xc0, PORT, "port"},
+		{0xc1, TEXTUAL_PORT, "port(textual)"},
+		{0xc2, BINARY_PORT, "port(binary)"},
+		{0xd0, BYTEVECTOR, "bytevector"},
+		{0x83, ENVIRONMENT, "environment"},
+		{0xf0, HASH_TABLE, "hash-table"},
 		{0xff, 0xff, "illegal"}, // id = 255
 	}
 
@@ -0,0 +1,60 @@
+// gopische/scheme/values.go
+
+package scheme
+
+import (
+	"strings"
+)
+
+// Values object, which holds multiple values returned by `values`.
+// A single value is never wrapped by it.
+type Values struct {
+	values []Object
+}
+
+// NewValues returns multiple values.  It returns the value itself
+// when only one value is given.
+func NewValues(values ...Object) Object {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return &Values{values: values}
+}
+
+func (sobj *Values) Tag() Tag {
+	return Tag(SPECIAL)
+}
+
+func (sobj *Values) SubClass() SubClass {
+	return SubClass(MULTIPLE_VALUES & subClassMask)
+}
+
+func (sobj *Values) Value() any {
+	return sobj.values
+}
+
+func (sobj *Values) IsClass(bits Class) bool {
+	return bits == bitsSpecial()
+}
+
+func (sobj *Values) String() string {
+	strs := make([]string, len(sobj.values))
+	for i, v := range sobj.values {
+		strs[i] = v.String()
+	}
+	return strings.Join(strs, " ")
+}
+
+// Values returns the values held by the object.
+func (sobj *Values) Values() []Object {
+	return sobj.values
+}
+
+// ValuesToSlice returns values of an object returned by an expression.
+// An object which is not multiple values is a single value.
+func ValuesToSlice(obj Object) []Object {
+	if v, ok := obj.(*Values); ok {
+		return v.values
+	}
+	return []Object{obj}
+}
@@ -0,0 +1,40 @@
+// gopische/scheme/vector.go
+
+package scheme
+
+// Vector object, which holds a sequence of objects indexed by
+// integers.
+type Vector struct {
+	value []Object
+}
+
+// NewVector returns a vector holding elems, which is not copied.
+func NewVector(elems []Object) *Vector {
+	return &Vector{value: elems}
+}
+
+func (sobj *Vector) Tag() Tag {
+	return Tag(VECTOR)
+}
+
+func (sobj *Vector) SubClass() SubClass {
+	return SubClass(VECTOR & subClassMask)
+}
+
+func (sobj *Vector) Value() any {
+	return sobj.value
+}
+
+func (sobj *Vector) IsClass(bits Class) bool {
+	return bits == bitsList()
+}
+
+func (sobj *Vector) String() string {
+	return Write(sobj)
+}
+
+// Elements returns the elements held by the vector.  Modifying them
+// modifies the vector.
+func (sobj *Vector) Elements() []Object {
+	return sobj.value
+}
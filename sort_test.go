@@ -0,0 +1,90 @@
+// gopische/sort_test.go
+
+package gopische
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSRFI132(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(list-sort < '(3 1 4 1 5 9 2 6))", "(1 1 2 3 4 5 6 9)"},
+		{2, "(list-sort < '())", "()"},
+		{3, "(list-stable-sort (lambda (a b) (< (car a) (car b))) '((2 . a) (1 . b) (2 . c) (1 . d)))", "((1 . b) (1 . d) (2 . a) (2 . c))"},
+		{4, "(list-sort! string<? (list \"b\" \"c\" \"a\"))", "(\"a\" \"b\" \"c\")"},
+		{5, "(list (list-sorted? < '(1 2 2 3)) (list-sorted? < '(2 1)) (list-sorted? < '()))", "(#t #f #t)"},
+		{6, "(list-merge (lambda (a b) (< (car a) (car b))) '((1 . a) (3 . a)) '((1 . b) (2 . b)))", "((1 . a) (1 . b) (2 . b) (3 . a))"},
+		{7, "(list-merge! < '() '(1 2))", "(1 2)"},
+		{8, "(list-delete-neighbor-dups = '(1 1 2 3 3 3 1))", "(1 2 3 1)"},
+		{9, "(let ((l (list 3 1 2))) (list-sort > l) l)", "(3 1 2)"},
+		// continuations escaping from the comparator
+		{10, "(let ((l (list 3 1 2))) (list (call/cc (lambda (k) (list-sort (lambda (a b) (if (= a 2) (k 'escaped) (< a b))) l))) l))", "(escaped (3 1 2))"},
+		{11, "(let ((n 0)) (call/cc (lambda (k) (list-sort (lambda (a b) (set! n (+ n 1)) (if (> n 3) (k n) (< a b))) '(5 4 3 2 1)))))", "4"},
+		{12, "(guard (e (#t 'raised)) (list-sort (lambda (a b) (raise 'oops)) '(2 1)))", "raised"},
+		{13, "(length (list-sort < (let loop ((i 0) (acc '())) (if (= i 1000) acc (loop (+ i 1) (cons (modulo (* i 7919) 1009) acc))))))", "1000"},
+		// vectors
+		{14, "(vector-sort < #(3 1 4 1 5 9 2 6))", "#(1 1 2 3 4 5 6 9)"},
+		{15, "(vector-stable-sort (lambda (a b) (< (car a) (car b))) #((2 . a) (1 . b) (2 . c) (1 . d)) 1)", "#((1 . b) (1 . d) (2 . c))"},
+		{16, "(let ((v (vector 5 3 1 4 2))) (vector-sort! v < 1 4) v)", "#(5 1 3 4 2)"},
+		{17, "(let ((v (vector 2 1))) (vector-stable-sort! v >) v)", "#(2 1)"},
+		{18, "(list (vector-sorted? < #(1 2 2 3)) (vector-sorted? < #(2 1)) (vector-sorted? < #(3 1 2) 1))", "(#t #f #t)"},
+		{19, "(vector-merge < #(1 3 5) #(0 2 4 6) 1 3 0 2)", "#(0 2 3 5)"},
+		{20, "(let ((v (make-vector 5 0))) (vector-merge! < v #(1 3) #(2) 1) v)", "#(0 1 2 3 0)"},
+		{21, "(vector-delete-neighbor-dups = #(1 1 2 3 3 3 1))", "#(1 2 3 1)"},
+		{22, "(let* ((v (vector 0 1 1 2 2 3)) (end (vector-delete-neighbor-dups! = v 1))) (list end v))", "(4 #(0 1 2 3 2 3))"},
+		{23, "(list (vector-find-median < #(5 1 3) #f) (vector-find-median < #(4 1 3 2) #f) (vector-find-median < #() 'none))", "(3 5/2 none)"},
+		{24, "(vector-find-median < #(4 1 3 2) #f list)", "(2 3)"},
+		{25, "(let ((v (vector 3 1 2))) (vector-find-median! < v #f) v)", "#(1 2 3)"},
+		{26, "(list (vector-select! < (vector 5 1 4 2 3) 0) (vector-select! < (vector 5 1 4 2 3) 3) (vector-select! < (vector 9 5 1 4) 1 1))", "(1 4 4)"},
+		{27, "(let ((v (vector 5 1 4 2 3))) (vector-separate! < v 2) (list-sort < (list (vector-ref v 0) (vector-ref v 1))))", "(1 2)"},
+		{28, "(let ((v (vector 3 1 2))) (list (call/cc (lambda (k) (vector-sort! v (lambda (a b) (if (= a 2) (k 'escaped) (< a b)))))) v))", "(escaped #(3 1 2))"},
+		// libraries
+		{40, "(import (only (srfi 132) list-sort)) (list-sort > '(1 3 2))", "(3 2 1)"},
+		{41, "(import (only (srfi 132) vector-sort)) (vector-sort > #(1 3 2))", "#(3 2 1)"},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - engine %d: fail to evaluate %s: %s", tc.id, engine, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - engine %d: wrong value, expected=%s, got=%s", tc.id, engine, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestSRFI132Error(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(list-sort < '(1 . 2))"},
+		{2, "(list-sort 1 '(2 1))"},
+		{3, "(list-sort < '(1 a))"},
+		{4, "(list-merge < '(1) 2)"},
+		{5, "(vector-sort < '(2 1))"},
+		{6, "(vector-sort! < (vector 2 1))"},
+		{7, "(vector-select! < (vector 1 2) 2)"},
+		{8, "(vector-merge! < (vector 0) #(1) #(2))"},
+		{9, "(vector-sort < #(1 2) 2 1)"},
+		{10, "(define c (list 2 1)) (set-cdr! (cdr c) c) (list-sort < c)"},
+		{11, "(define c (list 1 2)) (set-cdr! (cdr c) c) (list-merge < '(0) c)"},
+		{12, "(define c (list 1 2)) (set-cdr! (cdr c) c) (list-sorted? < c)"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// gopische/srfi1_test.go
+
+package gopische
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSRFI1(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		// constructors
+		{1, "(xcons '(b c) 'a)", "(a b c)"},
+		{2, "(cons* 1 2 '(3 4))", "(1 2 3 4)"},
+		{3, "(cons* 1)", "1"},
+		{4, "(list-tabulate 4 (lambda (i) (* i i)))", "(0 1 4 9)"},
+		{5, "(iota 5)", "(0 1 2 3 4)"},
+		{6, "(iota 3 1 2)", "(1 3 5)"},
+		{7, "(iota 3 0 0.5)", "(0.0 0.5 1.0)"},
+		{8, "(take (circular-list 1 2) 5)", "(1 2 1 2 1)"},
+		// predicates
+		{10, "(map proper-list? (list '(1) '(1 . 2) (circular-list 1)))", "(#t #f #f)"},
+		{11, "(map circular-list? (list '(1) '(1 . 2) (circular-list 1)))", "(#f #f #t)"},
+		{12, "(map dotted-list? (list '(1) '(1 . 2) 3 (circular-list 1)))", "(#f #t #t #f)"},
+		{13, "(list (null-list? '()) (null-list? '(1)) (not-pair? 1))", "(#t #f #t)"},
+		{14, "(list (list= eq?) (list= = '(1 2) '(1 2) '(1 2)) (list= = '(1 2) '(1)))", "(#t #t #f)"},
+		// selectors
+		{20, "(list (first '(1 2 3)) (third '(1 2 3)) (caddr '(1 2 3)) (cdddr '(1 2 3 4)))", "(1 3 3 (4))"},
+		{21, "(call-with-values (lambda () (car+cdr '(1 . 2))) list)", "(1 2)"},
+		{22, "(list (take '(a b c d) 2) (drop '(a b c d) 2))", "((a b) (c d))"},
+		{23, "(list (take-right '(a b c . d) 2) (drop-right '(a b c d) 2))", "((b c . d) (a b))"},
+		{24, "(call-with-values (lambda () (split-at '(a b c d e) 2)) list)", "((a b) (c d e))"},
+		{25, "(list (last '(1 2 3)) (last-pair '(1 2 . 3)))", "(3 (2 . 3))"},
+		// miscellaneous
+		{30, "(list (length+ '(1 2)) (length+ (circular-list 1)))", "(2 #f)"},
+		{31, "(concatenate '((1) (2 3) () (4)))", "(1 2 3 4)"},
+		{32, "(append-reverse '(3 2 1) '(4 5))", "(1 2 3 4 5)"},
+		{33, "(zip '(1 2 3) '(a b))", "((1 a) (2 b))"},
+		{34, "(call-with-values (lambda () (unzip2 '((1 a) (2 b)))) list)", "((1 2) (a b))"},
+		{35, "(unzip1 '((1) (2)))", "(1 2)"},
+		{36, "(list (count even? '(1 2 3 4)) (count < '(1 5 2) '(2 3 4)))", "(2 2)"},
+		// fold, unfold and map
+		{40, "(fold cons '() '(a b c))", "(c b a)"},
+		{41, "(fold cons* '() '(a b c) '(1 2 3 4))", "(c 3 b 2 a 1)"},
+		{42, "(fold-right cons '() '(a b c))", "(a b c)"},
+		{43, "(fold-right cons* '() '(a b c) '(1 2))", "(a 1 b 2)"},
+		{44, "(pair-fold cons '() '(a b c))", "((c) (b c) (a b c))"},
+		{45, "(pair-fold-right cons '() '(a b c))", "((a b c) (b c) (c))"},
+		{46, "(list (reduce + 0 '(1 2 3)) (reduce + 0 '()) (reduce-right append '() '((1) (2) (3))))", "(6 0 (1 2 3))"},
+		{47, "(unfold (lambda (x) (> x 5)) (lambda (x) (* x x)) (lambda (x) (+ x 1)) 1)", "(1 4 9 16 25)"},
+		{48, "(unfold null-list? car cdr '(1 2 3) (lambda (x) 'end))", "(1 2 3 . end)"},
+		{49, "(unfold-right zero? (lambda (x) (* x x)) (lambda (x) (- x 1)) 5 '(0))", "(1 4 9 16 25 0)"},
+		{50, "(append-map (lambda (x) (list x (- x))) '(1 3))", "(1 -1 3 -3)"},
+		{51, "(filter-map (lambda (x) (and (number? x) (* x x))) '(a 1 b 3 c 7))", "(1 9 49)"},
+		{52, "(let ((acc '())) (pair-for-each (lambda (p) (set! acc (cons (length p) acc))) '(a b c)) acc)", "(1 2 3)"},
+		{53, "(let ((acc '())) (map-in-order (lambda (x) (set! acc (cons x acc)) x) '(1 2 3)) acc)", "(3 2 1)"},
+		// filtering and partitioning
+		{60, "(filter even? '(0 7 8 8 43 -4))", "(0 8 8 -4)"},
+		{61, "(remove even? '(0 7 8 8 43 -4))", "(7 43)"},
+		{62, "(call-with-values (lambda () (partition symbol? '(one 2 3 four five 6))) list)", "((one four five) (2 3 6))"},
+		// searching
+		{70, "(list (find even? '(3 1 4 1 5 9)) (find even? '(1 3)))", "(4 #f)"},
+		{71, "(find-tail even? '(3 1 37 -8 -5 0 0))", "(-8 -5 0 0)"},
+		{72, "(list (any integer? '(a 3 b 2.7)) (any < '(3 1 4 1 5) '(2 7 1 8 2)) (any (lambda (x) (memv x '(2 3))) '(1 3 4)))", "(#t #t (3))"},
+		{73, "(list (every integer? '()) (every integer? '(1 a)) (every (lambda (x) (+ x 1)) '(1 2)))", "(#t #f 3)"},
+		{74, "(list (list-index even? '(3 1 4 1 5 9)) (list-index < '(3 1 4 1 5 9 2 5 6) '(2 7 1 8 2)) (list-index = '(3 1 4 1 5 9 2 5 6) '(2 7 1 8 2)))", "(2 1 #f)"},
+		{75, "(list (take-while even? '(2 18 3 10 22 9)) (drop-while even? '(2 18 3 10 22 9)))", "((2 18) (3 10 22 9))"},
+		{76, "(call-with-values (lambda () (span even? '(2 18 3 10 22 9))) list)", "((2 18) (3 10 22 9))"},
+		{77, "(call-with-values (lambda () (break even? '(3 1 4 1 5 9 2 6))) list)", "((3 1) (4 1 5 9 2 6))"},
+		{78, "(take-while! even? '(1 2))", "()"},
+		// deletion
+		{80, "(delete 5 '(1 5 2 5 3))", "(1 2 3)"},
+		{81, "(delete 5 '(1 5 6 7 3) <)", "(1 5 3)"},
+		{82, "(delete-duplicates '(a b a c a b c z))", "(a b c z)"},
+		{83, "(delete-duplicates '((a . 3) (b . 7) (a . 9) (c . 1)) (lambda (x y) (eq? (car x) (car y))))", "((a . 3) (b . 7) (c . 1))"},
+		// association lists
+		{90, "(alist-cons 'a 1 '((b . 2)))", "((a . 1) (b . 2))"},
+		{91, "(let* ((a '((a . 1))) (b (alist-copy a))) (list (equal? a b) (eq? (car a) (car b))))", "(#t #f)"},
+		{92, "(alist-delete 'a '((a . 1) (b . 2) (a . 3)))", "((b . 2))"},
+		// sets as lists
+		{100, "(list (lset<= eq? '(a) '(a b a) '(a b c c)) (lset<= eq?) (lset<= eq? '(a z) '(a b)))", "(#t #t #f)"},
+		{101, "(list (lset= eq? '(b e a) '(a e b) '(e e b a)) (lset= eq? '(a) '(a b)))", "(#t #f)"},
+		{102, "(lset-adjoin eq? '(a b c d c e) 'a 'e 'i 'o 'u)", "(u o i a b c d c e)"},
+		{103, "(lset-union eq? '(a b c d e) '(a e i o u))", "(u o i a b c d e)"},
+		{104, "(list (lset-union eq? '(a a c) '(x a x)) (lset-union eq?) (lset-union eq? '(a b c)))", "((x a a c) () (a b c))"},
+		{105, "(lset-intersection eq? '(a b c d e) '(a e i o u))", "(a e)"},
+		{106, "(lset-difference eq? '(a b c d e) '(a e i o u))", "(b c d)"},
+		{107, "(lset-xor eq? '(a b c d e) '(a e i o u))", "(u o i b c d)"},
+		{108, "(list (lset-xor eq?) (lset-xor eq? '(a b)))", "(() (a b))"},
+		{109, "(call-with-values (lambda () (lset-diff+intersection eq? '(a b c d e) '(a e i o u))) list)", "((b c d) (a e))"},
+		// libraries
+		{120, "(import (only (srfi 1) fold)) (fold + 0 '(1 2 3))", "6"},
+		{121, "(define-library (sum) (import (scheme base) (prefix (srfi 1) s1:)) (export sum) (begin (define (sum l) (s1:reduce + 0 (s1:map car l))))) (import (sum)) (sum '((1) (2)))", "3"},
+		{122, "(cond-expand ((and srfi-1 (library (srfi 1))) 'yes) (else 'no))", "yes"},
+		// circular lists
+		{130, "(list (any even? (circular-list 1 2)) (find even? (circular-list 1 3 4)) (take (circular-list 1 2) 3))", "(#t 4 (1 2 1))"},
+		{131, "(list (map + '(1 2 3) (circular-list 10)) (list-index = '(1 3) (circular-list 2)))", "((11 12 13) #f)"},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - engine %d: fail to evaluate %s: %s", tc.id, engine, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - engine %d: wrong value, expected=%s, got=%s", tc.id, engine, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestSRFI1Error(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(take '(1 2) 3)"},
+		{2, "(drop-right '(1 2) 3)"},
+		{3, "(first '())"},
+		{4, "(fold + 0 '(1 . 2))"},
+		{5, "(filter even? 1)"},
+		{6, "(null-list? 1)"},
+		{7, "(iota -1)"},
+		{8, "(last '())"},
+		{9, "(alist-delete 'a '(1))"},
+		{10, "(any car '(1))"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
+
+// Procedures given circular lists which they cannot handle fail before
+// the deadline, without exhausting the memory.
+func TestSRFI1Circular(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, "(drop-right c 1)"},
+		{2, "(delete-duplicates c)"},
+		{3, "(lset-adjoin eq? c 3)"},
+		{4, "(filter odd? c)"},
+		{5, "(last c)"},
+		{6, "(last-pair c)"},
+		{7, "(take-right c 1)"},
+		{8, "(list-index even? c)"},
+		{9, "(take-while odd? c)"},
+		{10, "(pair-for-each car c)"},
+		{11, "(map + c c)"},
+		{12, "(iota 100000000000)"},
+		{13, "(list-tabulate 100000000000 values)"},
+		{14, "(take c 100000000000)"},
+	}
+
+	for _, tc := range tests {
+		interp := New(WithLimits(Limits{MaxCells: 1000, MaxSteps: 1000000}))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := interp.Eval(ctx, "(import (srfi 1)) (define c (circular-list 1 3)) "+tc.testcase)
+		cancel()
+		if err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("tests[%d] - not stopped before the deadline: %s", tc.id, tc.testcase)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// gopische/text_test.go
+
+package gopische
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStringLibrary(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		// searching
+		{1, `(list (string-index "héllo wörld" #\ö) (string-index "abc" #\z))`, "(7 #f)"},
+		{2, `(list (string-index "ab1c2" (lambda (c) (<= 48 (char->integer c) 57))) (string-index "ab1c2" (lambda (c) (<= 48 (char->integer c) 57)) 3) (string-index "ab1c2" (lambda (c) (<= 48 (char->integer c) 57)) 3 4))`, "(2 4 #f)"},
+		{3, `(list (string-search-forward "lo" "日本語 hello" 0) (string-search-forward "x" "hello" 0) (string-search-forward "l" "hello" 3))`, "(7 #f 3)"},
+		{4, `(list (string-contains "日本語テキスト" "テキ") (string-contains "abcabc" "bc" 2) (string-contains "abcabc" "bc" 2 4))`, "(3 4 #f)"},
+		{5, `(list (string-prefix? "日本" "日本語") (string-prefix? "語" "日本語") (string-suffix? "語" "日本語") (string-suffix? "" "a"))`, "(#t #f #t #t)"},
+		// joining and splitting
+		{10, `(list (string-join '("a" "b" "c")) (string-join '("a" "b") ", ") (string-join '() "-"))`, `("a b c" "a, b" "")`},
+		{11, `(list (string-join '("a" "b") "/" 'prefix) (string-join '("a" "b") ";" 'suffix))`, `("/a/b" "a;b;")`},
+		{12, `(list (string-split "a,b,,c" ",") (string-split "" ",") (string-split "a b" #\space))`, `(("a" "b" "" "c") () ("a" "b"))`},
+		{13, `(list (string-split "/usr/bin" "/" 'prefix) (string-split "a;b;" ";" 'suffix) (string-split "a:b:c" ":" 'infix 1))`, `(("usr" "bin") ("a" "b") ("a" "b:c"))`},
+		{14, `(string-split "日本語" "")`, `("日" "本" "語")`},
+		{15, `(list (string-tokenize "  hello   wörld ") (string-tokenize "a1b22c" (lambda (c) (not ((lambda (c) (<= 48 (char->integer c) 57)) c)))) (string-tokenize ""))`, `(("hello" "wörld") ("a" "b" "c") ())`},
+		// trimming and padding
+		{20, `(list (string-trim "  ab c  ") (string-trim-left "  ab  ") (string-trim-right "  ab  "))`, `("ab c" "ab  " "  ab")`},
+		{21, `(list (string-trim "xxaxx" #\x) (string-trim "12ab34" (lambda (c) (<= 48 (char->integer c) 57))) (string-trim "   "))`, `("a" "ab" "")`},
+		{22, `(list (string-pad "42" 5) (string-pad "12345" 3) (string-pad "7" 3 #\0) (string-pad "日本" 3))`, `("   42" "345" "007" " 日本")`},
+		{23, `(list (string-pad-right "ab" 4) (string-pad-right "abcde" 2) (string-pad-right "日本語" 2))`, `("ab  " "ab" "日本")`},
+		// folding
+		{30, `(string-fold cons '() "日本")`, `(#\本 #\日)`},
+		{31, `(string-fold (lambda (c n) (if (eqv? c #\a) (+ n 1) n)) 0 "banana" 2)`, "2"},
+		// libraries
+		{40, `(import (only (gopische string) string-join)) (string-join '("x" "y") "+")`, `"x+y"`},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - engine %d: fail to evaluate %s: %s", tc.id, engine, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - engine %d: wrong value, expected=%s, got=%s", tc.id, engine, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestStringLibraryError(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+	}{
+		{1, `(string-index "abc" 1)`},
+		{2, `(string-index "abc" #\a 4)`},
+		{3, `(string-join '("a" 1))`},
+		{4, `(string-join '() "," 'strict-infix)`},
+		{5, `(string-split "a" "," 'unknown)`},
+		{6, `(string-pad "a" -1)`},
+		{7, `(string-trim 'a)`},
+		{8, `(string-fold cons '() "abc" 2 1)`},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		if _, err := interp.Eval(context.Background(), tc.testcase); err == nil {
+			t.Fatalf("tests[%d] - no error for %s", tc.id, tc.testcase)
+		}
+	}
+}
@@ -11,21 +11,34 @@ import (
 type TokenType string
 
 const (
-	LPAREN     = "LPAREN"
-	RPAREN     = "RPAREN"
-	QUOTE      = "QUOTE"
-	EMPTY_LIST = "EMPTY_LIST"
-	BOOLEAN    = "BOOLEAN"
-	NUMBER     = "NUMBER"
-	STRING     = "STRING"
-	SYMBOL     = "SYMBOL"
-	ILLEGAL    = "ILLEGAL"
+	LPAREN           = "LPAREN"
+	RPAREN           = "RPAREN"
+	QUOTE            = "QUOTE"
+	QUASIQUOTE       = "QUASIQUOTE"
+	UNQUOTE          = "UNQUOTE"
+	UNQUOTE_SPLICING = "UNQUOTE_SPLICING"
+	DOT              = "DOT"
+	EMPTY_LIST       = "EMPTY_LIST"
+	BOOLEAN          = "BOOLEAN"
+	CHARACTER        = "CHARACTER"
+	BYTEVECTOR       = "BYTEVECTOR"    // "#u8" followed by a list of bytes
+	VECTOR           = "VECTOR"        // "#" followed by a list
+	LABEL            = "LABEL"         // "#n=" followed by the labeled datum
+	LABEL_REF        = "LABEL_REF"     // "#n#" referring to a labeled datum
+	DATUM_COMMENT    = "DATUM_COMMENT" // "#;" followed by a datum to skip
+	NUMBER           = "NUMBER"
+	STRING           = "STRING"
+	SYMBOL           = "SYMBOL"
+	ILLEGAL          = "ILLEGAL"
 )
 
 type Token struct {
 	TokenType TokenType
 	Literal   string
 	Value     scheme.Object
+	Line      int    // line number in the input, starting from 1
+	Column    int    // column number in the line in runes, starting from 1
+	Trivia    string // whitespaces and comments before the token, if kept
 }
 
 func NewIllegalToken(lit string) *Token {
@@ -0,0 +1,518 @@
+package gopische
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mnbi/gopische/scheme"
+)
+
+// Engine selects how an interpreter evaluates expressions.
+type Engine int
+
+const (
+	// VM compiles expressions into bytecode, and runs it on a
+	// virtual machine.  It is the default.
+	VM Engine = iota
+	// TreeWalker evaluates expanded expressions directly.  Its
+	// continuations can only escape.
+	TreeWalker
+)
+
+// WithEngine sets the engine which evaluates expressions.
+func WithEngine(engine Engine) Option {
+	return func(interp *Interpreter) {
+		interp.engine = engine
+	}
+}
+
+// frame holds variables bound by a lambda expression at run time.
+type frame struct {
+	vars  []scheme.Object
+	names []string // for debuggers
+	outer *frame
+}
+
+// vmClosure is the body of a procedure created by compiled code.
+type vmClosure struct {
+	code   *code
+	env    *frame
+	global *environment
+}
+
+type frameKind uint8
+
+const (
+	returnFrame frameKind = iota // resumes the caller
+	valuesFrame                  // passes values to the consumer of call-with-values
+	windFrame                    // leaves the extent of dynamic-wind
+)
+
+// vmFrame is a continuation frame pushed by a non-tail call.
+type vmFrame struct {
+	kind   frameKind
+	code   *code
+	pc     int
+	env    *frame
+	global *environment
+	proc   scheme.Object
+	wind   *winder
+}
+
+// vmRun is an activation of the VM loop.  A primitive which calls a
+// procedure starts a nested run on the same stacks.
+type vmRun struct {
+	parent  *vmRun
+	base    int // the bottom of the operand stack
+	fbase   int // the bottom of the frame stack
+	active  bool
+	winders *winder
+
+	// the registers of the outer run
+	code   *code
+	pc     int
+	env    *frame
+	global *environment
+}
+
+// vm is the state of the virtual machine of an evaluation.
+type vm struct {
+	m      *machine
+	stack  []scheme.Object
+	frames []vmFrame
+	run    *vmRun
+
+	// registers
+	code   *code
+	pc     int
+	env    *frame
+	global *environment
+}
+
+// evaluate evaluates an expanded expression by the engine of the
+// interpreter.
+func (m *machine) evaluate(expr scheme.Object, env *environment) (scheme.Object, error) {
+	saved := m.toplevel
+	m.toplevel = env
+	defer func() { m.toplevel = saved }()
+
+	if m.interp.engine == TreeWalker {
+		return m.eval(expr, env)
+	}
+	c, err := compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return m.execute(c, env)
+}
+
+// execute runs compiled code on the VM.
+func (m *machine) execute(c *code, env *environment) (scheme.Object, error) {
+	saved := m.toplevel
+	m.toplevel = env
+	defer func() { m.toplevel = saved }()
+
+	return m.vm.execute(func() (bool, scheme.Object, error) {
+		vm := m.vm
+		vm.code, vm.pc, vm.env, vm.global = c, 0, nil, env
+		return false, nil, nil
+	})
+}
+
+// apply calls a procedure in a nested run.
+func (vm *vm) apply(proc *scheme.Procedure, args []scheme.Object) (scheme.Object, error) {
+	return vm.execute(func() (bool, scheme.Object, error) {
+		vm.stack = append(vm.stack, proc)
+		vm.stack = append(vm.stack, args...)
+		return vm.call(len(args), true)
+	})
+}
+
+// execute starts a run, which sets up the registers by start.  The
+// registers of the outer run are saved and restored.
+func (vm *vm) execute(start func() (bool, scheme.Object, error)) (value scheme.Object, err error) {
+	m := vm.m
+	if err := m.enter(); err != nil {
+		return nil, err
+	}
+	defer m.leave()
+
+	r := &vmRun{
+		parent: vm.run, base: len(vm.stack), fbase: len(vm.frames), active: true, winders: m.winders,
+		code: vm.code, pc: vm.pc, env: vm.env, global: vm.global,
+	}
+	vm.run = r
+	defer func() {
+		if err != nil {
+			m.depth -= len(vm.frames) - r.fbase
+			clear(vm.frames[r.fbase:])
+			vm.frames = vm.frames[:r.fbase]
+			vm.stack = vm.stack[:r.base]
+			// Remember where the error is raised, so that a guard
+			// can run the after thunks the run skips.
+			var invoked *continuationInvoked
+			if m.unwound == nil && !errors.As(err, &invoked) {
+				m.unwound = m.winders
+			}
+			m.winders = r.winders
+		}
+		r.active = false
+		vm.run = r.parent
+		vm.code, vm.pc, vm.env, vm.global = r.code, r.pc, r.env, r.global
+	}()
+
+	fin, value, err := start()
+	if fin, value, err = vm.resume(fin, value, err); fin || err != nil {
+		return value, err
+	}
+	return vm.loop()
+}
+
+// resume handles the result of a call or a return.  An error which
+// invokes a continuation of the run restores the state of it.
+func (vm *vm) resume(fin bool, value scheme.Object, err error) (bool, scheme.Object, error) {
+	for err != nil {
+		var invoked *continuationInvoked
+		if !errors.As(err, &invoked) || !vm.reachable(invoked.k) {
+			return false, nil, err
+		}
+		fin, value, err = vm.restore(invoked.k, invoked.value)
+	}
+	return fin, value, nil
+}
+
+// reachable reports whether a continuation can be resumed in the
+// current run.  A continuation of a finished top-level run is resumed
+// in the current top-level run, since nothing but the caller of the
+// evaluation waits for the both.
+func (vm *vm) reachable(k *continuation) bool {
+	if k.run == nil {
+		return false
+	}
+	if k.run == vm.run {
+		return true
+	}
+	return !k.run.active && k.run.parent == nil && vm.run.parent == nil
+}
+
+func (vm *vm) loop() (scheme.Object, error) {
+	m := vm.m
+	// For a debugger, the instruction run before the current one in
+	// the same code, and whether a procedure has returned to it
+	d := m.interp.debugger
+	prev, returned := -1, false
+	for {
+		if d != nil {
+			if prev < 0 {
+				prev = vm.pc - 1
+			}
+			if vm.pc == 0 || returned || vm.code.lines[vm.pc] != vm.code.lines[prev] {
+				d.line(vm, returned)
+			}
+			prev, returned = -1, false
+		}
+		ins := vm.code.instrs[vm.pc]
+		vm.pc++
+
+		var fin bool
+		var value scheme.Object
+		var err error
+
+		switch ins.op {
+		case opConst:
+			vm.stack = append(vm.stack, vm.code.consts[ins.a])
+		case opLocalRef:
+			f := vm.frameAt(ins.a)
+			_, i := splitAddress(ins.a)
+			value = f.vars[i]
+			if value == scheme.Undefined {
+				err = fmt.Errorf("variable used before its definition: %s", vm.code.consts[ins.b])
+				break
+			}
+			vm.stack = append(vm.stack, value)
+		case opLocalSet:
+			f := vm.frameAt(ins.a)
+			_, i := splitAddress(ins.a)
+			value = vm.pop()
+			f.vars[i] = value
+			nameProcedure(value, vm.code.consts[ins.b].(*scheme.Symbol).Name())
+			vm.stack = append(vm.stack, scheme.Unspecified)
+		case opGlobalRef:
+			sym := vm.code.consts[ins.a].(*scheme.Symbol)
+			if value, err = m.lookup(sym, vm.global); err == nil {
+				vm.stack = append(vm.stack, value)
+			}
+		case opGlobalSet:
+			name := vm.code.consts[ins.a].(*scheme.Symbol).Name()
+			value = vm.pop()
+			if !vm.global.set(name, value) {
+				err = fmt.Errorf("unbound variable: %s", name)
+				break
+			}
+			nameProcedure(value, name)
+			vm.stack = append(vm.stack, scheme.Unspecified)
+		case opGlobalDefine:
+			name := vm.code.consts[ins.a].(*scheme.Symbol).Name()
+			value = vm.pop()
+			nameProcedure(value, name)
+			vm.global.define(name, value)
+			vm.stack = append(vm.stack, scheme.Unspecified)
+		case opPop:
+			vm.stack = vm.stack[:len(vm.stack)-1]
+		case opJump:
+			prev = vm.pc - 1
+			vm.pc = int(ins.a)
+		case opJumpIfFalse:
+			if !scheme.IsTrue(vm.pop()) {
+				prev = vm.pc - 1
+				vm.pc = int(ins.a)
+			}
+		case opClosure:
+			child := vm.code.children[ins.a]
+			impl := &vmClosure{code: child, env: vm.env, global: vm.global}
+			vm.stack = append(vm.stack, scheme.NewClosure(child.arity(), child.loc, impl))
+		case opCall:
+			fin, value, err = vm.call(int(ins.a), false)
+		case opTailCall:
+			fin, value, err = vm.call(int(ins.a), true)
+			returned = vm.pc != 0
+		case opReturn:
+			fin, value, err = vm.ret(vm.pop())
+			returned = true
+		case opEnter:
+			n := int(ins.a)
+			top := len(vm.stack)
+			vars := make([]scheme.Object, n)
+			copy(vars, vm.stack[top-n:])
+			vm.stack = vm.stack[:top-n]
+			vm.env = &frame{vars: vars, names: vm.code.scopes[ins.b], outer: vm.env}
+		case opLeave:
+			vm.env = vm.env.outer
+		default:
+			err = fmt.Errorf("illegal instruction: %s", ins.op)
+		}
+
+		if err != nil {
+			if fin, value, err = vm.resume(fin, value, err); err != nil {
+				return nil, err
+			}
+		}
+		if fin {
+			return value, nil
+		}
+	}
+}
+
+func (vm *vm) pop() scheme.Object {
+	top := len(vm.stack) - 1
+	value := vm.stack[top]
+	vm.stack = vm.stack[:top]
+	return value
+}
+
+func (vm *vm) frameAt(address int32) *frame {
+	depth, _ := splitAddress(address)
+	f := vm.env
+	for ; depth > 0; depth-- {
+		f = f.outer
+	}
+	return f
+}
+
+func (vm *vm) pushFrame(f vmFrame) error {
+	if err := vm.m.enter(); err != nil {
+		return err
+	}
+	vm.frames = append(vm.frames, f)
+	return nil
+}
+
+// returnTo is the frame which resumes the current code.
+func (vm *vm) returnTo() vmFrame {
+	return vmFrame{kind: returnFrame, code: vm.code, pc: vm.pc, env: vm.env, global: vm.global}
+}
+
+// call applies the procedure below n arguments on the stack.  A call
+// in a tail position pushes no frame.  It returns true when the run
+// finishes with the value.
+func (vm *vm) call(n int, tail bool) (bool, scheme.Object, error) {
+	m := vm.m
+	for {
+		if err := m.step(); err != nil {
+			return false, nil, err
+		}
+		top := len(vm.stack)
+		fn := vm.stack[top-n-1]
+		args := vm.stack[top-n : top : top]
+		proc, ok := fn.(*scheme.Procedure)
+		if !ok {
+			return false, nil, fmt.Errorf("not applicable: %s", fn)
+		}
+		if !proc.Arity().Accepts(n) {
+			return false, nil, fmt.Errorf("%s: wrong number of arguments, %d", proc, n)
+		}
+
+		var value scheme.Object
+		var err error
+		switch impl := proc.Impl().(type) {
+		case *vmClosure:
+			c := impl.code
+			vars := make([]scheme.Object, c.nparams, c.nparams+1)
+			copy(vars, args)
+			if c.rest {
+				if err := m.allocCells(n - c.nparams); err != nil {
+					return false, nil, err
+				}
+				vars = append(vars, scheme.NewList(args[c.nparams:]...))
+			}
+			vm.stack = vm.stack[:top-n-1]
+			if !tail {
+				if err := vm.pushFrame(vm.returnTo()); err != nil {
+					return false, nil, err
+				}
+			}
+			vm.code, vm.pc, vm.env, vm.global = c, 0, &frame{vars: vars, names: c.params, outer: impl.env}, impl.global
+			return false, nil, nil
+		case *primitive:
+			switch impl.ctl {
+			case ctlApply:
+				last, ok := scheme.ListToSlice(args[n-1])
+				if !ok {
+					return false, nil, fmt.Errorf("%s: %s", proc.Name(), wrongType("list", args[n-1]))
+				}
+				spread := append(append([]scheme.Object{}, args[:n-1]...), last...)
+				vm.stack = append(vm.stack[:top-n-1], spread...)
+				n = len(spread) - 1
+				continue
+			case ctlCallCC:
+				f := args[0]
+				vm.stack = vm.stack[:top-n-1]
+				k := vm.capture(tail)
+				vm.stack = append(vm.stack, f, newContinuation(k))
+				n = 1
+				continue
+			case ctlCallWithValues:
+				producer, consumer := args[0], args[1]
+				vm.stack = vm.stack[:top-n-1]
+				if err := vm.pushContinuation(tail, vmFrame{kind: valuesFrame, proc: consumer}); err != nil {
+					return false, nil, err
+				}
+				vm.stack = append(vm.stack, producer)
+				n, tail = 0, true
+				continue
+			case ctlDynamicWind:
+				before, thunk, after := args[0], args[1], args[2]
+				vm.stack = vm.stack[:top-n-1]
+				if _, err := m.apply(before, nil); err != nil {
+					return false, nil, err
+				}
+				m.winders = newWinder(before, after, m.winders)
+				if err := vm.pushContinuation(tail, vmFrame{kind: windFrame, wind: m.winders}); err != nil {
+					return false, nil, err
+				}
+				vm.stack = append(vm.stack, thunk)
+				n, tail = 0, true
+				continue
+			}
+			// args points into the stack, which the primitive may
+			// reenter, and its value may keep args as they are.
+			value, err = m.callPrimitive(proc, impl, append([]scheme.Object(nil), args...))
+		case *continuation:
+			vm.stack = vm.stack[:top-n-1]
+			err = m.throw(impl, args)
+			var invoked *continuationInvoked
+			if errors.As(err, &invoked) && impl.run == vm.run {
+				return vm.restore(impl, invoked.value)
+			}
+			return false, nil, err
+		default:
+			value, err = m.apply(proc, append([]scheme.Object(nil), args...))
+		}
+
+		vm.stack = vm.stack[:top-n-1]
+		if err != nil {
+			return false, nil, err
+		}
+		if tail {
+			return vm.ret(value)
+		}
+		vm.stack = append(vm.stack, value)
+		return false, nil, nil
+	}
+}
+
+// pushContinuation pushes a frame which processes the value of a call
+// before returning it.
+func (vm *vm) pushContinuation(tail bool, f vmFrame) error {
+	if !tail {
+		if err := vm.pushFrame(vm.returnTo()); err != nil {
+			return err
+		}
+	}
+	return vm.pushFrame(f)
+}
+
+// ret returns a value to the innermost frame.  It returns true when
+// no frame of the run remains.
+func (vm *vm) ret(value scheme.Object) (bool, scheme.Object, error) {
+	m := vm.m
+	for {
+		top := len(vm.frames) - 1
+		if top < vm.run.fbase {
+			return true, value, nil
+		}
+		f := vm.frames[top]
+		vm.frames[top] = vmFrame{}
+		vm.frames = vm.frames[:top]
+		m.leave()
+
+		switch f.kind {
+		case returnFrame:
+			vm.code, vm.pc, vm.env, vm.global = f.code, f.pc, f.env, f.global
+			vm.stack = append(vm.stack, value)
+			return false, nil, nil
+		case valuesFrame:
+			values := scheme.ValuesToSlice(value)
+			vm.stack = append(vm.stack, f.proc)
+			vm.stack = append(vm.stack, values...)
+			return vm.call(len(values), true)
+		case windFrame:
+			m.winders = f.wind.parent
+			if _, err := m.apply(f.wind.after, nil); err != nil {
+				return false, nil, err
+			}
+		}
+	}
+}
+
+// capture creates a continuation of the current run.
+func (vm *vm) capture(tail bool) *continuation {
+	r := vm.run
+	return &continuation{
+		run:     r,
+		stack:   append([]scheme.Object(nil), vm.stack[r.base:]...),
+		frames:  append([]vmFrame(nil), vm.frames[r.fbase:]...),
+		code:    vm.code,
+		pc:      vm.pc,
+		env:     vm.env,
+		global:  vm.global,
+		ret:     tail,
+		winders: vm.m.winders,
+	}
+}
+
+// restore replaces the state of the current run with a continuation,
+// and passes a value to it.
+func (vm *vm) restore(k *continuation, value scheme.Object) (bool, scheme.Object, error) {
+	r := vm.run
+	vm.m.depth += len(k.frames) - (len(vm.frames) - r.fbase)
+	clear(vm.frames[r.fbase:])
+	vm.stack = append(vm.stack[:r.base], k.stack...)
+	vm.frames = append(vm.frames[:r.fbase], k.frames...)
+	vm.code, vm.pc, vm.env, vm.global = k.code, k.pc, k.env, k.global
+	if k.ret {
+		return vm.ret(value)
+	}
+	vm.stack = append(vm.stack, value)
+	return false, nil, nil
+}
@@ -0,0 +1,105 @@
+// gopische/vm_test.go
+
+package gopische
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEngines(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(define (fact n) (if (= n 0) 1 (* n (fact (- n 1))))) (fact 10)", "3628800"},
+		{2, "(define (make-counter) (let ((n 0)) (lambda () (set! n (+ n 1)) n))) (define c (make-counter)) (c) (c)", "2"},
+		{3, "(let loop ((i 0)) (if (< i 100000) (loop (+ i 1)) i))", "100000"},
+		{4, "(apply (lambda (a . b) b) 1 2 '(3))", "(2 3)"},
+		{5, "(+ 1 (call/cc (lambda (k) (+ 10 (k 2)))))", "3"},
+		{6, "(call-with-values (lambda () (values 1 2 3)) list)", "(1 2 3)"},
+		{7, "(call-with-values (lambda () 1) (lambda (x) (+ x 1)))", "2"},
+		{8, "(define r '()) (dynamic-wind (lambda () (set! r (cons 'in r))) (lambda () (set! r (cons 'body r))) (lambda () (set! r (cons 'out r)))) r", "(out body in)"},
+		{9, "(define r '()) (call/cc (lambda (k) (dynamic-wind (lambda () (set! r (cons 'in r))) (lambda () (k 1)) (lambda () (set! r (cons 'out r)))))) r", "(out in)"},
+		{10, "(map (lambda (x) (call/cc (lambda (k) (if (odd? x) (k 'odd) x)))) '(1 2 3))", "(odd 2 odd)"},
+		{11, "(define (f x) (define y (* x 2)) (+ x y)) (f 3)", "9"},
+		{12, "(eval '(+ 1 2) (interaction-environment))", "3"},
+		{13, `(let ((e (guard (x (#t x)) (error "m" 1 2)))) (list 7 8 9 10 11 (error-object-irritants e)))`, "(7 8 9 10 11 (1 2))"},
+		{14, `(guard (e (#t (list (error-object-message e) (error-object-irritants e)))) (error "boom" 1 2))`, `("boom" (1 2))`},
+	}
+
+	for _, engine := range []Engine{VM, TreeWalker} {
+		for _, tc := range tests {
+			interp := New(WithEngine(engine))
+			value, err := interp.Eval(context.Background(), tc.testcase)
+			if err != nil {
+				t.Fatalf("tests[%d] - engine %d: fail to evaluate %s: %s", tc.id, engine, tc.testcase, err)
+			}
+			if value.String() != tc.expected {
+				t.Fatalf("tests[%d] - engine %d: wrong value, expected=%s, got=%s", tc.id, engine, tc.expected, value)
+			}
+		}
+	}
+}
+
+func TestContinuationReentry(t *testing.T) {
+	tests := []struct {
+		id       int
+		testcase string
+		expected string
+	}{
+		{1, "(define (gen) (let ((k #f) (n 0)) (let ((r (+ 1 (call/cc (lambda (c) (set! k c) 1))))) (set! n (+ n 1)) (if (< n 3) (k n) r)))) (gen)", "3"},
+		{2, "(define r '()) (define k #f) (dynamic-wind (lambda () (set! r (cons 'in r))) (lambda () (call/cc (lambda (c) (set! k c)))) (lambda () (set! r (cons 'out r)))) (if (< (length r) 4) (k 0)) r", "(out in out in)"},
+		{3, "(define k #f) (define (g) (call/cc (lambda (c) (set! k c) 0))) (define n (+ 100 (g))) (if (< n 105) (k 5)) n", "105"},
+	}
+
+	for _, tc := range tests {
+		interp := New()
+		value, err := interp.Eval(context.Background(), tc.testcase)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to evaluate %s: %s", tc.id, tc.testcase, err)
+		}
+		if value.String() != tc.expected {
+			t.Fatalf("tests[%d] - wrong value, expected=%s, got=%s", tc.id, tc.expected, value)
+		}
+	}
+}
+
+func TestTreeWalkerEscapeOnly(t *testing.T) {
+	interp := New(WithEngine(TreeWalker))
+	src := "(define k #f) (call/cc (lambda (c) (set! k c))) (k 1)"
+	if _, err := interp.Eval(context.Background(), src); err == nil {
+		t.Fatalf("no error for a continuation invoked out of its extent")
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	interp := New()
+	if _, err := interp.Eval(context.Background(), "(define (f x) (g x 1))"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id       int
+		src      string
+		expected []string
+	}{
+		{1, "f", []string{"; f (params: 1)", "GREF    g", "LREF    0.0 x", "CONST   1", "TCALL   2"}},
+		{2, "(if a 1 2)", []string{"; toplevel", "JUMPF   4", "RETURN"}},
+		{3, "(lambda (a . b) b)", []string{"CLOSURE #0", "; toplevel/0 (params: 1, rest)", "LREF    0.1 b"}},
+	}
+
+	for _, tc := range tests {
+		listing, err := interp.Disassemble(tc.src)
+		if err != nil {
+			t.Fatalf("tests[%d] - fail to disassemble %s: %s", tc.id, tc.src, err)
+		}
+		for _, s := range tc.expected {
+			if !strings.Contains(listing, s) {
+				t.Fatalf("tests[%d] - %q not found in:\n%s", tc.id, s, listing)
+			}
+		}
+	}
+}